@@ -0,0 +1,30 @@
+-- Exams assembled by teachers from approved questions in question_bank.
+
+CREATE TABLE IF NOT EXISTS exams (
+    id               BIGSERIAL PRIMARY KEY,
+    course_id        BIGINT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    chapter_id       BIGINT REFERENCES chapters(id) ON DELETE SET NULL,
+    class_id         BIGINT REFERENCES classes(id) ON DELETE SET NULL,
+    title            TEXT NOT NULL,
+    description      TEXT NOT NULL DEFAULT '',
+    duration_minutes INT NOT NULL DEFAULT 0,
+    status           TEXT NOT NULL DEFAULT 'draft', -- draft | published
+    created_by       BIGINT NOT NULL REFERENCES users(id),
+    published_at     BIGINT,
+    timecreated      BIGINT NOT NULL,
+    timemodified     BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_exams_created_by ON exams(created_by);
+CREATE INDEX IF NOT EXISTS idx_exams_course ON exams(course_id);
+
+CREATE TABLE IF NOT EXISTS exam_questions (
+    id          BIGSERIAL PRIMARY KEY,
+    exam_id     BIGINT NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    question_id BIGINT NOT NULL REFERENCES questions(id),
+    position    INT NOT NULL,
+    points      DOUBLE PRECISION NOT NULL DEFAULT 1,
+    UNIQUE (exam_id, question_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_questions_exam ON exam_questions(exam_id, position);
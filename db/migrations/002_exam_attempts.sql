@@ -0,0 +1,29 @@
+-- Student attempts at published exams.
+
+CREATE TABLE IF NOT EXISTS exam_attempts (
+    id           BIGSERIAL PRIMARY KEY,
+    exam_id      BIGINT NOT NULL REFERENCES exams(id) ON DELETE CASCADE,
+    student_id   BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status       TEXT NOT NULL DEFAULT 'in_progress', -- in_progress | submitted | expired
+    started_at   BIGINT NOT NULL,
+    deadline_at  BIGINT, -- NULL when the exam has no duration
+    finished_at  BIGINT,
+    score        DOUBLE PRECISION,
+    max_score    DOUBLE PRECISION,
+    timecreated  BIGINT NOT NULL,
+    timemodified BIGINT NOT NULL,
+    UNIQUE (exam_id, student_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_exam_attempts_open ON exam_attempts(deadline_at) WHERE status = 'in_progress';
+
+CREATE TABLE IF NOT EXISTS attempt_answers (
+    id             BIGSERIAL PRIMARY KEY,
+    attempt_id     BIGINT NOT NULL REFERENCES exam_attempts(id) ON DELETE CASCADE,
+    question_id    BIGINT NOT NULL REFERENCES questions(id),
+    answer_id      BIGINT REFERENCES answers(id) ON DELETE SET NULL,
+    is_correct     BOOLEAN,
+    points_awarded DOUBLE PRECISION,
+    timemodified   BIGINT NOT NULL,
+    UNIQUE (attempt_id, question_id)
+);
@@ -0,0 +1,8 @@
+-- Per-attempt randomized question and option order.
+
+ALTER TABLE exams
+    ADD COLUMN IF NOT EXISTS shuffle_questions BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN IF NOT EXISTS shuffle_options   BOOLEAN NOT NULL DEFAULT TRUE;
+
+ALTER TABLE exam_attempts
+    ADD COLUMN IF NOT EXISTS shuffle_seed BIGINT NOT NULL DEFAULT 0;
@@ -0,0 +1,20 @@
+-- Question types beyond single-answer multiple choice.
+--
+-- answers rows are reused by every type:
+--   multiple_choice, true_false, multiple_response: one row per option
+--   short_answer: one row per accepted answer
+--   numeric: a single row holding the value, with an optional tolerance
+--   matching: one row per pair, option_text on the left, match_text on the right
+
+ALTER TABLE questions
+    ADD COLUMN IF NOT EXISTS type TEXT NOT NULL DEFAULT 'multiple_choice';
+    -- multiple_choice | true_false | multiple_response | short_answer | numeric | matching
+
+ALTER TABLE answers
+    ADD COLUMN IF NOT EXISTS tolerance  DOUBLE PRECISION NULL,
+    ADD COLUMN IF NOT EXISTS match_text TEXT NULL;
+
+-- Responses that do not fit in answer_id: selected option ids, typed text
+-- or matching pairs.
+ALTER TABLE attempt_answers
+    ADD COLUMN IF NOT EXISTS response JSONB NULL;
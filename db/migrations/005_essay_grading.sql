@@ -0,0 +1,45 @@
+-- Essay questions graded by hand against a rubric.
+--
+-- Essays have no answers rows. Their rubric is a list of criteria, each
+-- with score levels; a graded response scores one level per criterion and
+-- earns (sum of chosen level scores / sum of top level scores) * points.
+
+CREATE TABLE IF NOT EXISTS rubric_criteria (
+    id          BIGSERIAL PRIMARY KEY,
+    question_id BIGINT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    position    INT NOT NULL,
+    title       TEXT NOT NULL,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_rubric_criteria_question ON rubric_criteria(question_id);
+
+CREATE TABLE IF NOT EXISTS rubric_levels (
+    id           BIGSERIAL PRIMARY KEY,
+    criterion_id BIGINT NOT NULL REFERENCES rubric_criteria(id) ON DELETE CASCADE,
+    score        DOUBLE PRECISION NOT NULL,
+    label        TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_rubric_levels_criterion ON rubric_levels(criterion_id);
+
+-- Totals of attempts with ungraded essays stay NULL until the last essay
+-- is graded.
+ALTER TABLE exam_attempts
+    ADD COLUMN IF NOT EXISTS grading_status TEXT NOT NULL DEFAULT 'graded'; -- graded | pending
+
+ALTER TABLE attempt_answers
+    ADD COLUMN IF NOT EXISTS feedback  TEXT NULL,
+    ADD COLUMN IF NOT EXISTS graded_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS graded_at BIGINT NULL;
+
+CREATE TABLE IF NOT EXISTS attempt_rubric_scores (
+    attempt_id   BIGINT NOT NULL REFERENCES exam_attempts(id) ON DELETE CASCADE,
+    question_id  BIGINT NOT NULL REFERENCES questions(id),
+    criterion_id BIGINT NOT NULL REFERENCES rubric_criteria(id),
+    level_id     BIGINT NOT NULL REFERENCES rubric_levels(id),
+    score        DOUBLE PRECISION NOT NULL,
+    comment      TEXT NOT NULL DEFAULT '',
+    PRIMARY KEY (attempt_id, question_id, criterion_id)
+);
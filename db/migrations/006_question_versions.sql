@@ -0,0 +1,53 @@
+-- Immutable question revisions.
+--
+-- questions keeps the current revision's fields and its number in
+-- questions.version. Every edit writes a new question_versions row and a
+-- fresh set of answers and rubric rows tagged with the new version; rows
+-- of older versions are never changed or deleted, so attempts served an
+-- older version keep their answer ids.
+
+ALTER TABLE questions
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+ALTER TABLE answers
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE INDEX IF NOT EXISTS idx_answers_question_version ON answers(question_id, version);
+
+ALTER TABLE rubric_criteria
+    ADD COLUMN IF NOT EXISTS version INT NOT NULL DEFAULT 1;
+
+CREATE TABLE IF NOT EXISTS question_versions (
+    id             BIGSERIAL PRIMARY KEY,
+    question_id    BIGINT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    version        INT NOT NULL,
+    type           TEXT NOT NULL,
+    content        TEXT NOT NULL,
+    difficulty     TEXT NOT NULL,
+    taxonomy_level TEXT NOT NULL,
+    created_by     BIGINT REFERENCES users(id) ON DELETE SET NULL, -- who made this revision
+    note           TEXT NOT NULL DEFAULT '', -- e.g. "restored from version 2"
+    timecreated    BIGINT NOT NULL,
+    UNIQUE (question_id, version)
+);
+
+INSERT INTO question_versions
+    (question_id, version, type, content, difficulty, taxonomy_level, created_by, timecreated)
+SELECT id, version, type, content, difficulty, taxonomy_level, created_by, timemodified
+FROM questions
+ON CONFLICT (question_id, version) DO NOTHING;
+
+-- The version of every exam question an attempt was served.
+CREATE TABLE IF NOT EXISTS attempt_question_versions (
+    attempt_id  BIGINT NOT NULL REFERENCES exam_attempts(id) ON DELETE CASCADE,
+    question_id BIGINT NOT NULL REFERENCES questions(id),
+    version     INT NOT NULL,
+    PRIMARY KEY (attempt_id, question_id)
+);
+
+INSERT INTO attempt_question_versions (attempt_id, question_id, version)
+SELECT a.id, eq.question_id, q.version
+FROM exam_attempts a
+JOIN exam_questions eq ON eq.exam_id = a.exam_id
+JOIN questions q ON q.id = eq.question_id
+ON CONFLICT (attempt_id, question_id) DO NOTHING;
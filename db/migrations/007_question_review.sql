@@ -0,0 +1,41 @@
+-- Question review workflow.
+--
+-- questions.status moves through
+--   draft -> submitted -> in_review -> approved | rejected | changes_requested
+-- and changes_requested goes back to submitted once the author has edited
+-- the question. Every transition is kept in question_review_events with
+-- the reason the actor gave.
+
+ALTER TABLE questions
+    ADD COLUMN IF NOT EXISTS reviewer_id BIGINT NULL REFERENCES users(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_questions_reviewer ON questions(reviewer_id) WHERE reviewer_id IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS question_review_events (
+    id          BIGSERIAL PRIMARY KEY,
+    question_id BIGINT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    from_status TEXT NOT NULL,
+    to_status   TEXT NOT NULL, -- draft | submitted | in_review | approved | rejected | changes_requested
+    actor_id    BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    reviewer_id BIGINT NULL REFERENCES users(id) ON DELETE SET NULL, -- set on (re)assignment
+    reason      TEXT NOT NULL DEFAULT '',
+    timecreated BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_review_events_question ON question_review_events(question_id);
+
+-- Comments are threaded through parent_id and anchored either to the
+-- question as a whole or to one answer option of the version that was
+-- current when the thread was started.
+CREATE TABLE IF NOT EXISTS question_comments (
+    id          BIGSERIAL PRIMARY KEY,
+    question_id BIGINT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    parent_id   BIGINT NULL REFERENCES question_comments(id) ON DELETE CASCADE,
+    answer_id   BIGINT NULL REFERENCES answers(id) ON DELETE SET NULL,
+    version     INT NOT NULL,
+    author_id   BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    body        TEXT NOT NULL,
+    timecreated BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_comments_question ON question_comments(question_id);
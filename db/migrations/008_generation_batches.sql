@@ -0,0 +1,18 @@
+-- Every rag_generate call stores its questions as one generation batch so
+-- they can be reviewed together and the batch's acceptance rate tracked.
+
+CREATE TABLE IF NOT EXISTS generation_batches (
+    id            BIGSERIAL PRIMARY KEY,
+    material_id   BIGINT NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+    created_by    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    question_type TEXT NOT NULL,
+    instruction   TEXT NOT NULL DEFAULT '',
+    timecreated   BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_batches_creator ON generation_batches(created_by);
+
+ALTER TABLE questions
+    ADD COLUMN IF NOT EXISTS batch_id BIGINT NULL REFERENCES generation_batches(id) ON DELETE SET NULL;
+
+CREATE INDEX IF NOT EXISTS idx_questions_batch ON questions(batch_id) WHERE batch_id IS NOT NULL;
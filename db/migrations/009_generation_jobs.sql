@@ -0,0 +1,23 @@
+-- Question generation runs as persisted jobs picked up by the server's
+-- worker pool. A job that was running when the server stopped is queued
+-- again on start, up to max attempts.
+
+CREATE TABLE IF NOT EXISTS generation_jobs (
+    id            BIGSERIAL PRIMARY KEY,
+    created_by    BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    material_id   BIGINT NOT NULL REFERENCES materials(id) ON DELETE CASCADE,
+    question_type TEXT NOT NULL,
+    instruction   TEXT NOT NULL DEFAULT '',
+    status        TEXT NOT NULL DEFAULT 'queued', -- queued | running | succeeded | failed
+    attempts      INT NOT NULL DEFAULT 0,
+    error         TEXT NOT NULL DEFAULT '',
+    batch_id      BIGINT NULL REFERENCES generation_batches(id) ON DELETE SET NULL,
+    skipped       JSONB NOT NULL DEFAULT '[]', -- near-duplicates left out of the batch
+    started_at    BIGINT NULL,
+    finished_at   BIGINT NULL,
+    timecreated   BIGINT NOT NULL,
+    timemodified  BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_queued ON generation_jobs(id) WHERE status = 'queued';
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_creator ON generation_jobs(created_by);
@@ -0,0 +1,23 @@
+-- Durable material ingestion.
+--
+-- A background worker picks up pending materials, downloads the PDF from
+-- file_url and sends it to FastAPI /ingest_material. Failed attempts are
+-- retried with exponential backoff until the attempt limit, then the
+-- material is left failed with the last error until ingestion is
+-- triggered again.
+
+-- Materials uploaded before this migration were sent to FastAPI right
+-- away; they start out indexed (with an unknown chunk count) so they are
+-- not embedded a second time. New materials start pending.
+ALTER TABLE materials
+    ADD COLUMN IF NOT EXISTS ingest_status TEXT NOT NULL DEFAULT 'indexed', -- pending | processing | indexed | failed
+    ADD COLUMN IF NOT EXISTS ingest_chunks INT NULL,
+    ADD COLUMN IF NOT EXISTS ingest_error TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS ingest_attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS ingest_next_at BIGINT NULL, -- earliest time of the next attempt
+    ADD COLUMN IF NOT EXISTS ingest_updated_at BIGINT NULL;
+
+ALTER TABLE materials
+    ALTER COLUMN ingest_status SET DEFAULT 'pending';
+
+CREATE INDEX IF NOT EXISTS idx_materials_ingest_pending ON materials(ingest_next_at) WHERE ingest_status = 'pending';
@@ -0,0 +1,25 @@
+-- Keep the vector index in step with materials.
+--
+-- A material whose file_url changes is queued with ingest_action
+-- 'reindex', which replaces its vectors through FastAPI
+-- /reingest_material. A deleted material leaves a vector_purges row that
+-- the ingestion worker sends to FastAPI DELETE /materials/{id}/vectors,
+-- with the same retries as ingestion.
+
+ALTER TABLE materials
+    ADD COLUMN IF NOT EXISTS ingest_action TEXT NOT NULL DEFAULT 'index'; -- index | reindex
+
+CREATE TABLE IF NOT EXISTS vector_purges (
+    id           BIGSERIAL PRIMARY KEY,
+    material_id  BIGINT NOT NULL, -- the material row is already gone
+    requested_by BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    status       TEXT NOT NULL DEFAULT 'pending', -- pending | processing | done | failed
+    attempts     INT NOT NULL DEFAULT 0,
+    deleted      INT NULL, -- vectors removed, as reported by FastAPI
+    error        TEXT NOT NULL DEFAULT '',
+    next_at      BIGINT NULL,
+    timecreated  BIGINT NOT NULL,
+    timemodified BIGINT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_vector_purges_pending ON vector_purges(next_at) WHERE status = 'pending';
@@ -0,0 +1,5 @@
+-- Generated questions are validated one by one; the job keeps a report
+-- of what happened to each item (see models.GenerationItem).
+
+ALTER TABLE generation_jobs
+    ADD COLUMN IF NOT EXISTS report JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,14 @@
+-- The passages of the material a generated question was written from, so
+-- a reviewer can check it against them. Filled from the chunks FastAPI
+-- retrieved; chunk_id is the Pinecone vector id.
+
+CREATE TABLE IF NOT EXISTS question_sources (
+    id          BIGSERIAL PRIMARY KEY,
+    question_id BIGINT NOT NULL REFERENCES questions(id) ON DELETE CASCADE,
+    position    INT NOT NULL,
+    chunk_id    TEXT NOT NULL DEFAULT '',
+    page        INT NULL,
+    text        TEXT NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idx_question_sources_question ON question_sources(question_id);
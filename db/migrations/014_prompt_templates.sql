@@ -0,0 +1,52 @@
+-- Prompt templates and generation presets managed by admins.
+--
+-- Editing a template's body adds a version; older versions stay for the
+-- jobs that used them. A preset bundles a template with the taxonomy
+-- levels, option count and difficulty to ask for, and counts its own
+-- edits in version. A generation job pins what it was created with, so a
+-- later edit does not change a queued or finished job.
+
+CREATE TABLE IF NOT EXISTS prompt_templates (
+    id           BIGSERIAL PRIMARY KEY,
+    name         TEXT NOT NULL,
+    description  TEXT NOT NULL DEFAULT '',
+    version      INT NOT NULL DEFAULT 1,
+    created_by   BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    timecreated  BIGINT NOT NULL,
+    timemodified BIGINT NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS prompt_template_versions (
+    id          BIGSERIAL PRIMARY KEY,
+    template_id BIGINT NOT NULL REFERENCES prompt_templates(id) ON DELETE CASCADE,
+    version     INT NOT NULL,
+    body        TEXT NOT NULL,
+    note        TEXT NOT NULL DEFAULT '',
+    created_by  BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    timecreated BIGINT NOT NULL,
+    UNIQUE (template_id, version)
+);
+
+CREATE TABLE IF NOT EXISTS generation_presets (
+    id              BIGSERIAL PRIMARY KEY,
+    name            TEXT NOT NULL,
+    description     TEXT NOT NULL DEFAULT '',
+    template_id     BIGINT NULL REFERENCES prompt_templates(id) ON DELETE SET NULL,
+    taxonomy_levels TEXT[] NOT NULL DEFAULT '{}', -- empty: the prompt's default
+    option_count    INT NULL,
+    difficulty      TEXT NOT NULL DEFAULT '', -- '' | easy | medium | hard
+    version         INT NOT NULL DEFAULT 1,
+    created_by      BIGINT NULL REFERENCES users(id) ON DELETE SET NULL,
+    timecreated     BIGINT NOT NULL,
+    timemodified    BIGINT NOT NULL
+);
+
+ALTER TABLE generation_jobs
+    ADD COLUMN IF NOT EXISTS preset_id BIGINT NULL REFERENCES generation_presets(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS preset_version INT NULL,
+    ADD COLUMN IF NOT EXISTS template_id BIGINT NULL REFERENCES prompt_templates(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS template_version INT NULL,
+    ADD COLUMN IF NOT EXISTS prompt_template TEXT NOT NULL DEFAULT '', -- '': FastAPI's default
+    ADD COLUMN IF NOT EXISTS taxonomy_levels TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS option_count INT NULL,
+    ADD COLUMN IF NOT EXISTS difficulty TEXT NOT NULL DEFAULT '';
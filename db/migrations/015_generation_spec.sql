@@ -0,0 +1,14 @@
+-- Structured generation requests: the question count and its split per
+-- difficulty, the language, and the chapter, tags and materials the
+-- generation was scoped to. material_ids is the resolved material set;
+-- material_id stays its first member. summary compares what a finished
+-- job asked for with what it saved.
+
+ALTER TABLE generation_jobs
+    ADD COLUMN IF NOT EXISTS question_count INT NOT NULL DEFAULT 0, -- 0: taken from the instruction
+    ADD COLUMN IF NOT EXISTS difficulty_counts JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS language TEXT NOT NULL DEFAULT 'id', -- id | en
+    ADD COLUMN IF NOT EXISTS material_ids BIGINT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS chapter_id BIGINT NULL REFERENCES chapters(id) ON DELETE SET NULL,
+    ADD COLUMN IF NOT EXISTS tag_ids BIGINT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN IF NOT EXISTS summary JSONB NULL;
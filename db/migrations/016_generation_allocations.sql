@@ -0,0 +1,7 @@
+-- A job with a count over several materials is split into one share per
+-- material, pinned when the job is created. Each generated question is
+-- linked to the material of its share; the report items and the summary
+-- record the material.
+
+ALTER TABLE generation_jobs
+    ADD COLUMN IF NOT EXISTS allocations JSONB NOT NULL DEFAULT '[]';
@@ -0,0 +1,40 @@
+-- Token usage and estimated cost of question generation, summed per
+-- user, course and month, and the quotas that limit generation. There is
+-- no school entity in this schema, so quotas are set per role, with a
+-- per-user quota replacing the role's.
+
+ALTER TABLE generation_jobs
+    ADD COLUMN IF NOT EXISTS model TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS prompt_tokens BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS completion_tokens BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS cost_usd DOUBLE PRECISION NOT NULL DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS idx_generation_jobs_creator_time ON generation_jobs(created_by, timecreated);
+
+CREATE TABLE IF NOT EXISTS generation_usage (
+    user_id           BIGINT NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    course_id         BIGINT NOT NULL REFERENCES courses(id) ON DELETE CASCADE,
+    month             TEXT NOT NULL, -- YYYY-MM, server time
+    requests          INT NOT NULL DEFAULT 0,
+    questions         INT NOT NULL DEFAULT 0,
+    prompt_tokens     BIGINT NOT NULL DEFAULT 0,
+    completion_tokens BIGINT NOT NULL DEFAULT 0,
+    cost_usd          DOUBLE PRECISION NOT NULL DEFAULT 0,
+    timemodified      BIGINT NOT NULL,
+    PRIMARY KEY (user_id, course_id, month)
+);
+
+CREATE INDEX IF NOT EXISTS idx_generation_usage_month ON generation_usage(month);
+
+CREATE TABLE IF NOT EXISTS generation_quotas (
+    id                  BIGSERIAL PRIMARY KEY,
+    role_id             BIGINT NULL REFERENCES roles(id) ON DELETE CASCADE,
+    user_id             BIGINT NULL REFERENCES users(id) ON DELETE CASCADE,
+    requests_per_day    INT NULL, -- NULL: unlimited
+    questions_per_month INT NULL, -- NULL: unlimited
+    timemodified        BIGINT NOT NULL,
+    CHECK ((role_id IS NULL) <> (user_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_generation_quotas_role ON generation_quotas(role_id) WHERE role_id IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_generation_quotas_user ON generation_quotas(user_id) WHERE user_id IS NOT NULL;
@@ -1,6 +1,6 @@
 from langchain_text_splitters import RecursiveCharacterTextSplitter
 from langchain_core.documents import Document
-from pinecone_client import vectorstore
+from pinecone_client import vectorstore, index
 import tempfile
 import os
 from pypdf import PdfReader
@@ -12,35 +12,69 @@ async def ingest_pdf(file, material_id, course_id, chapter_id):
         tmp_path = tmp.name
 
     reader = PdfReader(tmp_path)
-    text = ""
-    for page in reader.pages:
-        text += page.extract_text() + "\n"
-
-    os.unlink(tmp_path)
 
     splitter = RecursiveCharacterTextSplitter(
         chunk_size=800,
         chunk_overlap=150
     )
 
-    chunks = splitter.split_text(text)
+    # split per halaman supaya setiap chunk tahu nomor halamannya
+    docs = []
+    ids = []
+    for page_no, page in enumerate(reader.pages, start=1):
+        for chunk in splitter.split_text(page.extract_text() or ""):
+            # id per chunk supaya vector satu materi bisa dihapus / diganti
+            chunk_id = f"{vector_prefix(material_id)}{len(docs)}"
+            docs.append(Document(
+                page_content=chunk,
+                metadata={
+                    "material_id": material_id,
+                    "course_id": course_id,
+                    "chapter_id": chapter_id,
+                    "source": file.filename,
+                    "page": page_no,
+                    "chunk_id": chunk_id
+                }
+            ))
+            ids.append(chunk_id)
 
-    docs = [
-        Document(
-            page_content=chunk,
-            metadata={
-                "material_id": material_id,
-                "course_id": course_id,
-                "chapter_id": chapter_id,
-                "source": file.filename
-            }
-        )
-        for chunk in chunks
-    ]
+    os.unlink(tmp_path)
 
-    vectorstore.add_documents(docs)
+    if docs:
+        vectorstore.add_documents(docs, ids=ids)
 
     return {
         "status": "ok",
         "chunks": len(docs)
     }
+
+
+def vector_prefix(material_id):
+    return f"material-{material_id}-"
+
+
+def delete_material_vectors(material_id):
+    """Hapus semua vector milik satu materi, mengembalikan jumlah yang dihapus."""
+    deleted = 0
+
+    # vector dengan id per chunk (lihat ingest_pdf)
+    for ids in index.list(prefix=vector_prefix(material_id)):
+        if ids:
+            index.delete(ids=ids)
+            deleted += len(ids)
+
+    # vector lama yang di-ingest sebelum ada id per chunk hanya bisa
+    # dihapus lewat filter metadata (tidak didukung index serverless)
+    try:
+        index.delete(filter={"material_id": material_id})
+    except Exception:
+        pass
+
+    return deleted
+
+
+async def reingest_pdf(file, material_id, course_id, chapter_id):
+    deleted = delete_material_vectors(material_id)
+    result = await ingest_pdf(file, material_id, course_id, chapter_id)
+    result["deleted"] = deleted
+    return result
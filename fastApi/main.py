@@ -4,8 +4,8 @@ import os
 from fastapi import FastAPI, HTTPException
 from pydantic import BaseModel
 from fastapi import UploadFile, File, Form
-from ingest import ingest_pdf
-from rag import generate_exam
+from ingest import ingest_pdf, reingest_pdf, delete_material_vectors
+from rag import generate_exam, attach_sources
 
 app = FastAPI()
 
@@ -14,21 +14,45 @@ BACKEND_URL = os.getenv("BACKEND_URL")
 class ExamRequest(BaseModel):
     material_id: int
     instruction: str
+    question_type: str = "multiple_choice"
+    # dari template / preset yang dipilih di Go backend
+    prompt_template: str | None = None
+    taxonomy_levels: list[str] | None = None
+    option_count: int | None = None
+    difficulty: str | None = None
+    # permintaan terstruktur, sudah divalidasi Go backend
+    count: int | None = None
+    difficulty_counts: dict[str, int] | None = None
+    language: str | None = None
+    material_ids: list[int] | None = None
 
 @app.post("/generate_exam")
 def generate(data: ExamRequest):
     try:
         # 1️⃣ Jalankan RAG (SEMUA logic di rag.py)
-        result = generate_exam(
+        result, docs, usage = generate_exam(
             material_id=data.material_id,
-            instruction=data.instruction
+            instruction=data.instruction,
+            question_type=data.question_type,
+            prompt_template=data.prompt_template,
+            taxonomy_levels=data.taxonomy_levels,
+            option_count=data.option_count,
+            difficulty=data.difficulty,
+            count=data.count,
+            difficulty_counts=data.difficulty_counts,
+            language=data.language,
+            material_ids=data.material_ids
         )
 
         # 2️⃣ Parse JSON dari LLM
         exam_json = json.loads(result)
 
+        # 3️⃣ Ganti label sumber dengan chunk (id, halaman, teks)
+        exam_json = attach_sources(exam_json, docs)
+
         return {
-            "rag_result": exam_json
+            "rag_result": exam_json,
+            "usage": usage
         }
 
     except ValueError as e:
@@ -53,4 +77,30 @@ async def ingest_material(
         course_id,
         chapter_id
     )
-    return result
\ No newline at end of file
+    return result
+
+@app.post("/reingest_material")
+async def reingest_material(
+    file: UploadFile = File(...),
+    material_id: int = Form(...),
+    course_id: int = Form(...),
+    chapter_id: int = Form(...)
+):
+    # ganti semua vector materi dengan hasil ingest file yang baru
+    return await reingest_pdf(
+        file,
+        material_id,
+        course_id,
+        chapter_id
+    )
+
+@app.delete("/materials/{material_id}/vectors")
+def delete_material(material_id: int):
+    try:
+        deleted = delete_material_vectors(material_id)
+    except Exception as e:
+        raise HTTPException(status_code=500, detail=str(e))
+    return {
+        "status": "ok",
+        "deleted": deleted
+    }
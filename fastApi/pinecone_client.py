@@ -9,6 +9,9 @@ import os
 pc = Pinecone(api_key=os.environ["PINECONE_API_KEY"])
 print("PINECONE:", os.getenv("PINECONE_API_KEY"))
 
+# index mentah, dipakai untuk menghapus vector per materi
+index = pc.Index(os.environ["PINECONE_INDEX"])
+
 # model embedding HARUS sama dengan saat indexing
 embeddings = OpenAIEmbeddings(model="text-embedding-3-small")
 
@@ -36,3 +39,15 @@ def invoke_by_material(material_id: int, query: str = ""):
         filter={"material_id": material_id}
     )
     return docs
+
+def invoke_by_materials(material_ids: list[int], query: str = ""):
+    # sama seperti invoke_by_material, tapi untuk sekumpulan materi;
+    # jumlah chunk ikut bertambah supaya setiap materi kebagian
+    if len(material_ids) == 1:
+        return invoke_by_material(material_ids[0], query)
+    docs = vectorstore.similarity_search(
+        query=query,
+        k=min(3 * len(material_ids), 18),
+        filter={"material_id": {"$in": material_ids}}
+    )
+    return docs
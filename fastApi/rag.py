@@ -1,11 +1,15 @@
-from pinecone_client import retriever
+import os
+import re
+from pinecone_client import invoke_by_materials
 from langchain_openai import ChatOpenAI
-from langchain_core.prompts import PromptTemplate
 
-EXAM_PROMPT_STRICT = PromptTemplate(
-    input_variables=["context", "instruction"],
-    template="""
-Anda adalah AI pembuat soal ujian PILIHAN GANDA.
+# Template prompt default. Template dari database (Go backend) memakai
+# placeholder yang sama: {context}, {instruction}, {material_id},
+# {question_type}, {type_rules}, {taxonomy_levels}, {option_count},
+# {difficulty}, {count}, {language}. Placeholder diganti apa adanya, jadi kurung kurawal contoh
+# JSON tidak perlu di-escape.
+DEFAULT_EXAM_PROMPT = """
+Anda adalah AI pembuat soal ujian.
 
 ⚠️ ATURAN KERAS:
 - GUNAKAN HANYA informasi dari KONTEKS
@@ -21,16 +25,18 @@ Anda adalah AI pembuat soal ujian PILIHAN GANDA.
 
 ### FORMAT OUTPUT (WAJIB JSON VALID)
 - HANYA kembalikan JSON
-- Output WAJIB berupa ARRAY/LIST dari object soal, contoh: `[ {{...}}, {{...}} ]`
-- Jika diminta 1 soal, tetap kembalikan dalam array `[ {{...}} ]`
+- Output WAJIB berupa ARRAY/LIST dari object soal, contoh: `[ {...}, {...} ]`
+- Jika diminta 1 soal, tetap kembalikan dalam array `[ {...} ]`
 - Gunakan format PERSIS seperti berikut:
 
 [
   {
     "material_id": {material_id},
+    "type": "{question_type}",
     "content": "Teks soal murni tanpa nomor...",
     "difficulty": "easy | medium | hard",
-    "taxonomy_level": "C5 | C6",
+    "taxonomy_level": "{taxonomy_levels}",
+    "sources": ["S1", "S3"],
     "answers": [
       { "label": "A", "text": "...", "is_correct": false },
       { "label": "B", "text": "...", "is_correct": true }
@@ -41,26 +47,113 @@ Anda adalah AI pembuat soal ujian PILIHAN GANDA.
 
 ⚠️ ATURAN TAMBAHAN:
 - content WAJIB MURNI TEKS SOAL. JANGAN pakai "Pertanyaan 1", "No. 1", dll.
-- Jumlah soal WAJIB SESUAI instruksi teacher (jika tidak disebut, buat 1).
+- Jumlah soal: {count}.
+- Bahasa soal dan jawaban: {language}.
 - Taxonomy Level & Difficulty:
   1. IKUTI instruksi teacher jika ada.
   2. JIKA TIDAK ADA instruksi, TENTUKAN SENDIRI berdasarkan analisis soal.
-  3. Taxonomy Level WAJIB HANYA "C5" atau "C6". JANGAN gunakan C1-C4.
-  4. Difficulty soal bebas, jika tidak ada instruksi, tentukan sendiri berdasarkan analisis soal: "easy", "medium", atau "hard".
+  3. Taxonomy Level WAJIB HANYA salah satu dari: {taxonomy_levels}.
+  4. Difficulty: {difficulty}.
+  5. Jumlah pilihan jawaban: {option_count}.
 
+- sources WAJIB berisi label potongan konteks ([S1], [S2], ...) yang menjadi dasar soal.
 - TIDAK BOLEH ada penjelasan / pembahasan
 - TIDAK BOLEH mengulang konteks
+
+### ATURAN JENIS SOAL
+{type_rules}
+"""
+
+DEFAULT_TAXONOMY = ["C5", "C6"]
+
+LANGUAGES = {
+    "id": "Bahasa Indonesia",
+    "en": "Bahasa Inggris (English)",
+}
+
+
+def render_prompt(template: str, values: dict) -> str:
+    # sekali jalan, supaya teks materi yang kebetulan berisi "{...}" tidak
+    # ikut diganti
+    return re.sub(
+        r"\{([a-z_]+)\}",
+        lambda m: str(values[m.group(1)]) if m.group(1) in values else m.group(0),
+        template,
+    )
+
+def render_difficulty(difficulty, difficulty_counts):
+    counts = {d: n for d, n in (difficulty_counts or {}).items() if n}
+    if counts:
+        return "WAJIB " + ", ".join(f'{n} soal "{d}"' for d, n in counts.items())
+    if difficulty:
+        return f'WAJIB "{difficulty}"'
+    return 'ikuti instruksi teacher, jika tidak ada tentukan sendiri: "easy", "medium", atau "hard"'
+
+TYPE_RULES = {
+    "multiple_choice": """- Jenis soal: PILIHAN GANDA
 - TEPAT SATU jawaban is_correct = true
 - Jumlah pilihan jawaban MENYESUAIKAN INSTRUKSI (default 4 jika tidak disebut)
-- Label berurutan A, B, C, D...
-"""
-)
+- Label berurutan A, B, C, D...""",
+    "true_false": """- Jenis soal: BENAR/SALAH, content berupa pernyataan
+- answers TEPAT DUA: { "label": "A", "text": "Benar" } dan { "label": "B", "text": "Salah" }
+- TEPAT SATU jawaban is_correct = true""",
+    "multiple_response": """- Jenis soal: PILIHAN GANDA KOMPLEKS (jawaban benar lebih dari satu)
+- MINIMAL DUA jawaban is_correct = true dan minimal satu is_correct = false
+- Jumlah pilihan jawaban MENYESUAIKAN INSTRUKSI (default 5 jika tidak disebut)
+- Label berurutan A, B, C, D...""",
+    "short_answer": """- Jenis soal: ISIAN SINGKAT (jawaban satu kata atau frasa pendek)
+- answers berisi SEMUA variasi jawaban yang diterima, semuanya is_correct = true""",
+    "numeric": """- Jenis soal: NUMERIK (jawaban berupa angka)
+- answers TEPAT SATU: { "label": "A", "text": "<angka>", "is_correct": true, "tolerance": <selisih yang masih diterima, 0 jika harus tepat> }""",
+    "matching": """- Jenis soal: MENJODOHKAN
+- Setiap answer adalah satu pasangan: "text" = pernyataan kiri, "match_text" = pasangan kanan yang benar, is_correct = true
+- Minimal 3 pasangan, pasangan kanan tidak boleh sama""",
+    "essay": """- Jenis soal: ESAI (jawaban uraian terbuka), cocok untuk C5/C6
+- answers WAJIB array kosong []
+- Tambahkan field "rubric": array kriteria penilaian, contoh:
+  "rubric": [
+    { "title": "Ketepatan konsep", "description": "...", "levels": [
+      { "score": 0, "label": "Kurang", "description": "..." },
+      { "score": 2, "label": "Cukup", "description": "..." },
+      { "score": 4, "label": "Baik", "description": "..." }
+    ] }
+  ]
+- Minimal 2 kriteria, setiap kriteria minimal 2 level dengan skor berbeda""",
+}
+
+LLM_MODEL = "gpt-4o-mini-2024-07-18"
 
 llm = ChatOpenAI(
-    model="gpt-4o-mini-2024-07-18",
+    model=LLM_MODEL,
     temperature=0.3
 )
 
+# harga USD per 1 juta token (input, output), untuk estimasi biaya;
+# bisa diganti lewat env LLM_PRICE_INPUT / LLM_PRICE_OUTPUT
+MODEL_PRICES = {
+    "gpt-4o-mini-2024-07-18": (0.15, 0.60),
+}
+
+
+def usage_of(response):
+    """
+    Jumlah token dan estimasi biaya satu panggilan LLM.
+    """
+    meta = getattr(response, "usage_metadata", None) or {}
+    prompt_tokens = int(meta.get("input_tokens", 0))
+    completion_tokens = int(meta.get("output_tokens", 0))
+
+    price_in, price_out = MODEL_PRICES.get(LLM_MODEL, (0.0, 0.0))
+    price_in = float(os.getenv("LLM_PRICE_INPUT", price_in))
+    price_out = float(os.getenv("LLM_PRICE_OUTPUT", price_out))
+
+    return {
+        "model": LLM_MODEL,
+        "prompt_tokens": prompt_tokens,
+        "completion_tokens": completion_tokens,
+        "cost_usd": (prompt_tokens * price_in + completion_tokens * price_out) / 1_000_000
+    }
+
 def validate_context(docs):
     if not docs:
         raise ValueError("Materi tidak ditemukan di Pinecone.")
@@ -69,17 +162,64 @@ def validate_context(docs):
     if len(text) < 300:
         raise ValueError("Konteks terlalu sedikit untuk generate soal.")
 
-    return text
+    # setiap potongan diberi label supaya LLM bisa menyebut sumbernya
+    return "\n\n".join(
+        f"[S{i}] (materi {doc.metadata.get('material_id', '?')}, "
+        f"halaman {doc.metadata.get('page', '?')})\n{doc.page_content}"
+        for i, doc in enumerate(docs, start=1)
+    )
+
+
+def source_of(doc):
+    page = doc.metadata.get("page")
+    material_id = doc.metadata.get("material_id")
+    return {
+        "material_id": int(material_id) if material_id is not None else None,
+        "chunk_id": doc.metadata.get("chunk_id") or doc.id or "",
+        "page": int(page) if page is not None else None,
+        "text": doc.page_content
+    }
 
 
-def generate_exam(material_id: int, instruction: str) -> dict:
+def attach_sources(items, docs):
     """
-    FULL RAG PIPELINE
+    Ganti label sumber dari LLM ("S1", ...) dengan chunk aslinya.
+    Soal tanpa label yang valid diberi semua chunk konteks.
+    """
+    for item in items:
+        picked = []
+        for label in item.get("sources") or []:
+            label = str(label).strip().strip("[]").upper().lstrip("S")
+            if label.isdigit() and 1 <= int(label) <= len(docs):
+                doc = docs[int(label) - 1]
+                if doc not in picked:
+                    picked.append(doc)
+        item["sources"] = [source_of(doc) for doc in (picked or docs)]
+    return items
+
+
+def generate_exam(
+    material_id: int,
+    instruction: str,
+    question_type: str = "multiple_choice",
+    prompt_template: str | None = None,
+    taxonomy_levels: list[str] | None = None,
+    option_count: int | None = None,
+    difficulty: str | None = None,
+    count: int | None = None,
+    difficulty_counts: dict[str, int] | None = None,
+    language: str | None = None,
+    material_ids: list[int] | None = None
+):
+    """
+    FULL RAG PIPELINE, mengembalikan output LLM, chunk konteksnya, dan
+    pemakaian token
     """
 
-    # 1️⃣ Ambil context dari Pinecone BERDASARKAN material_id
-    docs = retriever.invoke_by_material(
-        material_id=material_id,
+    # 1️⃣ Ambil context dari Pinecone BERDASARKAN material_id (atau
+    # sekumpulan materi dari bab / tag)
+    docs = invoke_by_materials(
+        material_ids=material_ids or [material_id],
         query=instruction
     )
 
@@ -87,13 +227,29 @@ def generate_exam(material_id: int, instruction: str) -> dict:
     context = validate_context(docs)
 
     # 3️⃣ Build prompt
-    prompt = EXAM_PROMPT_STRICT.format(
-        context=context,
-        instruction=instruction,
-        material_id=material_id
-    )
+    if question_type not in TYPE_RULES:
+        raise ValueError(f"Jenis soal tidak dikenal: {question_type}")
+
+    prompt = render_prompt(prompt_template or DEFAULT_EXAM_PROMPT, {
+        "context": context,
+        "instruction": instruction,
+        "material_id": material_id,
+        "question_type": question_type,
+        "type_rules": TYPE_RULES[question_type],
+        "taxonomy_levels": " | ".join(taxonomy_levels or DEFAULT_TAXONOMY),
+        "option_count": (
+            f"TEPAT {option_count} pilihan" if option_count
+            else "sesuai instruksi teacher atau aturan jenis soal"
+        ),
+        "difficulty": render_difficulty(difficulty, difficulty_counts),
+        "count": (
+            f"TEPAT {count} soal" if count
+            else "sesuai instruksi teacher (jika tidak disebut, buat 1)"
+        ),
+        "language": LANGUAGES.get(language or "id", LANGUAGES["id"]),
+    })
 
     # 4️⃣ Call LLM
     response = llm.invoke(prompt)
 
-    return response.content
+    return response.content, docs, usage_of(response)
@@ -5,34 +5,28 @@ import (
 	"net/http"
 	"strconv"
 
+	"backendLMS/middlewares"
 	"backendLMS/repositories"
 
 	"github.com/gorilla/mux"
 )
 
 func CreateAnswer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
 	questionID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		http.Error(w, "invalid id", 400)
 		return
 	}
 
-	var req struct {
-		Label     string `json:"label"`
-		Text      string `json:"text"`
-		IsCorrect bool   `json:"is_correct"`
-	}
-
+	var req answerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
 
-	err = repositories.CreateAnswer(r.Context(), questionID, repositories.AnswerInput{
-		Label:     req.Label,
-		Text:      req.Text,
-		IsCorrect: req.IsCorrect,
-	})
+	err = repositories.CreateAnswer(r.Context(), questionID, userID, roleID, req.input())
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -43,28 +37,21 @@ func CreateAnswer(w http.ResponseWriter, r *http.Request) {
 }
 
 func UpdateAnswer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
 	answerID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		http.Error(w, "invalid id", 400)
 		return
 	}
 
-	var req struct {
-		Label     string `json:"label"`
-		Text      string `json:"text"`
-		IsCorrect bool   `json:"is_correct"`
-	}
-
+	var req answerRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
 
-	err = repositories.UpdateAnswer(r.Context(), answerID, repositories.AnswerInput{
-		Label:     req.Label,
-		Text:      req.Text,
-		IsCorrect: req.IsCorrect,
-	})
+	err = repositories.UpdateAnswer(r.Context(), answerID, userID, roleID, req.input())
 
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
@@ -75,9 +62,11 @@ func UpdateAnswer(w http.ResponseWriter, r *http.Request) {
 }
 
 func DeleteAnswer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
 	answerID, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 
-	err := repositories.DeleteAnswer(r.Context(), answerID)
+	err := repositories.DeleteAnswer(r.Context(), answerID, userID, roleID)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
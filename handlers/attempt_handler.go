@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+type attemptAnswersRequest struct {
+	Answers []struct {
+		QuestionID int64           `json:"question_id"`
+		AnswerID   *int64          `json:"answer_id"`
+		AnswerIDs  []int64         `json:"answer_ids"`
+		Text       *string         `json:"text"`
+		Pairs      map[int64]int64 `json:"pairs"`
+	} `json:"answers"`
+}
+
+func (req attemptAnswersRequest) inputs() []repositories.AttemptAnswerInput {
+	var result []repositories.AttemptAnswerInput
+	for _, a := range req.Answers {
+		result = append(result, repositories.AttemptAnswerInput{
+			QuestionID: a.QuestionID,
+			AnswerID:   a.AnswerID,
+			AnswerIDs:  a.AnswerIDs,
+			Text:       a.Text,
+			Pairs:      a.Pairs,
+		})
+	}
+	return result
+}
+
+// buildAttemptQuestions lays out the exam items in the order and with the
+// option labels of this attempt, so the same attempt always looks the same.
+// The answer key is only included when reveal is set.
+func buildAttemptQuestions(
+	exam *models.Exam,
+	attempt *models.ExamAttempt,
+	items []models.ExamItem,
+	saved []models.AttemptAnswer,
+	reveal bool,
+) []models.AttemptQuestion {
+	responses := make(map[int64]models.AttemptAnswer)
+	for _, s := range saved {
+		responses[s.QuestionID] = s
+	}
+
+	result := services.LayoutItems(items, attempt.ShuffleSeed, exam.ShuffleQuestions, exam.ShuffleOptions, reveal)
+	for i := range result {
+		q := &result[i]
+		if resp, ok := responses[q.QuestionID]; ok {
+			q.SelectedAnswerID = resp.AnswerID
+			q.SelectedAnswerIDs = resp.AnswerIDs
+			q.ResponseText = resp.Text
+			q.Pairs = resp.Pairs
+			q.IsCorrect = resp.IsCorrect
+			q.PointsAwarded = resp.PointsAwarded
+			q.Feedback = resp.Feedback
+			q.CriterionScores = resp.CriterionScores
+		}
+	}
+	return result
+}
+
+// loadAttemptView loads what is needed to lay out an attempt.
+func loadAttemptView(ctx context.Context, attempt *models.ExamAttempt) (*models.Exam, []models.ExamItem, []models.AttemptAnswer, error) {
+	exam, err := repositories.GetExamOfAttempt(ctx, attempt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	items, err := repositories.GetAttemptItems(ctx, attempt)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	saved, err := repositories.GetAttemptAnswers(ctx, attempt.ID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return exam, items, saved, nil
+}
+
+func writeAttemptError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrExamNotAvailable),
+		errors.Is(err, repositories.ErrAttemptNotFound),
+		errors.Is(err, repositories.ErrEssayNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repositories.ErrAttemptClosed),
+		errors.Is(err, repositories.ErrAttemptExpired),
+		errors.Is(err, repositories.ErrAttemptNotFinished):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+/*
+====================================
+ GET /student/exams
+====================================
+*/
+func StudentGetExams(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	data, err := repositories.GetPublishedExamsForStudent(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /student/exams/{id}/attempts
+====================================
+*/
+func StartAttempt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	examID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	attempt, err := repositories.StartAttempt(r.Context(), examID, userID)
+	if err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	exam, items, saved, err := loadAttemptView(r.Context(), attempt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt":     attempt,
+		"questions":   buildAttemptQuestions(exam, attempt, items, saved, false),
+		"server_time": time.Now().Unix(),
+	})
+}
+
+/*
+====================================
+ GET /student/attempts
+====================================
+*/
+func StudentGetAttempts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	data, err := repositories.GetStudentAttempts(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /student/attempts/{id}
+====================================
+*/
+func StudentGetAttempt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	attempt, err := repositories.GetStudentAttempt(r.Context(), id, userID)
+	if err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	exam, items, saved, err := loadAttemptView(r.Context(), attempt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt":     attempt,
+		"questions":   buildAttemptQuestions(exam, attempt, items, saved, false),
+		"server_time": time.Now().Unix(),
+	})
+}
+
+/*
+====================================
+ PUT /student/attempts/{id}/answers
+====================================
+*/
+func SaveAttemptAnswers(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req attemptAnswersRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if err := repositories.SaveAttemptAnswers(r.Context(), id, userID, req.inputs()); err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ POST /student/attempts/{id}/submit
+====================================
+*/
+func SubmitAttempt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	// final answers are optional
+	var req attemptAnswersRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	attempt, err := repositories.SubmitAttempt(r.Context(), id, userID, req.inputs())
+	if err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	exam, items, saved, err := loadAttemptView(r.Context(), attempt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt":   attempt,
+		"questions": buildAttemptQuestions(exam, attempt, items, saved, false),
+	})
+}
+
+/*
+====================================
+ GET /teacher/exams/{id}/attempts
+====================================
+*/
+func GetExamAttempts(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	examID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetAttemptsByExam(r.Context(), examID, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /teacher/attempts/{id}
+====================================
+*/
+func TeacherGetAttempt(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	attempt, err := repositories.GetAttemptForTeacher(r.Context(), id, userID)
+	if err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	exam, items, saved, err := loadAttemptView(r.Context(), attempt)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"attempt":   attempt,
+		"questions": buildAttemptQuestions(exam, attempt, items, saved, true),
+	})
+}
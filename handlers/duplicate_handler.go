@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backendLMS/repositories"
+	"backendLMS/services"
+)
+
+/*
+====================================
+ GET /admin/questions/duplicates?course_id=&threshold=
+====================================
+*/
+func ScanDuplicateQuestions(w http.ResponseWriter, r *http.Request) {
+	var courseID int64
+	if v := r.URL.Query().Get("course_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid course_id", http.StatusBadRequest)
+			return
+		}
+		courseID = id
+	}
+
+	threshold := services.DuplicateThreshold
+	if v := r.URL.Query().Get("threshold"); v != "" {
+		t, err := strconv.ParseFloat(v, 64)
+		if err != nil || t <= 0 || t > 1 {
+			http.Error(w, "threshold must be between 0 and 1", http.StatusBadRequest)
+			return
+		}
+		threshold = t
+	}
+
+	data, err := repositories.ScanDuplicateClusters(r.Context(), courseID, threshold)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+====================================
+ GET /teacher/grading-queue
+====================================
+*/
+func GetGradingQueue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	var examID int64
+	if v := r.URL.Query().Get("exam_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			http.Error(w, "invalid exam_id", http.StatusBadRequest)
+			return
+		}
+		examID = id
+	}
+
+	data, err := repositories.GetGradingQueue(r.Context(), userID, examID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ PUT /teacher/attempts/{id}/questions/{question_id}/grade
+====================================
+*/
+func GradeEssay(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	attemptID, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	questionID, err := strconv.ParseInt(mux.Vars(r)["question_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid question_id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Criteria []struct {
+			CriterionID int64  `json:"criterion_id"`
+			LevelID     int64  `json:"level_id"`
+			Comment     string `json:"comment"`
+		} `json:"criteria"`
+		Feedback string `json:"feedback"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var picked []models.CriterionScore
+	for _, c := range req.Criteria {
+		picked = append(picked, models.CriterionScore{
+			CriterionID: c.CriterionID,
+			LevelID:     c.LevelID,
+			Comment:     c.Comment,
+		})
+	}
+
+	attempt, err := repositories.GradeEssay(r.Context(), attemptID, questionID, userID, picked, req.Feedback)
+	if err != nil {
+		writeAttemptError(w, err)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "grade_essay",
+		TargetTable: "exam_attempts",
+		TargetID:    attemptID,
+		Description: fmt.Sprintf("question %d graded", questionID),
+	})
+
+	json.NewEncoder(w).Encode(attempt)
+}
@@ -0,0 +1,485 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+type examRequest struct {
+	CourseID         int64  `json:"course_id"`
+	ChapterID        *int64 `json:"chapter_id"`
+	ClassID          *int64 `json:"class_id"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	DurationMinutes  int    `json:"duration_minutes"`
+	ShuffleQuestions *bool  `json:"shuffle_questions"`
+	ShuffleOptions   *bool  `json:"shuffle_options"`
+}
+
+// boolOrDefault reads an optional JSON boolean.
+func boolOrDefault(v *bool, def bool) bool {
+	if v == nil {
+		return def
+	}
+	return *v
+}
+
+type examQuestionsRequest struct {
+	Items []struct {
+		QuestionID int64    `json:"question_id"`
+		Points     *float64 `json:"points"`
+	} `json:"items"`
+}
+
+/*
+====================================
+ GET /teacher/exams/bank?course_id=&chapter_id=
+====================================
+*/
+func GetExamBank(w http.ResponseWriter, r *http.Request) {
+	courseID, err := strconv.ParseInt(r.URL.Query().Get("course_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "course_id is required", http.StatusBadRequest)
+		return
+	}
+	chapterID, _ := strconv.ParseInt(r.URL.Query().Get("chapter_id"), 10, 64)
+
+	data, err := repositories.GetBankQuestions(r.Context(), courseID, chapterID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /teacher/exams
+====================================
+*/
+func CreateExam(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	var req examRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CourseID == 0 || req.Title == "" {
+		http.Error(w, "course_id and title are required", http.StatusBadRequest)
+		return
+	}
+	if req.DurationMinutes < 0 {
+		http.Error(w, "duration_minutes cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	exam := models.Exam{
+		CourseID:         req.CourseID,
+		ChapterID:        req.ChapterID,
+		ClassID:          req.ClassID,
+		Title:            req.Title,
+		Description:      req.Description,
+		DurationMinutes:  req.DurationMinutes,
+		ShuffleQuestions: boolOrDefault(req.ShuffleQuestions, true),
+		ShuffleOptions:   boolOrDefault(req.ShuffleOptions, true),
+		CreatedBy:        userID,
+	}
+
+	if err := repositories.CreateExam(r.Context(), &exam); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "create_exam",
+		TargetTable: "exams",
+		TargetID:    exam.ID,
+		Description: exam.Title,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(exam)
+}
+
+/*
+====================================
+ GET /teacher/exams
+====================================
+*/
+func GetExams(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	data, err := repositories.GetExamsByTeacher(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /teacher/exams/{id}
+====================================
+*/
+func GetExamDetail(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	exam, err := repositories.GetExamByID(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, "exam not found", http.StatusNotFound)
+		return
+	}
+
+	items, err := repositories.GetExamItems(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var total float64
+	for _, it := range items {
+		total += it.Points
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exam":         exam,
+		"items":        items,
+		"total_points": total,
+	})
+}
+
+/*
+====================================
+ PUT /teacher/exams/{id}
+====================================
+*/
+func UpdateExam(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req examRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Title == "" {
+		http.Error(w, "title is required", http.StatusBadRequest)
+		return
+	}
+	if req.DurationMinutes < 0 {
+		http.Error(w, "duration_minutes cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	exam := models.Exam{
+		ID:               id,
+		ChapterID:        req.ChapterID,
+		ClassID:          req.ClassID,
+		Title:            req.Title,
+		Description:      req.Description,
+		DurationMinutes:  req.DurationMinutes,
+		ShuffleQuestions: boolOrDefault(req.ShuffleQuestions, true),
+		ShuffleOptions:   boolOrDefault(req.ShuffleOptions, true),
+	}
+
+	if err := repositories.UpdateExam(r.Context(), &exam, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "update_exam",
+		TargetTable: "exams",
+		TargetID:    id,
+		Description: exam.Title,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ DELETE /teacher/exams/{id}
+====================================
+*/
+func DeleteExam(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := repositories.DeleteExam(r.Context(), id, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "delete_exam",
+		TargetTable: "exams",
+		TargetID:    id,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+/*
+====================================
+ PUT /teacher/exams/{id}/questions
+====================================
+*/
+func SetExamQuestions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req examQuestionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	var items []repositories.ExamItemInput
+	for _, it := range req.Items {
+		points := 1.0
+		if it.Points != nil {
+			points = *it.Points
+		}
+		items = append(items, repositories.ExamItemInput{
+			QuestionID: it.QuestionID,
+			Points:     points,
+		})
+	}
+
+	if err := repositories.SetExamQuestions(r.Context(), id, userID, items); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ POST /teacher/exams/{id}/publish
+====================================
+*/
+func PublishExam(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	if err := repositories.PublishExam(r.Context(), id, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "publish_exam",
+		TargetTable: "exams",
+		TargetID:    id,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ GET /teacher/exams/{id}/export/qti
+====================================
+*/
+func ExportExamQTI(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	exam, err := repositories.GetExamByID(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, "exam not found", http.StatusNotFound)
+		return
+	}
+
+	if exam.Status != "published" {
+		http.Error(w, "only published exams can be exported", http.StatusConflict)
+		return
+	}
+
+	items, err := repositories.GetExamItems(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := services.ExportQTI(exam, items)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="exam-%d-qti21.zip"`, id))
+	w.Write(data)
+}
+
+type examBlueprintRequest struct {
+	CourseID         int64              `json:"course_id"`
+	ChapterIDs       []int64            `json:"chapter_ids"`
+	ClassID          *int64             `json:"class_id"`
+	Title            string             `json:"title"`
+	Description      string             `json:"description"`
+	DurationMinutes  int                `json:"duration_minutes"`
+	Total            int                `json:"total"`
+	DifficultyMix    map[string]float64 `json:"difficulty_mix"`
+	TaxonomyLevels   []string           `json:"taxonomy_levels"`
+	PointsPerItem    float64            `json:"points_per_item"`
+	ShuffleQuestions *bool              `json:"shuffle_questions"`
+	ShuffleOptions   *bool              `json:"shuffle_options"`
+}
+
+/*
+====================================
+ POST /teacher/exams/generate
+====================================
+*/
+func GenerateExamFromBlueprint(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	var req examBlueprintRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CourseID == 0 || req.Title == "" {
+		http.Error(w, "course_id and title are required", http.StatusBadRequest)
+		return
+	}
+	if req.DurationMinutes < 0 {
+		http.Error(w, "duration_minutes cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	mix := make(map[string]float64)
+	for k, v := range req.DifficultyMix {
+		k = strings.ToLower(k)
+		if !slices.Contains(services.Difficulties, k) {
+			http.Error(w, "unknown difficulty: "+k, http.StatusBadRequest)
+			return
+		}
+		mix[k] += v
+	}
+
+	cells, err := services.AllocateByPercentage(req.Total, mix)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	points := req.PointsPerItem
+	if points == 0 {
+		points = 1
+	}
+	if points < 0 {
+		http.Error(w, "points_per_item cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	exam := models.Exam{
+		CourseID:         req.CourseID,
+		ClassID:          req.ClassID,
+		Title:            req.Title,
+		Description:      req.Description,
+		DurationMinutes:  req.DurationMinutes,
+		ShuffleQuestions: boolOrDefault(req.ShuffleQuestions, true),
+		ShuffleOptions:   boolOrDefault(req.ShuffleOptions, true),
+		CreatedBy:        userID,
+	}
+	if len(req.ChapterIDs) == 1 {
+		exam.ChapterID = &req.ChapterIDs[0]
+	}
+
+	shortages, err := repositories.GenerateExamFromBlueprint(
+		r.Context(),
+		&exam,
+		repositories.BankFilter{
+			CourseID:       req.CourseID,
+			ChapterIDs:     req.ChapterIDs,
+			TaxonomyLevels: req.TaxonomyLevels,
+		},
+		cells,
+		points,
+	)
+
+	if errors.Is(err, repositories.ErrBlueprintUnsatisfiable) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":     err.Error(),
+			"requested": cells,
+			"shortages": shortages,
+		})
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "generate_exam",
+		TargetTable: "exams",
+		TargetID:    exam.ID,
+		Description: exam.Title,
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exam":      exam,
+		"allocated": cells,
+	})
+}
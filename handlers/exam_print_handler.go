@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+const maxPrintVariants = 26
+
+// loadPrintLayout reads the exam, its header and the requested variant
+// (?variant=N, default 1) for the print endpoints.
+func loadPrintLayout(r *http.Request) (*services.PrintHeader, []models.AttemptQuestion, int, error) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		return nil, nil, http.StatusBadRequest, fmt.Errorf("invalid id")
+	}
+
+	variant := 0
+	if v := r.URL.Query().Get("variant"); v != "" {
+		variant, err = strconv.Atoi(v)
+		if err != nil || variant < 1 || variant > maxPrintVariants {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("variant must be between 1 and %d", maxPrintVariants)
+		}
+	}
+
+	date := time.Now().Format("2006-01-02")
+	if d := r.URL.Query().Get("date"); d != "" {
+		if _, err := time.Parse("2006-01-02", d); err != nil {
+			return nil, nil, http.StatusBadRequest, fmt.Errorf("date must be YYYY-MM-DD")
+		}
+		date = d
+	}
+
+	exam, err := repositories.GetExamByID(r.Context(), id, userID)
+	if err != nil {
+		return nil, nil, http.StatusNotFound, fmt.Errorf("exam not found")
+	}
+
+	items, err := repositories.GetExamItems(r.Context(), id)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	if len(items) == 0 {
+		return nil, nil, http.StatusConflict, fmt.Errorf("exam has no questions")
+	}
+
+	header := &services.PrintHeader{
+		ExamTitle:       exam.Title,
+		Date:            date,
+		DurationMinutes: exam.DurationMinutes,
+		Variant:         variant,
+	}
+
+	course, err := repositories.GetCourseByID(r.Context(), exam.CourseID)
+	if err != nil {
+		return nil, nil, http.StatusInternalServerError, err
+	}
+	header.CourseName = course.Name
+
+	if exam.ClassID != nil {
+		class, err := repositories.GetClassByID(r.Context(), *exam.ClassID)
+		if err != nil {
+			return nil, nil, http.StatusInternalServerError, err
+		}
+		header.ClassName = class.Name
+	}
+
+	if variant == 0 {
+		variant = 1
+	}
+	return header, services.LayoutVariant(exam, items, variant), http.StatusOK, nil
+}
+
+func writePDF(w http.ResponseWriter, filename string, data []byte) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	w.Write(data)
+}
+
+func printFilename(r *http.Request, kind string) string {
+	name := "exam-" + mux.Vars(r)["id"] + "-" + kind
+	if v := r.URL.Query().Get("variant"); v != "" {
+		name += "-variant-" + v
+	}
+	return name + ".pdf"
+}
+
+/*
+====================================
+ GET /teacher/exams/{id}/print
+====================================
+*/
+func PrintExam(w http.ResponseWriter, r *http.Request) {
+	header, questions, status, err := loadPrintLayout(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	writePDF(w, printFilename(r, "paper"), services.RenderExamPDF(*header, questions))
+}
+
+/*
+====================================
+ GET /teacher/exams/{id}/print/answer-key
+====================================
+*/
+func PrintExamAnswerKey(w http.ResponseWriter, r *http.Request) {
+	header, questions, status, err := loadPrintLayout(r)
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	writePDF(w, printFilename(r, "answer-key"), services.RenderAnswerKeyPDF(*header, questions))
+}
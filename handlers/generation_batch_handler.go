@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+====================================
+ GET /generation-batches
+====================================
+*/
+func GetGenerationBatches(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+
+	data, err := repositories.GetGenerationBatches(r.Context(), userID, roleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /generation-batches/{id}
+====================================
+*/
+func GetGenerationBatch(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetGenerationBatch(r.Context(), id, userID, roleID)
+	if errors.Is(err, repositories.ErrBatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /generation-batches/{id}/review
+====================================
+*/
+func ReviewGenerationBatch(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	// an empty question_ids applies the action to the whole batch
+	var body struct {
+		Action      string  `json:"action"`
+		QuestionIDs []int64 `json:"question_ids"`
+		Reason      string  `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	ids, skipped, err := repositories.ReviewGenerationBatch(
+		r.Context(), id, userID, roleID, body.Action, body.QuestionIDs, body.Reason,
+	)
+	if errors.Is(err, repositories.ErrBatchNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "review_generation_batch",
+		TargetTable: "generation_batches",
+		TargetID:    id,
+		Description: fmt.Sprintf("%s applied to %d questions", body.Action, len(ids)),
+	})
+
+	batch, err := repositories.GetGenerationBatch(r.Context(), id, userID, roleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"question_ids":         ids,
+		"skipped_question_ids": skipped,
+		"batch":                batch.Batch,
+	})
+}
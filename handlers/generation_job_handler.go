@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/repositories"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+====================================
+ GET /teacher/generation-jobs
+====================================
+*/
+func GetGenerationJobs(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	data, err := repositories.GetGenerationJobs(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /teacher/generation-jobs/{id}
+====================================
+*/
+func GetGenerationJob(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetGenerationJob(r.Context(), id, userID, roleID)
+	if errors.Is(err, repositories.ErrGenerationJobNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
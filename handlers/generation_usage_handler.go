@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+
+	"github.com/gorilla/mux"
+)
+
+// writeQuotaExceeded answers 429 with the limit that was hit.
+func writeQuotaExceeded(w http.ResponseWriter, quota *repositories.QuotaExceededError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": quota.Error(),
+		"limit": quota.Limit,
+		"max":   quota.Max,
+		"used":  quota.Used,
+	})
+}
+
+// usageTotal sums the usage rows of a report.
+func usageTotal(rows []models.GenerationUsage) map[string]interface{} {
+	var requests, questions int
+	var tokens models.TokenUsage
+	for _, u := range rows {
+		requests += u.Requests
+		questions += u.Questions
+		tokens.Add(models.TokenUsage{
+			PromptTokens:     u.PromptTokens,
+			CompletionTokens: u.CompletionTokens,
+			CostUSD:          u.CostUSD,
+		})
+	}
+	return map[string]interface{}{
+		"requests":          requests,
+		"questions":         questions,
+		"prompt_tokens":     tokens.PromptTokens,
+		"completion_tokens": tokens.CompletionTokens,
+		"cost_usd":          tokens.CostUSD,
+	}
+}
+
+/*
+====================================
+ GET /admin/generation-usage?month=YYYY-MM&user_id=&course_id=
+====================================
+*/
+func GetGenerationUsage(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f := repositories.GenerationUsageFilter{Month: query.Get("month")}
+	if f.Month != "" {
+		if _, err := time.Parse("2006-01", f.Month); err != nil {
+			http.Error(w, "month must be YYYY-MM", http.StatusBadRequest)
+			return
+		}
+	}
+	for name, dst := range map[string]*int64{"user_id": &f.UserID, "course_id": &f.CourseID} {
+		if v := query.Get(name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				http.Error(w, "invalid "+name, http.StatusBadRequest)
+				return
+			}
+			*dst = id
+		}
+	}
+
+	rows, err := repositories.GetGenerationUsage(r.Context(), f)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"usage": rows,
+		"total": usageTotal(rows),
+	})
+}
+
+/*
+====================================
+ GET /teacher/generation-usage
+====================================
+*/
+func GetMyGenerationUsage(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	allowance, err := repositories.GetGenerationAllowance(r.Context(), userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	rows, err := repositories.GetGenerationUsage(r.Context(), repositories.GenerationUsageFilter{
+		Month:  time.Now().Format("2006-01"),
+		UserID: userID,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"allowance": allowance,
+		"usage":     rows,
+		"total":     usageTotal(rows),
+	})
+}
+
+/*
+====================================
+ GET /admin/generation-quotas
+====================================
+*/
+func GetGenerationQuotas(w http.ResponseWriter, r *http.Request) {
+	data, err := repositories.GetGenerationQuotas(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ PUT /admin/generation-quotas/roles/{id}
+ PUT /admin/generation-quotas/users/{id}
+====================================
+*/
+func SetGenerationQuota(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		// null is unlimited
+		RequestsPerDay    *int `json:"requests_per_day"`
+		QuestionsPerMonth *int `json:"questions_per_month"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if (req.RequestsPerDay != nil && *req.RequestsPerDay < 0) ||
+		(req.QuestionsPerMonth != nil && *req.QuestionsPerMonth < 0) {
+		http.Error(w, "limits must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	q := models.GenerationQuota{
+		RequestsPerDay:    req.RequestsPerDay,
+		QuestionsPerMonth: req.QuestionsPerMonth,
+	}
+	target := "role"
+	if mux.Vars(r)["target"] == "users" {
+		q.UserID = &id
+		target = "user"
+	} else {
+		q.RoleID = &id
+	}
+
+	err = repositories.SetGenerationQuota(r.Context(), &q)
+	if errors.Is(err, repositories.ErrQuotaTargetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "set_generation_quota",
+		TargetTable: "generation_quotas",
+		TargetID:    q.ID,
+		Description: fmt.Sprintf("%s %d", target, id),
+	})
+
+	json.NewEncoder(w).Encode(q)
+}
+
+/*
+====================================
+ DELETE /admin/generation-quotas/{id}
+====================================
+*/
+func DeleteGenerationQuota(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = repositories.DeleteGenerationQuota(r.Context(), id)
+	if errors.Is(err, repositories.ErrGenerationQuotaNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "delete_generation_quota",
+		TargetTable: "generation_quotas",
+		TargetID:    id,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+/*
+====================================
+ GET /teacher/exams/{id}/item-analysis
+====================================
+*/
+func GetExamItemAnalysis(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	exam, err := repositories.GetExamByID(r.Context(), id, userID)
+	if err != nil {
+		http.Error(w, "exam not found", http.StatusNotFound)
+		return
+	}
+
+	if err := repositories.ExpireOverdueAttempts(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	items, err := repositories.GetExamItems(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responses, err := repositories.GetExamItemResponses(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	var stats []models.ItemStats
+	flagged := 0
+	for _, it := range items {
+		s := services.AnalyzeItem(it.Question, it.Answers, responses[it.Question.ID])
+		if s.DifficultyMismatch {
+			flagged++
+		}
+		stats = append(stats, s)
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"exam":    exam,
+		"items":   stats,
+		"flagged": flagged,
+	})
+}
+
+/*
+====================================
+ GET /questions/{id}/item-analysis
+====================================
+*/
+func GetQuestionItemAnalysis(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	// a teacher who put someone else's bank question in their own exams
+	// sees the statistics of those exams only
+	var examOwner int64
+	q, answers, err := repositories.GetQuestionByID(r.Context(), id, userID, roleID)
+	if err != nil && roleID != 1 {
+		examOwner = userID
+		q, answers, err = repositories.GetQuestionInTeacherExams(r.Context(), id, userID)
+	}
+	if err != nil {
+		http.Error(w, "not found", http.StatusNotFound)
+		return
+	}
+
+	if err := repositories.ExpireOverdueAttempts(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	responses, exams, err := repositories.GetQuestionItemResponses(r.Context(), id, examOwner)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	stats := services.AnalyzeItem(*q, answers, responses)
+	stats.ExamCount = exams
+
+	json.NewEncoder(w).Encode(stats)
+}
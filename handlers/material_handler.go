@@ -3,18 +3,19 @@ package handlers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
 	"strconv"
 	"time"
-	"bytes"
-	"mime/multipart"
 
 	"backendLMS/middlewares"
 	"backendLMS/models"
 	"backendLMS/repositories"
+	"backendLMS/services"
+	"backendLMS/workers"
 
 	"github.com/gorilla/mux"
 )
@@ -53,13 +54,7 @@ func uploadPDFToSupabase(file io.Reader, filename string) (string, error) {
 	}
 
 	// public read URL (TANPA service key)
-	fileURL := fmt.Sprintf(
-		"%s/storage/v1/object/public/materials/%s",
-		os.Getenv("SUPABASE_URL"),
-		filename,
-	)
-
-	return fileURL, nil
+	return services.MaterialFileURL(filename), nil
 }
 
 /*
@@ -138,16 +133,9 @@ func CreateMaterial(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ⬇️ kirim PDF ke FastAPI untuk chunking + embedding
-	if _, err := file.Seek(0, io.SeekStart); err == nil {
-		go sendPDFToFastAPI(
-			file,
-			filename,
-			material.ID,
-			material.CourseID,
-			material.ChapterID,
-		)
-	}
+	// ⬇️ kirim PDF ke FastAPI untuk chunking + embedding (background worker)
+	workers.NotifyMaterialIngestion()
+	material.Ingestion = &models.MaterialIngestion{Status: "pending"}
 
 	// log activity
 	repositories.CreateLog(context.Background(), &models.LogActivity{
@@ -218,9 +206,14 @@ func UpdateMaterial(w http.ResponseWriter, r *http.Request) {
 	m.ID = id
 
 	if err := repositories.UpdateMaterial(context.Background(), &m); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		status := http.StatusInternalServerError
+		if errors.Is(err, repositories.ErrForeignFileURL) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
+	workers.NotifyMaterialIngestion()
 
 	userID := r.Context().Value(middlewares.CtxUserID).(int64)
 	repositories.CreateLog(context.Background(), &models.LogActivity{
@@ -260,9 +253,14 @@ func TeacherUpdateMaterial(w http.ResponseWriter, r *http.Request) {
 		&m,
 		userID,
 	); err != nil {
-		http.Error(w, err.Error(), http.StatusForbidden)
+		status := http.StatusForbidden
+		if errors.Is(err, repositories.ErrForeignFileURL) {
+			status = http.StatusBadRequest
+		}
+		http.Error(w, err.Error(), status)
 		return
 	}
+	workers.NotifyMaterialIngestion()
 
 	repositories.CreateLog(context.Background(), &models.LogActivity{
 		UserID:      userID,
@@ -281,18 +279,20 @@ func TeacherUpdateMaterial(w http.ResponseWriter, r *http.Request) {
 ====================================
 */
 func DeleteMaterial(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
 	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
 		http.Error(w, "invalid id", http.StatusBadRequest)
 		return
 	}
 
-	if err := repositories.DeleteMaterial(context.Background(), id); err != nil {
+	if err := repositories.DeleteMaterial(context.Background(), id, userID); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
+	workers.NotifyMaterialIngestion()
 
-	userID := r.Context().Value(middlewares.CtxUserID).(int64)
 	repositories.CreateLog(context.Background(), &models.LogActivity{
 		UserID:      userID,
 		Action:      "delete_material",
@@ -325,6 +325,7 @@ func TeacherDeleteMaterial(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusForbidden)
 		return
 	}
+	workers.NotifyMaterialIngestion()
 
 	repositories.CreateLog(context.Background(), &models.LogActivity{
 		UserID:      userID,
@@ -336,55 +337,105 @@ func TeacherDeleteMaterial(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
-func sendPDFToFastAPI(
-	file io.Reader,
-	filename string,
-	materialID int64,
-	courseID int64,
-	chapterID int64,
-) error {
+/*
+====================================
+ POST /materials/{id}/ingest
+====================================
+*/
+func RetriggerMaterialIngestion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
 
-	url := os.Getenv("FASTAPI_URL") + "/ingest_material"
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = repositories.RetriggerMaterialIngestion(r.Context(), id, userID, roleID)
+	switch {
+	case errors.Is(err, repositories.ErrMaterialNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	case errors.Is(err, repositories.ErrIngestionRunning):
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	workers.NotifyMaterialIngestion()
 
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "retrigger_material_ingestion",
+		TargetTable: "materials",
+		TargetID:    id,
+	})
 
-	// file
-	part, err := writer.CreateFormFile("file", filename)
+	material, err := repositories.GetMaterialByID(r.Context(), id)
 	if err != nil {
-		return err
-	}
-	if _, err := io.Copy(part, file); err != nil {
-		return err
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// metadata
-	writer.WriteField("material_id", fmt.Sprintf("%d", materialID))
-	writer.WriteField("course_id", fmt.Sprintf("%d", courseID))
-	writer.WriteField("chapter_id", fmt.Sprintf("%d", chapterID))
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(material)
+}
 
-	writer.Close()
+/*
+====================================
+ GET /admin/vector-purges
+====================================
+*/
+func GetVectorPurges(w http.ResponseWriter, r *http.Request) {
+	all := r.URL.Query().Get("all") == "true"
 
-	req, err := http.NewRequest(http.MethodPost, url, body)
+	purges, err := repositories.GetVectorPurges(r.Context(), all)
 	if err != nil {
-		return err
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if purges == nil {
+		purges = []models.VectorPurge{}
 	}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
+	json.NewEncoder(w).Encode(purges)
+}
 
-	client := &http.Client{Timeout: 60 * time.Second}
-	resp, err := client.Do(req)
+/*
+====================================
+ POST /admin/vector-purges/{id}/retry
+====================================
+*/
+func RetryVectorPurge(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
 	if err != nil {
-		return err
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode >= 300 {
-		b, _ := io.ReadAll(resp.Body)
-		return fmt.Errorf("fastapi ingest failed: %s", string(b))
+	err = repositories.RetryVectorPurge(r.Context(), id)
+	if errors.Is(err, repositories.ErrPurgeNotFailed) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
+	workers.NotifyMaterialIngestion()
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "retry_vector_purge",
+		TargetTable: "vector_purges",
+		TargetID:    id,
+	})
 
-	return nil
+	w.WriteHeader(http.StatusAccepted)
 }
 
 /*
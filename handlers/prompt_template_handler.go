@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+type promptTemplateRequest struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	Body        string `json:"body"`
+	// Note describes a new version on update.
+	Note string `json:"note"`
+}
+
+func (req promptTemplateRequest) validate() error {
+	if strings.TrimSpace(req.Name) == "" {
+		return errors.New("name is required")
+	}
+	return services.ValidatePromptTemplate(req.Body)
+}
+
+type generationPresetRequest struct {
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	TemplateID     *int64   `json:"template_id"`
+	TaxonomyLevels []string `json:"taxonomy_levels"`
+	OptionCount    *int     `json:"option_count"`
+	Difficulty     string   `json:"difficulty"`
+}
+
+// preset validates the request and returns it as a preset with normalized
+// settings.
+func (req generationPresetRequest) preset() (*models.GenerationPreset, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, errors.New("name is required")
+	}
+	levels, err := services.NormalizeTaxonomyLevels(req.TaxonomyLevels)
+	if err != nil {
+		return nil, err
+	}
+	difficulty := strings.ToLower(strings.TrimSpace(req.Difficulty))
+	if err := services.ValidateGenerationSettings(req.OptionCount, difficulty); err != nil {
+		return nil, err
+	}
+	return &models.GenerationPreset{
+		Name:           strings.TrimSpace(req.Name),
+		Description:    req.Description,
+		TemplateID:     req.TemplateID,
+		TaxonomyLevels: levels,
+		OptionCount:    req.OptionCount,
+		Difficulty:     difficulty,
+	}, nil
+}
+
+/*
+====================================
+ GET /admin/prompt-templates
+====================================
+*/
+func GetPromptTemplates(w http.ResponseWriter, r *http.Request) {
+	data, err := repositories.GetPromptTemplates(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /admin/prompt-templates/{id}
+====================================
+*/
+func GetPromptTemplate(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetPromptTemplate(r.Context(), id)
+	if errors.Is(err, repositories.ErrPromptTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /admin/prompt-templates/{id}/versions
+====================================
+*/
+func GetPromptTemplateVersions(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetPromptTemplateVersions(r.Context(), id)
+	if errors.Is(err, repositories.ErrPromptTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /admin/prompt-templates
+====================================
+*/
+func CreatePromptTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	var req promptTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	t := models.PromptTemplate{
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Body:        req.Body,
+	}
+	if err := repositories.CreatePromptTemplate(r.Context(), &t, userID); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "create_prompt_template",
+		TargetTable: "prompt_templates",
+		TargetID:    t.ID,
+		Description: t.Name,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(t)
+}
+
+/*
+====================================
+ PUT /admin/prompt-templates/{id}
+====================================
+*/
+func UpdatePromptTemplate(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req promptTemplateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	if err := req.validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// a changed body becomes a new version; jobs keep the one they used
+	t := models.PromptTemplate{
+		ID:          id,
+		Name:        strings.TrimSpace(req.Name),
+		Description: req.Description,
+		Body:        req.Body,
+	}
+	err = repositories.UpdatePromptTemplate(r.Context(), &t, userID, req.Note)
+	if errors.Is(err, repositories.ErrPromptTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "update_prompt_template",
+		TargetTable: "prompt_templates",
+		TargetID:    t.ID,
+		Description: t.Name + " v" + strconv.Itoa(t.Version),
+	})
+
+	json.NewEncoder(w).Encode(t)
+}
+
+/*
+====================================
+ GET /admin/generation-presets
+====================================
+*/
+func GetGenerationPresets(w http.ResponseWriter, r *http.Request) {
+	data, err := repositories.GetGenerationPresets(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /admin/generation-presets/{id}
+====================================
+*/
+func GetGenerationPreset(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetGenerationPreset(r.Context(), id)
+	if errors.Is(err, repositories.ErrGenerationPresetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /admin/generation-presets
+====================================
+*/
+func CreateGenerationPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	var req generationPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := req.preset()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	err = repositories.CreateGenerationPreset(r.Context(), p, userID)
+	if errors.Is(err, repositories.ErrPromptTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "create_generation_preset",
+		TargetTable: "generation_presets",
+		TargetID:    p.ID,
+		Description: p.Name,
+	})
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+/*
+====================================
+ PUT /admin/generation-presets/{id}
+====================================
+*/
+func UpdateGenerationPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var req generationPresetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+	p, err := req.preset()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	p.ID = id
+
+	err = repositories.UpdateGenerationPreset(r.Context(), p)
+	if errors.Is(err, repositories.ErrPromptTemplateNotFound) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, repositories.ErrGenerationPresetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "update_generation_preset",
+		TargetTable: "generation_presets",
+		TargetID:    p.ID,
+		Description: p.Name + " v" + strconv.Itoa(p.Version),
+	})
+
+	json.NewEncoder(w).Encode(p)
+}
+
+/*
+====================================
+ DELETE /admin/generation-presets/{id}
+====================================
+*/
+func DeleteGenerationPreset(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	err = repositories.DeleteGenerationPreset(r.Context(), id)
+	if errors.Is(err, repositories.ErrGenerationPresetNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "delete_generation_preset",
+		TargetTable: "generation_presets",
+		TargetID:    id,
+	})
+
+	w.WriteHeader(http.StatusNoContent)
+}
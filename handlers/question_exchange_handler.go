@@ -0,0 +1,304 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+)
+
+type exportQuestionsRequest struct {
+	QuestionIDs []int64 `json:"question_ids"`
+	Format      string  `json:"format"`
+}
+
+type importResult struct {
+	Index      int    `json:"index"`
+	Name       string `json:"name,omitempty"`
+	QuestionID int64  `json:"question_id,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// importDuplicate lists what an imported stem is a near-duplicate of: bank
+// questions of the course, or earlier questions of the same file.
+type importDuplicate struct {
+	Index      int                     `json:"index"`
+	Name       string                  `json:"name,omitempty"`
+	Duplicates []models.DuplicateMatch `json:"duplicates,omitempty"`
+	SameAs     []int                   `json:"same_as_index,omitempty"`
+}
+
+/*
+====================================
+ POST /questions/export
+====================================
+*/
+func ExportQuestions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+
+	var req exportQuestionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	if len(req.QuestionIDs) == 0 {
+		http.Error(w, "question_ids is required", http.StatusBadRequest)
+		return
+	}
+
+	var questions []models.QuestionWithAnswers
+	for _, id := range req.QuestionIDs {
+		q, answers, err := repositories.GetQuestionByID(r.Context(), id, userID, roleID)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("question %d not found", id), http.StatusNotFound)
+			return
+		}
+		questions = append(questions, models.QuestionWithAnswers{Question: *q, Answers: answers})
+	}
+
+	switch strings.ToLower(req.Format) {
+	case "moodle", "xml", "moodle_xml":
+		data, err := services.ExportMoodleXML(questions)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="questions.xml"`)
+		w.Write(data)
+
+	case "gift":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="questions.gift.txt"`)
+		w.Write(services.ExportGIFT(questions))
+
+	default:
+		http.Error(w, "format must be moodle or gift", http.StatusBadRequest)
+	}
+}
+
+/*
+====================================
+ POST /questions/import
+====================================
+*/
+func ImportQuestions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+
+	if err := r.ParseMultipartForm(10 << 20); err != nil {
+		http.Error(w, "invalid multipart form", http.StatusBadRequest)
+		return
+	}
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	materialID, err := strconv.ParseInt(r.FormValue("material_id"), 10, 64)
+	if err != nil {
+		http.Error(w, "material_id is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := repositories.GetMaterialByID(r.Context(), materialID); err != nil {
+		http.Error(w, "material not found", http.StatusNotFound)
+		return
+	}
+
+	allowDuplicate := false
+	if raw := r.FormValue("allow_duplicate"); raw != "" {
+		if allowDuplicate, err = strconv.ParseBool(raw); err != nil {
+			http.Error(w, "invalid allow_duplicate", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		http.Error(w, "failed to read file", http.StatusBadRequest)
+		return
+	}
+
+	format := strings.ToLower(r.FormValue("format"))
+	if format == "" {
+		if strings.EqualFold(filepath.Ext(header.Filename), ".xml") {
+			format = "moodle"
+		} else {
+			format = "gift"
+		}
+	}
+
+	var parsed []services.ImportedQuestion
+	switch format {
+	case "moodle", "xml", "moodle_xml":
+		parsed, err = services.ParseMoodleXML(data)
+	case "gift":
+		parsed, err = services.ParseGIFT(data)
+	default:
+		http.Error(w, "format must be moodle or gift", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// defaults for questions without metadata tags
+	defaultDifficulty := r.FormValue("difficulty")
+	if defaultDifficulty == "" {
+		defaultDifficulty = "medium"
+	}
+	defaultTaxonomy := r.FormValue("taxonomy_level")
+
+	// formats carry no rubric; an optional essay_rubric (JSON, as in
+	// question create) is given to every imported essay
+	var essayRubric []rubricCriterionRequest
+	if raw := r.FormValue("essay_rubric"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &essayRubric); err != nil {
+			http.Error(w, "invalid essay_rubric", http.StatusBadRequest)
+			return
+		}
+	}
+
+	// as in question create, near-duplicates stop the import unless
+	// allow_duplicate is set; nothing is saved so the file can be fixed
+	// and sent again
+	if !allowDuplicate {
+		duplicates, err := importDuplicates(r.Context(), materialID, parsed)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(duplicates) > 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":      fmt.Sprintf("%d imported question(s) are near-duplicates", len(duplicates)),
+				"duplicates": duplicates,
+			})
+			return
+		}
+	}
+
+	var results []importResult
+	imported := 0
+	for _, q := range parsed {
+		res := importResult{Index: q.Index, Name: q.Name}
+
+		if q.Err != nil {
+			res.Error = q.Err.Error()
+			results = append(results, res)
+			continue
+		}
+
+		difficulty := q.Difficulty
+		if difficulty == "" {
+			difficulty = defaultDifficulty
+		}
+		taxonomy := q.TaxonomyLevel
+		if taxonomy == "" {
+			taxonomy = defaultTaxonomy
+		}
+
+		var answers []repositories.AnswerInput
+		for i, a := range q.Answers {
+			answers = append(answers, repositories.AnswerInput{
+				Label:     services.OptionLabel(i),
+				Text:      a.Text,
+				IsCorrect: a.IsCorrect,
+				Tolerance: a.Tolerance,
+				MatchText: a.MatchText,
+			})
+		}
+
+		var rubric []repositories.RubricCriterionInput
+		if q.Type == services.TypeEssay {
+			if len(essayRubric) == 0 {
+				res.Error = "soal esai harus memiliki rubrik; kirim essay_rubric bersama file impor"
+				results = append(results, res)
+				continue
+			}
+			rubric = toRubricInputs(essayRubric)
+		}
+
+		id, err := repositories.CreateQuestionWithAnswers(
+			r.Context(),
+			materialID,
+			userID,
+			q.Type,
+			q.Content,
+			difficulty,
+			taxonomy,
+			answers,
+			rubric,
+		)
+		if err != nil {
+			res.Error = err.Error()
+		} else {
+			res.QuestionID = id
+			imported++
+		}
+		results = append(results, res)
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "import_questions",
+		TargetTable: "questions",
+		TargetID:    materialID,
+		Description: fmt.Sprintf("%s: %d of %d imported", header.Filename, imported, len(parsed)),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"imported": imported,
+		"failed":   len(parsed) - imported,
+		"results":  results,
+	})
+}
+
+// importDuplicates checks the parsed questions against the course bank and
+// against the questions before them in the file.
+func importDuplicates(ctx context.Context, materialID int64, parsed []services.ImportedQuestion) ([]importDuplicate, error) {
+	var valid []services.ImportedQuestion
+	var contents []string
+	for _, q := range parsed {
+		if q.Err == nil {
+			valid = append(valid, q)
+			contents = append(contents, q.Content)
+		}
+	}
+
+	bank, err := repositories.FindNearDuplicatesOf(ctx, materialID, contents)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []importDuplicate
+	var earlier []services.StemItem
+	for i, q := range valid {
+		d := importDuplicate{Index: q.Index, Name: q.Name, Duplicates: bank[i]}
+		for _, m := range services.SimilarStems(q.Content, earlier, services.DuplicateThreshold) {
+			d.SameAs = append(d.SameAs, int(m.QuestionID))
+		}
+		if len(d.Duplicates) > 0 || len(d.SameAs) > 0 {
+			result = append(result, d)
+		}
+		earlier = append(earlier, services.StemItem{ID: int64(q.Index), Content: q.Content})
+	}
+	return result, nil
+}
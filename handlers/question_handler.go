@@ -1,47 +1,100 @@
 package handlers
 
 import (
-	"bytes"
 	"encoding/json"
+	"errors"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 
 	"github.com/gorilla/mux"
 
 	"backendLMS/middlewares"
 	"backendLMS/repositories"
+	"backendLMS/services"
+	"backendLMS/workers"
 )
 
-var FASTAPI_URL = os.Getenv("FASTAPI_URL")
+type answerRequest struct {
+	Label     string   `json:"label"`
+	Text      string   `json:"text"`
+	IsCorrect bool     `json:"is_correct"`
+	Tolerance *float64 `json:"tolerance"`
+	MatchText string   `json:"match_text"`
+}
 
-type createQuestionRequest struct {
-	MaterialID    int64  `json:"material_id"`
-	Content       string `json:"content"`
-	Difficulty    string `json:"difficulty"`
-	TaxonomyLevel string `json:"taxonomy_level"`
-	Answers       []struct {
-		Label     string `json:"label"`
-		Text      string `json:"text"`
-		IsCorrect bool   `json:"is_correct"`
-	} `json:"answers"`
+func (a answerRequest) input() repositories.AnswerInput {
+	return repositories.AnswerInput{
+		Label:     a.Label,
+		Text:      a.Text,
+		IsCorrect: a.IsCorrect,
+		Tolerance: a.Tolerance,
+		MatchText: a.MatchText,
+	}
+}
+
+func toAnswerInputs(answers []answerRequest) []repositories.AnswerInput {
+	var result []repositories.AnswerInput
+	for _, a := range answers {
+		result = append(result, a.input())
+	}
+	return result
+}
+
+type rubricCriterionRequest struct {
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	Levels      []struct {
+		Score       float64 `json:"score"`
+		Label       string  `json:"label"`
+		Description string  `json:"description"`
+	} `json:"levels"`
+}
+
+// toRubricInputs keeps a missing rubric nil so updates can tell it apart
+// from an empty one.
+func toRubricInputs(rubric []rubricCriterionRequest) []repositories.RubricCriterionInput {
+	if rubric == nil {
+		return nil
+	}
+	result := make([]repositories.RubricCriterionInput, 0, len(rubric))
+	for _, c := range rubric {
+		in := repositories.RubricCriterionInput{
+			Title:       c.Title,
+			Description: c.Description,
+		}
+		for _, l := range c.Levels {
+			in.Levels = append(in.Levels, repositories.RubricLevelInput{
+				Score:       l.Score,
+				Label:       l.Label,
+				Description: l.Description,
+			})
+		}
+		result = append(result, in)
+	}
+	return result
 }
 
-type fastAPIGeneratedQuestion struct {
-	MaterialID    int64  `json:"material_id"`
-	Content       string `json:"content"`
-	Difficulty    string `json:"difficulty"`
-	TaxonomyLevel string `json:"taxonomy_level"`
-	Answers       []struct {
-		Label     string `json:"label"`
-		Text      string `json:"text"`
-		IsCorrect bool   `json:"is_correct"`
-	} `json:"answers"`
+type createQuestionRequest struct {
+	MaterialID    int64                    `json:"material_id"`
+	Type          string                   `json:"type"`
+	Content       string                   `json:"content"`
+	Difficulty    string                   `json:"difficulty"`
+	TaxonomyLevel string                   `json:"taxonomy_level"`
+	Answers       []answerRequest          `json:"answers"`
+	Rubric        []rubricCriterionRequest `json:"rubric"`
+	// AllowDuplicate saves the question even when near-duplicates exist.
+	AllowDuplicate bool `json:"allow_duplicate"`
 }
 
-type RAGGenerateRequest struct {
-	MaterialID  int64  `json:"material_id"`
-	Instruction string `json:"instruction"`
+// writeNearDuplicate answers 409 with the ids of the matching questions.
+func writeNearDuplicate(w http.ResponseWriter, dup *repositories.NearDuplicateError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusConflict)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error":      dup.Error(),
+		"duplicates": dup.Matches,
+	})
 }
 
 func GenerateQuestionFromRAG(w http.ResponseWriter, r *http.Request) {
@@ -50,76 +103,95 @@ func GenerateQuestionFromRAG(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		MaterialID  int64  `json:"material_id"`
 		Instruction string `json:"instruction"`
+		Type        string `json:"type"`
+		PresetID    *int64 `json:"preset_id"`
+		TemplateID  *int64 `json:"template_id"`
+
+		// structured request; anything left out falls back to the preset
+		// or to the instruction
+		Count            int            `json:"count"`
+		DifficultyCounts map[string]int `json:"difficulty_counts"`
+		TaxonomyLevels   []string       `json:"taxonomy_levels"`
+		OptionCount      *int           `json:"option_count"`
+		Language         string         `json:"language"`
+
+		// scope beyond material_id
+		MaterialIDs []int64 `json:"material_ids"`
+		ChapterID   *int64  `json:"chapter_id"`
+		TagIDs      []int64 `json:"tag_ids"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "invalid body", http.StatusBadRequest)
 		return
 	}
 
-	// 1. Panggil FastAPI
-	payload := RAGGenerateRequest{
-		MaterialID:  req.MaterialID,
-		Instruction: req.Instruction,
+	qType, err := services.NormalizeQuestionType(req.Type)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-	body, _ := json.Marshal(payload)
 
-	httpReq, _ := http.NewRequest("POST", FASTAPI_URL+"/generate_exam", bytes.NewBuffer(body))
-	httpReq.Header.Set("Content-Type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(httpReq)
-	if err != nil || resp.StatusCode != 200 {
-		http.Error(w, "failed to generate question from RAG", http.StatusInternalServerError)
-		return
+	spec := services.GenerationSpec{
+		Count:            req.Count,
+		DifficultyCounts: req.DifficultyCounts,
+		Language:         req.Language,
 	}
-	defer resp.Body.Close()
-
-	var fastApiResp struct {
-		RagResult []struct {
-			Content       string `json:"content"`
-			Difficulty    string `json:"difficulty"`
-			TaxonomyLevel string `json:"taxonomy_level"`
-			Answers       []struct {
-				Label     string `json:"label"`
-				Text      string `json:"text"`
-				IsCorrect bool   `json:"is_correct"`
-			} `json:"answers"`
-		} `json:"rag_result"`
+	if err := services.NormalizeGenerationSpec(&spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
-
-	if err := json.NewDecoder(resp.Body).Decode(&fastApiResp); err != nil {
-		http.Error(w, "invalid response from RAG", http.StatusInternalServerError)
+	if spec.Count == 0 && strings.TrimSpace(req.Instruction) == "" {
+		http.Error(w, "count or instruction is required", http.StatusBadRequest)
 		return
 	}
-
-	// 2. Simpan ke DB (Batch Insert)
-	for _, q := range fastApiResp.RagResult {
-		var answers []repositories.AnswerInput
-		for _, a := range q.Answers {
-			answers = append(answers, repositories.AnswerInput{
-				Label:     a.Label,
-				Text:      a.Text,
-				IsCorrect: a.IsCorrect,
-			})
-		}
-
-		err = repositories.CreateQuestionWithAnswers(
-			r.Context(),
-			req.MaterialID,
-			userID,
-			q.Content,
-			q.Difficulty,
-			q.TaxonomyLevel,
-			answers,
-		)
-		if err != nil {
-			// Jika satu gagal, return error (bisa diimprove dengan bulk insert transaction)
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+	var levels []string
+	if req.TaxonomyLevels != nil {
+		if levels, err = services.NormalizeTaxonomyLevels(req.TaxonomyLevels); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
 	}
+	if err := services.ValidateGenerationSettings(req.OptionCount, ""); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 
-	w.WriteHeader(http.StatusCreated)
+	// generation runs in the worker pool; the teacher polls the job
+	job, err := repositories.CreateGenerationJob(r.Context(), userID, repositories.GenerationJobInput{
+		MaterialID:     req.MaterialID,
+		MaterialIDs:    req.MaterialIDs,
+		ChapterID:      req.ChapterID,
+		TagIDs:         req.TagIDs,
+		QuestionType:   qType,
+		Instruction:    req.Instruction,
+		PresetID:       req.PresetID,
+		TemplateID:     req.TemplateID,
+		TaxonomyLevels: levels,
+		OptionCount:    req.OptionCount,
+		Spec:           spec,
+	})
+	var quota *repositories.QuotaExceededError
+	if errors.As(err, &quota) {
+		writeQuotaExceeded(w, quota)
+		return
+	}
+	if errors.Is(err, repositories.ErrGenerationPresetNotFound) ||
+		errors.Is(err, repositories.ErrPromptTemplateNotFound) ||
+		errors.Is(err, repositories.ErrMaterialNotFound) ||
+		errors.Is(err, repositories.ErrEmptyGenerationScope) ||
+		errors.Is(err, repositories.ErrGenerationCountRequired) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	workers.NotifyGenerationJob()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(job)
 }
 
 func CreateQuestion(w http.ResponseWriter, r *http.Request) {
@@ -131,41 +203,33 @@ func CreateQuestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if len(req.Answers) < 2 {
-		http.Error(w, "minimum 2 answers", http.StatusBadRequest)
-		return
-	}
-
-	var correct int
-	var answers []repositories.AnswerInput
-	for _, a := range req.Answers {
-		if a.IsCorrect {
-			correct++
+	if !req.AllowDuplicate {
+		matches, err := repositories.FindNearDuplicates(r.Context(), req.MaterialID, req.Content)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(matches) > 0 {
+			writeNearDuplicate(w, &repositories.NearDuplicateError{Matches: matches})
+			return
 		}
-		answers = append(answers, repositories.AnswerInput{
-			Label:     a.Label,
-			Text:      a.Text,
-			IsCorrect: a.IsCorrect,
-		})
-	}
-
-	if correct != 1 {
-		http.Error(w, "exactly 1 correct answer required", http.StatusBadRequest)
-		return
 	}
 
-	err := repositories.CreateQuestionWithAnswers(
+	// answers and rubric are validated per question type by the repository
+	_, err := repositories.CreateQuestionWithAnswers(
 		r.Context(),
 		req.MaterialID,
 		userID,
+		req.Type,
 		req.Content,
 		req.Difficulty,
 		req.TaxonomyLevel,
-		answers,
+		toAnswerInputs(req.Answers),
+		toRubricInputs(req.Rubric),
 	)
 
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
@@ -196,9 +260,24 @@ func GetQuestionDetail(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	rubric, err := repositories.GetRubric(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
+	// the passages a generated question came from, for the reviewer
+	sources, err := repositories.GetQuestionSources(r.Context(), id)
+	if err != nil {
+		http.Error(w, err.Error(), 500)
+		return
+	}
+
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"question": q,
 		"answers":  answers,
+		"rubric":   rubric,
+		"sources":  sources,
 	})
 }
 
@@ -213,28 +292,11 @@ func UpdateQuestion(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var correct int
-	var answers []repositories.AnswerInput
-	for _, a := range req.Answers {
-		if a.IsCorrect {
-			correct++
-		}
-		answers = append(answers, repositories.AnswerInput{
-			Label:     a.Label,
-			Text:      a.Text,
-			IsCorrect: a.IsCorrect,
-		})
-	}
-
-	if correct != 1 {
-		http.Error(w, "exactly one correct answer required", 400)
-		return
-	}
-
 	err := repositories.UpdateQuestion(
 		r.Context(), id, userID, roleID,
-		req.Content, req.Difficulty, req.TaxonomyLevel,
-		answers,
+		req.Type, req.Content, req.Difficulty, req.TaxonomyLevel,
+		toAnswerInputs(req.Answers),
+		toRubricInputs(req.Rubric),
 	)
 
 	if err != nil {
@@ -258,25 +320,3 @@ func DeleteQuestion(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusNoContent)
 }
-
-func UpdateQuestionStatus(w http.ResponseWriter, r *http.Request) {
-	userID := r.Context().Value(middlewares.CtxUserID).(int64)
-	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
-	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
-
-	var body struct {
-		Status string `json:"status"`
-	}
-	json.NewDecoder(r.Body).Decode(&body)
-
-	err := repositories.UpdateQuestionStatus(
-		r.Context(), id, userID, roleID, body.Status,
-	)
-
-	if err != nil {
-		http.Error(w, err.Error(), 400)
-		return
-	}
-
-	w.WriteHeader(http.StatusOK)
-}
@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+func writeReviewError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrQuestionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, services.ErrReviewForbidden),
+		errors.Is(err, services.ErrSelfReview):
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case errors.Is(err, services.ErrInvalidStatus):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+/*
+====================================
+ PATCH /questions/{id}/status
+====================================
+*/
+func UpdateQuestionStatus(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, _ := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+
+	var body struct {
+		Status string `json:"status"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	err := repositories.UpdateQuestionStatus(
+		r.Context(), id, userID, roleID, body.Status, body.Reason,
+	)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "update_question_status",
+		TargetTable: "questions",
+		TargetID:    id,
+		Description: "status changed to " + body.Status,
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ PUT /questions/{id}/reviewer
+====================================
+*/
+func AssignQuestionReviewer(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		ReviewerID int64  `json:"reviewer_id"`
+		Reason     string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.ReviewerID == 0 {
+		http.Error(w, "reviewer_id is required", http.StatusBadRequest)
+		return
+	}
+
+	err = repositories.AssignQuestionReviewer(r.Context(), id, body.ReviewerID, userID, roleID, body.Reason)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "assign_question_reviewer",
+		TargetTable: "questions",
+		TargetID:    id,
+		Description: fmt.Sprintf("reviewer set to user %d", body.ReviewerID),
+	})
+
+	w.WriteHeader(http.StatusOK)
+}
+
+/*
+====================================
+ GET /questions/{id}/review-history
+====================================
+*/
+func GetQuestionReviewHistory(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetQuestionReviewHistory(r.Context(), id, userID, roleID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /review-queue
+====================================
+*/
+func GetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+
+	data, err := repositories.GetReviewQueue(r.Context(), userID, roleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /questions/{id}/comments
+====================================
+*/
+func GetQuestionComments(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetQuestionComments(r.Context(), id, userID, roleID)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ POST /questions/{id}/comments
+====================================
+*/
+func CreateQuestionComment(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	var body struct {
+		Body     string `json:"body"`
+		ParentID *int64 `json:"parent_id"`
+		AnswerID *int64 `json:"answer_id"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid body", http.StatusBadRequest)
+		return
+	}
+
+	c, err := repositories.CreateQuestionComment(r.Context(), id, userID, roleID, body.ParentID, body.AnswerID, body.Body)
+	if err != nil {
+		writeReviewError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"backendLMS/middlewares"
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+
+	"github.com/gorilla/mux"
+)
+
+func writeQuestionVersionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, repositories.ErrQuestionVersionNotFound),
+		errors.Is(err, repositories.ErrQuestionNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, repositories.ErrQuestionVersionCurrent):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	}
+}
+
+/*
+====================================
+ GET /questions/{id}/versions
+====================================
+*/
+func GetQuestionVersions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetQuestionVersions(r.Context(), id, userID, roleID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /questions/{id}/versions/{version}
+====================================
+*/
+func GetQuestionVersion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	data, err := repositories.GetQuestionVersion(r.Context(), id, version, userID, roleID)
+	if err != nil {
+		writeQuestionVersionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(data)
+}
+
+/*
+====================================
+ GET /questions/{id}/versions/diff?from=&to=
+====================================
+*/
+func DiffQuestionVersions(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "invalid from", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "invalid to", http.StatusBadRequest)
+		return
+	}
+
+	older, err := repositories.GetQuestionVersion(r.Context(), id, from, userID, roleID)
+	if err != nil {
+		writeQuestionVersionError(w, err)
+		return
+	}
+	newer, err := repositories.GetQuestionVersion(r.Context(), id, to, userID, roleID)
+	if err != nil {
+		writeQuestionVersionError(w, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(services.DiffQuestionVersions(*older, *newer))
+}
+
+/*
+====================================
+ POST /questions/{id}/versions/{version}/restore
+====================================
+*/
+func RestoreQuestionVersion(w http.ResponseWriter, r *http.Request) {
+	userID := r.Context().Value(middlewares.CtxUserID).(int64)
+	roleID := r.Context().Value(middlewares.CtxRoleID).(int64)
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "invalid id", http.StatusBadRequest)
+		return
+	}
+	version, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "invalid version", http.StatusBadRequest)
+		return
+	}
+
+	next, err := repositories.RestoreQuestionVersion(r.Context(), id, version, userID, roleID)
+	if err != nil {
+		writeQuestionVersionError(w, err)
+		return
+	}
+
+	repositories.CreateLog(context.Background(), &models.LogActivity{
+		UserID:      userID,
+		Action:      "restore_question_version",
+		TargetTable: "questions",
+		TargetID:    id,
+		Description: fmt.Sprintf("version %d restored as version %d", version, next),
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"question_id": id,
+		"version":     next,
+	})
+}
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
 	"backendLMS/db"
 	"backendLMS/router"
+	"backendLMS/services"
+	"backendLMS/workers"
 
 	"github.com/joho/godotenv"
 )
@@ -19,6 +27,18 @@ func main() {
 	db.Init()
 	defer db.Pool.Close()
 
+	// stopped by SIGINT/SIGTERM; work in progress is put back in its queue
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// background question generation and material ingestion
+	generationWorkers := 2
+	if n, err := strconv.Atoi(os.Getenv("GENERATION_WORKERS")); err == nil && n > 0 {
+		generationWorkers = n
+	}
+	workers.StartGenerationWorkers(ctx, generationWorkers)
+	workers.StartIngestionWorker(ctx)
+
 	// init router
 	r := router.New()
 
@@ -27,6 +47,23 @@ func main() {
 		port = "8080"
 	}
 
-	log.Println("Server running on port", port)
-	log.Fatal(http.ListenAndServe(":"+port, r))
+	srv := &http.Server{Addr: ":" + port, Handler: r}
+	srv.RegisterOnShutdown(services.Progress.Close)
+
+	go func() {
+		log.Println("Server running on port", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Println("shutdown:", err)
+	}
+	workers.Wait()
 }
@@ -17,8 +17,29 @@ const (
 )
 
 func JWTAuth(next http.Handler) http.Handler {
+	return authenticate(next, func(r *http.Request) string {
+		return r.Header.Get("Authorization")
+	})
+}
+
+// EventStreamAuth is JWTAuth for the event stream route only. EventSource
+// cannot set headers, so the token may come in the access_token query
+// parameter instead; no other route accepts a token in its URL.
+func EventStreamAuth(next http.Handler) http.Handler {
+	return authenticate(next, func(r *http.Request) string {
+		if auth := r.Header.Get("Authorization"); auth != "" {
+			return auth
+		}
+		if token := r.URL.Query().Get("access_token"); token != "" {
+			return "Bearer " + token
+		}
+		return ""
+	})
+}
+
+func authenticate(next http.Handler, authOf func(*http.Request) string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		auth := r.Header.Get("Authorization")
+		auth := authOf(r)
 		if auth == "" {
 			http.Error(w, "missing token", http.StatusUnauthorized)
 			return
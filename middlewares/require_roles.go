@@ -6,15 +6,15 @@ import (
 	"github.com/gorilla/mux"
 )
 
-func RequireRoles(roles ...int) mux.MiddlewareFunc {
-	roleSet := make(map[int]bool)
+func RequireRoles(roles ...int64) mux.MiddlewareFunc {
+	roleSet := make(map[int64]bool)
 	for _, r := range roles {
 		roleSet[r] = true
 	}
 
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			roleID, ok := r.Context().Value(CtxRoleID).(int)
+			roleID, ok := r.Context().Value(CtxRoleID).(int64)
 			if !ok {
 				http.Error(w, "unauthorized", http.StatusUnauthorized)
 				return
@@ -1,9 +1,14 @@
 package models
 
+// Answer is one row of a question's answer data. For choice questions it is
+// an option; for short answer an accepted answer; for numeric the expected
+// value with its Tolerance; for matching a pair of Text and MatchText.
 type Answer struct {
-	ID         int64  `json:"id"`
-	QuestionID int64  `json:"question_id"`
-	Label      string `json:"label"`
-	Text       string `json:"text"`
-	IsCorrect  bool   `json:"is_correct"`
+	ID         int64    `json:"id"`
+	QuestionID int64    `json:"question_id"`
+	Label      string   `json:"label"`
+	Text       string   `json:"text"`
+	IsCorrect  bool     `json:"is_correct"`
+	Tolerance  *float64 `json:"tolerance,omitempty"`
+	MatchText  string   `json:"match_text,omitempty"`
 }
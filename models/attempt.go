@@ -0,0 +1,72 @@
+package models
+
+type ExamAttempt struct {
+	ID            int64    `json:"id"`
+	ExamID        int64    `json:"exam_id"`
+	StudentID     int64    `json:"student_id"`
+	Status        string   `json:"status"`
+	StartedAt     int64    `json:"started_at"`
+	DeadlineAt    *int64   `json:"deadline_at,omitempty"`
+	FinishedAt    *int64   `json:"finished_at,omitempty"`
+	Score         *float64 `json:"score,omitempty"`
+	MaxScore      *float64 `json:"max_score,omitempty"`
+	GradingStatus string   `json:"grading_status"` // graded | pending (essays wait for a grader, Score stays empty)
+	ShuffleSeed   int64    `json:"-"`
+	TimeCreated   int64    `json:"timecreated"`
+	TimeModified  int64    `json:"timemodified"`
+
+	ExamTitle   string `json:"exam_title,omitempty"`
+	StudentName string `json:"student_name,omitempty"`
+}
+
+// AttemptAnswer is a student's response to one question. Which response
+// field is used depends on the question type: AnswerID for multiple choice
+// and true/false, AnswerIDs for multiple response, Text for short answer
+// and numeric and essay, and Pairs (left answer id -> chosen right answer
+// id) for matching. Graded essays carry the grader's Feedback and
+// CriterionScores.
+type AttemptAnswer struct {
+	QuestionID      int64            `json:"question_id"`
+	AnswerID        *int64           `json:"answer_id"`
+	AnswerIDs       []int64          `json:"answer_ids,omitempty"`
+	Text            *string          `json:"text,omitempty"`
+	Pairs           map[int64]int64  `json:"pairs,omitempty"`
+	IsCorrect       *bool            `json:"is_correct,omitempty"`
+	PointsAwarded   *float64         `json:"points_awarded,omitempty"`
+	Feedback        *string          `json:"feedback,omitempty"`
+	CriterionScores []CriterionScore `json:"criterion_scores,omitempty"`
+}
+
+// AttemptOption is an answer option as shown in an attempt. Label is the
+// label displayed in this attempt; OriginalLabel, IsCorrect and Tolerance
+// are only filled in for teachers.
+type AttemptOption struct {
+	AnswerID      int64    `json:"answer_id"`
+	Label         string   `json:"label"`
+	Text          string   `json:"text"`
+	OriginalLabel string   `json:"original_label,omitempty"`
+	IsCorrect     *bool    `json:"is_correct,omitempty"`
+	Tolerance     *float64 `json:"tolerance,omitempty"`
+}
+
+// AttemptQuestion is a question at the position it has in one attempt.
+// Options are the choices, the accepted answers (teachers only, for short
+// answer and numeric) or the left column of a matching question, whose
+// right column is in Matches.
+type AttemptQuestion struct {
+	Position          int              `json:"position"`
+	Points            float64          `json:"points"`
+	QuestionID        int64            `json:"question_id"`
+	Type              string           `json:"type"`
+	Content           string           `json:"content"`
+	Options           []AttemptOption  `json:"options"`
+	Matches           []AttemptOption  `json:"matches,omitempty"`
+	SelectedAnswerID  *int64           `json:"selected_answer_id"`
+	SelectedAnswerIDs []int64          `json:"selected_answer_ids,omitempty"`
+	ResponseText      *string          `json:"response_text,omitempty"`
+	Pairs             map[int64]int64  `json:"pairs,omitempty"`
+	IsCorrect         *bool            `json:"is_correct,omitempty"`
+	PointsAwarded     *float64         `json:"points_awarded,omitempty"`
+	Feedback          *string          `json:"feedback,omitempty"`
+	CriterionScores   []CriterionScore `json:"criterion_scores,omitempty"`
+}
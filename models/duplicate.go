@@ -0,0 +1,22 @@
+package models
+
+// DuplicateMatch is an existing question whose stem is near-identical to
+// the one being checked.
+type DuplicateMatch struct {
+	QuestionID int64   `json:"question_id"`
+	Similarity float64 `json:"similarity"`
+}
+
+// DuplicateCluster is a group of near-duplicate questions of one course.
+type DuplicateCluster struct {
+	CourseID  int64      `json:"course_id"`
+	Questions []Question `json:"questions"`
+}
+
+// SkippedQuestion is a generated question that was not saved because it
+// duplicates an existing question or an earlier one of the same batch.
+type SkippedQuestion struct {
+	Index   int              `json:"index"`
+	Content string           `json:"content"`
+	Matches []DuplicateMatch `json:"matches"`
+}
@@ -0,0 +1,42 @@
+package models
+
+type Exam struct {
+	ID               int64  `json:"id"`
+	CourseID         int64  `json:"course_id"`
+	ChapterID        *int64 `json:"chapter_id,omitempty"`
+	ClassID          *int64 `json:"class_id,omitempty"`
+	Title            string `json:"title"`
+	Description      string `json:"description"`
+	DurationMinutes  int    `json:"duration_minutes"`
+	ShuffleQuestions bool   `json:"shuffle_questions"`
+	ShuffleOptions   bool   `json:"shuffle_options"`
+	Status           string `json:"status"`
+	CreatedBy        int64  `json:"created_by"`
+	PublishedAt      *int64 `json:"published_at,omitempty"`
+	TimeCreated      int64  `json:"timecreated"`
+	TimeModified     int64  `json:"timemodified"`
+}
+
+type ExamQuestion struct {
+	ID         int64   `json:"id"`
+	ExamID     int64   `json:"exam_id"`
+	QuestionID int64   `json:"question_id"`
+	Position   int     `json:"position"`
+	Points     float64 `json:"points"`
+}
+
+// ExamItem is a question as it appears inside an exam.
+type ExamItem struct {
+	Position int      `json:"position"`
+	Points   float64  `json:"points"`
+	Question Question `json:"question"`
+	Answers  []Answer `json:"answers"`
+}
+
+// BlueprintShortage describes a blueprint cell the question bank cannot fill.
+type BlueprintShortage struct {
+	Difficulty string `json:"difficulty"`
+	Required   int    `json:"required"`
+	Available  int    `json:"available"`
+	Short      int    `json:"short"`
+}
@@ -0,0 +1,40 @@
+package models
+
+// GenerationBatch is the set of questions created by one rag_generate call.
+// MaterialID is the material the call was made for; MaterialIDs are the
+// materials its questions are linked to, which differ for a chapter, tag
+// or multi-material scope.
+type GenerationBatch struct {
+	ID           int64      `json:"id"`
+	MaterialID   int64      `json:"material_id"`
+	MaterialIDs  []int64    `json:"material_ids"`
+	CreatedBy    int64      `json:"created_by"`
+	QuestionType string     `json:"question_type"`
+	Instruction  string     `json:"instruction"`
+	TimeCreated  int64      `json:"timecreated"`
+	Stats        BatchStats `json:"stats"`
+	// Skipped and Report are only filled in by the generation call that
+	// made the batch.
+	Skipped []SkippedQuestion `json:"skipped,omitempty"`
+	Report  []GenerationItem  `json:"report,omitempty"`
+}
+
+// BatchStats counts a batch's questions per review status. AcceptanceRate
+// is approved / (approved + rejected) and stays nil until one of them has
+// been decided.
+type BatchStats struct {
+	Total            int      `json:"total"`
+	Draft            int      `json:"draft"`
+	Submitted        int      `json:"submitted"`
+	InReview         int      `json:"in_review"`
+	ChangesRequested int      `json:"changes_requested"`
+	Approved         int      `json:"approved"`
+	Rejected         int      `json:"rejected"`
+	AcceptanceRate   *float64 `json:"acceptance_rate"`
+}
+
+// GenerationBatchDetail is a batch with its questions and their answers.
+type GenerationBatchDetail struct {
+	Batch     GenerationBatch       `json:"batch"`
+	Questions []QuestionWithAnswers `json:"questions"`
+}
@@ -0,0 +1,96 @@
+package models
+
+// GenerationJob is a queued question generation call. QuestionIDs lists
+// the questions of the batch the job created once it has succeeded.
+//
+// The preset and template versions and the settings they resolved to are
+// pinned when the job is created; PromptTemplate is empty for FastAPI's
+// default prompt. MaterialIDs is the material set the request's scope
+// resolved to, starting with MaterialID; with a count, Allocations splits
+// it over them. Summary is set once the job succeeded.
+type GenerationJob struct {
+	ID               int64              `json:"id"`
+	CreatedBy        int64              `json:"created_by"`
+	MaterialID       int64              `json:"material_id"`
+	QuestionType     string             `json:"question_type"`
+	Instruction      string             `json:"instruction"`
+	PresetID         *int64             `json:"preset_id"`
+	PresetVersion    *int               `json:"preset_version"`
+	TemplateID       *int64             `json:"template_id"`
+	TemplateVersion  *int               `json:"template_version"`
+	PromptTemplate   string             `json:"-"`
+	TaxonomyLevels   []string           `json:"taxonomy_levels"`
+	OptionCount      *int               `json:"option_count"`
+	Difficulty       string             `json:"difficulty,omitempty"`
+	Count            int                `json:"count"`
+	DifficultyCounts map[string]int     `json:"difficulty_counts"`
+	Language         string             `json:"language"`
+	MaterialIDs      []int64            `json:"material_ids"`
+	ChapterID        *int64             `json:"chapter_id"`
+	TagIDs           []int64            `json:"tag_ids"`
+	Allocations      []GenerationShare  `json:"allocations"`
+	Usage            TokenUsage         `json:"usage"`
+	Status           string             `json:"status"`
+	Attempts         int                `json:"attempts"`
+	Error            string             `json:"error,omitempty"`
+	BatchID          *int64             `json:"batch_id"`
+	QuestionIDs      []int64            `json:"question_ids"`
+	Skipped          []SkippedQuestion  `json:"skipped"`
+	Report           []GenerationItem   `json:"report"`
+	Summary          *GenerationSummary `json:"summary"`
+	StartedAt        *int64             `json:"started_at"`
+	FinishedAt       *int64             `json:"finished_at"`
+	TimeCreated      int64              `json:"timecreated"`
+	TimeModified     int64              `json:"timemodified"`
+}
+
+// GenerationItem reports what happened to one generated question: it was
+// saved as is (accepted) or after fixes (repaired), or left out because
+// validation failed (rejected) or it was a near-duplicate (duplicate).
+type GenerationItem struct {
+	Index      int      `json:"index"`
+	Status     string   `json:"status"` // accepted | repaired | rejected | duplicate
+	Content    string   `json:"content"`
+	Difficulty string   `json:"difficulty,omitempty"`
+	MaterialID int64    `json:"material_id,omitempty"`
+	QuestionID *int64   `json:"question_id,omitempty"`
+	Repairs    []string `json:"repairs,omitempty"`
+	Reason     string   `json:"reason,omitempty"`
+}
+
+// GenerationShare is the part of a job's count one material is asked for.
+type GenerationShare struct {
+	MaterialID       int64          `json:"material_id"`
+	Count            int            `json:"count"`
+	DifficultyCounts map[string]int `json:"difficulty_counts,omitempty"`
+}
+
+// GenerationSummary compares what a generation job asked for with what it
+// returned and saved. Shortfall is how many requested questions are
+// missing; Difficulty breaks it down when the request split the count
+// per difficulty and Materials per material of a distributed job.
+type GenerationSummary struct {
+	Requested  int                        `json:"requested"`
+	Returned   int                        `json:"returned"`
+	Saved      int                        `json:"saved"`
+	Shortfall  int                        `json:"shortfall"`
+	Difficulty map[string]DifficultyTally `json:"difficulty,omitempty"`
+	Materials  []MaterialTally            `json:"materials,omitempty"`
+}
+
+// MaterialTally is a material's share of a distributed job. Error is why
+// its generation call failed, if it did.
+type MaterialTally struct {
+	MaterialID int64  `json:"material_id"`
+	Requested  int    `json:"requested"`
+	Returned   int    `json:"returned"`
+	Saved      int    `json:"saved"`
+	Shortfall  int    `json:"shortfall"`
+	Error      string `json:"error,omitempty"`
+}
+
+type DifficultyTally struct {
+	Requested int `json:"requested"`
+	Saved     int `json:"saved"`
+	Shortfall int `json:"shortfall"`
+}
@@ -0,0 +1,56 @@
+package models
+
+// TokenUsage is what LLM calls consumed, with the cost FastAPI estimated
+// from the model's price.
+type TokenUsage struct {
+	Model            string  `json:"model"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// Add adds the usage of another call.
+func (u *TokenUsage) Add(o TokenUsage) {
+	if o.Model != "" {
+		u.Model = o.Model
+	}
+	u.PromptTokens += o.PromptTokens
+	u.CompletionTokens += o.CompletionTokens
+	u.CostUSD += o.CostUSD
+}
+
+// GenerationUsage is the generation a user did in a course in a month
+// (YYYY-MM): the rag_generate requests made, the questions saved and the
+// tokens and cost of the LLM calls.
+type GenerationUsage struct {
+	UserID           int64   `json:"user_id"`
+	UserName         string  `json:"user_name"`
+	CourseID         int64   `json:"course_id"`
+	CourseName       string  `json:"course_name"`
+	Month            string  `json:"month"`
+	Requests         int     `json:"requests"`
+	Questions        int     `json:"questions"`
+	PromptTokens     int64   `json:"prompt_tokens"`
+	CompletionTokens int64   `json:"completion_tokens"`
+	CostUSD          float64 `json:"cost_usd"`
+}
+
+// GenerationQuota limits the generation of a role, or of one user in
+// place of their role's quota. A nil limit is unlimited.
+type GenerationQuota struct {
+	ID                int64  `json:"id"`
+	RoleID            *int64 `json:"role_id"`
+	UserID            *int64 `json:"user_id"`
+	RequestsPerDay    *int   `json:"requests_per_day"`
+	QuestionsPerMonth *int   `json:"questions_per_month"`
+	TimeModified      int64  `json:"timemodified"`
+}
+
+// GenerationAllowance is a user's quota with what they used of it: the
+// requests today and the questions this month, counting the questions
+// asked for by jobs still queued or running.
+type GenerationAllowance struct {
+	Quota         *GenerationQuota `json:"quota"`
+	RequestsToday int              `json:"requests_today"`
+	QuestionsUsed int              `json:"questions_this_month"`
+}
@@ -0,0 +1,29 @@
+package models
+
+// ItemStats holds classic item statistics for one question.
+type ItemStats struct {
+	QuestionID         int64         `json:"question_id"`
+	Content            string        `json:"content"`
+	LabelledDifficulty string        `json:"labelled_difficulty"`
+	AnalysedDifficulty string        `json:"analysed_difficulty,omitempty"`
+	DifficultyMismatch bool          `json:"difficulty_mismatch"`
+	Responses          int           `json:"responses"`
+	ExamCount          int           `json:"exam_count,omitempty"`
+	PValue             float64       `json:"p_value"`
+	Discrimination     float64       `json:"discrimination"`
+	PointBiserial      *float64      `json:"point_biserial"`
+	Omitted            int           `json:"omitted"`
+	Options            []OptionStats `json:"options"`
+}
+
+// OptionStats is the selection rate of one answer option.
+type OptionStats struct {
+	AnswerID  int64   `json:"answer_id"`
+	Label     string  `json:"label"`
+	Text      string  `json:"text"`
+	IsCorrect bool    `json:"is_correct"`
+	Count     int     `json:"count"`
+	Rate      float64 `json:"rate"`
+	UpperRate float64 `json:"upper_rate"`
+	LowerRate float64 `json:"lower_rate"`
+}
@@ -12,4 +12,32 @@ type Material struct {
 	FileURL     string    `json:"file_url"`
 	UploadedAt  time.Time `json:"uploaded_at"`
 	TimeModified int64    `json:"timemodified"`
-}
\ No newline at end of file
+	// Ingestion is only filled in by GetMaterialByID.
+	Ingestion *MaterialIngestion `json:"ingestion,omitempty"`
+}
+
+// MaterialIngestion is how far a material is in being chunked and
+// embedded by FastAPI.
+type MaterialIngestion struct {
+	Status    string `json:"status"` // pending | processing | indexed | failed
+	Action    string `json:"action"` // index | reindex
+	Chunks    *int   `json:"chunks"`
+	Error     string `json:"error,omitempty"`
+	Attempts  int    `json:"attempts"`
+	NextAt    *int64 `json:"next_attempt_at,omitempty"`
+	UpdatedAt *int64 `json:"updated_at"`
+}
+
+// VectorPurge removes the vectors of a deleted material from the index.
+type VectorPurge struct {
+	ID           int64  `json:"id"`
+	MaterialID   int64  `json:"material_id"`
+	RequestedBy  *int64 `json:"requested_by"`
+	Status       string `json:"status"` // pending | processing | done | failed
+	Attempts     int    `json:"attempts"`
+	Deleted      *int   `json:"deleted"`
+	Error        string `json:"error,omitempty"`
+	NextAt       *int64 `json:"next_attempt_at,omitempty"`
+	TimeCreated  int64  `json:"timecreated"`
+	TimeModified int64  `json:"timemodified"`
+}
@@ -0,0 +1,22 @@
+package models
+
+// ProgressEvent is pushed to a user's event stream while their material
+// ingestion or question generation runs in the background.
+//
+// Type is one of ingest_started | ingest_done | ingest_retrying |
+// ingest_failed | generation_started | generation_done |
+// generation_failed. Count is the
+// number of chunks for ingest_done and of questions created for
+// generation_done; Skipped and Rejected count the generated questions
+// left out as near-duplicates and as invalid.
+type ProgressEvent struct {
+	Type       string `json:"type"`
+	MaterialID int64  `json:"material_id,omitempty"`
+	JobID      int64  `json:"job_id,omitempty"`
+	BatchID    int64  `json:"batch_id,omitempty"`
+	Count      int    `json:"count"`
+	Skipped    int    `json:"skipped,omitempty"`
+	Rejected   int    `json:"rejected,omitempty"`
+	Message    string `json:"message,omitempty"`
+	Time       int64  `json:"time"`
+}
@@ -0,0 +1,42 @@
+package models
+
+// PromptTemplate is an admin-managed generation prompt. Body is the text
+// of the current version.
+type PromptTemplate struct {
+	ID           int64  `json:"id"`
+	Name         string `json:"name"`
+	Description  string `json:"description"`
+	Version      int    `json:"version"`
+	Body         string `json:"body"`
+	CreatedBy    *int64 `json:"created_by"`
+	TimeCreated  int64  `json:"timecreated"`
+	TimeModified int64  `json:"timemodified"`
+}
+
+// PromptTemplateVersion is one immutable revision of a template's body.
+type PromptTemplateVersion struct {
+	ID          int64  `json:"id"`
+	TemplateID  int64  `json:"template_id"`
+	Version     int    `json:"version"`
+	Body        string `json:"body"`
+	Note        string `json:"note"`
+	CreatedBy   *int64 `json:"created_by"`
+	TimeCreated int64  `json:"timecreated"`
+}
+
+// GenerationPreset is a named set of generation settings teachers pick
+// instead of spelling them out. Empty or nil settings leave the prompt's
+// default in place.
+type GenerationPreset struct {
+	ID             int64    `json:"id"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	TemplateID     *int64   `json:"template_id"`
+	TaxonomyLevels []string `json:"taxonomy_levels"`
+	OptionCount    *int     `json:"option_count"`
+	Difficulty     string   `json:"difficulty"`
+	Version        int      `json:"version"`
+	CreatedBy      *int64   `json:"created_by"`
+	TimeCreated    int64    `json:"timecreated"`
+	TimeModified   int64    `json:"timemodified"`
+}
@@ -4,10 +4,20 @@ type Question struct {
 	ID            int64  `json:"id"`
 	MaterialID    int64  `json:"material_id"`
 	CreatedBy     int64  `json:"created_by"`
+	Type          string `json:"type"`
 	Content       string `json:"content"`
 	Difficulty    string `json:"difficulty"`
 	TaxonomyLevel string `json:"taxonomy_level"`
 	Status        string `json:"status"`
+	ReviewerID    *int64 `json:"reviewer_id"`
+	BatchID       *int64 `json:"batch_id"`
+	Version       int    `json:"version"`
 	TimeCreated   int64  `json:"timecreated"`
 	TimeModified  int64  `json:"timemodified"`
 }
+
+// QuestionWithAnswers is a question together with its answer options.
+type QuestionWithAnswers struct {
+	Question Question `json:"question"`
+	Answers  []Answer `json:"answers"`
+}
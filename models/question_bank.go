@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// BankQuestion is an approved question available in question_bank.
+type BankQuestion struct {
+	Question
+	CourseID   int64     `json:"course_id"`
+	ChapterID  *int64    `json:"chapter_id"`
+	ApprovedBy int64     `json:"approved_by"`
+	ApprovedAt time.Time `json:"approved_at"`
+}
@@ -0,0 +1,38 @@
+package models
+
+// QuestionReviewEvent is one step of a question's review history. A
+// reviewer assignment is recorded with the same status on both sides.
+type QuestionReviewEvent struct {
+	ID          int64  `json:"id"`
+	QuestionID  int64  `json:"question_id"`
+	FromStatus  string `json:"from_status"`
+	ToStatus    string `json:"to_status"`
+	ActorID     *int64 `json:"actor_id"`
+	ActorName   string `json:"actor_name"`
+	ReviewerID  *int64 `json:"reviewer_id,omitempty"`
+	Reason      string `json:"reason"`
+	TimeCreated int64  `json:"timecreated"`
+}
+
+// QuestionComment is a review comment. AnswerID is set when the thread is
+// anchored to an answer option; replies share the anchor of their parent.
+type QuestionComment struct {
+	ID          int64             `json:"id"`
+	QuestionID  int64             `json:"question_id"`
+	ParentID    *int64            `json:"parent_id"`
+	AnswerID    *int64            `json:"answer_id"`
+	AnswerLabel string            `json:"answer_label,omitempty"`
+	Version     int               `json:"version"`
+	AuthorID    *int64            `json:"author_id"`
+	AuthorName  string            `json:"author_name"`
+	Body        string            `json:"body"`
+	TimeCreated int64             `json:"timecreated"`
+	Replies     []QuestionComment `json:"replies"`
+}
+
+// ReviewQueueItem is a question waiting on the reviewer it is assigned to.
+type ReviewQueueItem struct {
+	Question    Question `json:"question"`
+	AuthorName  string   `json:"author_name"`
+	SubmittedAt int64    `json:"submitted_at"`
+}
@@ -0,0 +1,11 @@
+package models
+
+// QuestionSource is a passage of the material a generated question was
+// written from. Page is nil when the chunk did not record one.
+type QuestionSource struct {
+	ID         int64  `json:"id"`
+	QuestionID int64  `json:"question_id"`
+	ChunkID    string `json:"chunk_id"`
+	Page       *int   `json:"page"`
+	Text       string `json:"text"`
+}
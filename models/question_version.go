@@ -0,0 +1,38 @@
+package models
+
+// QuestionVersion is one immutable revision of a question. Answers and
+// Rubric are only filled in when a single version is requested.
+type QuestionVersion struct {
+	ID            int64             `json:"id"`
+	QuestionID    int64             `json:"question_id"`
+	Version       int               `json:"version"`
+	Type          string            `json:"type"`
+	Content       string            `json:"content"`
+	Difficulty    string            `json:"difficulty"`
+	TaxonomyLevel string            `json:"taxonomy_level"`
+	CreatedBy     *int64            `json:"created_by"`
+	Note          string            `json:"note"`
+	TimeCreated   int64             `json:"timecreated"`
+	Current       bool              `json:"current"`
+	Answers       []Answer          `json:"answers,omitempty"`
+	Rubric        []RubricCriterion `json:"rubric,omitempty"`
+}
+
+// FieldChange is a value that differs between two versions. Answers and
+// rubric criteria are matched by label and position respectively, so Key
+// names the answer label or criterion number for those.
+type FieldChange struct {
+	Field string `json:"field"`
+	Key   string `json:"key,omitempty"`
+	From  string `json:"from"`
+	To    string `json:"to"`
+}
+
+// QuestionVersionDiff lists what changed from one version to another.
+// Added and removed answers or criteria have an empty From or To.
+type QuestionVersionDiff struct {
+	QuestionID int64         `json:"question_id"`
+	From       int           `json:"from"`
+	To         int           `json:"to"`
+	Changes    []FieldChange `json:"changes"`
+}
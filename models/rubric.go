@@ -0,0 +1,44 @@
+package models
+
+// RubricCriterion is one criterion an essay is graded on, with the score
+// levels a grader picks from.
+type RubricCriterion struct {
+	ID          int64         `json:"id"`
+	QuestionID  int64         `json:"question_id"`
+	Position    int           `json:"position"`
+	Title       string        `json:"title"`
+	Description string        `json:"description"`
+	Levels      []RubricLevel `json:"levels"`
+}
+
+type RubricLevel struct {
+	ID          int64   `json:"id"`
+	CriterionID int64   `json:"criterion_id"`
+	Score       float64 `json:"score"`
+	Label       string  `json:"label"`
+	Description string  `json:"description"`
+}
+
+// CriterionScore is the level a grader picked for one criterion of an
+// essay response.
+type CriterionScore struct {
+	CriterionID int64   `json:"criterion_id"`
+	LevelID     int64   `json:"level_id"`
+	Score       float64 `json:"score"`
+	Comment     string  `json:"comment"`
+}
+
+// EssayGradingItem is an essay response waiting in the grading queue.
+type EssayGradingItem struct {
+	AttemptID   int64             `json:"attempt_id"`
+	ExamID      int64             `json:"exam_id"`
+	ExamTitle   string            `json:"exam_title"`
+	StudentID   int64             `json:"student_id"`
+	StudentName string            `json:"student_name"`
+	QuestionID  int64             `json:"question_id"`
+	Content     string            `json:"content"`
+	Response    string            `json:"response"`
+	Points      float64           `json:"points"`
+	FinishedAt  *int64            `json:"finished_at,omitempty"`
+	Rubric      []RubricCriterion `json:"rubric"`
+}
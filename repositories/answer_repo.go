@@ -3,93 +3,237 @@ package repositories
 import (
 	"context"
 	"errors"
+	"strings"
 
 	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
 )
 
-var ErrQuestionApproved = errors.New("question already approved, answers cannot be modified")
+var (
+	ErrQuestionApproved    = errors.New("question already approved, answers cannot be modified")
+	ErrQuestionNotEditable = errors.New("question not found or not editable")
+	ErrAnswerOutdated      = errors.New("answer belongs to an older version of the question")
+)
 
 // ==========================
 // helper
 // ==========================
-func isQuestionApprovedByAnswerID(ctx context.Context, answerID int64) (bool, error) {
-	var status string
+func getQuestionType(ctx context.Context, questionID int64) (string, error) {
+	var qType string
 	err := db.Pool.QueryRow(ctx, `
-		SELECT q.status
-		FROM questions q
-		JOIN answers a ON a.question_id = q.id
-		WHERE a.id = $1
-	`, answerID).Scan(&status)
+		SELECT type FROM questions WHERE id = $1
+	`, questionID).Scan(&qType)
+	return qType, err
+}
 
-	if err != nil {
-		return false, err
-	}
+const answerColumns = `
+	a.id, a.question_id, a.option_label, a.option_text, a.is_correct,
+	a.tolerance, COALESCE(a.match_text, '')
+`
 
-	return status == "approved", nil
+func scanAnswer(row interface{ Scan(...any) error }, a *models.Answer) error {
+	return row.Scan(
+		&a.ID,
+		&a.QuestionID,
+		&a.Label,
+		&a.Text,
+		&a.IsCorrect,
+		&a.Tolerance,
+		&a.MatchText,
+	)
 }
 
-func isQuestionApprovedByQuestionID(ctx context.Context, questionID int64) (bool, error) {
-	var status string
-	err := db.Pool.QueryRow(ctx, `
-		SELECT status FROM questions WHERE id = $1
-	`, questionID).Scan(&status)
+func insertAnswers(ctx context.Context, tx pgx.Tx, questionID int64, version int, answers []AnswerInput) error {
+	for _, a := range answers {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO answers (question_id, version, option_label, option_text, is_correct, tolerance, match_text)
+			VALUES ($1,$2,$3,$4,$5,$6,NULLIF($7,''))
+		`, questionID, version, a.Label, a.Text, a.IsCorrect, a.Tolerance, a.MatchText)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
 
-	if err != nil {
-		return false, err
+// checkSingleAnswer applies the per-type rules that can be checked when a
+// single answer row is added or changed among the current answers. Rows of
+// key-only types are always stored as correct.
+func checkSingleAnswer(qType string, current []models.Answer, answerID int64, input *AnswerInput) error {
+	if !services.HasOptions(qType) || qType == services.TypeMatching {
+		input.IsCorrect = true
 	}
 
-	return status == "approved", nil
+	switch qType {
+	case services.TypeEssay:
+		return errors.New("essay questions have no answers, edit the rubric instead")
+	case services.TypeNumeric:
+		if _, err := services.ParseNumber(input.Text); err != nil {
+			return errors.New("numeric answer must be a number")
+		}
+		if answerID == 0 && len(current) > 0 {
+			return errors.New("numeric questions have exactly one answer")
+		}
+	case services.TypeMatching:
+		if strings.TrimSpace(input.MatchText) == "" {
+			return errors.New("matching answers need a match_text")
+		}
+	}
+	if qType != services.TypeNumeric {
+		input.Tolerance = nil
+	}
+	if qType != services.TypeMatching {
+		input.MatchText = ""
+	}
+
+	if !services.IsSingleChoice(qType) || !input.IsCorrect {
+		return nil
+	}
+
+	for _, a := range current {
+		if a.IsCorrect && a.ID != answerID {
+			return errors.New("only one correct answer allowed per question")
+		}
+	}
+	return nil
 }
 
-// ==========================
-// CREATE
-// ==========================
-func CreateAnswer(ctx context.Context, questionID int64, input AnswerInput) error {
-	approved, err := isQuestionApprovedByQuestionID(ctx, questionID)
+func answerInput(a models.Answer) AnswerInput {
+	return AnswerInput{
+		Label:     a.Label,
+		Text:      a.Text,
+		IsCorrect: a.IsCorrect,
+		Tolerance: a.Tolerance,
+		MatchText: a.MatchText,
+	}
+}
+
+// reviseAnswers writes a new version of a question whose answers are the
+// current ones passed through edit. Answer rows are never changed in place
+// so attempts served an older version keep working. It follows the editing
+// rules of UpdateQuestion: teachers change only their own questions while
+// those are editable, admins any question that is not approved.
+func reviseAnswers(
+	ctx context.Context,
+	questionID, editorID, roleID int64,
+	edit func(qType string, current []models.Answer) ([]AnswerInput, error),
+) error {
+	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return err
 	}
-	if approved {
+	defer tx.Rollback(ctx)
+
+	var qType, status string
+	var version int
+	var createdBy int64
+	err = tx.QueryRow(ctx, `
+		SELECT type, version, status, created_by FROM questions WHERE id = $1 FOR UPDATE
+	`, questionID).Scan(&qType, &version, &status, &createdBy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrQuestionNotEditable
+	}
+	if err != nil {
+		return err
+	}
+	if status == services.StatusApproved {
 		return ErrQuestionApproved
 	}
+	if roleID != 1 && (createdBy != editorID || !services.IsEditableStatus(status)) {
+		return ErrQuestionNotEditable
+	}
 
-	var count int
-	err = db.Pool.QueryRow(ctx, `
-		SELECT COUNT(*)
-		FROM answers
-		WHERE question_id = $1 AND is_correct = true
-	`, questionID).Scan(&count)
+	current, err := getAnswersByVersions(ctx, map[int64]int{questionID: version})
+	if err != nil {
+		return err
+	}
+
+	answers, err := edit(qType, current[questionID])
+	if err != nil {
+		return err
+	}
 
+	next, err := bumpQuestionVersion(ctx, tx, questionID)
 	if err != nil {
 		return err
 	}
 
-	if input.IsCorrect && count > 0 {
-		return errors.New("only one correct answer allowed per question")
+	if err := insertAnswers(ctx, tx, questionID, next, answers); err != nil {
+		return err
+	}
+
+	if err := copyRubric(ctx, tx, questionID, version, next); err != nil {
+		return err
+	}
+
+	if err := snapshotQuestionVersion(ctx, tx, questionID, editorID, ""); err != nil {
+		return err
 	}
 
-	_, err = db.Pool.Exec(ctx, `
-		INSERT INTO answers (question_id, option_label, option_text, is_correct)
-		VALUES ($1,$2,$3,$4)
-	`, questionID, input.Label, input.Text, input.IsCorrect)
+	return tx.Commit(ctx)
+}
 
-	return err
+// ==========================
+// CREATE
+// ==========================
+func CreateAnswer(ctx context.Context, questionID, editorID, roleID int64, input AnswerInput) error {
+	return reviseAnswers(ctx, questionID, editorID, roleID, func(qType string, current []models.Answer) ([]AnswerInput, error) {
+		if err := checkSingleAnswer(qType, current, 0, &input); err != nil {
+			return nil, err
+		}
+
+		var result []AnswerInput
+		for _, a := range current {
+			result = append(result, answerInput(a))
+		}
+		return append(result, input), nil
+	})
 }
 
 // ==========================
 // UPDATE
 // ==========================
-func UpdateAnswer(ctx context.Context, answerID int64, input AnswerInput) error {
-	approved, err := isQuestionApprovedByAnswerID(ctx, answerID)
+func UpdateAnswer(ctx context.Context, answerID, editorID, roleID int64, input AnswerInput) error {
+	var questionID int64
+	err := db.Pool.QueryRow(ctx, `
+		SELECT question_id FROM answers WHERE id=$1
+	`, answerID).Scan(&questionID)
+
 	if err != nil {
 		return err
 	}
-	if approved {
-		return ErrQuestionApproved
-	}
 
+	return reviseAnswers(ctx, questionID, editorID, roleID, func(qType string, current []models.Answer) ([]AnswerInput, error) {
+		if err := checkSingleAnswer(qType, current, answerID, &input); err != nil {
+			return nil, err
+		}
+
+		found := false
+		var result []AnswerInput
+		for _, a := range current {
+			if a.ID == answerID {
+				found = true
+				result = append(result, input)
+				continue
+			}
+			result = append(result, answerInput(a))
+		}
+		if !found {
+			return nil, ErrAnswerOutdated
+		}
+		return result, nil
+	})
+}
+
+// ==========================
+// DELETE
+// ==========================
+func DeleteAnswer(ctx context.Context, answerID, editorID, roleID int64) error {
 	var questionID int64
-	err = db.Pool.QueryRow(ctx, `
+	err := db.Pool.QueryRow(ctx, `
 		SELECT question_id FROM answers WHERE id=$1
 	`, answerID).Scan(&questionID)
 
@@ -97,47 +241,96 @@ func UpdateAnswer(ctx context.Context, answerID int64, input AnswerInput) error
 		return err
 	}
 
-	if input.IsCorrect {
-		var count int
-		err = db.Pool.QueryRow(ctx, `
-			SELECT COUNT(*)
-			FROM answers
-			WHERE question_id=$1 AND is_correct=true AND id<>$2
-		`, questionID, answerID).Scan(&count)
-
-		if err != nil {
-			return err
+	return reviseAnswers(ctx, questionID, editorID, roleID, func(_ string, current []models.Answer) ([]AnswerInput, error) {
+		found := false
+		var result []AnswerInput
+		for _, a := range current {
+			if a.ID == answerID {
+				found = true
+				continue
+			}
+			result = append(result, answerInput(a))
 		}
-
-		if count > 0 {
-			return errors.New("only one correct answer allowed per question")
+		if !found {
+			return nil, ErrAnswerOutdated
 		}
+		return result, nil
+	})
+}
+
+// ==========================
+// BULK READ
+// ==========================
+
+// getAnswersByQuestionIDs returns the answers of the current version of
+// each question.
+func getAnswersByQuestionIDs(ctx context.Context, questionIDs []int64) (map[int64][]models.Answer, error) {
+	result := make(map[int64][]models.Answer)
+	if len(questionIDs) == 0 {
+		return result, nil
 	}
 
-	_, err = db.Pool.Exec(ctx, `
-		UPDATE answers
-		SET option_label=$1, option_text=$2, is_correct=$3
-		WHERE id=$4
-	`, input.Label, input.Text, input.IsCorrect, answerID)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+answerColumns+`
+		FROM answers a
+		JOIN questions q ON q.id = a.question_id AND q.version = a.version
+		WHERE a.question_id = ANY($1)
+		ORDER BY a.question_id, a.option_label, a.id
+	`, questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-	return err
+	for rows.Next() {
+		var a models.Answer
+		if err := scanAnswer(rows, &a); err != nil {
+			return nil, err
+		}
+		result[a.QuestionID] = append(result[a.QuestionID], a)
+	}
+
+	return result, rows.Err()
 }
 
-// ==========================
-// DELETE
-// ==========================
-func DeleteAnswer(ctx context.Context, answerID int64) error {
-	approved, err := isQuestionApprovedByAnswerID(ctx, answerID)
+// getAnswersByVersions returns the answers of the given version of each
+// question.
+func getAnswersByVersions(ctx context.Context, versions map[int64]int) (map[int64][]models.Answer, error) {
+	result := make(map[int64][]models.Answer)
+	if len(versions) == 0 {
+		return result, nil
+	}
+
+	ids, nums := splitVersions(versions)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+answerColumns+`
+		FROM answers a
+		JOIN unnest($1::bigint[], $2::int[]) AS p(question_id, version)
+		  ON p.question_id = a.question_id AND p.version = a.version
+		ORDER BY a.question_id, a.option_label, a.id
+	`, ids, nums)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	if approved {
-		return ErrQuestionApproved
+	defer rows.Close()
+
+	for rows.Next() {
+		var a models.Answer
+		if err := scanAnswer(rows, &a); err != nil {
+			return nil, err
+		}
+		result[a.QuestionID] = append(result[a.QuestionID], a)
 	}
 
-	_, err = db.Pool.Exec(ctx, `
-		DELETE FROM answers WHERE id=$1
-	`, answerID)
+	return result, rows.Err()
+}
 
-	return err
+func splitVersions(versions map[int64]int) ([]int64, []int32) {
+	ids := make([]int64, 0, len(versions))
+	nums := make([]int32, 0, len(versions))
+	for id, v := range versions {
+		ids = append(ids, id)
+		nums = append(nums, int32(v))
+	}
+	return ids, nums
 }
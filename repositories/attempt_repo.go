@@ -0,0 +1,886 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrExamNotAvailable = errors.New("exam not found or not available")
+	ErrAttemptNotFound  = errors.New("attempt not found")
+	ErrAttemptClosed    = errors.New("attempt already finished")
+	ErrAttemptExpired   = errors.New("attempt deadline has passed")
+)
+
+// attemptGracePeriod absorbs network latency on answers sent right before
+// the deadline.
+const attemptGracePeriod int64 = 30
+
+const attemptColumns = `
+	a.id, a.exam_id, a.student_id, a.status, a.started_at, a.deadline_at,
+	a.finished_at, a.score, a.max_score, a.grading_status, a.shuffle_seed,
+	a.timecreated, a.timemodified
+`
+
+func scanAttempt(row interface{ Scan(...any) error }, a *models.ExamAttempt, extra ...any) error {
+	dest := []any{
+		&a.ID,
+		&a.ExamID,
+		&a.StudentID,
+		&a.Status,
+		&a.StartedAt,
+		&a.DeadlineAt,
+		&a.FinishedAt,
+		&a.Score,
+		&a.MaxScore,
+		&a.GradingStatus,
+		&a.ShuffleSeed,
+		&a.TimeCreated,
+		&a.TimeModified,
+	}
+	return row.Scan(append(dest, extra...)...)
+}
+
+func isAttemptOverdue(a *models.ExamAttempt, now int64) bool {
+	return a.Status == "in_progress" &&
+		a.DeadlineAt != nil &&
+		now > *a.DeadlineAt+attemptGracePeriod
+}
+
+// ==========================
+// STUDENT
+// ==========================
+func GetPublishedExamsForStudent(ctx context.Context, studentID int64) ([]models.Exam, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+examColumns+`
+		FROM exams
+		WHERE status = 'published'
+		  AND course_id IN (SELECT course_id FROM user_courses WHERE user_id = $1)
+		  AND (class_id IS NULL OR class_id = (SELECT class_id FROM users WHERE id = $1))
+		ORDER BY published_at DESC
+	`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Exam
+	for rows.Next() {
+		var e models.Exam
+		if err := scanExam(rows, &e); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+// StartAttempt opens the student's attempt at an exam, or returns the one
+// already open. A finished attempt is returned together with ErrAttemptClosed.
+func StartAttempt(ctx context.Context, examID, studentID int64) (*models.ExamAttempt, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var duration int
+	var shuffleQuestions bool
+	err = tx.QueryRow(ctx, `
+		SELECT duration_minutes, shuffle_questions
+		FROM exams
+		WHERE id = $1
+		  AND status = 'published'
+		  AND course_id IN (SELECT course_id FROM user_courses WHERE user_id = $2)
+		  AND (class_id IS NULL OR class_id = (SELECT class_id FROM users WHERE id = $2))
+	`, examID, studentID).Scan(&duration, &shuffleQuestions)
+	if err != nil {
+		return nil, ErrExamNotAvailable
+	}
+
+	var a models.ExamAttempt
+	err = scanAttempt(tx.QueryRow(ctx, `
+		SELECT `+attemptColumns+`
+		FROM exam_attempts a
+		WHERE a.exam_id = $1 AND a.student_id = $2
+		FOR UPDATE
+	`, examID, studentID), &a)
+
+	if err == nil {
+		if _, err := finishIfOverdue(ctx, tx, &a); err != nil {
+			return nil, err
+		}
+		if err := tx.Commit(ctx); err != nil {
+			return nil, err
+		}
+		if a.Status != "in_progress" {
+			return &a, ErrAttemptClosed
+		}
+		return &a, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	a = models.ExamAttempt{
+		ExamID:        examID,
+		StudentID:     studentID,
+		Status:        "in_progress",
+		StartedAt:     now,
+		GradingStatus: "graded",
+		TimeCreated:   now,
+		TimeModified:  now,
+	}
+	if duration > 0 {
+		deadline := now + int64(duration)*60
+		a.DeadlineAt = &deadline
+	}
+
+	a.ShuffleSeed, err = pickShuffleSeed(ctx, tx, examID, studentID, shuffleQuestions)
+	if err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO exam_attempts
+		(exam_id, student_id, status, started_at, deadline_at, shuffle_seed, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,$4,$4)
+		RETURNING id
+	`, a.ExamID, a.StudentID, a.Status, a.StartedAt, a.DeadlineAt, a.ShuffleSeed).Scan(&a.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// later edits to the questions do not change what this attempt shows
+	_, err = tx.Exec(ctx, `
+		INSERT INTO attempt_question_versions (attempt_id, question_id, version)
+		SELECT $1, q.id, q.version
+		FROM exam_questions eq
+		JOIN questions q ON q.id = eq.question_id
+		WHERE eq.exam_id = $2
+	`, a.ID, a.ExamID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &a, tx.Commit(ctx)
+}
+
+// GetExamOfAttempt returns the exam an attempt belongs to.
+func GetExamOfAttempt(ctx context.Context, attempt *models.ExamAttempt) (*models.Exam, error) {
+	var e models.Exam
+	err := scanExam(db.Pool.QueryRow(ctx, `
+		SELECT `+examColumns+`
+		FROM exams
+		WHERE id = $1
+	`, attempt.ExamID), &e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// GetAttemptItems returns the exam items as they were when the attempt
+// started, with each question at the version the attempt is pinned to.
+func GetAttemptItems(ctx context.Context, attempt *models.ExamAttempt) ([]models.ExamItem, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT eq.position, eq.points,
+		       q.id, q.material_id, q.created_by, qv.type, qv.content,
+		       qv.difficulty, qv.taxonomy_level, q.status, qv.version,
+		       q.timecreated, qv.timecreated
+		FROM exam_questions eq
+		JOIN questions q ON q.id = eq.question_id
+		JOIN attempt_question_versions av ON av.attempt_id = $2 AND av.question_id = q.id
+		JOIN question_versions qv ON qv.question_id = q.id AND qv.version = av.version
+		WHERE eq.exam_id = $1
+		ORDER BY eq.position
+	`, attempt.ExamID, attempt.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ExamItem
+	versions := make(map[int64]int)
+	for rows.Next() {
+		var it models.ExamItem
+		if err := rows.Scan(
+			&it.Position,
+			&it.Points,
+			&it.Question.ID,
+			&it.Question.MaterialID,
+			&it.Question.CreatedBy,
+			&it.Question.Type,
+			&it.Question.Content,
+			&it.Question.Difficulty,
+			&it.Question.TaxonomyLevel,
+			&it.Question.Status,
+			&it.Question.Version,
+			&it.Question.TimeCreated,
+			&it.Question.TimeModified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+		versions[it.Question.ID] = it.Question.Version
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	answers, err := getAnswersByVersions(ctx, versions)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Answers = answers[items[i].Question.ID]
+	}
+
+	return items, nil
+}
+
+// GetStudentAttempt returns an attempt owned by the student, grading it
+// first if its deadline has passed.
+func GetStudentAttempt(ctx context.Context, attemptID, studentID int64) (*models.ExamAttempt, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := lockStudentAttempt(ctx, tx, attemptID, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := finishIfOverdue(ctx, tx, a); err != nil {
+		return nil, err
+	}
+
+	return a, tx.Commit(ctx)
+}
+
+func GetStudentAttempts(ctx context.Context, studentID int64) ([]models.ExamAttempt, error) {
+	if err := ExpireOverdueAttempts(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+attemptColumns+`, e.title
+		FROM exam_attempts a
+		JOIN exams e ON e.id = a.exam_id
+		WHERE a.student_id = $1
+		ORDER BY a.started_at DESC
+	`, studentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ExamAttempt
+	for rows.Next() {
+		var a models.ExamAttempt
+		if err := scanAttempt(rows, &a, &a.ExamTitle); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+// SaveAttemptAnswers stores the student's selections while the attempt is
+// still open.
+func SaveAttemptAnswers(ctx context.Context, attemptID, studentID int64, answers []AttemptAnswerInput) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := lockStudentAttempt(ctx, tx, attemptID, studentID)
+	if err != nil {
+		return err
+	}
+
+	if a.Status != "in_progress" {
+		return ErrAttemptClosed
+	}
+
+	expired, err := finishIfOverdue(ctx, tx, a)
+	if err != nil {
+		return err
+	}
+	if expired {
+		if err := tx.Commit(ctx); err != nil {
+			return err
+		}
+		return ErrAttemptExpired
+	}
+
+	if err := upsertAttemptAnswers(ctx, tx, a, answers); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// SubmitAttempt stores any final answers and grades the attempt. When the
+// deadline has already passed the final answers are discarded and the
+// attempt is graded as expired.
+func SubmitAttempt(ctx context.Context, attemptID, studentID int64, answers []AttemptAnswerInput) (*models.ExamAttempt, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	a, err := lockStudentAttempt(ctx, tx, attemptID, studentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if a.Status != "in_progress" {
+		return a, ErrAttemptClosed
+	}
+
+	expired, err := finishIfOverdue(ctx, tx, a)
+	if err != nil {
+		return nil, err
+	}
+
+	if !expired {
+		if err := upsertAttemptAnswers(ctx, tx, a, answers); err != nil {
+			return nil, err
+		}
+		if err := gradeAttempt(ctx, tx, a, "submitted"); err != nil {
+			return nil, err
+		}
+	}
+
+	return a, tx.Commit(ctx)
+}
+
+func GetAttemptAnswers(ctx context.Context, attemptID int64) ([]models.AttemptAnswer, error) {
+	scores, err := getCriterionScores(ctx, attemptID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT question_id, answer_id, response, is_correct, points_awarded, feedback
+		FROM attempt_answers
+		WHERE attempt_id = $1
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.AttemptAnswer
+	for rows.Next() {
+		var aa models.AttemptAnswer
+		var raw []byte
+		if err := rows.Scan(&aa.QuestionID, &aa.AnswerID, &raw, &aa.IsCorrect, &aa.PointsAwarded, &aa.Feedback); err != nil {
+			return nil, err
+		}
+		if err := decodeAttemptResponse(raw, &aa); err != nil {
+			return nil, err
+		}
+		aa.CriterionScores = scores[aa.QuestionID]
+		result = append(result, aa)
+	}
+	return result, rows.Err()
+}
+
+func getCriterionScores(ctx context.Context, attemptID int64) (map[int64][]models.CriterionScore, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT s.question_id, s.criterion_id, s.level_id, s.score, s.comment
+		FROM attempt_rubric_scores s
+		JOIN rubric_criteria c ON c.id = s.criterion_id
+		WHERE s.attempt_id = $1
+		ORDER BY s.question_id, c.position
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64][]models.CriterionScore)
+	for rows.Next() {
+		var qID int64
+		var cs models.CriterionScore
+		if err := rows.Scan(&qID, &cs.CriterionID, &cs.LevelID, &cs.Score, &cs.Comment); err != nil {
+			return nil, err
+		}
+		result[qID] = append(result[qID], cs)
+	}
+	return result, rows.Err()
+}
+
+// ==========================
+// TEACHER
+// ==========================
+func GetAttemptsByExam(ctx context.Context, examID, teacherID int64) ([]models.ExamAttempt, error) {
+	if err := ExpireOverdueAttempts(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+attemptColumns+`, e.title, u.name
+		FROM exam_attempts a
+		JOIN exams e ON e.id = a.exam_id
+		JOIN users u ON u.id = a.student_id
+		WHERE a.exam_id = $1 AND e.created_by = $2
+		ORDER BY u.name
+	`, examID, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ExamAttempt
+	for rows.Next() {
+		var a models.ExamAttempt
+		if err := scanAttempt(rows, &a, &a.ExamTitle, &a.StudentName); err != nil {
+			return nil, err
+		}
+		result = append(result, a)
+	}
+	return result, rows.Err()
+}
+
+func GetAttemptForTeacher(ctx context.Context, attemptID, teacherID int64) (*models.ExamAttempt, error) {
+	if err := ExpireOverdueAttempts(ctx); err != nil {
+		return nil, err
+	}
+
+	var a models.ExamAttempt
+	err := scanAttempt(db.Pool.QueryRow(ctx, `
+		SELECT `+attemptColumns+`, e.title, u.name
+		FROM exam_attempts a
+		JOIN exams e ON e.id = a.exam_id
+		JOIN users u ON u.id = a.student_id
+		WHERE a.id = $1 AND e.created_by = $2
+	`, attemptID, teacherID), &a, &a.ExamTitle, &a.StudentName)
+	if err != nil {
+		return nil, ErrAttemptNotFound
+	}
+	return &a, nil
+}
+
+// ExpireOverdueAttempts grades every open attempt whose deadline has passed.
+func ExpireOverdueAttempts(ctx context.Context) error {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id
+		FROM exam_attempts
+		WHERE status = 'in_progress'
+		  AND deadline_at IS NOT NULL
+		  AND deadline_at + $1 < $2
+	`, attemptGracePeriod, time.Now().Unix())
+	if err != nil {
+		return err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		if err := expireAttempt(ctx, id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func expireAttempt(ctx context.Context, attemptID int64) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var a models.ExamAttempt
+	err = scanAttempt(tx.QueryRow(ctx, `
+		SELECT `+attemptColumns+`
+		FROM exam_attempts a
+		WHERE a.id = $1
+		FOR UPDATE
+	`, attemptID), &a)
+	if err != nil {
+		return err
+	}
+
+	if _, err := finishIfOverdue(ctx, tx, &a); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ==========================
+// helper
+// ==========================
+func lockStudentAttempt(ctx context.Context, tx pgx.Tx, attemptID, studentID int64) (*models.ExamAttempt, error) {
+	var a models.ExamAttempt
+	err := scanAttempt(tx.QueryRow(ctx, `
+		SELECT `+attemptColumns+`
+		FROM exam_attempts a
+		WHERE a.id = $1 AND a.student_id = $2
+		FOR UPDATE
+	`, attemptID, studentID), &a)
+	if err != nil {
+		return nil, ErrAttemptNotFound
+	}
+	return &a, nil
+}
+
+// maxSeedTries bounds the search for a question order no classmate has.
+const maxSeedTries = 20
+
+// pickShuffleSeed draws a seed for a new attempt. When questions are
+// shuffled it retries until the resulting question order differs from the
+// orders already served to students of the same class, as long as there
+// are enough distinct orders to go around.
+func pickShuffleSeed(ctx context.Context, tx pgx.Tx, examID, studentID int64, shuffleQuestions bool) (int64, error) {
+	seed := rand.Int64()
+	if !shuffleQuestions {
+		return seed, nil
+	}
+
+	var itemCount int
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM exam_questions WHERE exam_id = $1
+	`, examID).Scan(&itemCount)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT a.shuffle_seed
+		FROM exam_attempts a
+		JOIN users u ON u.id = a.student_id
+		WHERE a.exam_id = $1
+		  AND u.class_id IS NOT DISTINCT FROM (SELECT class_id FROM users WHERE id = $2)
+	`, examID, studentID)
+	if err != nil {
+		return 0, err
+	}
+	var taken [][]int
+	for rows.Next() {
+		var s int64
+		if err := rows.Scan(&s); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		taken = append(taken, services.QuestionOrder(s, itemCount))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	if !enoughOrders(itemCount, len(taken)+1) {
+		return seed, nil
+	}
+
+	for try := 0; try < maxSeedTries; try++ {
+		order := services.QuestionOrder(seed, itemCount)
+		clash := false
+		for _, t := range taken {
+			if services.SameOrder(order, t) {
+				clash = true
+				break
+			}
+		}
+		if !clash {
+			break
+		}
+		seed = rand.Int64()
+	}
+
+	return seed, nil
+}
+
+// enoughOrders reports whether n items have at least want distinct orders.
+func enoughOrders(n, want int) bool {
+	perms := 1
+	for i := 2; i <= n; i++ {
+		perms *= i
+		if perms >= want {
+			return true
+		}
+	}
+	return perms >= want
+}
+
+// finishIfOverdue grades a locked attempt as expired when its deadline has
+// passed and reports whether it did so.
+func finishIfOverdue(ctx context.Context, tx pgx.Tx, a *models.ExamAttempt) (bool, error) {
+	if !isAttemptOverdue(a, time.Now().Unix()) {
+		return false, nil
+	}
+	return true, gradeAttempt(ctx, tx, a, "expired")
+}
+
+// attemptResponse is the JSON stored in attempt_answers.response for
+// question types whose response is not a single answer id.
+type attemptResponse struct {
+	AnswerIDs []int64         `json:"answer_ids,omitempty"`
+	Text      *string         `json:"text,omitempty"`
+	Pairs     map[int64]int64 `json:"pairs,omitempty"`
+}
+
+func upsertAttemptAnswers(ctx context.Context, tx pgx.Tx, a *models.ExamAttempt, answers []AttemptAnswerInput) error {
+	now := time.Now().Unix()
+
+	for _, in := range answers {
+		var qType string
+		var optionIDs []int64
+		err := tx.QueryRow(ctx, `
+			SELECT qv.type, COALESCE(array_agg(an.id) FILTER (WHERE an.id IS NOT NULL), '{}')
+			FROM exam_questions eq
+			JOIN attempt_question_versions av ON av.attempt_id = $3 AND av.question_id = eq.question_id
+			JOIN question_versions qv ON qv.question_id = av.question_id AND qv.version = av.version
+			LEFT JOIN answers an ON an.question_id = av.question_id AND an.version = av.version
+			WHERE eq.exam_id = $1 AND eq.question_id = $2
+			GROUP BY qv.type
+		`, a.ExamID, in.QuestionID, a.ID).Scan(&qType, &optionIDs)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("question %d is not part of this exam", in.QuestionID)
+		}
+		if err != nil {
+			return err
+		}
+
+		belongs := make(map[int64]bool)
+		for _, id := range optionIDs {
+			belongs[id] = true
+		}
+		checkIDs := func(ids ...int64) error {
+			for _, id := range ids {
+				if !belongs[id] {
+					return fmt.Errorf("answer %d does not belong to question %d", id, in.QuestionID)
+				}
+			}
+			return nil
+		}
+
+		var answerID *int64
+		var response *attemptResponse
+		switch {
+		case services.IsSingleChoice(qType):
+			if in.AnswerID != nil {
+				if err := checkIDs(*in.AnswerID); err != nil {
+					return err
+				}
+			}
+			answerID = in.AnswerID
+
+		case qType == services.TypeMultipleResponse:
+			if err := checkIDs(in.AnswerIDs...); err != nil {
+				return err
+			}
+			response = &attemptResponse{AnswerIDs: in.AnswerIDs}
+
+		case qType == services.TypeMatching:
+			for left, right := range in.Pairs {
+				if err := checkIDs(left, right); err != nil {
+					return err
+				}
+			}
+			response = &attemptResponse{Pairs: in.Pairs}
+
+		default: // short answer, numeric
+			response = &attemptResponse{Text: in.Text}
+		}
+
+		var raw []byte
+		if response != nil {
+			raw, err = json.Marshal(response)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO attempt_answers (attempt_id, question_id, answer_id, response, timemodified)
+			VALUES ($1,$2,$3,$4,$5)
+			ON CONFLICT (attempt_id, question_id)
+			DO UPDATE SET answer_id = EXCLUDED.answer_id,
+			              response = EXCLUDED.response,
+			              timemodified = EXCLUDED.timemodified
+		`, a.ID, in.QuestionID, answerID, raw, now)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(ctx, `
+		UPDATE exam_attempts SET timemodified = $1 WHERE id = $2
+	`, now, a.ID)
+	return err
+}
+
+// gradeAttempt scores every stored answer with the grading rule and key of
+// the question version the attempt was served, and closes the attempt with
+// the given status. Written essays are left ungraded and keep the
+// attempt's score pending; blank essays earn nothing.
+func gradeAttempt(ctx context.Context, tx pgx.Tx, a *models.ExamAttempt, status string) error {
+	points := make(map[int64]float64)
+	types := make(map[int64]string)
+	versions := make(map[int64]int)
+	rows, err := tx.Query(ctx, `
+		SELECT eq.question_id, eq.points, qv.type, qv.version
+		FROM exam_questions eq
+		JOIN attempt_question_versions av ON av.attempt_id = $2 AND av.question_id = eq.question_id
+		JOIN question_versions qv ON qv.question_id = av.question_id AND qv.version = av.version
+		WHERE eq.exam_id = $1
+	`, a.ExamID, a.ID)
+	if err != nil {
+		return err
+	}
+	var maxScore float64
+	for rows.Next() {
+		var qID int64
+		var p float64
+		var qType string
+		var version int
+		if err := rows.Scan(&qID, &p, &qType, &version); err != nil {
+			rows.Close()
+			return err
+		}
+		points[qID] = p
+		types[qID] = qType
+		versions[qID] = version
+		maxScore += p
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	answers, err := getAnswersByVersions(ctx, versions)
+	if err != nil {
+		return err
+	}
+
+	responses, err := loadAttemptResponses(ctx, tx, a.ID)
+	if err != nil {
+		return err
+	}
+
+	var score float64
+	pending := 0
+	for _, resp := range responses {
+		qType := types[resp.QuestionID]
+		if services.IsManuallyGraded(qType) && resp.Text != nil && strings.TrimSpace(*resp.Text) != "" {
+			pending++
+			continue
+		}
+
+		fraction := services.GradeResponse(qType, answers[resp.QuestionID], resp)
+		isCorrect := fraction >= 1
+		awarded := fraction * points[resp.QuestionID]
+		score += awarded
+
+		_, err := tx.Exec(ctx, `
+			UPDATE attempt_answers
+			SET is_correct = $1, points_awarded = $2
+			WHERE attempt_id = $3 AND question_id = $4
+		`, isCorrect, awarded, a.ID, resp.QuestionID)
+		if err != nil {
+			return err
+		}
+	}
+
+	finalScore := &score
+	gradingStatus := "graded"
+	if pending > 0 {
+		finalScore = nil
+		gradingStatus = "pending"
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(ctx, `
+		UPDATE exam_attempts
+		SET status = $1, finished_at = $2, score = $3, max_score = $4,
+		    grading_status = $5, timemodified = $2
+		WHERE id = $6
+	`, status, now, finalScore, maxScore, gradingStatus, a.ID)
+	if err != nil {
+		return err
+	}
+
+	a.Status = status
+	a.FinishedAt = &now
+	a.Score = finalScore
+	a.MaxScore = &maxScore
+	a.GradingStatus = gradingStatus
+	a.TimeModified = now
+
+	return nil
+}
+
+func loadAttemptResponses(ctx context.Context, tx pgx.Tx, attemptID int64) ([]models.AttemptAnswer, error) {
+	rows, err := tx.Query(ctx, `
+		SELECT question_id, answer_id, response
+		FROM attempt_answers
+		WHERE attempt_id = $1
+	`, attemptID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.AttemptAnswer
+	for rows.Next() {
+		var aa models.AttemptAnswer
+		var raw []byte
+		if err := rows.Scan(&aa.QuestionID, &aa.AnswerID, &raw); err != nil {
+			return nil, err
+		}
+		if err := decodeAttemptResponse(raw, &aa); err != nil {
+			return nil, err
+		}
+		result = append(result, aa)
+	}
+	return result, rows.Err()
+}
+
+func decodeAttemptResponse(raw []byte, aa *models.AttemptAnswer) error {
+	if raw == nil {
+		return nil
+	}
+	var r attemptResponse
+	if err := json.Unmarshal(raw, &r); err != nil {
+		return err
+	}
+	aa.AnswerIDs = r.AnswerIDs
+	aa.Text = r.Text
+	aa.Pairs = r.Pairs
+	return nil
+}
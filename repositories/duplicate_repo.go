@@ -0,0 +1,145 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// NearDuplicateError rejects a question whose stem is near-identical to
+// existing questions of the same course.
+type NearDuplicateError struct {
+	Matches []models.DuplicateMatch
+}
+
+func (e *NearDuplicateError) Error() string {
+	return fmt.Sprintf("question is a near-duplicate of %d existing question(s)", len(e.Matches))
+}
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// courseStems returns the stems of the questions in the course of the
+// material. Rejected questions are left out so a rejected stem can be
+// written again properly.
+func courseStems(ctx context.Context, q querier, materialID int64) ([]services.StemItem, error) {
+	rows, err := q.Query(ctx, `
+		SELECT q.id, q.content
+		FROM questions q
+		JOIN materials m ON m.id = q.material_id
+		WHERE m.course_id = (SELECT course_id FROM materials WHERE id = $1)
+		  AND q.status <> 'rejected'
+	`, materialID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []services.StemItem
+	for rows.Next() {
+		var it services.StemItem
+		if err := rows.Scan(&it.ID, &it.Content); err != nil {
+			return nil, err
+		}
+		result = append(result, it)
+	}
+	return result, rows.Err()
+}
+
+// FindNearDuplicates compares a stem with the questions of the material's
+// course and returns the near-duplicates, most similar first.
+func FindNearDuplicates(ctx context.Context, materialID int64, content string) ([]models.DuplicateMatch, error) {
+	pool, err := courseStems(ctx, db.Pool, materialID)
+	if err != nil {
+		return nil, err
+	}
+	return services.SimilarStems(content, pool, services.DuplicateThreshold), nil
+}
+
+// FindNearDuplicatesOf compares several stems with the questions of the
+// material's course, loading the course once. The result lines up with
+// contents.
+func FindNearDuplicatesOf(ctx context.Context, materialID int64, contents []string) ([][]models.DuplicateMatch, error) {
+	pool, err := courseStems(ctx, db.Pool, materialID)
+	if err != nil {
+		return nil, err
+	}
+	result := make([][]models.DuplicateMatch, len(contents))
+	for i, content := range contents {
+		result[i] = services.SimilarStems(content, pool, services.DuplicateThreshold)
+	}
+	return result, nil
+}
+
+// ScanDuplicateClusters groups the questions of the bank into clusters of
+// near-duplicates, course by course. courseID 0 scans every course.
+func ScanDuplicateClusters(ctx context.Context, courseID int64, threshold float64) ([]models.DuplicateCluster, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT m.course_id,
+		       q.id, q.material_id, q.created_by, q.type, q.content,
+		       q.difficulty, q.taxonomy_level, q.status, q.reviewer_id, q.batch_id, q.version,
+		       q.timecreated, q.timemodified
+		FROM questions q
+		JOIN materials m ON m.id = q.material_id
+		WHERE ($1 = 0 OR m.course_id = $1)
+		  AND q.status <> 'rejected'
+		ORDER BY m.course_id, q.id
+	`, courseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var courses []int64
+	stems := make(map[int64][]services.StemItem)
+	questions := make(map[int64]models.Question)
+	for rows.Next() {
+		var course int64
+		var q models.Question
+		if err := rows.Scan(
+			&course,
+			&q.ID,
+			&q.MaterialID,
+			&q.CreatedBy,
+			&q.Type,
+			&q.Content,
+			&q.Difficulty,
+			&q.TaxonomyLevel,
+			&q.Status,
+			&q.ReviewerID,
+			&q.BatchID,
+			&q.Version,
+			&q.TimeCreated,
+			&q.TimeModified,
+		); err != nil {
+			return nil, err
+		}
+		if _, ok := stems[course]; !ok {
+			courses = append(courses, course)
+		}
+		stems[course] = append(stems[course], services.StemItem{ID: q.ID, Content: q.Content})
+		questions[q.ID] = q
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	result := []models.DuplicateCluster{}
+	for _, course := range courses {
+		for _, ids := range services.DuplicateClusters(stems[course], threshold) {
+			c := models.DuplicateCluster{CourseID: course}
+			for _, id := range ids {
+				c.Questions = append(c.Questions, questions[id])
+			}
+			result = append(result, c)
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,246 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrAttemptNotFinished = errors.New("attempt is not finished yet")
+	ErrEssayNotFound      = errors.New("no written essay response for this question")
+)
+
+// GetGradingQueue returns the essay responses of the teacher's exams that
+// still wait for a grade, oldest submission first. examID 0 means all
+// exams.
+func GetGradingQueue(ctx context.Context, teacherID, examID int64) ([]models.EssayGradingItem, error) {
+	if err := ExpireOverdueAttempts(ctx); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT a.id, a.exam_id, e.title, a.student_id, u.name,
+		       qv.question_id, qv.version, qv.content, COALESCE(aa.response->>'text', ''),
+		       eq.points, a.finished_at
+		FROM attempt_answers aa
+		JOIN exam_attempts a ON a.id = aa.attempt_id
+		JOIN exams e ON e.id = a.exam_id
+		JOIN users u ON u.id = a.student_id
+		JOIN attempt_question_versions av ON av.attempt_id = a.id AND av.question_id = aa.question_id
+		JOIN question_versions qv ON qv.question_id = av.question_id AND qv.version = av.version
+		JOIN exam_questions eq ON eq.exam_id = a.exam_id AND eq.question_id = aa.question_id
+		WHERE e.created_by = $1
+		  AND ($2 = 0 OR a.exam_id = $2)
+		  AND a.status <> 'in_progress'
+		  AND qv.type = 'essay'
+		  AND aa.points_awarded IS NULL
+		ORDER BY a.finished_at, a.id, eq.position
+	`, teacherID, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.EssayGradingItem
+	var versions []int
+	for rows.Next() {
+		var it models.EssayGradingItem
+		var version int
+		if err := rows.Scan(
+			&it.AttemptID,
+			&it.ExamID,
+			&it.ExamTitle,
+			&it.StudentID,
+			&it.StudentName,
+			&it.QuestionID,
+			&version,
+			&it.Content,
+			&it.Response,
+			&it.Points,
+			&it.FinishedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, it)
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// attempts may have been served different versions of one question
+	type pin struct {
+		questionID int64
+		version    int
+	}
+	rubrics := make(map[pin][]models.RubricCriterion)
+	for i := range result {
+		key := pin{result[i].QuestionID, versions[i]}
+		rubric, ok := rubrics[key]
+		if !ok {
+			byQuestion, err := getRubricsByVersions(ctx, map[int64]int{key.questionID: key.version})
+			if err != nil {
+				return nil, err
+			}
+			rubric = byQuestion[key.questionID]
+			rubrics[key] = rubric
+		}
+		result[i].Rubric = rubric
+	}
+
+	return result, nil
+}
+
+// GradeEssay scores an essay response against the rubric of the question
+// version the attempt was served, or re-scores an already graded one. Once
+// the last essay of the attempt is graded the attempt's score is filled in.
+func GradeEssay(
+	ctx context.Context,
+	attemptID, questionID, teacherID int64,
+	picked []models.CriterionScore,
+	feedback string,
+) (*models.ExamAttempt, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var a models.ExamAttempt
+	err = scanAttempt(tx.QueryRow(ctx, `
+		SELECT `+attemptColumns+`
+		FROM exam_attempts a
+		JOIN exams e ON e.id = a.exam_id
+		WHERE a.id = $1 AND e.created_by = $2
+		FOR UPDATE OF a
+	`, attemptID, teacherID), &a)
+	if err != nil {
+		return nil, ErrAttemptNotFound
+	}
+
+	if _, err := finishIfOverdue(ctx, tx, &a); err != nil {
+		return nil, err
+	}
+	if a.Status == "in_progress" {
+		return nil, ErrAttemptNotFinished
+	}
+
+	var qType string
+	var version int
+	var points float64
+	var raw []byte
+	err = tx.QueryRow(ctx, `
+		SELECT qv.type, qv.version, eq.points, aa.response
+		FROM attempt_answers aa
+		JOIN attempt_question_versions av ON av.attempt_id = aa.attempt_id AND av.question_id = aa.question_id
+		JOIN question_versions qv ON qv.question_id = av.question_id AND qv.version = av.version
+		JOIN exam_questions eq ON eq.exam_id = $1 AND eq.question_id = aa.question_id
+		WHERE aa.attempt_id = $2 AND aa.question_id = $3
+	`, a.ExamID, a.ID, questionID).Scan(&qType, &version, &points, &raw)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrEssayNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var resp models.AttemptAnswer
+	if err := decodeAttemptResponse(raw, &resp); err != nil {
+		return nil, err
+	}
+	if !services.IsManuallyGraded(qType) || resp.Text == nil || strings.TrimSpace(*resp.Text) == "" {
+		return nil, ErrEssayNotFound
+	}
+
+	rubrics, err := getRubricsByVersions(ctx, map[int64]int{questionID: version})
+	if err != nil {
+		return nil, err
+	}
+
+	scored, fraction, err := services.ScoreRubric(rubrics[questionID], picked)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		DELETE FROM attempt_rubric_scores WHERE attempt_id = $1 AND question_id = $2
+	`, a.ID, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cs := range scored {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO attempt_rubric_scores
+			(attempt_id, question_id, criterion_id, level_id, score, comment)
+			VALUES ($1,$2,$3,$4,$5,$6)
+		`, a.ID, questionID, cs.CriterionID, cs.LevelID, cs.Score, cs.Comment)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(ctx, `
+		UPDATE attempt_answers
+		SET points_awarded = $1, is_correct = $2, feedback = NULLIF($3, ''),
+		    graded_by = $4, graded_at = $5
+		WHERE attempt_id = $6 AND question_id = $7
+	`, fraction*points, fraction >= 1, feedback, teacherID, now, a.ID, questionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := refreshAttemptScore(ctx, tx, &a); err != nil {
+		return nil, err
+	}
+
+	return &a, tx.Commit(ctx)
+}
+
+// refreshAttemptScore sums the awarded points of a closed attempt once no
+// response is waiting for a grade, and marks the attempt pending otherwise.
+func refreshAttemptScore(ctx context.Context, tx pgx.Tx, a *models.ExamAttempt) error {
+	var pending int
+	var total float64
+	err := tx.QueryRow(ctx, `
+		SELECT COUNT(*) FILTER (WHERE points_awarded IS NULL),
+		       COALESCE(SUM(points_awarded), 0)
+		FROM attempt_answers
+		WHERE attempt_id = $1
+	`, a.ID).Scan(&pending, &total)
+	if err != nil {
+		return err
+	}
+
+	var score *float64
+	status := "pending"
+	if pending == 0 {
+		score = &total
+		status = "graded"
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(ctx, `
+		UPDATE exam_attempts
+		SET score = $1, grading_status = $2, timemodified = $3
+		WHERE id = $4
+	`, score, status, now, a.ID)
+	if err != nil {
+		return err
+	}
+
+	a.Score = score
+	a.GradingStatus = status
+	a.TimeModified = now
+	return nil
+}
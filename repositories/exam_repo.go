@@ -0,0 +1,523 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrExamNotEditable = errors.New("exam not found or not editable")
+
+// ==========================
+// QUESTION BANK
+// ==========================
+func GetBankQuestions(ctx context.Context, courseID, chapterID int64) ([]models.BankQuestion, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT q.id, q.material_id, q.created_by, q.type, q.content,
+		       q.difficulty, q.taxonomy_level, q.status,
+		       q.timecreated, q.timemodified,
+		       m.course_id, m.chapter_id, qb.approved_by, qb.approved_at
+		FROM question_bank qb
+		JOIN questions q ON q.id = qb.question_id
+		JOIN materials m ON m.id = q.material_id
+		WHERE m.course_id = $1
+		  AND ($2 = 0 OR m.chapter_id = $2)
+		  AND q.status = 'approved'
+		ORDER BY m.chapter_id, q.id
+	`, courseID, chapterID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.BankQuestion
+	for rows.Next() {
+		var b models.BankQuestion
+		if err := rows.Scan(
+			&b.ID,
+			&b.MaterialID,
+			&b.CreatedBy,
+			&b.Type,
+			&b.Content,
+			&b.Difficulty,
+			&b.TaxonomyLevel,
+			&b.Status,
+			&b.TimeCreated,
+			&b.TimeModified,
+			&b.CourseID,
+			&b.ChapterID,
+			&b.ApprovedBy,
+			&b.ApprovedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+// ==========================
+// EXAMS
+// ==========================
+func CreateExam(ctx context.Context, e *models.Exam) error {
+	now := time.Now().Unix()
+	e.Status = "draft"
+	e.TimeCreated = now
+	e.TimeModified = now
+
+	return db.Pool.QueryRow(ctx, `
+		INSERT INTO exams
+		(course_id, chapter_id, class_id, title, description, duration_minutes,
+		 shuffle_questions, shuffle_options, status, created_by, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$11)
+		RETURNING id
+	`,
+		e.CourseID,
+		e.ChapterID,
+		e.ClassID,
+		e.Title,
+		e.Description,
+		e.DurationMinutes,
+		e.ShuffleQuestions,
+		e.ShuffleOptions,
+		e.Status,
+		e.CreatedBy,
+		now,
+	).Scan(&e.ID)
+}
+
+const examColumns = `
+	id, course_id, chapter_id, class_id, title, description,
+	duration_minutes, shuffle_questions, shuffle_options,
+	status, created_by, published_at, timecreated, timemodified
+`
+
+func scanExam(row interface{ Scan(...any) error }, e *models.Exam) error {
+	return row.Scan(
+		&e.ID,
+		&e.CourseID,
+		&e.ChapterID,
+		&e.ClassID,
+		&e.Title,
+		&e.Description,
+		&e.DurationMinutes,
+		&e.ShuffleQuestions,
+		&e.ShuffleOptions,
+		&e.Status,
+		&e.CreatedBy,
+		&e.PublishedAt,
+		&e.TimeCreated,
+		&e.TimeModified,
+	)
+}
+
+func GetExamsByTeacher(ctx context.Context, teacherID int64) ([]models.Exam, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+examColumns+`
+		FROM exams
+		WHERE created_by = $1
+		ORDER BY timecreated DESC
+	`, teacherID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.Exam
+	for rows.Next() {
+		var e models.Exam
+		if err := scanExam(rows, &e); err != nil {
+			return nil, err
+		}
+		result = append(result, e)
+	}
+	return result, rows.Err()
+}
+
+func GetExamByID(ctx context.Context, id, teacherID int64) (*models.Exam, error) {
+	var e models.Exam
+	err := scanExam(db.Pool.QueryRow(ctx, `
+		SELECT `+examColumns+`
+		FROM exams
+		WHERE id = $1 AND created_by = $2
+	`, id, teacherID), &e)
+	if err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+func GetExamItems(ctx context.Context, examID int64) ([]models.ExamItem, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT eq.position, eq.points,
+		       q.id, q.material_id, q.created_by, q.type, q.content,
+		       q.difficulty, q.taxonomy_level, q.status, q.version,
+		       q.timecreated, q.timemodified
+		FROM exam_questions eq
+		JOIN questions q ON q.id = eq.question_id
+		WHERE eq.exam_id = $1
+		ORDER BY eq.position
+	`, examID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []models.ExamItem
+	var ids []int64
+	for rows.Next() {
+		var it models.ExamItem
+		if err := rows.Scan(
+			&it.Position,
+			&it.Points,
+			&it.Question.ID,
+			&it.Question.MaterialID,
+			&it.Question.CreatedBy,
+			&it.Question.Type,
+			&it.Question.Content,
+			&it.Question.Difficulty,
+			&it.Question.TaxonomyLevel,
+			&it.Question.Status,
+			&it.Question.Version,
+			&it.Question.TimeCreated,
+			&it.Question.TimeModified,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+		ids = append(ids, it.Question.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	answers, err := getAnswersByQuestionIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Answers = answers[items[i].Question.ID]
+	}
+
+	return items, nil
+}
+
+func UpdateExam(ctx context.Context, e *models.Exam, teacherID int64) error {
+	e.TimeModified = time.Now().Unix()
+
+	res, err := db.Pool.Exec(ctx, `
+		UPDATE exams
+		SET chapter_id=$1, class_id=$2, title=$3, description=$4,
+		    duration_minutes=$5, shuffle_questions=$6, shuffle_options=$7,
+		    timemodified=$8
+		WHERE id=$9 AND created_by=$10 AND status='draft'
+	`,
+		e.ChapterID,
+		e.ClassID,
+		e.Title,
+		e.Description,
+		e.DurationMinutes,
+		e.ShuffleQuestions,
+		e.ShuffleOptions,
+		e.TimeModified,
+		e.ID,
+		teacherID,
+	)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrExamNotEditable
+	}
+
+	return nil
+}
+
+func DeleteExam(ctx context.Context, id, teacherID int64) error {
+	res, err := db.Pool.Exec(ctx, `
+		DELETE FROM exams
+		WHERE id=$1 AND created_by=$2 AND status='draft'
+	`, id, teacherID)
+	if err != nil {
+		return err
+	}
+
+	if res.RowsAffected() == 0 {
+		return ErrExamNotEditable
+	}
+
+	return nil
+}
+
+// SetExamQuestions replaces the items of a draft exam. The order of items
+// is the order in which the questions appear in the exam.
+func SetExamQuestions(ctx context.Context, examID, teacherID int64, items []ExamItemInput) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var courseID int64
+	var chapterID *int64
+	err = tx.QueryRow(ctx, `
+		SELECT course_id, chapter_id
+		FROM exams
+		WHERE id=$1 AND created_by=$2 AND status='draft'
+		FOR UPDATE
+	`, examID, teacherID).Scan(&courseID, &chapterID)
+	if err != nil {
+		return ErrExamNotEditable
+	}
+
+	seen := make(map[int64]bool)
+	for _, it := range items {
+		if seen[it.QuestionID] {
+			return fmt.Errorf("question %d listed more than once", it.QuestionID)
+		}
+		seen[it.QuestionID] = true
+
+		if it.Points <= 0 {
+			return fmt.Errorf("question %d: points must be greater than 0", it.QuestionID)
+		}
+
+		var qCourseID int64
+		var qChapterID *int64 // materials without a chapter
+		err := tx.QueryRow(ctx, `
+			SELECT m.course_id, m.chapter_id
+			FROM question_bank qb
+			JOIN questions q ON q.id = qb.question_id
+			JOIN materials m ON m.id = q.material_id
+			WHERE qb.question_id = $1 AND q.status = 'approved'
+		`, it.QuestionID).Scan(&qCourseID, &qChapterID)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("question %d is not in the question bank", it.QuestionID)
+		}
+		if err != nil {
+			return err
+		}
+
+		if qCourseID != courseID {
+			return fmt.Errorf("question %d belongs to another course", it.QuestionID)
+		}
+		if chapterID != nil && (qChapterID == nil || *qChapterID != *chapterID) {
+			return fmt.Errorf("question %d belongs to another chapter", it.QuestionID)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `DELETE FROM exam_questions WHERE exam_id=$1`, examID)
+	if err != nil {
+		return err
+	}
+
+	for i, it := range items {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO exam_questions (exam_id, question_id, position, points)
+			VALUES ($1,$2,$3,$4)
+		`, examID, it.QuestionID, i+1, it.Points)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE exams SET timemodified=$1 WHERE id=$2
+	`, time.Now().Unix(), examID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+func PublishExam(ctx context.Context, id, teacherID int64) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var exists bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM exams
+			WHERE id=$1 AND created_by=$2 AND status='draft'
+		)
+	`, id, teacherID).Scan(&exists)
+	if err != nil || !exists {
+		return ErrExamNotEditable
+	}
+
+	var count int
+	err = tx.QueryRow(ctx, `
+		SELECT COUNT(*) FROM exam_questions WHERE exam_id=$1
+	`, id).Scan(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return errors.New("exam has no questions")
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(ctx, `
+		UPDATE exams
+		SET status='published', published_at=$1, timemodified=$1
+		WHERE id=$2
+	`, now, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ==========================
+// BLUEPRINT
+// ==========================
+var ErrBlueprintUnsatisfiable = errors.New("question bank cannot satisfy the blueprint")
+
+const bankFilterSQL = `
+	FROM question_bank qb
+	JOIN questions q ON q.id = qb.question_id
+	JOIN materials m ON m.id = q.material_id
+	WHERE m.course_id = $1
+	  AND (cardinality($2::bigint[]) = 0 OR m.chapter_id = ANY($2))
+	  AND (cardinality($3::text[]) = 0 OR upper(q.taxonomy_level) = ANY($3))
+	  AND q.status = 'approved'
+	  AND lower(q.difficulty) = $4
+`
+
+// GenerateExamFromBlueprint samples questions per difficulty cell and creates
+// a draft exam holding them. When any cell cannot be filled no exam is
+// created and the shortages are returned with ErrBlueprintUnsatisfiable.
+func GenerateExamFromBlueprint(
+	ctx context.Context,
+	e *models.Exam,
+	filter BankFilter,
+	cells map[string]int,
+	points float64,
+) ([]models.BlueprintShortage, error) {
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	chapterIDs := filter.ChapterIDs
+	if chapterIDs == nil {
+		chapterIDs = []int64{}
+	}
+	taxonomy := []string{}
+	for _, t := range filter.TaxonomyLevels {
+		taxonomy = append(taxonomy, strings.ToUpper(t))
+	}
+
+	var shortages []models.BlueprintShortage
+	selected := make(map[string][]int64)
+
+	for _, difficulty := range services.Difficulties {
+		required := cells[difficulty]
+		if required == 0 {
+			continue
+		}
+
+		var available int
+		err := tx.QueryRow(ctx, `SELECT COUNT(*) `+bankFilterSQL,
+			filter.CourseID, chapterIDs, taxonomy, difficulty,
+		).Scan(&available)
+		if err != nil {
+			return nil, err
+		}
+
+		if available < required {
+			shortages = append(shortages, models.BlueprintShortage{
+				Difficulty: difficulty,
+				Required:   required,
+				Available:  available,
+				Short:      required - available,
+			})
+			continue
+		}
+
+		rows, err := tx.Query(ctx, `SELECT q.id `+bankFilterSQL+`
+			ORDER BY random()
+			LIMIT $5
+		`, filter.CourseID, chapterIDs, taxonomy, difficulty, required)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			selected[difficulty] = append(selected[difficulty], id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(shortages) > 0 {
+		return shortages, ErrBlueprintUnsatisfiable
+	}
+
+	now := time.Now().Unix()
+	e.Status = "draft"
+	e.TimeCreated = now
+	e.TimeModified = now
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO exams
+		(course_id, chapter_id, class_id, title, description, duration_minutes,
+		 shuffle_questions, shuffle_options, status, created_by, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$11)
+		RETURNING id
+	`,
+		e.CourseID,
+		e.ChapterID,
+		e.ClassID,
+		e.Title,
+		e.Description,
+		e.DurationMinutes,
+		e.ShuffleQuestions,
+		e.ShuffleOptions,
+		e.Status,
+		e.CreatedBy,
+		now,
+	).Scan(&e.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	position := 1
+	for _, difficulty := range services.Difficulties {
+		for _, qID := range selected[difficulty] {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO exam_questions (exam_id, question_id, position, points)
+				VALUES ($1,$2,$3,$4)
+			`, e.ID, qID, position, points)
+			if err != nil {
+				return nil, err
+			}
+			position++
+		}
+	}
+
+	return nil, tx.Commit(ctx)
+}
@@ -0,0 +1,445 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrBatchNotFound = errors.New("generation batch not found")
+	ErrBatchQuestion = errors.New("question is not part of this batch")
+	ErrBatchEmpty    = errors.New("no question in the batch can take this action")
+	ErrBatchAction   = errors.New("action must be submit, approve, reject or request_changes")
+)
+
+var batchActionStatuses = map[string]string{
+	"submit":          services.StatusSubmitted,
+	"approve":         services.StatusApproved,
+	"reject":          services.StatusRejected,
+	"request_changes": services.StatusChangesRequested,
+}
+
+// insertGenerationBatch stores the questions of one generation call under
+// a new batch and reports on every item. Near-duplicates of questions in
+// the course of the question's material, or of earlier questions of the
+// batch, are not saved and are listed in Skipped. Each question is
+// inserted under its own savepoint, so one that the repository refuses is
+// rejected alone while the others are still saved with the batch.
+func insertGenerationBatch(
+	ctx context.Context,
+	tx pgx.Tx,
+	materialID, teacherID int64,
+	qType, instruction string,
+	items []GeneratedInput,
+) (*models.GenerationBatch, error) {
+	b := models.GenerationBatch{
+		MaterialID:   materialID,
+		MaterialIDs:  []int64{},
+		CreatedBy:    teacherID,
+		QuestionType: qType,
+		Instruction:  instruction,
+		TimeCreated:  time.Now().Unix(),
+	}
+	err := tx.QueryRow(ctx, `
+		INSERT INTO generation_batches (material_id, created_by, question_type, instruction, timecreated)
+		VALUES ($1,$2,$3,$4,$5)
+		RETURNING id
+	`, b.MaterialID, b.CreatedBy, b.QuestionType, b.Instruction, b.TimeCreated).Scan(&b.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	// the stems saved so far in this batch count as existing questions
+	// too; a multi-material scope can span courses, so each course has
+	// its own pool
+	pools := make(map[int64][]services.StemItem)
+	courses := make(map[int64]int64)
+	courseOf := func(materialID int64) (int64, error) {
+		if c, ok := courses[materialID]; ok {
+			return c, nil
+		}
+		var c int64
+		err := tx.QueryRow(ctx, `SELECT course_id FROM materials WHERE id = $1`, materialID).Scan(&c)
+		if err != nil {
+			return 0, err
+		}
+		if _, ok := pools[c]; !ok {
+			pool, err := courseStems(ctx, tx, materialID)
+			if err != nil {
+				return 0, err
+			}
+			pools[c] = pool
+		}
+		courses[materialID] = c
+		return c, nil
+	}
+
+	b.Report = make([]models.GenerationItem, 0, len(items))
+	for i, it := range items {
+		item := models.GenerationItem{
+			Index:      i,
+			Status:     "accepted",
+			Content:    it.Content,
+			Repairs:    it.Repairs,
+			MaterialID: it.MaterialID,
+		}
+		// a question of a multi-material scope belongs to the material it
+		// was generated from
+		itemMaterial := materialID
+		if it.MaterialID != 0 {
+			itemMaterial = it.MaterialID
+		}
+		if len(it.Repairs) > 0 {
+			item.Status = "repaired"
+		}
+
+		q := it.Question
+		switch {
+		case q == nil:
+			item.Status = "rejected"
+			item.Reason = it.RejectReason
+
+		default:
+			item.Difficulty = q.Difficulty
+			item.MaterialID = itemMaterial
+			course, err := courseOf(itemMaterial)
+			if errors.Is(err, pgx.ErrNoRows) {
+				item.Status = "rejected"
+				item.Reason = ErrMaterialNotFound.Error()
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			matches := services.SimilarStems(q.Content, pools[course], services.DuplicateThreshold)
+			if len(matches) > 0 {
+				b.Skipped = append(b.Skipped, models.SkippedQuestion{
+					Index:   i,
+					Content: q.Content,
+					Matches: matches,
+				})
+				item.Status = "duplicate"
+				item.Reason = fmt.Sprintf("near-duplicate of question %d", matches[0].QuestionID)
+				break
+			}
+
+			id, err := insertSavepointed(ctx, tx, itemMaterial, teacherID, &b.ID, *q)
+			if err != nil {
+				item.Status = "rejected"
+				item.Reason = err.Error()
+				break
+			}
+			item.QuestionID = &id
+			if !slices.Contains(b.MaterialIDs, itemMaterial) {
+				b.MaterialIDs = append(b.MaterialIDs, itemMaterial)
+			}
+			pools[course] = append(pools[course], services.StemItem{ID: id, Content: q.Content})
+			b.Stats.Total++
+		}
+		b.Report = append(b.Report, item)
+	}
+
+	b.Stats.Draft = b.Stats.Total
+
+	return &b, nil
+}
+
+// insertSavepointed inserts a question under a savepoint of tx, so a
+// failed insert leaves tx usable.
+func insertSavepointed(ctx context.Context, tx pgx.Tx, materialID, teacherID int64, batchID *int64, q QuestionInput) (int64, error) {
+	sp, err := tx.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer sp.Rollback(ctx)
+
+	id, err := insertQuestion(ctx, sp, materialID, teacherID, batchID, q)
+	if err != nil {
+		return 0, err
+	}
+	return id, sp.Commit(ctx)
+}
+
+// batchColumns reads a batch with the materials and review counts of its
+// questions; the query must GROUP BY b.id.
+const batchColumns = `
+	b.id, b.material_id, b.created_by, b.question_type, b.instruction, b.timecreated,
+	COALESCE(array_agg(DISTINCT q.material_id) FILTER (WHERE q.id IS NOT NULL), '{}'),
+	COUNT(q.id),
+	COUNT(q.id) FILTER (WHERE q.status = 'draft'),
+	COUNT(q.id) FILTER (WHERE q.status = 'submitted'),
+	COUNT(q.id) FILTER (WHERE q.status = 'in_review'),
+	COUNT(q.id) FILTER (WHERE q.status = 'changes_requested'),
+	COUNT(q.id) FILTER (WHERE q.status = 'approved'),
+	COUNT(q.id) FILTER (WHERE q.status = 'rejected')
+`
+
+// batchVisible limits batches to the ones the user created or reviews a
+// question of; $1 is the admin flag and $2 the user.
+const batchVisible = `
+	($1 OR b.created_by = $2 OR EXISTS(
+		SELECT 1 FROM questions r WHERE r.batch_id = b.id AND r.reviewer_id = $2
+	))
+`
+
+func scanBatch(row interface{ Scan(...any) error }, b *models.GenerationBatch) error {
+	err := row.Scan(
+		&b.ID,
+		&b.MaterialID,
+		&b.CreatedBy,
+		&b.QuestionType,
+		&b.Instruction,
+		&b.TimeCreated,
+		&b.MaterialIDs,
+		&b.Stats.Total,
+		&b.Stats.Draft,
+		&b.Stats.Submitted,
+		&b.Stats.InReview,
+		&b.Stats.ChangesRequested,
+		&b.Stats.Approved,
+		&b.Stats.Rejected,
+	)
+	if err != nil {
+		return err
+	}
+
+	if decided := b.Stats.Approved + b.Stats.Rejected; decided > 0 {
+		rate := float64(b.Stats.Approved) / float64(decided)
+		b.Stats.AcceptanceRate = &rate
+	}
+	return nil
+}
+
+// GetGenerationBatches lists the batches the user can see, newest first.
+func GetGenerationBatches(ctx context.Context, userID, roleID int64) ([]models.GenerationBatch, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+batchColumns+`
+		FROM generation_batches b
+		LEFT JOIN questions q ON q.batch_id = b.id
+		WHERE `+batchVisible+`
+		GROUP BY b.id
+		ORDER BY b.timecreated DESC, b.id DESC
+	`, roleID == 1, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.GenerationBatch
+	for rows.Next() {
+		var b models.GenerationBatch
+		if err := scanBatch(rows, &b); err != nil {
+			return nil, err
+		}
+		result = append(result, b)
+	}
+	return result, rows.Err()
+}
+
+func getGenerationBatch(ctx context.Context, batchID, userID, roleID int64) (*models.GenerationBatch, error) {
+	var b models.GenerationBatch
+	err := scanBatch(db.Pool.QueryRow(ctx, `
+		SELECT `+batchColumns+`
+		FROM generation_batches b
+		LEFT JOIN questions q ON q.batch_id = b.id
+		WHERE b.id = $3 AND `+batchVisible+`
+		GROUP BY b.id
+	`, roleID == 1, userID, batchID), &b)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrBatchNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &b, nil
+}
+
+// GetGenerationBatch returns a batch with the questions of it the user may
+// see: all of them for the author and admins, the assigned ones for a
+// reviewer.
+func GetGenerationBatch(ctx context.Context, batchID, userID, roleID int64) (*models.GenerationBatchDetail, error) {
+	b, err := getGenerationBatch(ctx, batchID, userID, roleID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, material_id, created_by, type, content,
+		       difficulty, taxonomy_level, status, reviewer_id, batch_id, version,
+		       timecreated, timemodified
+		FROM questions
+		WHERE batch_id = $1 AND ($2 OR created_by = $3 OR reviewer_id = $3)
+		ORDER BY id
+	`, batchID, roleID == 1, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var questions []models.Question
+	var ids []int64
+	for rows.Next() {
+		var q models.Question
+		if err := rows.Scan(
+			&q.ID,
+			&q.MaterialID,
+			&q.CreatedBy,
+			&q.Type,
+			&q.Content,
+			&q.Difficulty,
+			&q.TaxonomyLevel,
+			&q.Status,
+			&q.ReviewerID,
+			&q.BatchID,
+			&q.Version,
+			&q.TimeCreated,
+			&q.TimeModified,
+		); err != nil {
+			return nil, err
+		}
+		questions = append(questions, q)
+		ids = append(ids, q.ID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	answers, err := getAnswersByQuestionIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	detail := &models.GenerationBatchDetail{Batch: *b}
+	for _, q := range questions {
+		detail.Questions = append(detail.Questions, models.QuestionWithAnswers{
+			Question: q,
+			Answers:  answers[q.ID],
+		})
+	}
+	return detail, nil
+}
+
+// ReviewGenerationBatch applies one review action to the selected
+// questions of a batch, or to every question of it that can take the
+// action when questionIDs is empty. Decisions on submitted questions start
+// their review first. It runs in a single transaction: if any question
+// fails, nothing is changed. It returns the moved question ids and, for a
+// decision on the whole batch, the caller's own questions it left alone,
+// since nobody reviews their own question.
+func ReviewGenerationBatch(
+	ctx context.Context,
+	batchID, userID, roleID int64,
+	action string,
+	questionIDs []int64,
+	reason string,
+) ([]int64, []int64, error) {
+	status, ok := batchActionStatuses[action]
+	if !ok {
+		return nil, nil, ErrBatchAction
+	}
+
+	if _, err := getGenerationBatch(ctx, batchID, userID, roleID); err != nil {
+		return nil, nil, err
+	}
+
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	decision := status != services.StatusSubmitted
+	sources := []string{services.StatusSubmitted, services.StatusInReview}
+	if !decision {
+		sources = []string{services.StatusDraft, services.StatusChangesRequested}
+	}
+
+	var ids, skipped []int64
+	if len(questionIDs) == 0 {
+		rows, err := tx.Query(ctx, `
+			SELECT id, created_by = $4 FROM questions
+			WHERE batch_id = $1 AND status = ANY($2)
+			  AND ($3 OR created_by = $4 OR reviewer_id = $4)
+			ORDER BY id
+		`, batchID, sources, roleID == 1, userID)
+		if err != nil {
+			return nil, nil, err
+		}
+		for rows.Next() {
+			var id int64
+			var own bool
+			if err := rows.Scan(&id, &own); err != nil {
+				rows.Close()
+				return nil, nil, err
+			}
+			if decision && own {
+				skipped = append(skipped, id)
+				continue
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, nil, err
+		}
+		if len(ids) == 0 && len(skipped) > 0 {
+			return nil, nil, services.ErrSelfReview
+		}
+		if len(ids) == 0 {
+			return nil, nil, ErrBatchEmpty
+		}
+	} else {
+		seen := make(map[int64]bool)
+		for _, id := range questionIDs {
+			if !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+		// a fixed lock order keeps concurrent batch reviews from deadlocking
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+		var n int
+		err := tx.QueryRow(ctx, `
+			SELECT COUNT(*) FROM questions WHERE batch_id = $1 AND id = ANY($2)
+		`, batchID, ids).Scan(&n)
+		if err != nil {
+			return nil, nil, err
+		}
+		if n != len(ids) {
+			return nil, nil, ErrBatchQuestion
+		}
+	}
+
+	for _, id := range ids {
+		if decision {
+			var current string
+			err := tx.QueryRow(ctx, `SELECT status FROM questions WHERE id = $1`, id).Scan(&current)
+			if err != nil {
+				return nil, nil, err
+			}
+			if current == services.StatusSubmitted {
+				if err := applyReviewStep(ctx, tx, id, userID, roleID, services.StatusInReview, ""); err != nil {
+					return nil, nil, fmt.Errorf("question %d: %w", id, err)
+				}
+			}
+		}
+
+		if err := applyReviewStep(ctx, tx, id, userID, roleID, status, reason); err != nil {
+			return nil, nil, fmt.Errorf("question %d: %w", id, err)
+		}
+	}
+
+	return ids, skipped, tx.Commit(ctx)
+}
@@ -0,0 +1,542 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrGenerationJobNotFound = errors.New("generation job not found")
+	ErrEmptyGenerationScope  = errors.New("no material in the generation scope")
+)
+
+const generationJobColumns = `
+	j.id, j.created_by, j.material_id, j.question_type, j.instruction,
+	j.preset_id, j.preset_version, j.template_id, j.template_version,
+	j.prompt_template, j.taxonomy_levels, j.option_count, j.difficulty,
+	j.question_count, j.difficulty_counts, j.language, j.material_ids, j.chapter_id, j.tag_ids,
+	j.allocations, j.model, j.prompt_tokens, j.completion_tokens, j.cost_usd, j.status, j.attempts, j.error, j.batch_id,
+	COALESCE((SELECT array_agg(q.id ORDER BY q.id) FROM questions q WHERE q.batch_id = j.batch_id), '{}'),
+	j.skipped, j.report, j.summary, j.started_at, j.finished_at, j.timecreated, j.timemodified
+`
+
+func scanGenerationJob(row interface{ Scan(...any) error }, j *models.GenerationJob) error {
+	var skipped, report, counts, allocations, summary []byte
+	err := row.Scan(
+		&j.ID,
+		&j.CreatedBy,
+		&j.MaterialID,
+		&j.QuestionType,
+		&j.Instruction,
+		&j.PresetID,
+		&j.PresetVersion,
+		&j.TemplateID,
+		&j.TemplateVersion,
+		&j.PromptTemplate,
+		&j.TaxonomyLevels,
+		&j.OptionCount,
+		&j.Difficulty,
+		&j.Count,
+		&counts,
+		&j.Language,
+		&j.MaterialIDs,
+		&j.ChapterID,
+		&j.TagIDs,
+		&allocations,
+		&j.Usage.Model,
+		&j.Usage.PromptTokens,
+		&j.Usage.CompletionTokens,
+		&j.Usage.CostUSD,
+		&j.Status,
+		&j.Attempts,
+		&j.Error,
+		&j.BatchID,
+		&j.QuestionIDs,
+		&skipped,
+		&report,
+		&summary,
+		&j.StartedAt,
+		&j.FinishedAt,
+		&j.TimeCreated,
+		&j.TimeModified,
+	)
+	if err != nil {
+		return err
+	}
+	if err := json.Unmarshal(skipped, &j.Skipped); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(counts, &j.DifficultyCounts); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(allocations, &j.Allocations); err != nil {
+		return err
+	}
+	if summary != nil {
+		if err := json.Unmarshal(summary, &j.Summary); err != nil {
+			return err
+		}
+	}
+	return json.Unmarshal(report, &j.Report)
+}
+
+// ResolveGenerationMaterials returns the material set of a generation
+// scope: the given materials, then the materials of the chapter that
+// carry any of the tags. Every given material must exist.
+func ResolveGenerationMaterials(ctx context.Context, materialIDs []int64, chapterID *int64, tagIDs []int64) ([]int64, error) {
+	if materialIDs == nil {
+		materialIDs = []int64{}
+	}
+	if tagIDs == nil {
+		tagIDs = []int64{}
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT m.id
+		FROM materials m
+		WHERE m.id = ANY($1)
+		   OR (($2::bigint IS NOT NULL OR cardinality($3::bigint[]) > 0)
+		       AND ($2::bigint IS NULL OR m.chapter_id = $2)
+		       AND (cardinality($3::bigint[]) = 0 OR EXISTS (
+		           SELECT 1 FROM material_tags mt
+		           WHERE mt.material_id = m.id AND mt.tag_id = ANY($3)
+		       )))
+		ORDER BY m.id
+	`, materialIDs, chapterID, tagIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	found := make(map[int64]bool)
+	var scoped []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		found[id] = true
+		scoped = append(scoped, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the given materials first, in the order given
+	result := []int64{}
+	seen := make(map[int64]bool)
+	for _, id := range materialIDs {
+		if !found[id] {
+			return nil, fmt.Errorf("%w: %d", ErrMaterialNotFound, id)
+		}
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	for _, id := range scoped {
+		if !seen[id] {
+			seen[id] = true
+			result = append(result, id)
+		}
+	}
+	if len(result) == 0 {
+		return nil, ErrEmptyGenerationScope
+	}
+	return result, nil
+}
+
+// CreateGenerationJob queues a generation call for the worker pool. The
+// scope is resolved to its material set, a count is distributed over it,
+// and the preset and template are resolved to their current versions
+// here; all are pinned on the job. A request over the user's quota fails
+// with a QuotaExceededError; one within it counts toward the user's usage
+// of the course.
+func CreateGenerationJob(ctx context.Context, teacherID int64, in GenerationJobInput) (*models.GenerationJob, error) {
+	var given []int64
+	if in.MaterialID != 0 {
+		given = append(given, in.MaterialID)
+	}
+	materialIDs, err := ResolveGenerationMaterials(ctx, append(given, in.MaterialIDs...), in.ChapterID, in.TagIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	tagIDs := in.TagIDs
+	if tagIDs == nil {
+		tagIDs = []int64{}
+	}
+	now := time.Now().Unix()
+	j := models.GenerationJob{
+		CreatedBy:        teacherID,
+		MaterialID:       materialIDs[0],
+		QuestionType:     in.QuestionType,
+		Instruction:      in.Instruction,
+		TemplateID:       in.TemplateID,
+		TaxonomyLevels:   []string{},
+		Count:            in.Spec.Count,
+		DifficultyCounts: in.Spec.DifficultyCounts,
+		Language:         in.Spec.Language,
+		MaterialIDs:      materialIDs,
+		ChapterID:        in.ChapterID,
+		TagIDs:           tagIDs,
+		Status:           "queued",
+		QuestionIDs:      []int64{},
+		Skipped:          []models.SkippedQuestion{},
+		Report:           []models.GenerationItem{},
+		TimeCreated:      now,
+		TimeModified:     now,
+	}
+	if j.DifficultyCounts == nil {
+		j.DifficultyCounts = map[string]int{}
+	}
+	if j.Language == "" {
+		j.Language = "id"
+	}
+
+	if in.PresetID != nil {
+		p, err := GetGenerationPreset(ctx, *in.PresetID)
+		if err != nil {
+			return nil, err
+		}
+		j.PresetID = &p.ID
+		j.PresetVersion = &p.Version
+		j.TaxonomyLevels = p.TaxonomyLevels
+		j.OptionCount = p.OptionCount
+		j.Difficulty = p.Difficulty
+		if j.TemplateID == nil {
+			j.TemplateID = p.TemplateID
+		}
+	}
+
+	if j.TemplateID != nil {
+		t, err := GetPromptTemplate(ctx, *j.TemplateID)
+		if err != nil {
+			return nil, err
+		}
+		j.TemplateVersion = &t.Version
+		j.PromptTemplate = t.Body
+	}
+
+	if len(in.TaxonomyLevels) > 0 {
+		j.TaxonomyLevels = in.TaxonomyLevels
+	}
+	if in.OptionCount != nil {
+		j.OptionCount = in.OptionCount
+	}
+	if len(j.DifficultyCounts) > 0 {
+		j.Difficulty = ""
+	}
+
+	j.Allocations = services.DistributeGeneration(j.Count, j.DifficultyCounts, j.MaterialIDs)
+	if j.Allocations == nil {
+		j.Allocations = []models.GenerationShare{}
+	}
+
+	counts, err := json.Marshal(j.DifficultyCounts)
+	if err != nil {
+		return nil, err
+	}
+	allocations, err := json.Marshal(j.Allocations)
+	if err != nil {
+		return nil, err
+	}
+	// the quota check, the job and the request it counts are one step, so
+	// parallel requests cannot slip past the quota together
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkGenerationQuota(ctx, tx, teacherID, j.Count); err != nil {
+		return nil, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO generation_jobs
+		(created_by, material_id, question_type, instruction,
+		 preset_id, preset_version, template_id, template_version,
+		 prompt_template, taxonomy_levels, option_count, difficulty,
+		 question_count, difficulty_counts, language, material_ids, chapter_id, tag_ids,
+		 allocations, status, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18,$19,'queued',$20,$20)
+		RETURNING id
+	`,
+		teacherID, j.MaterialID, j.QuestionType, j.Instruction,
+		j.PresetID, j.PresetVersion, j.TemplateID, j.TemplateVersion,
+		j.PromptTemplate, j.TaxonomyLevels, j.OptionCount, j.Difficulty,
+		j.Count, counts, j.Language, j.MaterialIDs, j.ChapterID, j.TagIDs,
+		allocations, now,
+	).Scan(&j.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	var courseID int64
+	err = tx.QueryRow(ctx, `SELECT course_id FROM materials WHERE id = $1`, j.MaterialID).Scan(&courseID)
+	if err != nil {
+		return nil, err
+	}
+	if err := addGenerationUsage(ctx, tx, teacherID, courseID, 1, 0, models.TokenUsage{}); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// GetGenerationJob returns a job of the user, or any job for an admin.
+func GetGenerationJob(ctx context.Context, jobID, userID, roleID int64) (*models.GenerationJob, error) {
+	var j models.GenerationJob
+	err := scanGenerationJob(db.Pool.QueryRow(ctx, `
+		SELECT `+generationJobColumns+`
+		FROM generation_jobs j
+		WHERE j.id = $1 AND ($2 OR j.created_by = $3)
+	`, jobID, roleID == 1, userID), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGenerationJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// GetGenerationJobs lists the user's jobs, newest first.
+func GetGenerationJobs(ctx context.Context, userID int64) ([]models.GenerationJob, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+generationJobColumns+`
+		FROM generation_jobs j
+		WHERE j.created_by = $1
+		ORDER BY j.id DESC
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.GenerationJob
+	for rows.Next() {
+		var j models.GenerationJob
+		if err := scanGenerationJob(rows, &j); err != nil {
+			return nil, err
+		}
+		result = append(result, j)
+	}
+	return result, rows.Err()
+}
+
+// ClaimGenerationJob marks the oldest queued job as running and returns
+// it, or nil when the queue is empty. SKIP LOCKED lets several workers
+// claim at the same time without taking the same job.
+func ClaimGenerationJob(ctx context.Context) (*models.GenerationJob, error) {
+	now := time.Now().Unix()
+	var j models.GenerationJob
+	err := scanGenerationJob(db.Pool.QueryRow(ctx, `
+		WITH next AS (
+			SELECT id FROM generation_jobs
+			WHERE status = 'queued'
+			ORDER BY id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE generation_jobs j
+		SET status = 'running', attempts = j.attempts + 1,
+		    started_at = $1, timemodified = $1
+		FROM next
+		WHERE j.id = next.id
+		RETURNING `+generationJobColumns+`
+	`, now), &j)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &j, nil
+}
+
+// CompleteGenerationJob saves the accepted generated questions as the
+// job's batch and marks the job succeeded with the per-item report and
+// its summary in one transaction, so a restart never saves a job's
+// questions twice. The summary is also set on job. The tokens used and
+// the questions saved are added to the usage of each material's course.
+func CompleteGenerationJob(ctx context.Context, job *models.GenerationJob, out GenerationOutcome) (*models.GenerationBatch, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var status string
+	err = tx.QueryRow(ctx, `
+		SELECT status FROM generation_jobs WHERE id = $1 FOR UPDATE
+	`, job.ID).Scan(&status)
+	if err != nil {
+		return nil, err
+	}
+	if status != "running" {
+		return nil, errors.New("generation job is no longer running")
+	}
+
+	batch, err := insertGenerationBatch(ctx, tx, job.MaterialID, job.CreatedBy, job.QuestionType, job.Instruction, out.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := batch.Skipped
+	if skipped == nil {
+		skipped = []models.SkippedQuestion{}
+	}
+	raw, err := json.Marshal(skipped)
+	if err != nil {
+		return nil, err
+	}
+	report, err := json.Marshal(batch.Report)
+	if err != nil {
+		return nil, err
+	}
+	summary := services.SummarizeGeneration(job, batch.Report, out.Failures)
+	rawSummary, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+
+	var usage models.TokenUsage
+	for _, u := range out.Usage {
+		usage.Add(u)
+	}
+
+	now := time.Now().Unix()
+	_, err = tx.Exec(ctx, `
+		UPDATE generation_jobs
+		SET status = 'succeeded', error = '', batch_id = $1, skipped = $2, report = $3,
+		    summary = $4, model = $5, prompt_tokens = $6, completion_tokens = $7, cost_usd = $8,
+		    finished_at = $9, timemodified = $9
+		WHERE id = $10
+	`, batch.ID, raw, report, rawSummary,
+		usage.Model, usage.PromptTokens, usage.CompletionTokens, usage.CostUSD,
+		now, job.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := addJobUsage(ctx, tx, job, batch.Report, out.Usage); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	job.Summary = &summary
+	job.Usage = usage
+	return batch, nil
+}
+
+// addJobUsage adds the questions a job saved and the tokens it used to
+// the usage of the course of each material involved. Items and tokens
+// without a material, or of a material deleted meanwhile, count for the
+// job's material.
+func addJobUsage(ctx context.Context, tx pgx.Tx, job *models.GenerationJob, report []models.GenerationItem, usage map[int64]models.TokenUsage) error {
+	ids := []int64{job.MaterialID}
+	for _, it := range report {
+		ids = append(ids, it.MaterialID)
+	}
+	for id := range usage {
+		ids = append(ids, id)
+	}
+	courses, err := materialCourses(ctx, tx, ids)
+	if err != nil {
+		return err
+	}
+	courseOf := func(materialID int64) int64 {
+		if c, ok := courses[materialID]; ok {
+			return c
+		}
+		return courses[job.MaterialID]
+	}
+
+	type courseUsage struct {
+		questions int
+		tokens    models.TokenUsage
+	}
+	perCourse := make(map[int64]*courseUsage)
+	of := func(courseID int64) *courseUsage {
+		if perCourse[courseID] == nil {
+			perCourse[courseID] = &courseUsage{}
+		}
+		return perCourse[courseID]
+	}
+	for _, it := range report {
+		if it.QuestionID != nil {
+			of(courseOf(it.MaterialID)).questions++
+		}
+	}
+	for id, u := range usage {
+		of(courseOf(id)).tokens.Add(u)
+	}
+
+	for courseID, u := range perCourse {
+		if courseID == 0 {
+			continue
+		}
+		if err := addGenerationUsage(ctx, tx, job.CreatedBy, courseID, 0, u.questions, u.tokens); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FailGenerationJob marks a running job failed with the reason.
+func FailGenerationJob(ctx context.Context, jobID int64, reason string) error {
+	now := time.Now().Unix()
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE generation_jobs
+		SET status = 'failed', error = $1, finished_at = $2, timemodified = $2
+		WHERE id = $3 AND status = 'running'
+	`, reason, now, jobID)
+	return err
+}
+
+// RequeueAbandonedGenerationJobs puts the running jobs whose server died
+// back in the queue. A job is abandoned once it has run longer than lease
+// per generator call it makes, one per material share. A job that has
+// already been started maxAttempts times is failed instead, so a job that
+// brings the server down cannot do it forever.
+func RequeueAbandonedGenerationJobs(ctx context.Context, maxAttempts int, lease time.Duration) error {
+	now := time.Now().Unix()
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE generation_jobs
+		SET status = CASE WHEN attempts >= $1 THEN 'failed' ELSE 'queued' END,
+		    error = CASE WHEN attempts >= $1 THEN 'interrupted too many times' ELSE error END,
+		    finished_at = CASE WHEN attempts >= $1 THEN $2 ELSE NULL END,
+		    timemodified = $2
+		WHERE status = 'running'
+		  AND started_at < $2 - $3 * GREATEST(jsonb_array_length(allocations), 1)
+	`, maxAttempts, now, int64(lease.Seconds()))
+	return err
+}
+
+// ReleaseGenerationJob puts a running job its worker stopped back in the
+// queue without counting the attempt.
+func ReleaseGenerationJob(ctx context.Context, jobID int64) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE generation_jobs
+		SET status = 'queued', attempts = GREATEST(attempts - 1, 0),
+		    started_at = NULL, timemodified = $1
+		WHERE id = $2 AND status = 'running'
+	`, time.Now().Unix(), jobID)
+	return err
+}
@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrGenerationQuotaNotFound = errors.New("generation quota not found")
+	ErrQuotaTargetNotFound     = errors.New("role or user not found")
+	ErrGenerationCountRequired = errors.New("count is required while a questions_per_month quota applies")
+)
+
+// QuotaExceededError is returned when a generation request would go over
+// the user's quota. Limit is requests_per_day or questions_per_month.
+type QuotaExceededError struct {
+	Limit string
+	Max   int
+	Used  int
+}
+
+func (e *QuotaExceededError) Error() string {
+	return fmt.Sprintf("generation quota exceeded: %s is %d, %d used", e.Limit, e.Max, e.Used)
+}
+
+func usageMonth(t time.Time) string {
+	return t.Format("2006-01")
+}
+
+const generationQuotaColumns = `
+	id, role_id, user_id, requests_per_day, questions_per_month, timemodified
+`
+
+func scanGenerationQuota(row interface{ Scan(...any) error }, q *models.GenerationQuota) error {
+	return row.Scan(
+		&q.ID,
+		&q.RoleID,
+		&q.UserID,
+		&q.RequestsPerDay,
+		&q.QuestionsPerMonth,
+		&q.TimeModified,
+	)
+}
+
+// effectiveQuota returns the user's own quota, else the quota of their
+// role, or nil when neither is set.
+func effectiveQuota(ctx context.Context, q querier, userID int64) (*models.GenerationQuota, error) {
+	rows, err := q.Query(ctx, `
+		SELECT `+generationQuotaColumns+`
+		FROM generation_quotas
+		WHERE user_id = $1
+		   OR role_id = (SELECT role_id FROM users WHERE id = $1)
+		ORDER BY user_id NULLS LAST
+		LIMIT 1
+	`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		return nil, rows.Err()
+	}
+	var quota models.GenerationQuota
+	if err := scanGenerationQuota(rows, &quota); err != nil {
+		return nil, err
+	}
+	return &quota, nil
+}
+
+// generationAllowance reads the user's quota and what they used of it.
+func generationAllowance(ctx context.Context, q querier, userID int64) (*models.GenerationAllowance, error) {
+	quota, err := effectiveQuota(ctx, q, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	startOfDay := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	a := models.GenerationAllowance{Quota: quota}
+	err = q.QueryRow(ctx, `
+		SELECT
+			(SELECT COUNT(*) FROM generation_jobs
+			 WHERE created_by = $1 AND timecreated >= $2),
+			(SELECT COALESCE(SUM(questions), 0) FROM generation_usage
+			 WHERE user_id = $1 AND month = $3)
+			+ (SELECT COALESCE(SUM(GREATEST(question_count, 1)), 0) FROM generation_jobs
+			   WHERE created_by = $1 AND status IN ('queued', 'running'))
+	`, userID, startOfDay.Unix(), usageMonth(now)).Scan(&a.RequestsToday, &a.QuestionsUsed)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// GetGenerationAllowance returns the user's quota and their usage of it.
+func GetGenerationAllowance(ctx context.Context, userID int64) (*models.GenerationAllowance, error) {
+	return generationAllowance(ctx, db.Pool, userID)
+}
+
+// checkGenerationQuota fails with a QuotaExceededError when one more
+// request asking for the given number of questions goes over the user's
+// quota. Under a questions_per_month quota the request must give a count,
+// since nothing else bounds how many questions a free-text instruction
+// yields. The user's row stays locked until tx ends, so concurrent
+// requests of the user are checked one after the other.
+func checkGenerationQuota(ctx context.Context, tx pgx.Tx, userID int64, questions int) error {
+	if _, err := tx.Exec(ctx, `SELECT 1 FROM users WHERE id = $1 FOR UPDATE`, userID); err != nil {
+		return err
+	}
+
+	a, err := generationAllowance(ctx, tx, userID)
+	if err != nil {
+		return err
+	}
+	if a.Quota == nil {
+		return nil
+	}
+	if limit := a.Quota.RequestsPerDay; limit != nil && a.RequestsToday+1 > *limit {
+		return &QuotaExceededError{Limit: "requests_per_day", Max: *limit, Used: a.RequestsToday}
+	}
+	if a.Quota.QuestionsPerMonth != nil && questions == 0 {
+		return ErrGenerationCountRequired
+	}
+	if limit := a.Quota.QuestionsPerMonth; limit != nil && a.QuestionsUsed+questions > *limit {
+		return &QuotaExceededError{Limit: "questions_per_month", Max: *limit, Used: a.QuestionsUsed}
+	}
+	return nil
+}
+
+// addGenerationUsage adds to the user's usage of the course this month.
+func addGenerationUsage(ctx context.Context, tx pgx.Tx, userID, courseID int64, requests, questions int, usage models.TokenUsage) error {
+	now := time.Now()
+	_, err := tx.Exec(ctx, `
+		INSERT INTO generation_usage
+		(user_id, course_id, month, requests, questions, prompt_tokens, completion_tokens, cost_usd, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9)
+		ON CONFLICT (user_id, course_id, month) DO UPDATE
+		SET requests = generation_usage.requests + EXCLUDED.requests,
+		    questions = generation_usage.questions + EXCLUDED.questions,
+		    prompt_tokens = generation_usage.prompt_tokens + EXCLUDED.prompt_tokens,
+		    completion_tokens = generation_usage.completion_tokens + EXCLUDED.completion_tokens,
+		    cost_usd = generation_usage.cost_usd + EXCLUDED.cost_usd,
+		    timemodified = EXCLUDED.timemodified
+	`, userID, courseID, usageMonth(now), requests, questions,
+		usage.PromptTokens, usage.CompletionTokens, usage.CostUSD, now.Unix())
+	return err
+}
+
+// materialCourses maps the materials to their course.
+func materialCourses(ctx context.Context, q querier, materialIDs []int64) (map[int64]int64, error) {
+	rows, err := q.Query(ctx, `
+		SELECT id, course_id FROM materials WHERE id = ANY($1)
+	`, materialIDs)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := make(map[int64]int64)
+	for rows.Next() {
+		var id, course int64
+		if err := rows.Scan(&id, &course); err != nil {
+			return nil, err
+		}
+		result[id] = course
+	}
+	return result, rows.Err()
+}
+
+// GenerationUsageFilter narrows the usage report; zero values match all.
+type GenerationUsageFilter struct {
+	Month    string
+	UserID   int64
+	CourseID int64
+}
+
+// GetGenerationUsage lists the usage per user, course and month, newest
+// month first.
+func GetGenerationUsage(ctx context.Context, f GenerationUsageFilter) ([]models.GenerationUsage, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT g.user_id, u.name, g.course_id, c.name, g.month,
+		       g.requests, g.questions, g.prompt_tokens, g.completion_tokens, g.cost_usd
+		FROM generation_usage g
+		JOIN users u ON u.id = g.user_id
+		JOIN courses c ON c.id = g.course_id
+		WHERE ($1::text = '' OR g.month = $1)
+		  AND ($2::bigint = 0 OR g.user_id = $2)
+		  AND ($3::bigint = 0 OR g.course_id = $3)
+		ORDER BY g.month DESC, g.cost_usd DESC, g.user_id, g.course_id
+	`, f.Month, f.UserID, f.CourseID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.GenerationUsage{}
+	for rows.Next() {
+		var u models.GenerationUsage
+		if err := rows.Scan(
+			&u.UserID,
+			&u.UserName,
+			&u.CourseID,
+			&u.CourseName,
+			&u.Month,
+			&u.Requests,
+			&u.Questions,
+			&u.PromptTokens,
+			&u.CompletionTokens,
+			&u.CostUSD,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, u)
+	}
+	return result, rows.Err()
+}
+
+func GetGenerationQuotas(ctx context.Context) ([]models.GenerationQuota, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+generationQuotaColumns+`
+		FROM generation_quotas
+		ORDER BY role_id NULLS LAST, user_id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.GenerationQuota{}
+	for rows.Next() {
+		var q models.GenerationQuota
+		if err := scanGenerationQuota(rows, &q); err != nil {
+			return nil, err
+		}
+		result = append(result, q)
+	}
+	return result, rows.Err()
+}
+
+// SetGenerationQuota creates or replaces the quota of q's role or user.
+func SetGenerationQuota(ctx context.Context, q *models.GenerationQuota) error {
+	target, table, id := "role_id", "roles", q.RoleID
+	if q.UserID != nil {
+		target, table, id = "user_id", "users", q.UserID
+	}
+
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `SELECT EXISTS(SELECT 1 FROM `+table+` WHERE id = $1)`, id).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrQuotaTargetNotFound
+	}
+
+	return scanGenerationQuota(db.Pool.QueryRow(ctx, `
+		INSERT INTO generation_quotas (role_id, user_id, requests_per_day, questions_per_month, timemodified)
+		VALUES ($1,$2,$3,$4,$5)
+		ON CONFLICT (`+target+`) WHERE `+target+` IS NOT NULL DO UPDATE
+		SET requests_per_day = EXCLUDED.requests_per_day,
+		    questions_per_month = EXCLUDED.questions_per_month,
+		    timemodified = EXCLUDED.timemodified
+		RETURNING `+generationQuotaColumns+`
+	`, q.RoleID, q.UserID, q.RequestsPerDay, q.QuestionsPerMonth, time.Now().Unix()), q)
+}
+
+func DeleteGenerationQuota(ctx context.Context, id int64) error {
+	cmd, err := db.Pool.Exec(ctx, `DELETE FROM generation_quotas WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrGenerationQuotaNotFound
+	}
+	return nil
+}
@@ -0,0 +1,151 @@
+package repositories
+
+import (
+	"context"
+
+	"backendLMS/db"
+	"backendLMS/services"
+)
+
+// finishedResponsesSQL yields one row per finished and fully graded
+// attempt and exam item, including items the student left unanswered.
+const finishedResponsesSQL = `
+	SELECT eq.question_id, eq.points, a.exam_id, a.score, a.max_score,
+	       aa.answer_id, aa.response, COALESCE(aa.points_awarded, 0)
+	FROM exam_attempts a
+	JOIN exam_questions eq ON eq.exam_id = a.exam_id
+	LEFT JOIN attempt_answers aa
+	       ON aa.attempt_id = a.id AND aa.question_id = eq.question_id
+	WHERE a.status IN ('submitted', 'expired')
+	  AND a.grading_status = 'graded'
+`
+
+type responseRow struct {
+	questionID int64
+	examID     int64
+	response   services.ItemResponse
+}
+
+func queryItemResponses(ctx context.Context, filter string, args ...interface{}) ([]responseRow, error) {
+	rows, err := db.Pool.Query(ctx, finishedResponsesSQL+filter, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []responseRow
+	for rows.Next() {
+		var row responseRow
+		var points, awarded float64
+		var score, maxScore *float64
+		var raw []byte
+		if err := rows.Scan(
+			&row.questionID,
+			&points,
+			&row.examID,
+			&score,
+			&maxScore,
+			&row.response.Answer.AnswerID,
+			&raw,
+			&awarded,
+		); err != nil {
+			return nil, err
+		}
+		if err := decodeAttemptResponse(raw, &row.response.Answer); err != nil {
+			return nil, err
+		}
+
+		if points > 0 {
+			row.response.Score = awarded / points
+		}
+		if score != nil && maxScore != nil && *maxScore > 0 {
+			row.response.Total = *score / *maxScore
+		}
+		result = append(result, row)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// answer ids belong to the version the attempt was served, which may
+	// no longer be the question's current one
+	var ids []int64
+	for _, row := range result {
+		ids = append(ids, services.SelectedAnswerIDs(row.response.Answer)...)
+	}
+	labels, err := answerLabels(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for i := range result {
+		for _, id := range services.SelectedAnswerIDs(result[i].response.Answer) {
+			if l, ok := labels[id]; ok {
+				result[i].response.Labels = append(result[i].response.Labels, l)
+			}
+		}
+	}
+	return result, nil
+}
+
+// answerLabels maps answer ids of any version to their option label.
+func answerLabels(ctx context.Context, ids []int64) (map[int64]string, error) {
+	result := make(map[int64]string)
+	if len(ids) == 0 {
+		return result, nil
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, option_label FROM answers WHERE id = ANY($1)
+	`, ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int64
+		var label string
+		if err := rows.Scan(&id, &label); err != nil {
+			return nil, err
+		}
+		result[id] = label
+	}
+	return result, rows.Err()
+}
+
+// GetExamItemResponses returns the finished responses of an exam grouped
+// by question.
+func GetExamItemResponses(ctx context.Context, examID int64) (map[int64][]services.ItemResponse, error) {
+	rows, err := queryItemResponses(ctx, `AND a.exam_id = $1`, examID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[int64][]services.ItemResponse)
+	for _, row := range rows {
+		result[row.questionID] = append(result[row.questionID], row.response)
+	}
+	return result, nil
+}
+
+// GetQuestionItemResponses returns the finished responses to a question
+// and the number of exams they come from. A non-zero examOwner limits them
+// to the exams that user created; otherwise every exam counts.
+func GetQuestionItemResponses(ctx context.Context, questionID, examOwner int64) ([]services.ItemResponse, int, error) {
+	rows, err := queryItemResponses(ctx, `
+		AND eq.question_id = $1
+		AND ($2 = 0 OR a.exam_id IN (SELECT id FROM exams WHERE created_by = $2))
+	`, questionID, examOwner)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	exams := make(map[int64]bool)
+	var result []services.ItemResponse
+	for _, row := range rows {
+		exams[row.examID] = true
+		result = append(result, row.response)
+	}
+	return result, len(exams), nil
+}
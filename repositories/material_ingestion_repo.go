@@ -0,0 +1,289 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrMaterialNotFound = errors.New("material not found")
+	ErrIngestionRunning = errors.New("material is being ingested right now")
+	ErrPurgeNotFailed   = errors.New("vector purge not found or not failed")
+)
+
+// ClaimMaterialIngestion marks the pending material that is due longest
+// as processing and returns it, or nil when none is due.
+func ClaimMaterialIngestion(ctx context.Context) (*models.Material, error) {
+	now := time.Now().Unix()
+	var m models.Material
+	var ing models.MaterialIngestion
+	err := db.Pool.QueryRow(ctx, `
+		WITH next AS (
+			SELECT id FROM materials
+			WHERE ingest_status = 'pending'
+			  AND (ingest_next_at IS NULL OR ingest_next_at <= $1)
+			ORDER BY ingest_next_at NULLS FIRST, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE materials m
+		SET ingest_status = 'processing', ingest_attempts = m.ingest_attempts + 1,
+		    ingest_next_at = NULL, ingest_updated_at = $1
+		FROM next
+		WHERE m.id = next.id
+		RETURNING m.id, m.teacher_id, m.course_id, m.chapter_id, m.title, m.file_url,
+		          m.ingest_status, m.ingest_action, m.ingest_attempts
+	`, now).Scan(
+		&m.ID,
+		&m.TeacherID,
+		&m.CourseID,
+		&m.ChapterID,
+		&m.Title,
+		&m.FileURL,
+		&ing.Status,
+		&ing.Action,
+		&ing.Attempts,
+	)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m.Ingestion = &ing
+	return &m, nil
+}
+
+// CompleteMaterialIngestion marks a material indexed with its chunk count.
+func CompleteMaterialIngestion(ctx context.Context, materialID int64, chunks int) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE materials
+		SET ingest_status = 'indexed', ingest_chunks = $1, ingest_error = '',
+		    ingest_next_at = NULL, ingest_updated_at = $2
+		WHERE id = $3 AND ingest_status = 'processing'
+	`, chunks, time.Now().Unix(), materialID)
+	return err
+}
+
+// FailMaterialIngestion records a failed attempt. With a nextAt the
+// material goes back to pending until then; without one it is failed for
+// good.
+func FailMaterialIngestion(ctx context.Context, materialID int64, reason string, nextAt *int64) error {
+	status := "failed"
+	if nextAt != nil {
+		status = "pending"
+	}
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE materials
+		SET ingest_status = $1, ingest_error = $2, ingest_next_at = $3, ingest_updated_at = $4
+		WHERE id = $5 AND ingest_status = 'processing'
+	`, status, reason, nextAt, time.Now().Unix(), materialID)
+	return err
+}
+
+// RequeueAbandonedIngestions puts the materials and vector purges whose
+// server died back to pending. They are abandoned once they have been
+// processing longer than lease.
+func RequeueAbandonedIngestions(ctx context.Context, lease time.Duration) error {
+	now := time.Now().Unix()
+	staleBefore := now - int64(lease.Seconds())
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE materials
+		SET ingest_status = 'pending', ingest_next_at = NULL, ingest_updated_at = $1
+		WHERE ingest_status = 'processing' AND ingest_updated_at < $2
+	`, now, staleBefore)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE vector_purges
+		SET status = 'pending', next_at = NULL, timemodified = $1
+		WHERE status = 'processing' AND timemodified < $2
+	`, now, staleBefore)
+	return err
+}
+
+// ReleaseMaterialIngestion puts a material its worker stopped back to
+// pending without counting the attempt.
+func ReleaseMaterialIngestion(ctx context.Context, materialID int64) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE materials
+		SET ingest_status = 'pending', ingest_attempts = GREATEST(ingest_attempts - 1, 0),
+		    ingest_updated_at = $1
+		WHERE id = $2 AND ingest_status = 'processing'
+	`, time.Now().Unix(), materialID)
+	return err
+}
+
+// ReleaseVectorPurge puts a purge its worker stopped back to pending
+// without counting the attempt.
+func ReleaseVectorPurge(ctx context.Context, purgeID int64) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE vector_purges
+		SET status = 'pending', attempts = GREATEST(attempts - 1, 0), timemodified = $1
+		WHERE id = $2 AND status = 'processing'
+	`, time.Now().Unix(), purgeID)
+	return err
+}
+
+// RetriggerMaterialIngestion queues a material for ingestion again with a
+// fresh attempt count. It re-indexes, since an earlier attempt may have
+// stored part of the vectors. Teachers may only re-trigger their own
+// materials.
+func RetriggerMaterialIngestion(ctx context.Context, materialID, userID, roleID int64) error {
+	var status string
+	err := db.Pool.QueryRow(ctx, `
+		SELECT ingest_status FROM materials
+		WHERE id = $1 AND ($2 OR teacher_id = $3)
+	`, materialID, roleID == 1, userID).Scan(&status)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrMaterialNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if status == "processing" {
+		return ErrIngestionRunning
+	}
+
+	_, err = db.Pool.Exec(ctx, `
+		UPDATE materials
+		SET ingest_status = 'pending', ingest_action = 'reindex', ingest_attempts = 0,
+		    ingest_error = '', ingest_next_at = NULL, ingest_updated_at = $1
+		WHERE id = $2 AND ingest_status <> 'processing'
+	`, time.Now().Unix(), materialID)
+	return err
+}
+
+func queueVectorPurge(ctx context.Context, tx pgx.Tx, materialID, userID int64) error {
+	now := time.Now().Unix()
+	_, err := tx.Exec(ctx, `
+		INSERT INTO vector_purges (material_id, requested_by, status, timecreated, timemodified)
+		VALUES ($1,$2,'pending',$3,$3)
+	`, materialID, userID, now)
+	return err
+}
+
+const vectorPurgeColumns = `
+	id, material_id, requested_by, status, attempts, deleted, error, next_at,
+	timecreated, timemodified
+`
+
+func scanVectorPurge(row interface{ Scan(...any) error }, p *models.VectorPurge) error {
+	return row.Scan(
+		&p.ID,
+		&p.MaterialID,
+		&p.RequestedBy,
+		&p.Status,
+		&p.Attempts,
+		&p.Deleted,
+		&p.Error,
+		&p.NextAt,
+		&p.TimeCreated,
+		&p.TimeModified,
+	)
+}
+
+// ClaimVectorPurge marks the pending purge that is due longest as
+// processing and returns it, or nil when none is due.
+func ClaimVectorPurge(ctx context.Context) (*models.VectorPurge, error) {
+	now := time.Now().Unix()
+	var p models.VectorPurge
+	err := scanVectorPurge(db.Pool.QueryRow(ctx, `
+		WITH next AS (
+			SELECT id FROM vector_purges
+			WHERE status = 'pending'
+			  AND (next_at IS NULL OR next_at <= $1)
+			ORDER BY next_at NULLS FIRST, id
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		UPDATE vector_purges v
+		SET status = 'processing', attempts = v.attempts + 1,
+		    next_at = NULL, timemodified = $1
+		FROM next
+		WHERE v.id = next.id
+		RETURNING `+vectorPurgeColumns+`
+	`, now), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// CompleteVectorPurge marks a purge done with the number of vectors the
+// index removed.
+func CompleteVectorPurge(ctx context.Context, purgeID int64, deleted int) error {
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE vector_purges
+		SET status = 'done', deleted = $1, error = '', timemodified = $2
+		WHERE id = $3 AND status = 'processing'
+	`, deleted, time.Now().Unix(), purgeID)
+	return err
+}
+
+// FailVectorPurge records a failed purge attempt like
+// FailMaterialIngestion does for ingestion.
+func FailVectorPurge(ctx context.Context, purgeID int64, reason string, nextAt *int64) error {
+	status := "failed"
+	if nextAt != nil {
+		status = "pending"
+	}
+	_, err := db.Pool.Exec(ctx, `
+		UPDATE vector_purges
+		SET status = $1, error = $2, next_at = $3, timemodified = $4
+		WHERE id = $5 AND status = 'processing'
+	`, status, reason, nextAt, time.Now().Unix(), purgeID)
+	return err
+}
+
+// GetVectorPurges lists the purges that are not done yet, oldest first,
+// or every purge when all is set.
+func GetVectorPurges(ctx context.Context, all bool) ([]models.VectorPurge, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+vectorPurgeColumns+`
+		FROM vector_purges
+		WHERE $1 OR status <> 'done'
+		ORDER BY id
+	`, all)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.VectorPurge
+	for rows.Next() {
+		var p models.VectorPurge
+		if err := scanVectorPurge(rows, &p); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+// RetryVectorPurge queues a failed purge again with a fresh attempt count.
+func RetryVectorPurge(ctx context.Context, purgeID int64) error {
+	cmd, err := db.Pool.Exec(ctx, `
+		UPDATE vector_purges
+		SET status = 'pending', attempts = 0, error = '', next_at = NULL, timemodified = $1
+		WHERE id = $2 AND status = 'failed'
+	`, time.Now().Unix(), purgeID)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrPurgeNotFailed
+	}
+	return nil
+}
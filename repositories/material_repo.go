@@ -7,8 +7,13 @@ import (
 
 	"backendLMS/db"
 	"backendLMS/models"
+	"backendLMS/services"
 )
 
+// ErrForeignFileURL rejects a file_url outside the materials bucket; the
+// ingestion worker downloads whatever file_url holds.
+var ErrForeignFileURL = errors.New("file_url must be a file uploaded to material storage")
+
 func CreateMaterial(ctx context.Context, m *models.Material) error {
 	now := time.Now().Unix()
 
@@ -66,9 +71,12 @@ func GetMaterials(ctx context.Context) ([]models.Material, error) {
 func GetMaterialByID(ctx context.Context, id int64) (*models.Material, error) {
 	var m models.Material
 
+	var ing models.MaterialIngestion
 	err := db.Pool.QueryRow(ctx, `
 		SELECT id, teacher_id, course_id, chapter_id,
-		       title, description, file_url, uploaded_at, timemodified
+		       title, description, file_url, uploaded_at, timemodified,
+		       ingest_status, ingest_action, ingest_chunks, ingest_error, ingest_attempts,
+		       ingest_next_at, ingest_updated_at
 		FROM materials
 		WHERE id = $1
 	`, id).Scan(
@@ -81,16 +89,39 @@ func GetMaterialByID(ctx context.Context, id int64) (*models.Material, error) {
 		&m.FileURL,
 		&m.UploadedAt,
 		&m.TimeModified,
+		&ing.Status,
+		&ing.Action,
+		&ing.Chunks,
+		&ing.Error,
+		&ing.Attempts,
+		&ing.NextAt,
+		&ing.UpdatedAt,
 	)
 
 	if err != nil {
 		return nil, err
 	}
+	m.Ingestion = &ing
 
 	return &m, nil
 }
 
+// reindexOnNewFile queues a re-index when an update sets a new file_url
+// ($3). SET expressions see the row as it was before the update, so
+// file_url here is still the old one.
+const reindexOnNewFile = `
+	ingest_status = CASE WHEN $3 <> '' AND file_url IS DISTINCT FROM $3 THEN 'pending' ELSE ingest_status END,
+	ingest_action = CASE WHEN $3 <> '' AND file_url IS DISTINCT FROM $3 THEN 'reindex' ELSE ingest_action END,
+	ingest_attempts = CASE WHEN $3 <> '' AND file_url IS DISTINCT FROM $3 THEN 0 ELSE ingest_attempts END,
+	ingest_error = CASE WHEN $3 <> '' AND file_url IS DISTINCT FROM $3 THEN '' ELSE ingest_error END,
+	ingest_next_at = CASE WHEN $3 <> '' AND file_url IS DISTINCT FROM $3 THEN NULL ELSE ingest_next_at END
+`
+
 func UpdateMaterial(ctx context.Context, m *models.Material) error {
+	if m.FileURL != "" && !services.IsMaterialFileURL(m.FileURL) {
+		return ErrForeignFileURL
+	}
+
 	now := time.Now().Unix()
 
 	_, err := db.Pool.Exec(ctx, `
@@ -98,7 +129,8 @@ func UpdateMaterial(ctx context.Context, m *models.Material) error {
 		SET title = $1,
 		    description = $2,
 		    file_url = $3,
-		    timemodified = $4
+		    timemodified = $4,
+		    `+reindexOnNewFile+`
 		WHERE id = $5
 	`,
 		m.Title,
@@ -116,6 +148,10 @@ func UpdateMaterialByTeacher(
 	m *models.Material,
 	teacherID int64,
 ) error {
+	if m.FileURL != "" && !services.IsMaterialFileURL(m.FileURL) {
+		return ErrForeignFileURL
+	}
+
 	now := time.Now().Unix()
 
 	cmd, err := db.Pool.Exec(ctx, `
@@ -123,7 +159,8 @@ func UpdateMaterialByTeacher(
 		SET title = $1,
 		    description = $2,
 		    file_url = $3,
-		    timemodified = $4
+		    timemodified = $4,
+		    `+reindexOnNewFile+`
 		WHERE id = $5
 		  AND teacher_id = $6
 	`,
@@ -146,14 +183,9 @@ func UpdateMaterialByTeacher(
 	return nil
 }
 
-
-func DeleteMaterial(ctx context.Context, id int64) error {
-	_, err := db.Pool.Exec(ctx, `
-		DELETE FROM materials
-		WHERE id = $1
-	`, id)
-
-	return err
+// DeleteMaterial removes a material and queues the purge of its vectors.
+func DeleteMaterial(ctx context.Context, id, userID int64) error {
+	return deleteMaterial(ctx, id, userID, true)
 }
 
 func DeleteMaterialByTeacher(
@@ -161,19 +193,36 @@ func DeleteMaterialByTeacher(
 	id int64,
 	teacherID int64,
 ) error {
-	cmd, err := db.Pool.Exec(ctx, `
+	return deleteMaterial(ctx, id, teacherID, false)
+}
+
+func deleteMaterial(ctx context.Context, id, userID int64, isAdmin bool) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	cmd, err := tx.Exec(ctx, `
 		DELETE FROM materials
 		WHERE id = $1
-		  AND teacher_id = $2
-	`, id, teacherID)
+		  AND ($2 OR teacher_id = $3)
+	`, id, isAdmin, userID)
 
 	if err != nil {
 		return err
 	}
 
 	if cmd.RowsAffected() == 0 {
+		if isAdmin {
+			return nil
+		}
 		return errors.New("material not found or not owned by teacher")
 	}
 
-	return nil
+	if err := queueVectorPurge(ctx, tx, id, userID); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
 }
@@ -0,0 +1,311 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrPromptTemplateNotFound   = errors.New("prompt template not found")
+	ErrGenerationPresetNotFound = errors.New("generation preset not found")
+)
+
+const promptTemplateColumns = `
+	t.id, t.name, t.description, t.version, v.body, t.created_by, t.timecreated, t.timemodified
+`
+
+func scanPromptTemplate(row interface{ Scan(...any) error }, t *models.PromptTemplate) error {
+	return row.Scan(
+		&t.ID,
+		&t.Name,
+		&t.Description,
+		&t.Version,
+		&t.Body,
+		&t.CreatedBy,
+		&t.TimeCreated,
+		&t.TimeModified,
+	)
+}
+
+func insertPromptTemplateVersion(ctx context.Context, tx pgx.Tx, templateID int64, version int, body, note string, userID int64) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO prompt_template_versions (template_id, version, body, note, created_by, timecreated)
+		VALUES ($1,$2,$3,$4,$5,$6)
+	`, templateID, version, body, note, userID, time.Now().Unix())
+	return err
+}
+
+// CreatePromptTemplate stores a template with its body as version 1.
+func CreatePromptTemplate(ctx context.Context, t *models.PromptTemplate, userID int64) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	now := time.Now().Unix()
+	err = tx.QueryRow(ctx, `
+		INSERT INTO prompt_templates (name, description, version, created_by, timecreated, timemodified)
+		VALUES ($1,$2,1,$3,$4,$4)
+		RETURNING id
+	`, t.Name, t.Description, userID, now).Scan(&t.ID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertPromptTemplateVersion(ctx, tx, t.ID, 1, t.Body, "", userID); err != nil {
+		return err
+	}
+
+	t.Version = 1
+	t.CreatedBy = &userID
+	t.TimeCreated = now
+	t.TimeModified = now
+	return tx.Commit(ctx)
+}
+
+// UpdatePromptTemplate renames a template and, when the body changed,
+// adds the new body as the next version.
+func UpdatePromptTemplate(ctx context.Context, t *models.PromptTemplate, userID int64, note string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var version int
+	var body string
+	err = tx.QueryRow(ctx, `
+		SELECT t.version, v.body
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.version
+		WHERE t.id = $1
+		FOR UPDATE OF t
+	`, t.ID).Scan(&version, &body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrPromptTemplateNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if t.Body != body {
+		version++
+		if err := insertPromptTemplateVersion(ctx, tx, t.ID, version, t.Body, note, userID); err != nil {
+			return err
+		}
+	}
+
+	err = scanPromptTemplate(tx.QueryRow(ctx, `
+		WITH t AS (
+			UPDATE prompt_templates
+			SET name = $1, description = $2, version = $3, timemodified = $4
+			WHERE id = $5
+			RETURNING *
+		)
+		SELECT `+promptTemplateColumns+`
+		FROM t
+		JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.version
+	`, t.Name, t.Description, version, time.Now().Unix(), t.ID), t)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetPromptTemplates lists the templates with their current body.
+func GetPromptTemplates(ctx context.Context) ([]models.PromptTemplate, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+promptTemplateColumns+`
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.version
+		ORDER BY t.name, t.id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.PromptTemplate{}
+	for rows.Next() {
+		var t models.PromptTemplate
+		if err := scanPromptTemplate(rows, &t); err != nil {
+			return nil, err
+		}
+		result = append(result, t)
+	}
+	return result, rows.Err()
+}
+
+func GetPromptTemplate(ctx context.Context, id int64) (*models.PromptTemplate, error) {
+	var t models.PromptTemplate
+	err := scanPromptTemplate(db.Pool.QueryRow(ctx, `
+		SELECT `+promptTemplateColumns+`
+		FROM prompt_templates t
+		JOIN prompt_template_versions v ON v.template_id = t.id AND v.version = t.version
+		WHERE t.id = $1
+	`, id), &t)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrPromptTemplateNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// GetPromptTemplateVersions lists every version of a template, newest
+// first.
+func GetPromptTemplateVersions(ctx context.Context, id int64) ([]models.PromptTemplateVersion, error) {
+	if _, err := GetPromptTemplate(ctx, id); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, template_id, version, body, note, created_by, timecreated
+		FROM prompt_template_versions
+		WHERE template_id = $1
+		ORDER BY version DESC
+	`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.PromptTemplateVersion{}
+	for rows.Next() {
+		var v models.PromptTemplateVersion
+		if err := rows.Scan(
+			&v.ID,
+			&v.TemplateID,
+			&v.Version,
+			&v.Body,
+			&v.Note,
+			&v.CreatedBy,
+			&v.TimeCreated,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+const generationPresetColumns = `
+	id, name, description, template_id, taxonomy_levels, option_count, difficulty,
+	version, created_by, timecreated, timemodified
+`
+
+func scanGenerationPreset(row interface{ Scan(...any) error }, p *models.GenerationPreset) error {
+	return row.Scan(
+		&p.ID,
+		&p.Name,
+		&p.Description,
+		&p.TemplateID,
+		&p.TaxonomyLevels,
+		&p.OptionCount,
+		&p.Difficulty,
+		&p.Version,
+		&p.CreatedBy,
+		&p.TimeCreated,
+		&p.TimeModified,
+	)
+}
+
+// checkPresetTemplate makes a missing template a not-found error instead
+// of a foreign key violation.
+func checkPresetTemplate(ctx context.Context, templateID *int64) error {
+	if templateID == nil {
+		return nil
+	}
+	_, err := GetPromptTemplate(ctx, *templateID)
+	return err
+}
+
+func CreateGenerationPreset(ctx context.Context, p *models.GenerationPreset, userID int64) error {
+	if err := checkPresetTemplate(ctx, p.TemplateID); err != nil {
+		return err
+	}
+	now := time.Now().Unix()
+	return scanGenerationPreset(db.Pool.QueryRow(ctx, `
+		INSERT INTO generation_presets
+		(name, description, template_id, taxonomy_levels, option_count, difficulty, version, created_by, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,1,$7,$8,$8)
+		RETURNING `+generationPresetColumns+`
+	`, p.Name, p.Description, p.TemplateID, p.TaxonomyLevels, p.OptionCount, p.Difficulty, userID, now), p)
+}
+
+// UpdateGenerationPreset replaces a preset's settings and counts the edit
+// in its version.
+func UpdateGenerationPreset(ctx context.Context, p *models.GenerationPreset) error {
+	if err := checkPresetTemplate(ctx, p.TemplateID); err != nil {
+		return err
+	}
+	err := scanGenerationPreset(db.Pool.QueryRow(ctx, `
+		UPDATE generation_presets
+		SET name = $1, description = $2, template_id = $3, taxonomy_levels = $4,
+		    option_count = $5, difficulty = $6, version = version + 1, timemodified = $7
+		WHERE id = $8
+		RETURNING `+generationPresetColumns+`
+	`, p.Name, p.Description, p.TemplateID, p.TaxonomyLevels, p.OptionCount, p.Difficulty, time.Now().Unix(), p.ID), p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ErrGenerationPresetNotFound
+	}
+	return err
+}
+
+func DeleteGenerationPreset(ctx context.Context, id int64) error {
+	cmd, err := db.Pool.Exec(ctx, `DELETE FROM generation_presets WHERE id = $1`, id)
+	if err != nil {
+		return err
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrGenerationPresetNotFound
+	}
+	return nil
+}
+
+func GetGenerationPresets(ctx context.Context) ([]models.GenerationPreset, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+generationPresetColumns+`
+		FROM generation_presets
+		ORDER BY name, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.GenerationPreset{}
+	for rows.Next() {
+		var p models.GenerationPreset
+		if err := scanGenerationPreset(rows, &p); err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, rows.Err()
+}
+
+func GetGenerationPreset(ctx context.Context, id int64) (*models.GenerationPreset, error) {
+	var p models.GenerationPreset
+	err := scanGenerationPreset(db.Pool.QueryRow(ctx, `
+		SELECT `+generationPresetColumns+`
+		FROM generation_presets
+		WHERE id = $1
+	`, id), &p)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrGenerationPresetNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
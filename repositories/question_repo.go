@@ -3,55 +3,90 @@ package repositories
 import (
 	"context"
 	"errors"
+	"strings"
 	"time"
 
 	"backendLMS/db"
 	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
 )
 
 func CreateQuestionWithAnswers(
 	ctx context.Context,
 	materialID, teacherID int64,
-	content, difficulty, taxonomy string,
+	qType, content, difficulty, taxonomy string,
 	answers []AnswerInput,
-) error {
-
-	if err := validateAnswers(answers); err != nil {
-		return err
-	}
+	rubric []RubricCriterionInput,
+) (int64, error) {
 
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
-		return err
+		return 0, err
 	}
 	defer tx.Rollback(ctx)
 
+	questionID, err := insertQuestion(ctx, tx, materialID, teacherID, nil, QuestionInput{
+		Type:          qType,
+		Content:       content,
+		Difficulty:    difficulty,
+		TaxonomyLevel: taxonomy,
+		Answers:       answers,
+		Rubric:        rubric,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return questionID, tx.Commit(ctx)
+}
+
+// insertQuestion validates and inserts a draft question as version 1,
+// optionally as part of a generation batch.
+func insertQuestion(ctx context.Context, tx pgx.Tx, materialID, teacherID int64, batchID *int64, in QuestionInput) (int64, error) {
+	qType, answers, err := normalizeAnswers(in.Type, in.Answers)
+	if err != nil {
+		return 0, err
+	}
+
+	rubric, err := normalizeRubric(qType, in.Rubric)
+	if err != nil {
+		return 0, err
+	}
+
 	now := time.Now().Unix()
 	var questionID int64
 
 	err = tx.QueryRow(ctx, `
 		INSERT INTO questions
-		(material_id, created_by, content, difficulty, taxonomy_level, status, timecreated, timemodified)
-		VALUES ($1,$2,$3,$4,$5,'draft',$6,$6)
+		(material_id, created_by, type, content, difficulty, taxonomy_level, status, batch_id, timecreated, timemodified)
+		VALUES ($1,$2,$3,$4,$5,$6,'draft',$7,$8,$8)
 		RETURNING id
-	`, materialID, teacherID, content, difficulty, taxonomy, now).
+	`, materialID, teacherID, qType, in.Content, in.Difficulty, in.TaxonomyLevel, batchID, now).
 		Scan(&questionID)
 
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	for _, a := range answers {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO answers (question_id, option_label, option_text, is_correct)
-			VALUES ($1,$2,$3,$4)
-		`, questionID, a.Label, a.Text, a.IsCorrect)
-		if err != nil {
-			return err
-		}
+	if err := insertAnswers(ctx, tx, questionID, 1, answers); err != nil {
+		return 0, err
 	}
 
-	return tx.Commit(ctx)
+	if err := insertRubric(ctx, tx, questionID, 1, rubric); err != nil {
+		return 0, err
+	}
+
+	if err := insertQuestionSources(ctx, tx, questionID, in.Sources); err != nil {
+		return 0, err
+	}
+
+	if err := snapshotQuestionVersion(ctx, tx, questionID, teacherID, ""); err != nil {
+		return 0, err
+	}
+
+	return questionID, nil
 }
 
 func GetQuestions(ctx context.Context, userID, roleID int64) ([]models.Question, error) {
@@ -60,16 +95,16 @@ func GetQuestions(ctx context.Context, userID, roleID int64) ([]models.Question,
 
 	if roleID == 1 { // ADMIN
 		query = `
-			SELECT id, material_id, created_by, content,
-			       difficulty, taxonomy_level, status,
+			SELECT id, material_id, created_by, type, content,
+			       difficulty, taxonomy_level, status, reviewer_id, batch_id, version,
 			       timecreated, timemodified
 			FROM questions
 			ORDER BY timecreated DESC
 		`
 	} else { // TEACHER
 		query = `
-			SELECT id, material_id, created_by, content,
-			       difficulty, taxonomy_level, status,
+			SELECT id, material_id, created_by, type, content,
+			       difficulty, taxonomy_level, status, reviewer_id, batch_id, version,
 			       timecreated, timemodified
 			FROM questions
 			WHERE created_by = $1
@@ -91,10 +126,14 @@ func GetQuestions(ctx context.Context, userID, roleID int64) ([]models.Question,
 			&q.ID,
 			&q.MaterialID,
 			&q.CreatedBy,
+			&q.Type,
 			&q.Content,
 			&q.Difficulty,
 			&q.TaxonomyLevel,
 			&q.Status,
+			&q.ReviewerID,
+			&q.BatchID,
+			&q.Version,
 			&q.TimeCreated,
 			&q.TimeModified,
 		)
@@ -106,39 +145,49 @@ func GetQuestions(ctx context.Context, userID, roleID int64) ([]models.Question,
 	return result, nil
 }
 
-func GetQuestionByID(ctx context.Context, id, userID, roleID int64) (*models.Question, []models.Answer, error) {
-	var q models.Question
-	var query string
-	var args []interface{}
+const questionColumns = `
+	id, material_id, created_by, type, content,
+	difficulty, taxonomy_level, status, reviewer_id, batch_id, version,
+	timecreated, timemodified
+`
 
+func GetQuestionByID(ctx context.Context, id, userID, roleID int64) (*models.Question, []models.Answer, error) {
 	if roleID == 1 { // ADMIN
-		query = `
-			SELECT id, material_id, created_by, content,
-			       difficulty, taxonomy_level, status,
-			       timecreated, timemodified
-			FROM questions
-			WHERE id=$1
-		`
-		args = append(args, id)
-	} else { // TEACHER
-		query = `
-			SELECT id, material_id, created_by, content,
-			       difficulty, taxonomy_level, status,
-			       timecreated, timemodified
-			FROM questions
-			WHERE id=$1 AND created_by=$2
-		`
-		args = append(args, id, userID)
+		return getQuestion(ctx, `id=$1`, id)
 	}
+	// TEACHER
+	return getQuestion(ctx, `id=$1 AND (created_by=$2 OR reviewer_id=$2)`, id, userID)
+}
+
+// GetQuestionInTeacherExams returns a question that a teacher put in one of
+// their own exams, whoever wrote it.
+func GetQuestionInTeacherExams(ctx context.Context, id, teacherID int64) (*models.Question, []models.Answer, error) {
+	return getQuestion(ctx, `
+		id=$1 AND EXISTS(
+			SELECT 1 FROM exam_questions eq
+			JOIN exams e ON e.id = eq.exam_id
+			WHERE eq.question_id = questions.id AND e.created_by = $2
+		)
+	`, id, teacherID)
+}
 
-	err := db.Pool.QueryRow(ctx, query, args...).Scan(
+func getQuestion(ctx context.Context, where string, args ...interface{}) (*models.Question, []models.Answer, error) {
+	var q models.Question
+	err := db.Pool.QueryRow(ctx, `
+		SELECT `+questionColumns+`
+		FROM questions
+		WHERE `+where, args...).Scan(
 		&q.ID,
 		&q.MaterialID,
 		&q.CreatedBy,
+		&q.Type,
 		&q.Content,
 		&q.Difficulty,
 		&q.TaxonomyLevel,
 		&q.Status,
+		&q.ReviewerID,
+		&q.BatchID,
+		&q.Version,
 		&q.TimeCreated,
 		&q.TimeModified,
 	)
@@ -147,38 +196,45 @@ func GetQuestionByID(ctx context.Context, id, userID, roleID int64) (*models.Que
 		return nil, nil, err
 	}
 
-	rows, err := db.Pool.Query(ctx, `
-		SELECT id, question_id, option_label, option_text, is_correct
-		FROM answers
-		WHERE question_id=$1
-		ORDER BY option_label
-	`, id)
+	answers, err := getAnswersByQuestionIDs(ctx, []int64{q.ID})
 	if err != nil {
 		return nil, nil, err
 	}
-	defer rows.Close()
-
-	var answers []models.Answer
-	for rows.Next() {
-		var a models.Answer
-		if err := rows.Scan(&a.ID, &a.QuestionID, &a.Label, &a.Text, &a.IsCorrect); err != nil {
-			return nil, nil, err
-		}
-		answers = append(answers, a)
-	}
 
-	return &q, answers, nil
+	return &q, answers[q.ID], nil
 }
 
+// UpdateQuestion saves an edit as a new version of the question; the rows
+// of earlier versions stay as they were. An essay updated without a rubric
+// keeps its current one.
 func UpdateQuestion(ctx context.Context, qID, userID, roleID int64,
-	content, difficulty, taxonomy string,
+	qType, content, difficulty, taxonomy string,
 	answers []AnswerInput,
+	rubric []RubricCriterionInput,
 ) error {
 
-	if err := validateAnswers(answers); err != nil {
+	// an update without a type keeps the current one
+	if strings.TrimSpace(qType) == "" {
+		current, err := getQuestionType(ctx, qID)
+		if err != nil {
+			return errors.New("question not found or not editable")
+		}
+		qType = current
+	}
+
+	qType, answers, err := normalizeAnswers(qType, answers)
+	if err != nil {
 		return err
 	}
 
+	keepRubric := qType == services.TypeEssay && rubric == nil
+	if !keepRubric {
+		rubric, err = normalizeRubric(qType, rubric)
+		if err != nil {
+			return err
+		}
+	}
+
 	tx, err := db.Pool.Begin(ctx)
 	if err != nil {
 		return err
@@ -191,41 +247,56 @@ func UpdateQuestion(ctx context.Context, qID, userID, roleID int64,
 	if roleID == 1 { // ADMIN: Can edit everything, no status check usually needed but lets keep logic simple
 		query = `
 			UPDATE questions
-			SET content=$1, difficulty=$2, taxonomy_level=$3, timemodified=$4
-			WHERE id=$5
+			SET type=$1, content=$2, difficulty=$3, taxonomy_level=$4, timemodified=$5,
+			    version = version + 1
+			WHERE id=$6
+			RETURNING version
 		`
-		args = append(args, content, difficulty, taxonomy, time.Now().Unix(), qID)
+		args = append(args, qType, content, difficulty, taxonomy, time.Now().Unix(), qID)
 	} else { // TEACHER: Only own draft questions
 		query = `
 			UPDATE questions
-			SET content=$1, difficulty=$2, taxonomy_level=$3, timemodified=$4
-			WHERE id=$5 AND created_by=$6 AND status='draft'
+			SET type=$1, content=$2, difficulty=$3, taxonomy_level=$4, timemodified=$5,
+			    version = version + 1
+			WHERE id=$6 AND created_by=$7 AND status IN ('draft','changes_requested')
+			RETURNING version
 		`
-		args = append(args, content, difficulty, taxonomy, time.Now().Unix(), qID, userID)
+		args = append(args, qType, content, difficulty, taxonomy, time.Now().Unix(), qID, userID)
 	}
 
-	res, err := tx.Exec(ctx, query, args...)
+	var version int
+	err = tx.QueryRow(ctx, query, args...).Scan(&version)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return errors.New("question not found or not editable")
+	}
 	if err != nil {
 		return err
 	}
 
-	if res.RowsAffected() == 0 {
-		return errors.New("question not found or not editable")
-	}
-
-	_, err = tx.Exec(ctx, `DELETE FROM answers WHERE question_id=$1`, qID)
-	if err != nil {
+	if err := insertAnswers(ctx, tx, qID, version, answers); err != nil {
 		return err
 	}
 
-	for _, a := range answers {
-		_, err := tx.Exec(ctx, `
-			INSERT INTO answers (question_id, option_label, option_text, is_correct)
-			VALUES ($1,$2,$3,$4)
-		`, qID, a.Label, a.Text, a.IsCorrect)
+	if keepRubric {
+		if err := copyRubric(ctx, tx, qID, version-1, version); err != nil {
+			return err
+		}
+		var exists bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS(SELECT 1 FROM rubric_criteria WHERE question_id = $1 AND version = $2)
+		`, qID, version).Scan(&exists)
 		if err != nil {
 			return err
 		}
+		if !exists {
+			return errors.New("soal esai harus memiliki rubrik")
+		}
+	} else if err := insertRubric(ctx, tx, qID, version, rubric); err != nil {
+		return err
+	}
+
+	if err := snapshotQuestionVersion(ctx, tx, qID, userID, ""); err != nil {
+		return err
 	}
 
 	return tx.Commit(ctx)
@@ -255,74 +326,105 @@ func DeleteQuestion(ctx context.Context, qID, userID, roleID int64) error {
 	return nil
 }
 
-func UpdateQuestionStatus(ctx context.Context, qID, userID, roleID int64, status string) error {
-	if status != "approved" && status != "rejected" {
-		return errors.New("invalid status")
-	}
-
-	tx, err := db.Pool.Begin(ctx)
+// normalizeAnswers checks the answers against the rules of the question
+// type and returns the normalized type and answers. Rows that are part of
+// the key by definition (accepted answers, numeric value, matching pairs)
+// are marked correct.
+func normalizeAnswers(qType string, answers []AnswerInput) (string, []AnswerInput, error) {
+	qType, err := services.NormalizeQuestionType(qType)
 	if err != nil {
-		return err
+		return "", nil, err
 	}
-	defer tx.Rollback(ctx)
 
-	var exists bool
-	var checkQuery string
-	var checkArgs []interface{}
-
-	if roleID == 1 {
-		checkQuery = `SELECT EXISTS(SELECT 1 FROM questions WHERE id=$1)`
-		checkArgs = append(checkArgs, qID)
-	} else {
-		checkQuery = `SELECT EXISTS(SELECT 1 FROM questions WHERE id=$1 AND created_by=$2)`
-		checkArgs = append(checkArgs, qID, userID)
+	correct := 0
+	for _, a := range answers {
+		if strings.TrimSpace(a.Text) == "" {
+			return "", nil, errors.New("teks jawaban tidak boleh kosong")
+		}
+		if a.IsCorrect {
+			correct++
+		}
 	}
 
-	err = tx.QueryRow(ctx, checkQuery, checkArgs...).Scan(&exists)
-	if err != nil || !exists {
-		return errors.New("question not found")
-	}
+	switch qType {
+	case services.TypeEssay:
+		if len(answers) > 0 {
+			return "", nil, errors.New("soal esai tidak memiliki jawaban, gunakan rubrik")
+		}
 
-	_, err = tx.Exec(ctx, `
-		UPDATE questions
-		SET status=$1, timemodified=$2
-		WHERE id=$3
-	`, status, time.Now().Unix(), qID)
+	case services.TypeMultipleChoice:
+		if len(answers) < 2 {
+			return "", nil, errors.New("minimal 2 jawaban diperlukan")
+		}
+		if correct != 1 {
+			return "", nil, errors.New("harus tepat 1 jawaban benar")
+		}
 
-	if err != nil {
-		return err
-	}
+	case services.TypeTrueFalse:
+		if len(answers) != 2 {
+			return "", nil, errors.New("soal benar/salah harus memiliki tepat 2 pilihan")
+		}
+		if correct != 1 {
+			return "", nil, errors.New("harus tepat 1 jawaban benar")
+		}
 
-	// AUTO INSERT TO QUESTION_BANK
-	if status == "approved" {
-		_, err = tx.Exec(ctx, `
-			INSERT INTO question_bank (question_id, approved_by, approved_at)
-			VALUES ($1,$2,now())
-			ON CONFLICT (question_id) DO NOTHING
-		`, qID, userID) // userID here is whoever doing action (approver)
-		if err != nil {
-			return err
+	case services.TypeMultipleResponse:
+		if len(answers) < 2 {
+			return "", nil, errors.New("minimal 2 jawaban diperlukan")
+		}
+		if correct < 1 {
+			return "", nil, errors.New("minimal 1 jawaban benar diperlukan")
 		}
-	}
 
-	return tx.Commit(ctx)
-}
+	case services.TypeShortAnswer:
+		if len(answers) < 1 {
+			return "", nil, errors.New("minimal 1 jawaban yang diterima diperlukan")
+		}
 
-func validateAnswers(answers []AnswerInput) error {
-	if len(answers) < 2 {
-		return errors.New("minimal 2 jawaban diperlukan")
-	}
+	case services.TypeNumeric:
+		if len(answers) != 1 {
+			return "", nil, errors.New("soal numerik harus memiliki tepat 1 jawaban")
+		}
+		if _, err := services.ParseNumber(answers[0].Text); err != nil {
+			return "", nil, errors.New("jawaban soal numerik harus berupa angka")
+		}
+		if t := answers[0].Tolerance; t != nil && *t < 0 {
+			return "", nil, errors.New("toleransi tidak boleh negatif")
+		}
 
-	correct := 0
-	for _, a := range answers {
-		if a.IsCorrect {
-			correct++
+	case services.TypeMatching:
+		if len(answers) < 2 {
+			return "", nil, errors.New("minimal 2 pasangan diperlukan")
+		}
+		seen := make(map[string]bool)
+		for _, a := range answers {
+			match := strings.TrimSpace(a.MatchText)
+			if match == "" {
+				return "", nil, errors.New("setiap pasangan harus memiliki match_text")
+			}
+			if seen[strings.ToLower(match)] {
+				return "", nil, errors.New("match_text tidak boleh duplikat")
+			}
+			seen[strings.ToLower(match)] = true
 		}
 	}
 
-	if correct != 1 {
-		return errors.New("harus tepat 1 jawaban benar")
+	result := make([]AnswerInput, len(answers))
+	for i, a := range answers {
+		if !services.HasOptions(qType) || qType == services.TypeMatching {
+			a.IsCorrect = true
+		}
+		if qType != services.TypeNumeric {
+			a.Tolerance = nil
+		}
+		if qType != services.TypeMatching {
+			a.MatchText = ""
+		}
+		if a.Label == "" {
+			a.Label = services.OptionLabel(i)
+		}
+		result[i] = a
 	}
 
-	return nil
+	return qType, result, nil
 }
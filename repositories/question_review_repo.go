@@ -0,0 +1,435 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrQuestionNotFound = errors.New("question not found")
+	ErrInvalidReviewer  = errors.New("reviewer must be another teacher or an admin")
+	ErrCommentParent    = errors.New("parent comment not found on this question")
+	ErrCommentAnswer    = errors.New("answer does not belong to this question")
+)
+
+type reviewState struct {
+	createdBy  int64
+	status     string
+	reviewerID *int64
+}
+
+// lockReviewState locks a question the user may see and returns its review
+// fields.
+func lockReviewState(ctx context.Context, tx pgx.Tx, questionID, userID, roleID int64) (reviewState, error) {
+	var st reviewState
+	err := tx.QueryRow(ctx, `
+		SELECT created_by, status, reviewer_id
+		FROM questions
+		WHERE id = $1 AND ($2 OR created_by = $3 OR reviewer_id = $3)
+		FOR UPDATE
+	`, questionID, roleID == 1, userID).Scan(&st.createdBy, &st.status, &st.reviewerID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return st, ErrQuestionNotFound
+	}
+	return st, err
+}
+
+func (st reviewState) actor(userID, roleID int64) services.ReviewActor {
+	return services.ReviewActor{
+		IsAdmin:    roleID == 1,
+		IsAuthor:   st.createdBy == userID,
+		IsReviewer: st.reviewerID != nil && *st.reviewerID == userID,
+	}
+}
+
+func insertReviewEvent(
+	ctx context.Context,
+	tx pgx.Tx,
+	questionID int64,
+	from, to string,
+	actorID int64,
+	reviewerID *int64,
+	reason string,
+) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO question_review_events
+		(question_id, from_status, to_status, actor_id, reviewer_id, reason, timecreated)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+	`, questionID, from, to, actorID, reviewerID, strings.TrimSpace(reason), time.Now().Unix())
+	return err
+}
+
+// UpdateQuestionStatus moves a question one step through the review
+// workflow and records the step with its reason.
+func UpdateQuestionStatus(ctx context.Context, qID, userID, roleID int64, status, reason string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := applyReviewStep(ctx, tx, qID, userID, roleID, status, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// applyReviewStep moves one question inside tx. An admin starting the
+// review of an unassigned question becomes its reviewer, and approved
+// questions are added to the question bank.
+func applyReviewStep(ctx context.Context, tx pgx.Tx, qID, userID, roleID int64, status, reason string) error {
+	st, err := lockReviewState(ctx, tx, qID, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	status = strings.TrimSpace(status)
+	if err := services.CheckReviewTransition(st.status, status, st.actor(userID, roleID), reason); err != nil {
+		return err
+	}
+
+	reviewerID := st.reviewerID
+	if status == services.StatusInReview && reviewerID == nil {
+		reviewerID = &userID
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE questions
+		SET status=$1, reviewer_id=$2, timemodified=$3
+		WHERE id=$4
+	`, status, reviewerID, time.Now().Unix(), qID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertReviewEvent(ctx, tx, qID, st.status, status, userID, nil, reason); err != nil {
+		return err
+	}
+
+	// AUTO INSERT TO QUESTION_BANK
+	if status == services.StatusApproved {
+		_, err = tx.Exec(ctx, `
+			INSERT INTO question_bank (question_id, approved_by, approved_at)
+			VALUES ($1,$2,now())
+			ON CONFLICT (question_id) DO NOTHING
+		`, qID, userID) // userID here is whoever doing action (approver)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AssignQuestionReviewer sets or replaces the reviewer of a question. The
+// author may pick one until the review has started; after that only an
+// admin can reassign, which sends the question back to submitted so the
+// new reviewer starts from the beginning.
+func AssignQuestionReviewer(ctx context.Context, qID, reviewerID, userID, roleID int64, reason string) error {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	st, err := lockReviewState(ctx, tx, qID, userID, roleID)
+	if err != nil {
+		return err
+	}
+
+	actor := st.actor(userID, roleID)
+	switch {
+	case st.status == services.StatusApproved || st.status == services.StatusRejected:
+		return services.ErrReviewForbidden
+	case actor.IsAdmin:
+	case actor.IsAuthor && st.status != services.StatusInReview:
+	default:
+		return services.ErrReviewForbidden
+	}
+
+	if reviewerID == st.createdBy {
+		return services.ErrSelfReview
+	}
+
+	var ok bool
+	err = tx.QueryRow(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE id = $1 AND role_id IN (1, 2))
+	`, reviewerID).Scan(&ok)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidReviewer
+	}
+
+	status := st.status
+	if status == services.StatusInReview {
+		status = services.StatusSubmitted
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE questions
+		SET reviewer_id=$1, status=$2, timemodified=$3
+		WHERE id=$4
+	`, reviewerID, status, time.Now().Unix(), qID)
+	if err != nil {
+		return err
+	}
+
+	if err := insertReviewEvent(ctx, tx, qID, st.status, status, userID, &reviewerID, reason); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// GetQuestionReviewHistory lists the review steps of a question, oldest
+// first.
+func GetQuestionReviewHistory(ctx context.Context, qID, userID, roleID int64) ([]models.QuestionReviewEvent, error) {
+	if err := canViewQuestion(ctx, qID, userID, roleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT ev.id, ev.question_id, ev.from_status, ev.to_status,
+		       ev.actor_id, COALESCE(u.name, ''), ev.reviewer_id, ev.reason, ev.timecreated
+		FROM question_review_events ev
+		LEFT JOIN users u ON u.id = ev.actor_id
+		WHERE ev.question_id = $1
+		ORDER BY ev.timecreated, ev.id
+	`, qID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.QuestionReviewEvent
+	for rows.Next() {
+		var ev models.QuestionReviewEvent
+		if err := rows.Scan(
+			&ev.ID,
+			&ev.QuestionID,
+			&ev.FromStatus,
+			&ev.ToStatus,
+			&ev.ActorID,
+			&ev.ActorName,
+			&ev.ReviewerID,
+			&ev.Reason,
+			&ev.TimeCreated,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, ev)
+	}
+	return result, rows.Err()
+}
+
+// GetReviewQueue returns the submitted and in-review questions assigned to
+// the user, or every one of them for an admin, longest waiting first.
+func GetReviewQueue(ctx context.Context, userID, roleID int64) ([]models.ReviewQueueItem, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT q.id, q.material_id, q.created_by, q.type, q.content,
+		       q.difficulty, q.taxonomy_level, q.status, q.reviewer_id, q.batch_id, q.version,
+		       q.timecreated, q.timemodified, u.name,
+		       COALESCE((
+		           SELECT MAX(ev.timecreated) FROM question_review_events ev
+		           WHERE ev.question_id = q.id AND ev.to_status = 'submitted'
+		       ), q.timemodified) AS submitted_at
+		FROM questions q
+		JOIN users u ON u.id = q.created_by
+		WHERE q.status IN ('submitted', 'in_review')
+		  AND ($1 OR q.reviewer_id = $2)
+		ORDER BY submitted_at, q.id
+	`, roleID == 1, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.ReviewQueueItem
+	for rows.Next() {
+		var it models.ReviewQueueItem
+		if err := rows.Scan(
+			&it.Question.ID,
+			&it.Question.MaterialID,
+			&it.Question.CreatedBy,
+			&it.Question.Type,
+			&it.Question.Content,
+			&it.Question.Difficulty,
+			&it.Question.TaxonomyLevel,
+			&it.Question.Status,
+			&it.Question.ReviewerID,
+			&it.Question.BatchID,
+			&it.Question.Version,
+			&it.Question.TimeCreated,
+			&it.Question.TimeModified,
+			&it.AuthorName,
+			&it.SubmittedAt,
+		); err != nil {
+			return nil, err
+		}
+		result = append(result, it)
+	}
+	return result, rows.Err()
+}
+
+const questionCommentColumns = `
+	c.id, c.question_id, c.parent_id, c.answer_id, COALESCE(a.option_label, ''),
+	c.version, c.author_id, COALESCE(u.name, ''), c.body, c.timecreated
+`
+
+func scanQuestionComment(row interface{ Scan(...any) error }, c *models.QuestionComment) error {
+	return row.Scan(
+		&c.ID,
+		&c.QuestionID,
+		&c.ParentID,
+		&c.AnswerID,
+		&c.AnswerLabel,
+		&c.Version,
+		&c.AuthorID,
+		&c.AuthorName,
+		&c.Body,
+		&c.TimeCreated,
+	)
+}
+
+// GetQuestionComments returns the comment threads of a question, each top
+// level comment with its replies nested below it.
+func GetQuestionComments(ctx context.Context, qID, userID, roleID int64) ([]models.QuestionComment, error) {
+	if err := canViewQuestion(ctx, qID, userID, roleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+questionCommentColumns+`
+		FROM question_comments c
+		LEFT JOIN answers a ON a.id = c.answer_id
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.question_id = $1
+		ORDER BY c.timecreated, c.id
+	`, qID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var all []models.QuestionComment
+	for rows.Next() {
+		var c models.QuestionComment
+		if err := scanQuestionComment(rows, &c); err != nil {
+			return nil, err
+		}
+		c.Replies = []models.QuestionComment{}
+		all = append(all, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return threadComments(all, nil), nil
+}
+
+// threadComments nests the comments under parent. Comments come ordered
+// by time, so every level stays oldest first.
+func threadComments(all []models.QuestionComment, parent *int64) []models.QuestionComment {
+	result := []models.QuestionComment{}
+	for _, c := range all {
+		if (parent == nil) != (c.ParentID == nil) {
+			continue
+		}
+		if parent != nil && *c.ParentID != *parent {
+			continue
+		}
+		id := c.ID
+		c.Replies = threadComments(all, &id)
+		result = append(result, c)
+	}
+	return result
+}
+
+// CreateQuestionComment adds a comment to a question. A reply takes the
+// anchor of its parent; a new thread may be anchored to one answer option
+// of the current version.
+func CreateQuestionComment(
+	ctx context.Context,
+	qID, userID, roleID int64,
+	parentID, answerID *int64,
+	body string,
+) (*models.QuestionComment, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return nil, errors.New("comment body is required")
+	}
+
+	if err := canViewQuestion(ctx, qID, userID, roleID); err != nil {
+		return nil, err
+	}
+
+	var version int
+	if parentID != nil {
+		err := db.Pool.QueryRow(ctx, `
+			SELECT answer_id, version FROM question_comments
+			WHERE id = $1 AND question_id = $2
+		`, *parentID, qID).Scan(&answerID, &version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCommentParent
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else if answerID != nil {
+		err := db.Pool.QueryRow(ctx, `
+			SELECT a.version FROM answers a
+			JOIN questions q ON q.id = a.question_id AND q.version = a.version
+			WHERE a.id = $1 AND a.question_id = $2
+		`, *answerID, qID).Scan(&version)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrCommentAnswer
+		}
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := db.Pool.QueryRow(ctx, `
+			SELECT version FROM questions WHERE id = $1
+		`, qID).Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var id int64
+	err := db.Pool.QueryRow(ctx, `
+		INSERT INTO question_comments
+		(question_id, parent_id, answer_id, version, author_id, body, timecreated)
+		VALUES ($1,$2,$3,$4,$5,$6,$7)
+		RETURNING id
+	`, qID, parentID, answerID, version, userID, body, time.Now().Unix()).Scan(&id)
+	if err != nil {
+		return nil, err
+	}
+
+	var c models.QuestionComment
+	err = scanQuestionComment(db.Pool.QueryRow(ctx, `
+		SELECT `+questionCommentColumns+`
+		FROM question_comments c
+		LEFT JOIN answers a ON a.id = c.answer_id
+		LEFT JOIN users u ON u.id = c.author_id
+		WHERE c.id = $1
+	`, id), &c)
+	if err != nil {
+		return nil, err
+	}
+	c.Replies = []models.QuestionComment{}
+
+	return &c, nil
+}
@@ -0,0 +1,48 @@
+package repositories
+
+import (
+	"context"
+
+	"backendLMS/db"
+	"backendLMS/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func insertQuestionSources(ctx context.Context, tx pgx.Tx, questionID int64, sources []SourceInput) error {
+	for i, s := range sources {
+		_, err := tx.Exec(ctx, `
+			INSERT INTO question_sources (question_id, position, chunk_id, page, text)
+			VALUES ($1,$2,$3,$4,$5)
+		`, questionID, i+1, s.ChunkID, s.Page, s.Text)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// GetQuestionSources returns the passages a question was generated from,
+// in the order the generator listed them.
+func GetQuestionSources(ctx context.Context, questionID int64) ([]models.QuestionSource, error) {
+	rows, err := db.Pool.Query(ctx, `
+		SELECT id, question_id, chunk_id, page, text
+		FROM question_sources
+		WHERE question_id = $1
+		ORDER BY position
+	`, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	result := []models.QuestionSource{}
+	for rows.Next() {
+		var s models.QuestionSource
+		if err := rows.Scan(&s.ID, &s.QuestionID, &s.ChunkID, &s.Page, &s.Text); err != nil {
+			return nil, err
+		}
+		result = append(result, s)
+	}
+	return result, rows.Err()
+}
@@ -0,0 +1,221 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"backendLMS/db"
+	"backendLMS/models"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	ErrQuestionVersionNotFound = errors.New("question version not found")
+	ErrQuestionVersionCurrent  = errors.New("version is already the current one")
+)
+
+// bumpQuestionVersion moves a locked question to its next version number
+// and returns it.
+func bumpQuestionVersion(ctx context.Context, tx pgx.Tx, questionID int64) (int, error) {
+	var version int
+	err := tx.QueryRow(ctx, `
+		UPDATE questions
+		SET version = version + 1, timemodified = $1
+		WHERE id = $2
+		RETURNING version
+	`, time.Now().Unix(), questionID).Scan(&version)
+	return version, err
+}
+
+// snapshotQuestionVersion records the question's current fields as the
+// revision its version number stands for.
+func snapshotQuestionVersion(ctx context.Context, tx pgx.Tx, questionID, editorID int64, note string) error {
+	_, err := tx.Exec(ctx, `
+		INSERT INTO question_versions
+		(question_id, version, type, content, difficulty, taxonomy_level, created_by, note, timecreated)
+		SELECT id, version, type, content, difficulty, taxonomy_level, $2, $3, $4
+		FROM questions
+		WHERE id = $1
+	`, questionID, editorID, note, time.Now().Unix())
+	return err
+}
+
+// canViewQuestion applies the same rule as GetQuestionByID: admins see
+// every question, teachers their own and the ones they review.
+func canViewQuestion(ctx context.Context, questionID, userID, roleID int64) error {
+	var exists bool
+	err := db.Pool.QueryRow(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM questions
+			WHERE id = $1 AND ($2 OR created_by = $3 OR reviewer_id = $3)
+		)
+	`, questionID, roleID == 1, userID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrQuestionNotFound
+	}
+	return nil
+}
+
+const questionVersionColumns = `
+	v.id, v.question_id, v.version, v.type, v.content, v.difficulty,
+	v.taxonomy_level, v.created_by, v.note, v.timecreated, v.version = q.version
+`
+
+func scanQuestionVersion(row interface{ Scan(...any) error }, v *models.QuestionVersion) error {
+	return row.Scan(
+		&v.ID,
+		&v.QuestionID,
+		&v.Version,
+		&v.Type,
+		&v.Content,
+		&v.Difficulty,
+		&v.TaxonomyLevel,
+		&v.CreatedBy,
+		&v.Note,
+		&v.TimeCreated,
+		&v.Current,
+	)
+}
+
+// GetQuestionVersions lists the revisions of a question, newest first.
+func GetQuestionVersions(ctx context.Context, questionID, userID, roleID int64) ([]models.QuestionVersion, error) {
+	if err := canViewQuestion(ctx, questionID, userID, roleID); err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+questionVersionColumns+`
+		FROM question_versions v
+		JOIN questions q ON q.id = v.question_id
+		WHERE v.question_id = $1
+		ORDER BY v.version DESC
+	`, questionID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var result []models.QuestionVersion
+	for rows.Next() {
+		var v models.QuestionVersion
+		if err := scanQuestionVersion(rows, &v); err != nil {
+			return nil, err
+		}
+		result = append(result, v)
+	}
+	return result, rows.Err()
+}
+
+// GetQuestionVersion returns one revision of a question with its answers
+// and rubric.
+func GetQuestionVersion(ctx context.Context, questionID int64, version int, userID, roleID int64) (*models.QuestionVersion, error) {
+	if err := canViewQuestion(ctx, questionID, userID, roleID); err != nil {
+		return nil, err
+	}
+
+	var v models.QuestionVersion
+	err := scanQuestionVersion(db.Pool.QueryRow(ctx, `
+		SELECT `+questionVersionColumns+`
+		FROM question_versions v
+		JOIN questions q ON q.id = v.question_id
+		WHERE v.question_id = $1 AND v.version = $2
+	`, questionID, version), &v)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrQuestionVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	pin := map[int64]int{questionID: version}
+	answers, err := getAnswersByVersions(ctx, pin)
+	if err != nil {
+		return nil, err
+	}
+	rubrics, err := getRubricsByVersions(ctx, pin)
+	if err != nil {
+		return nil, err
+	}
+	v.Answers = answers[questionID]
+	v.Rubric = rubrics[questionID]
+
+	return &v, nil
+}
+
+// RestoreQuestionVersion makes an older revision current again by copying
+// it into a new version, so the history itself is never rewritten. It
+// follows the editing rules of UpdateQuestion and returns the new version.
+func RestoreQuestionVersion(ctx context.Context, questionID int64, version int, userID, roleID int64) (int, error) {
+	tx, err := db.Pool.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	var current int
+	err = tx.QueryRow(ctx, `
+		SELECT version
+		FROM questions
+		WHERE id = $1 AND ($2 OR (created_by = $3 AND status IN ('draft', 'changes_requested')))
+		FOR UPDATE
+	`, questionID, roleID == 1, userID).Scan(&current)
+	if err != nil {
+		return 0, errors.New("question not found or not editable")
+	}
+	if current == version {
+		return 0, ErrQuestionVersionCurrent
+	}
+
+	var qType, content, difficulty, taxonomy string
+	err = tx.QueryRow(ctx, `
+		SELECT type, content, difficulty, taxonomy_level
+		FROM question_versions
+		WHERE question_id = $1 AND version = $2
+	`, questionID, version).Scan(&qType, &content, &difficulty, &taxonomy)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, ErrQuestionVersionNotFound
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	var next int
+	err = tx.QueryRow(ctx, `
+		UPDATE questions
+		SET type=$1, content=$2, difficulty=$3, taxonomy_level=$4,
+		    version = version + 1, timemodified=$5
+		WHERE id=$6
+		RETURNING version
+	`, qType, content, difficulty, taxonomy, time.Now().Unix(), questionID).Scan(&next)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO answers (question_id, version, option_label, option_text, is_correct, tolerance, match_text)
+		SELECT question_id, $3, option_label, option_text, is_correct, tolerance, match_text
+		FROM answers
+		WHERE question_id = $1 AND version = $2
+		ORDER BY id
+	`, questionID, version, next)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := copyRubric(ctx, tx, questionID, version, next); err != nil {
+		return 0, err
+	}
+
+	note := fmt.Sprintf("restored from version %d", version)
+	if err := snapshotQuestionVersion(ctx, tx, questionID, userID, note); err != nil {
+		return 0, err
+	}
+
+	return next, tx.Commit(ctx)
+}
@@ -0,0 +1,210 @@
+package repositories
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"backendLMS/db"
+	"backendLMS/models"
+	"backendLMS/services"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// normalizeRubric checks a rubric against the question type. Only essays
+// have a rubric, and an essay rubric needs at least one criterion with at
+// least one level and some score to earn.
+func normalizeRubric(qType string, rubric []RubricCriterionInput) ([]RubricCriterionInput, error) {
+	if qType != services.TypeEssay {
+		if len(rubric) > 0 {
+			return nil, errors.New("rubrik hanya untuk soal esai")
+		}
+		return nil, nil
+	}
+
+	if len(rubric) == 0 {
+		return nil, errors.New("soal esai harus memiliki rubrik")
+	}
+
+	var best float64
+	result := make([]RubricCriterionInput, len(rubric))
+	for i, c := range rubric {
+		c.Title = strings.TrimSpace(c.Title)
+		if c.Title == "" {
+			return nil, errors.New("judul kriteria rubrik tidak boleh kosong")
+		}
+		if len(c.Levels) == 0 {
+			return nil, errors.New("setiap kriteria rubrik harus memiliki minimal 1 level")
+		}
+
+		top := 0.0
+		seen := make(map[float64]bool)
+		for j, l := range c.Levels {
+			if l.Score < 0 {
+				return nil, errors.New("skor level rubrik tidak boleh negatif")
+			}
+			if seen[l.Score] {
+				return nil, errors.New("skor level dalam satu kriteria tidak boleh duplikat")
+			}
+			seen[l.Score] = true
+			if strings.TrimSpace(l.Label) == "" {
+				c.Levels[j].Label = strconv.FormatFloat(l.Score, 'f', -1, 64)
+			}
+			if l.Score > top {
+				top = l.Score
+			}
+		}
+		best += top
+		result[i] = c
+	}
+
+	if best <= 0 {
+		return nil, errors.New("skor maksimal rubrik harus lebih dari 0")
+	}
+	return result, nil
+}
+
+func insertRubric(ctx context.Context, tx pgx.Tx, questionID int64, version int, rubric []RubricCriterionInput) error {
+	for i, c := range rubric {
+		var criterionID int64
+		err := tx.QueryRow(ctx, `
+			INSERT INTO rubric_criteria (question_id, version, position, title, description)
+			VALUES ($1,$2,$3,$4,$5)
+			RETURNING id
+		`, questionID, version, i+1, c.Title, c.Description).Scan(&criterionID)
+		if err != nil {
+			return err
+		}
+
+		for _, l := range c.Levels {
+			_, err := tx.Exec(ctx, `
+				INSERT INTO rubric_levels (criterion_id, score, label, description)
+				VALUES ($1,$2,$3,$4)
+			`, criterionID, l.Score, l.Label, l.Description)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// copyRubric carries the rubric of one version over to a new version of
+// the same question.
+func copyRubric(ctx context.Context, tx pgx.Tx, questionID int64, from, to int) error {
+	rubrics, err := getRubricsByVersions(ctx, map[int64]int{questionID: from})
+	if err != nil {
+		return err
+	}
+	return insertRubric(ctx, tx, questionID, to, rubricInputs(rubrics[questionID]))
+}
+
+func rubricInputs(rubric []models.RubricCriterion) []RubricCriterionInput {
+	var result []RubricCriterionInput
+	for _, c := range rubric {
+		in := RubricCriterionInput{Title: c.Title, Description: c.Description}
+		for _, l := range c.Levels {
+			in.Levels = append(in.Levels, RubricLevelInput{
+				Score:       l.Score,
+				Label:       l.Label,
+				Description: l.Description,
+			})
+		}
+		result = append(result, in)
+	}
+	return result
+}
+
+const rubricColumns = `
+	c.id, c.question_id, c.position, c.title, c.description,
+	l.id, l.score, l.label, l.description
+`
+
+func scanRubrics(rows pgx.Rows) (map[int64][]models.RubricCriterion, error) {
+	defer rows.Close()
+
+	result := make(map[int64][]models.RubricCriterion)
+	for rows.Next() {
+		var c models.RubricCriterion
+		var l models.RubricLevel
+		if err := rows.Scan(
+			&c.ID,
+			&c.QuestionID,
+			&c.Position,
+			&c.Title,
+			&c.Description,
+			&l.ID,
+			&l.Score,
+			&l.Label,
+			&l.Description,
+		); err != nil {
+			return nil, err
+		}
+		l.CriterionID = c.ID
+
+		criteria := result[c.QuestionID]
+		if n := len(criteria); n == 0 || criteria[n-1].ID != c.ID {
+			criteria = append(criteria, c)
+		}
+		last := &criteria[len(criteria)-1]
+		last.Levels = append(last.Levels, l)
+		result[c.QuestionID] = criteria
+	}
+
+	return result, rows.Err()
+}
+
+// GetRubrics returns the rubrics of the current version of the given
+// questions, criteria in order and levels from the lowest score up.
+func GetRubrics(ctx context.Context, questionIDs []int64) (map[int64][]models.RubricCriterion, error) {
+	if len(questionIDs) == 0 {
+		return make(map[int64][]models.RubricCriterion), nil
+	}
+
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+rubricColumns+`
+		FROM rubric_criteria c
+		JOIN questions q ON q.id = c.question_id AND q.version = c.version
+		JOIN rubric_levels l ON l.criterion_id = c.id
+		WHERE c.question_id = ANY($1)
+		ORDER BY c.question_id, c.position, l.score, l.id
+	`, questionIDs)
+	if err != nil {
+		return nil, err
+	}
+	return scanRubrics(rows)
+}
+
+// getRubricsByVersions returns the rubrics of the given version of each
+// question.
+func getRubricsByVersions(ctx context.Context, versions map[int64]int) (map[int64][]models.RubricCriterion, error) {
+	if len(versions) == 0 {
+		return make(map[int64][]models.RubricCriterion), nil
+	}
+
+	ids, nums := splitVersions(versions)
+	rows, err := db.Pool.Query(ctx, `
+		SELECT `+rubricColumns+`
+		FROM rubric_criteria c
+		JOIN unnest($1::bigint[], $2::int[]) AS p(question_id, version)
+		  ON p.question_id = c.question_id AND p.version = c.version
+		JOIN rubric_levels l ON l.criterion_id = c.id
+		ORDER BY c.question_id, c.position, l.score, l.id
+	`, ids, nums)
+	if err != nil {
+		return nil, err
+	}
+	return scanRubrics(rows)
+}
+
+// GetRubric returns the rubric of one question; it is empty for questions
+// other than essays.
+func GetRubric(ctx context.Context, questionID int64) ([]models.RubricCriterion, error) {
+	rubrics, err := GetRubrics(ctx, []int64{questionID})
+	if err != nil {
+		return nil, err
+	}
+	return rubrics[questionID], nil
+}
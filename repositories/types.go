@@ -1,7 +1,110 @@
 package repositories
 
+import (
+	"backendLMS/models"
+	"backendLMS/services"
+)
+
 type AnswerInput struct {
 	Label     string
 	Text      string
 	IsCorrect bool
+	Tolerance *float64
+	MatchText string
+}
+
+type ExamItemInput struct {
+	QuestionID int64
+	Points     float64
+}
+
+type BankFilter struct {
+	CourseID       int64
+	ChapterIDs     []int64
+	TaxonomyLevels []string
+}
+
+// AttemptAnswerInput is a response to one question; see
+// models.AttemptAnswer for which field each question type uses.
+type AttemptAnswerInput struct {
+	QuestionID int64
+	AnswerID   *int64
+	AnswerIDs  []int64
+	Text       *string
+	Pairs      map[int64]int64
+}
+
+// RubricCriterionInput is one criterion of an essay rubric with its score
+// levels.
+type RubricCriterionInput struct {
+	Title       string
+	Description string
+	Levels      []RubricLevelInput
+}
+
+type RubricLevelInput struct {
+	Score       float64
+	Label       string
+	Description string
+}
+
+// GenerationJobInput is a generation request as the teacher sent it.
+// A template chosen explicitly wins over the preset's template, and
+// taxonomy levels or an option count given explicitly win over the
+// preset's. Per-difficulty counts replace the preset's difficulty.
+//
+// The scope is the union of MaterialID, MaterialIDs and the materials of
+// ChapterID that carry any of TagIDs (either filter may be left out).
+type GenerationJobInput struct {
+	MaterialID   int64
+	MaterialIDs  []int64
+	ChapterID    *int64
+	TagIDs       []int64
+	QuestionType string
+	Instruction  string
+	PresetID     *int64
+	TemplateID   *int64
+
+	TaxonomyLevels []string
+	OptionCount    *int
+	Spec           services.GenerationSpec
+}
+
+// GenerationOutcome is what the generation calls of a job produced: the
+// validated items, the error of each material whose share failed and the
+// tokens used per material (0 for a call over the whole scope).
+type GenerationOutcome struct {
+	Items    []GeneratedInput
+	Failures map[int64]string
+	Usage    map[int64]models.TokenUsage
+}
+
+// GeneratedInput is one item of a generation call after validation.
+// Question is nil when the item was rejected for RejectReason; Repairs
+// lists what validation fixed.
+type GeneratedInput struct {
+	Question     *QuestionInput
+	MaterialID   int64 // 0: the batch's material
+	Content      string
+	Repairs      []string
+	RejectReason string
+}
+
+// QuestionInput is a question to insert with its answers and rubric.
+type QuestionInput struct {
+	Type          string
+	Content       string
+	Difficulty    string
+	TaxonomyLevel string
+	Answers       []AnswerInput
+	Rubric        []RubricCriterionInput
+	Sources       []SourceInput
+}
+
+// SourceInput is a passage of the material a generated question was
+// written from.
+type SourceInput struct {
+	ChunkID string
+	Page    *int
+	Text    string
 }
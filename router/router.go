@@ -26,6 +26,13 @@ func New() http.Handler {
 	// ======================
 	// PROTECTED ROUTES (JWT)
 	// ======================
+	// the event stream also takes its token from the query string, so it
+	// is matched before the /api subrouter and its header-only auth
+	r.Handle(
+		"/api/events",
+		middlewares.EventStreamAuth(http.HandlerFunc(handlers.StreamProgress)),
+	).Methods("GET")
+
 	api := r.PathPrefix("/api").Subrouter()
 	api.Use(middlewares.JWTAuth)
 
@@ -42,10 +49,27 @@ func New() http.Handler {
 
 	// ---- Question Management (ADMIN FULL CRUD)
 	admin.HandleFunc("/questions", handlers.GetQuestions).Methods("GET")
+	admin.HandleFunc("/questions", handlers.CreateQuestion).Methods("POST")
+	admin.HandleFunc("/questions/duplicates", handlers.ScanDuplicateQuestions).Methods("GET")
 	admin.HandleFunc("/questions/{id}", handlers.GetQuestionDetail).Methods("GET")
 	admin.HandleFunc("/questions/{id}", handlers.UpdateQuestion).Methods("PUT")
 	admin.HandleFunc("/questions/{id}", handlers.DeleteQuestion).Methods("DELETE")
 	admin.HandleFunc("/questions/{id}/status", handlers.UpdateQuestionStatus).Methods("PATCH")
+	admin.HandleFunc("/questions/{id}/reviewer", handlers.AssignQuestionReviewer).Methods("PUT")
+	admin.HandleFunc("/questions/{id}/review-history", handlers.GetQuestionReviewHistory).Methods("GET")
+	admin.HandleFunc("/questions/{id}/comments", handlers.GetQuestionComments).Methods("GET")
+	admin.HandleFunc("/questions/{id}/comments", handlers.CreateQuestionComment).Methods("POST")
+	admin.HandleFunc("/review-queue", handlers.GetReviewQueue).Methods("GET")
+	admin.HandleFunc("/generation-batches", handlers.GetGenerationBatches).Methods("GET")
+	admin.HandleFunc("/generation-batches/{id}", handlers.GetGenerationBatch).Methods("GET")
+	admin.HandleFunc("/generation-batches/{id}/review", handlers.ReviewGenerationBatch).Methods("POST")
+	admin.HandleFunc("/questions/{id}/item-analysis", handlers.GetQuestionItemAnalysis).Methods("GET")
+	admin.HandleFunc("/questions/{id}/versions", handlers.GetQuestionVersions).Methods("GET")
+	admin.HandleFunc("/questions/{id}/versions/diff", handlers.DiffQuestionVersions).Methods("GET")
+	admin.HandleFunc("/questions/{id}/versions/{version:[0-9]+}", handlers.GetQuestionVersion).Methods("GET")
+	admin.HandleFunc("/questions/{id}/versions/{version:[0-9]+}/restore", handlers.RestoreQuestionVersion).Methods("POST")
+	admin.HandleFunc("/questions/export", handlers.ExportQuestions).Methods("POST")
+	admin.HandleFunc("/questions/import", handlers.ImportQuestions).Methods("POST")
 
 	// ---- Answer Management (ADMIN)
 	admin.HandleFunc(
@@ -133,11 +157,32 @@ func New() http.Handler {
 		handlers.CreateMaterial,
 	).Methods("POST")
 
+	teacher.HandleFunc(
+		"/materials/{id}/ingest",
+		handlers.RetriggerMaterialIngestion,
+	).Methods("POST")
+
 	teacher.HandleFunc("/questions", handlers.GetQuestions).Methods("GET")
+	teacher.HandleFunc("/questions", handlers.CreateQuestion).Methods("POST")
 	teacher.HandleFunc("/questions/{id}", handlers.GetQuestionDetail).Methods("GET")
 	teacher.HandleFunc("/questions/{id}", handlers.UpdateQuestion).Methods("PUT")
 	teacher.HandleFunc("/questions/{id}", handlers.DeleteQuestion).Methods("DELETE")
 	teacher.HandleFunc("/questions/{id}/status", handlers.UpdateQuestionStatus).Methods("PATCH")
+	teacher.HandleFunc("/questions/{id}/reviewer", handlers.AssignQuestionReviewer).Methods("PUT")
+	teacher.HandleFunc("/questions/{id}/review-history", handlers.GetQuestionReviewHistory).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/comments", handlers.GetQuestionComments).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/comments", handlers.CreateQuestionComment).Methods("POST")
+	teacher.HandleFunc("/review-queue", handlers.GetReviewQueue).Methods("GET")
+	teacher.HandleFunc("/generation-batches", handlers.GetGenerationBatches).Methods("GET")
+	teacher.HandleFunc("/generation-batches/{id}", handlers.GetGenerationBatch).Methods("GET")
+	teacher.HandleFunc("/generation-batches/{id}/review", handlers.ReviewGenerationBatch).Methods("POST")
+	teacher.HandleFunc("/questions/{id}/item-analysis", handlers.GetQuestionItemAnalysis).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/versions", handlers.GetQuestionVersions).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/versions/diff", handlers.DiffQuestionVersions).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/versions/{version:[0-9]+}", handlers.GetQuestionVersion).Methods("GET")
+	teacher.HandleFunc("/questions/{id}/versions/{version:[0-9]+}/restore", handlers.RestoreQuestionVersion).Methods("POST")
+	teacher.HandleFunc("/questions/export", handlers.ExportQuestions).Methods("POST")
+	teacher.HandleFunc("/questions/import", handlers.ImportQuestions).Methods("POST")
 
 	// ---- Answer Management (TEACHER)
 	teacher.HandleFunc(
@@ -186,6 +231,9 @@ func New() http.Handler {
 	// ---- Material (ADMIN)
 	admin.HandleFunc("/materials/{id}", handlers.UpdateMaterial).Methods("PUT")
 	admin.HandleFunc("/materials/{id}", handlers.DeleteMaterial).Methods("DELETE")
+	admin.HandleFunc("/materials/{id}/ingest", handlers.RetriggerMaterialIngestion).Methods("POST")
+	admin.HandleFunc("/vector-purges", handlers.GetVectorPurges).Methods("GET")
+	admin.HandleFunc("/vector-purges/{id}/retry", handlers.RetryVectorPurge).Methods("POST")
 	api.HandleFunc("/materials", handlers.GetMaterials).Methods("GET")
 	api.HandleFunc("/materials/{id}", handlers.GetMaterialByID).Methods("GET")
 	admin.HandleFunc(
@@ -251,6 +299,66 @@ func New() http.Handler {
 		"/questions/rag_generate",
 		handlers.GenerateQuestionFromRAG,
 	).Methods("POST")
+	teacher.HandleFunc("/generation-jobs", handlers.GetGenerationJobs).Methods("GET")
+	teacher.HandleFunc("/generation-jobs/{id}", handlers.GetGenerationJob).Methods("GET")
+	teacher.HandleFunc("/prompt-templates", handlers.GetPromptTemplates).Methods("GET")
+	teacher.HandleFunc("/generation-presets", handlers.GetGenerationPresets).Methods("GET")
+	teacher.HandleFunc("/generation-usage", handlers.GetMyGenerationUsage).Methods("GET")
+
+	// ---- Prompt Templates & Generation Presets (ADMIN)
+	admin.HandleFunc("/prompt-templates", handlers.GetPromptTemplates).Methods("GET")
+	admin.HandleFunc("/prompt-templates", handlers.CreatePromptTemplate).Methods("POST")
+	admin.HandleFunc("/prompt-templates/{id}", handlers.GetPromptTemplate).Methods("GET")
+	admin.HandleFunc("/prompt-templates/{id}", handlers.UpdatePromptTemplate).Methods("PUT")
+	admin.HandleFunc("/prompt-templates/{id}/versions", handlers.GetPromptTemplateVersions).Methods("GET")
+	admin.HandleFunc("/generation-presets", handlers.GetGenerationPresets).Methods("GET")
+	admin.HandleFunc("/generation-presets", handlers.CreateGenerationPreset).Methods("POST")
+	admin.HandleFunc("/generation-presets/{id}", handlers.GetGenerationPreset).Methods("GET")
+	admin.HandleFunc("/generation-presets/{id}", handlers.UpdateGenerationPreset).Methods("PUT")
+	admin.HandleFunc("/generation-presets/{id}", handlers.DeleteGenerationPreset).Methods("DELETE")
+
+	// ---- Generation Usage & Quotas (ADMIN)
+	admin.HandleFunc("/generation-usage", handlers.GetGenerationUsage).Methods("GET")
+	admin.HandleFunc("/generation-quotas", handlers.GetGenerationQuotas).Methods("GET")
+	admin.HandleFunc("/generation-quotas/{target:roles|users}/{id}", handlers.SetGenerationQuota).Methods("PUT")
+	admin.HandleFunc("/generation-quotas/{id}", handlers.DeleteGenerationQuota).Methods("DELETE")
+
+	// ---- Exams (TEACHER - OWN ONLY)
+	teacher.HandleFunc("/exams/bank", handlers.GetExamBank).Methods("GET")
+	teacher.HandleFunc("/exams", handlers.GetExams).Methods("GET")
+	teacher.HandleFunc("/exams", handlers.CreateExam).Methods("POST")
+	teacher.HandleFunc("/exams/generate", handlers.GenerateExamFromBlueprint).Methods("POST")
+	teacher.HandleFunc("/exams/{id}", handlers.GetExamDetail).Methods("GET")
+	teacher.HandleFunc("/exams/{id}", handlers.UpdateExam).Methods("PUT")
+	teacher.HandleFunc("/exams/{id}", handlers.DeleteExam).Methods("DELETE")
+	teacher.HandleFunc("/exams/{id}/questions", handlers.SetExamQuestions).Methods("PUT")
+	teacher.HandleFunc("/exams/{id}/publish", handlers.PublishExam).Methods("POST")
+	teacher.HandleFunc("/exams/{id}/export/qti", handlers.ExportExamQTI).Methods("GET")
+	teacher.HandleFunc("/exams/{id}/print", handlers.PrintExam).Methods("GET")
+	teacher.HandleFunc("/exams/{id}/print/answer-key", handlers.PrintExamAnswerKey).Methods("GET")
+
+	// ---- Exam Results (TEACHER - OWN EXAMS)
+	teacher.HandleFunc("/exams/{id}/attempts", handlers.GetExamAttempts).Methods("GET")
+	teacher.HandleFunc("/attempts/{id}", handlers.TeacherGetAttempt).Methods("GET")
+	teacher.HandleFunc("/exams/{id}/item-analysis", handlers.GetExamItemAnalysis).Methods("GET")
+
+	// ---- Essay Grading (TEACHER - OWN EXAMS)
+	teacher.HandleFunc("/grading-queue", handlers.GetGradingQueue).Methods("GET")
+	teacher.HandleFunc("/attempts/{id}/questions/{question_id}/grade", handlers.GradeEssay).Methods("PUT")
+
+	// ======================
+	// STUDENT ONLY
+	// ======================
+	student := api.PathPrefix("/student").Subrouter()
+	student.Use(middlewares.RequireRoles(3)) // ROLE_STUDENT
+
+	// ---- Exam Attempts (STUDENT - ENROLLED COURSES)
+	student.HandleFunc("/exams", handlers.StudentGetExams).Methods("GET")
+	student.HandleFunc("/exams/{id}/attempts", handlers.StartAttempt).Methods("POST")
+	student.HandleFunc("/attempts", handlers.StudentGetAttempts).Methods("GET")
+	student.HandleFunc("/attempts/{id}", handlers.StudentGetAttempt).Methods("GET")
+	student.HandleFunc("/attempts/{id}/answers", handlers.SaveAttemptAnswers).Methods("PUT")
+	student.HandleFunc("/attempts/{id}/submit", handlers.SubmitAttempt).Methods("POST")
 
 	// Setup CORS
 	c := cors.New(cors.Options{
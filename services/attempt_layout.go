@@ -0,0 +1,80 @@
+package services
+
+import (
+	"strconv"
+
+	"backendLMS/models"
+)
+
+// LayoutItems lays out exam items as one attempt or printed variant shows
+// them: questions in the order given by the seed, options relabelled A, B,
+// C... in their shuffled order. The answer key is only included when reveal
+// is set.
+func LayoutItems(items []models.ExamItem, seed int64, shuffleQuestions, shuffleOptions, reveal bool) []models.AttemptQuestion {
+	order := identity(len(items))
+	if shuffleQuestions {
+		order = QuestionOrder(seed, len(items))
+	}
+
+	var result []models.AttemptQuestion
+	for pos, idx := range order {
+		it := items[idx]
+		q := models.AttemptQuestion{
+			Position:   pos + 1,
+			Points:     it.Points,
+			QuestionID: it.Question.ID,
+			Type:       it.Question.Type,
+			Content:    it.Question.Content,
+		}
+
+		if !HasOptions(it.Question.Type) && !reveal {
+			result = append(result, q)
+			continue
+		}
+
+		optOrder := identity(len(it.Answers))
+		if shuffleOptions {
+			optOrder = OptionOrder(seed, it.Question.ID, len(it.Answers))
+		}
+		for i, oi := range optOrder {
+			a := it.Answers[oi]
+			opt := models.AttemptOption{
+				AnswerID: a.ID,
+				Label:    OptionLabel(i),
+				Text:     a.Text,
+			}
+			if it.Question.Type == TypeMatching {
+				opt.Label = strconv.Itoa(i + 1)
+			}
+			if reveal {
+				isCorrect := a.IsCorrect
+				opt.OriginalLabel = a.Label
+				opt.IsCorrect = &isCorrect
+				opt.Tolerance = a.Tolerance
+			}
+			q.Options = append(q.Options, opt)
+		}
+
+		if it.Question.Type == TypeMatching {
+			for i, mi := range MatchOrder(seed, it.Question.ID, len(it.Answers)) {
+				a := it.Answers[mi]
+				q.Matches = append(q.Matches, models.AttemptOption{
+					AnswerID: a.ID,
+					Label:    OptionLabel(i),
+					Text:     a.MatchText,
+				})
+			}
+		}
+
+		result = append(result, q)
+	}
+	return result
+}
+
+func identity(n int) []int {
+	order := make([]int, n)
+	for i := range order {
+		order[i] = i
+	}
+	return order
+}
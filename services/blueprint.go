@@ -0,0 +1,61 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+var Difficulties = []string{"easy", "medium", "hard"}
+
+// AllocateByPercentage splits total items across the keys of mix, where each
+// value is a percentage. Rounding uses the largest remainder method so the
+// counts always add up to total.
+func AllocateByPercentage(total int, mix map[string]float64) (map[string]int, error) {
+	if total <= 0 {
+		return nil, errors.New("total must be greater than 0")
+	}
+	if len(mix) == 0 {
+		return nil, errors.New("difficulty mix is empty")
+	}
+
+	var sum float64
+	keys := make([]string, 0, len(mix))
+	for k, p := range mix {
+		if p < 0 {
+			return nil, fmt.Errorf("percentage for %q cannot be negative", k)
+		}
+		sum += p
+		keys = append(keys, k)
+	}
+	if math.Abs(sum-100) > 0.01 {
+		return nil, fmt.Errorf("percentages must add up to 100, got %.2f", sum)
+	}
+	sort.Strings(keys)
+
+	counts := make(map[string]int, len(mix))
+	remainders := make([]float64, len(keys))
+	assigned := 0
+	for i, k := range keys {
+		exact := float64(total) * mix[k] / 100
+		counts[k] = int(math.Floor(exact))
+		remainders[i] = exact - math.Floor(exact)
+		assigned += counts[k]
+	}
+
+	order := make([]int, len(keys))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool {
+		return remainders[order[a]] > remainders[order[b]]
+	})
+
+	for i := 0; assigned < total; i++ {
+		counts[keys[order[i%len(order)]]]++
+		assigned++
+	}
+
+	return counts, nil
+}
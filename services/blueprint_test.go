@@ -0,0 +1,88 @@
+package services
+
+import (
+	"maps"
+	"strings"
+	"testing"
+)
+
+func TestAllocateByPercentage(t *testing.T) {
+	tests := []struct {
+		name    string
+		total   int
+		mix     map[string]float64
+		want    map[string]int
+		wantErr string
+	}{
+		{
+			name:  "exact split",
+			total: 10,
+			mix:   map[string]float64{"easy": 30, "medium": 50, "hard": 20},
+			want:  map[string]int{"easy": 3, "medium": 5, "hard": 2},
+		},
+		{
+			name:  "largest remainder gets the leftover",
+			total: 7,
+			mix:   map[string]float64{"easy": 20, "medium": 50, "hard": 30},
+			want:  map[string]int{"easy": 1, "medium": 4, "hard": 2},
+		},
+		{
+			name:  "thirds add up to the total",
+			total: 10,
+			mix:   map[string]float64{"easy": 33.3, "medium": 33.3, "hard": 33.4},
+			want:  map[string]int{"easy": 3, "medium": 3, "hard": 4},
+		},
+		{
+			name:  "ties go to the keys in sorted order",
+			total: 5,
+			mix:   map[string]float64{"hard": 50, "easy": 50},
+			want:  map[string]int{"easy": 3, "hard": 2},
+		},
+		{
+			name:  "a zero share stays empty",
+			total: 4,
+			mix:   map[string]float64{"easy": 0, "hard": 100},
+			want:  map[string]int{"easy": 0, "hard": 4},
+		},
+		{
+			name:    "total must be positive",
+			total:   0,
+			mix:     map[string]float64{"easy": 100},
+			wantErr: "total must be greater than 0",
+		},
+		{
+			name:    "empty mix",
+			total:   5,
+			wantErr: "difficulty mix is empty",
+		},
+		{
+			name:    "negative percentage",
+			total:   5,
+			mix:     map[string]float64{"easy": 110, "hard": -10},
+			wantErr: "cannot be negative",
+		},
+		{
+			name:    "percentages must add up to 100",
+			total:   5,
+			mix:     map[string]float64{"easy": 50, "hard": 40},
+			wantErr: "must add up to 100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AllocateByPercentage(tt.total, tt.mix)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !maps.Equal(got, tt.want) {
+				t.Errorf("counts = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package services
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backendLMS/models"
+)
+
+// PrintHeader is the information printed at the top of a paper exam.
+type PrintHeader struct {
+	ExamTitle       string
+	CourseName      string
+	ClassName       string
+	Date            string
+	DurationMinutes int
+	Variant         int // 0 when the exam is printed without variants
+}
+
+// VariantSeed derives the shuffle seed of a printed variant. Variant 1 keeps
+// the exam order so the teacher's copy matches the online preview.
+func VariantSeed(examID int64, variant int) int64 {
+	return examID*1000003 + int64(variant)*7919
+}
+
+// LayoutVariant returns the exam items as they are printed in the given
+// variant, with the answer key included. Whether questions and options move
+// follows the exam's shuffle settings.
+func LayoutVariant(exam *models.Exam, items []models.ExamItem, variant int) []models.AttemptQuestion {
+	shuffle := variant > 1
+	return LayoutItems(
+		items,
+		VariantSeed(exam.ID, variant),
+		shuffle && exam.ShuffleQuestions,
+		shuffle && exam.ShuffleOptions,
+		true,
+	)
+}
+
+// RenderExamPDF renders the student copy of a variant.
+func RenderExamPDF(h PrintHeader, questions []models.AttemptQuestion) []byte {
+	d := newPDFDocument()
+	writePrintHeader(d, h, "")
+
+	// student details
+	d.space(8)
+	for _, label := range []string{"Name", "Student No."} {
+		d.space(20)
+		d.textAt(pdfMargin, d.y, fontRegular, 10, label+":")
+		d.line(pdfMargin+70, d.y-2, pdfMargin+300, d.y-2)
+	}
+	d.space(18)
+
+	const (
+		size        = 10.5
+		numberX     = pdfMargin
+		contentX    = pdfMargin + 22
+		optionLabel = pdfMargin + 30
+		optionX     = pdfMargin + 46
+		essayLines  = 8
+	)
+
+	for _, q := range questions {
+		number := strconv.Itoa(q.Position) + "."
+		content := q.Content
+		switch q.Type {
+		case TypeMultipleResponse:
+			content += " (choose all that apply)"
+		case TypeMatching:
+			content += " (match each item with a letter)"
+		}
+		if q.Points != 1 {
+			content += " (" + formatPoints(q.Points) + " pts)"
+		}
+
+		// short answer and numeric rows are the key, not options
+		var options []models.AttemptOption
+		if HasOptions(q.Type) {
+			options = append(options, q.Options...)
+		}
+		if q.Type == TypeMatching {
+			for i := range options {
+				options[i].Text = "____  " + options[i].Text
+			}
+			options = append(options, q.Matches...)
+		}
+
+		// keep a question and its options on one page when they fit
+		height := paragraphHeight(contentX, contentX, fontRegular, size, content)
+		for _, o := range options {
+			height += paragraphHeight(optionX, optionX, fontRegular, size, o.Text)
+		}
+		if q.Type == TypeEssay {
+			height += essayLines * 22
+		} else if !HasOptions(q.Type) {
+			height += 24
+		}
+		if height < pdfPageHeight-2*pdfMargin {
+			d.ensure(height + 12)
+		}
+
+		d.space(12)
+		d.ensure(size * 1.35)
+		top := d.y
+		d.paragraph(contentX, contentX, fontRegular, size, content)
+		d.textAt(numberX, top-size*1.35, fontBold, size, number)
+
+		for i, o := range options {
+			if q.Type == TypeMatching && i == len(q.Options) {
+				d.space(4)
+			}
+			d.ensure(size * 1.35)
+			start := d.y
+			d.paragraph(optionX, optionX, fontRegular, size, o.Text)
+			d.textAt(optionLabel, start-size*1.35, fontRegular, size, o.Label+".")
+		}
+
+		if q.Type == TypeEssay {
+			for i := 0; i < essayLines; i++ {
+				d.ensure(22)
+				d.space(22)
+				d.line(contentX, d.y-2, pdfPageWidth-pdfMargin, d.y-2)
+			}
+		} else if !HasOptions(q.Type) {
+			d.ensure(24)
+			d.space(22)
+			d.textAt(contentX, d.y, fontRegular, size, "Answer:")
+			d.line(contentX+45, d.y-2, contentX+300, d.y-2)
+		}
+	}
+
+	return d.Bytes()
+}
+
+// RenderAnswerKeyPDF renders the answer key of a variant.
+func RenderAnswerKeyPDF(h PrintHeader, questions []models.AttemptQuestion) []byte {
+	d := newPDFDocument()
+	writePrintHeader(d, h, "ANSWER KEY")
+	d.space(24)
+
+	const (
+		size = 11.0
+		lead = 18.0
+	)
+
+	const (
+		pointsX = pdfMargin + 40
+		keyX    = pdfMargin + 100
+	)
+
+	d.textAt(pdfMargin, d.y, fontBold, size, "No.")
+	d.textAt(pointsX, d.y, fontBold, size, "Points")
+	d.textAt(keyX, d.y, fontBold, size, "Answer")
+	d.line(pdfMargin, d.y-5, pdfPageWidth-pdfMargin, d.y-5)
+
+	var total float64
+	for _, q := range questions {
+		total += q.Points
+
+		lines := wrapText(AnswerKeyText(q), fontBold, size, pdfPageWidth-pdfMargin-keyX, pdfPageWidth-pdfMargin-keyX)
+		d.ensure(lead * float64(len(lines)))
+		for i, ln := range lines {
+			d.space(lead)
+			if i == 0 {
+				d.textAt(pdfMargin, d.y, fontRegular, size, strconv.Itoa(q.Position))
+				d.textAt(pointsX, d.y, fontRegular, size, formatPoints(q.Points))
+			}
+			d.textAt(keyX, d.y, fontBold, size, ln)
+		}
+	}
+
+	d.ensure(lead + 8)
+	d.space(8)
+	d.line(pdfMargin, d.y-5, pdfPageWidth-pdfMargin, d.y-5)
+	d.space(lead)
+	d.textAt(pdfMargin, d.y, fontBold, size, "Total")
+	d.textAt(pointsX, d.y, fontBold, size, formatPoints(total))
+
+	return d.Bytes()
+}
+
+func writePrintHeader(d *pdfDocument, h PrintHeader, subtitle string) {
+	title := h.ExamTitle
+	if subtitle != "" {
+		title = subtitle + " - " + title
+	}
+	d.paragraph(pdfMargin, pdfMargin, fontBold, 15, title)
+	d.space(6)
+
+	left := []string{"Course: " + h.CourseName}
+	if h.ClassName != "" {
+		left = append(left, "Class: "+h.ClassName)
+	}
+	right := []string{"Date: " + h.Date}
+	if h.DurationMinutes > 0 {
+		right = append(right, fmt.Sprintf("Duration: %d minutes", h.DurationMinutes))
+	}
+	if h.Variant > 0 {
+		right = append(right, "Variant: "+OptionLabel(h.Variant-1))
+	}
+
+	rows := len(left)
+	if len(right) > rows {
+		rows = len(right)
+	}
+	for i := 0; i < rows; i++ {
+		d.space(15)
+		if i < len(left) {
+			d.textAt(pdfMargin, d.y, fontRegular, 10, left[i])
+		}
+		if i < len(right) {
+			d.textAt(pdfPageWidth/2+40, d.y, fontRegular, 10, right[i])
+		}
+	}
+
+	d.space(10)
+	d.line(pdfMargin, d.y, pdfPageWidth-pdfMargin, d.y)
+}
+
+// AnswerKeyText describes the expected response to a laid out question
+// using the labels of that layout.
+func AnswerKeyText(q models.AttemptQuestion) string {
+	var parts []string
+	switch q.Type {
+	case TypeEssay:
+		return "Essay, graded with its rubric"
+
+	case TypeShortAnswer:
+		for _, o := range q.Options {
+			parts = append(parts, o.Text)
+		}
+		return strings.Join(parts, " / ")
+
+	case TypeNumeric:
+		if len(q.Options) == 0 {
+			return "-"
+		}
+		o := q.Options[0]
+		if o.Tolerance != nil && *o.Tolerance > 0 {
+			return o.Text + " +/- " + formatPoints(*o.Tolerance)
+		}
+		return o.Text
+
+	case TypeMatching:
+		right := make(map[int64]string)
+		for _, m := range q.Matches {
+			right[m.AnswerID] = m.Label
+		}
+		for _, o := range q.Options {
+			parts = append(parts, o.Label+"-"+right[o.AnswerID])
+		}
+		return strings.Join(parts, ", ")
+
+	default:
+		for _, o := range q.Options {
+			if o.IsCorrect != nil && *o.IsCorrect {
+				parts = append(parts, o.Label)
+			}
+		}
+		if len(parts) == 0 {
+			return "-"
+		}
+		return strings.Join(parts, ", ")
+	}
+}
+
+func formatPoints(p float64) string {
+	return strconv.FormatFloat(p, 'f', -1, 64)
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"backendLMS/models"
+)
+
+func printItems(n int) []models.ExamItem {
+	var items []models.ExamItem
+	for i := range n {
+		id := int64(i + 1)
+		items = append(items, models.ExamItem{
+			Points:   1,
+			Question: models.Question{ID: id, Type: TypeMultipleChoice},
+			Answers: []models.Answer{
+				{ID: id * 10, Label: "A", IsCorrect: true},
+				{ID: id*10 + 1, Label: "B"},
+				{ID: id*10 + 2, Label: "C"},
+				{ID: id*10 + 3, Label: "D"},
+			},
+		})
+	}
+	return items
+}
+
+func questionIDs(qs []models.AttemptQuestion) []int64 {
+	var ids []int64
+	for _, q := range qs {
+		ids = append(ids, q.QuestionID)
+	}
+	return ids
+}
+
+func TestLayoutVariant(t *testing.T) {
+	items := printItems(8)
+	stored := []int64{1, 2, 3, 4, 5, 6, 7, 8}
+	tests := []struct {
+		name     string
+		exam     models.Exam
+		variant  int
+		shuffled bool
+	}{
+		{name: "unnumbered copy keeps the exam order", exam: models.Exam{ID: 5, ShuffleQuestions: true}, variant: 0},
+		{name: "variant 1 keeps the exam order", exam: models.Exam{ID: 5, ShuffleQuestions: true}, variant: 1},
+		{name: "later variants are shuffled", exam: models.Exam{ID: 5, ShuffleQuestions: true}, variant: 2, shuffled: true},
+		{name: "an exam without shuffling prints one order", exam: models.Exam{ID: 5}, variant: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := LayoutVariant(&tt.exam, items, tt.variant)
+			ids := questionIDs(got)
+			if shuffled := !slices.Equal(ids, stored); shuffled != tt.shuffled {
+				t.Errorf("order = %v, shuffled = %v, want %v", ids, shuffled, tt.shuffled)
+			}
+			if again := questionIDs(LayoutVariant(&tt.exam, items, tt.variant)); !slices.Equal(again, ids) {
+				t.Errorf("reprinting gave %v, first print %v", again, ids)
+			}
+			for i, q := range got {
+				if q.Position != i+1 {
+					t.Errorf("question %d has position %d", i+1, q.Position)
+				}
+				if AnswerKeyText(q) == "-" {
+					t.Errorf("question %d lost its key", q.QuestionID)
+				}
+			}
+		})
+	}
+
+	if slices.Equal(questionIDs(LayoutVariant(&models.Exam{ID: 5, ShuffleQuestions: true}, items, 2)),
+		questionIDs(LayoutVariant(&models.Exam{ID: 5, ShuffleQuestions: true}, items, 3))) {
+		t.Error("variants 2 and 3 print the same order")
+	}
+}
+
+func TestAnswerKeyText(t *testing.T) {
+	yes, no := true, false
+	tolerance := 0.25
+	tests := []struct {
+		name string
+		q    models.AttemptQuestion
+		want string
+	}{
+		{
+			name: "multiple choice",
+			q: models.AttemptQuestion{Type: TypeMultipleChoice, Options: []models.AttemptOption{
+				{Label: "A", IsCorrect: &no}, {Label: "B", IsCorrect: &yes},
+			}},
+			want: "B",
+		},
+		{
+			name: "multiple response",
+			q: models.AttemptQuestion{Type: TypeMultipleResponse, Options: []models.AttemptOption{
+				{Label: "A", IsCorrect: &yes}, {Label: "B", IsCorrect: &no}, {Label: "C", IsCorrect: &yes},
+			}},
+			want: "A, C",
+		},
+		{
+			name: "choice without a key",
+			q:    models.AttemptQuestion{Type: TypeTrueFalse, Options: []models.AttemptOption{{Label: "A"}}},
+			want: "-",
+		},
+		{
+			name: "short answer",
+			q:    models.AttemptQuestion{Type: TypeShortAnswer, Options: []models.AttemptOption{{Text: "Jupiter"}, {Text: "Yupiter"}}},
+			want: "Jupiter / Yupiter",
+		},
+		{
+			name: "numeric with tolerance",
+			q:    models.AttemptQuestion{Type: TypeNumeric, Options: []models.AttemptOption{{Text: "3.5", Tolerance: &tolerance}}},
+			want: "3.5 +/- 0.25",
+		},
+		{
+			name: "numeric without an answer",
+			q:    models.AttemptQuestion{Type: TypeNumeric},
+			want: "-",
+		},
+		{
+			name: "matching",
+			q: models.AttemptQuestion{
+				Type:    TypeMatching,
+				Options: []models.AttemptOption{{AnswerID: 1, Label: "1"}, {AnswerID: 2, Label: "2"}},
+				Matches: []models.AttemptOption{{AnswerID: 2, Label: "A"}, {AnswerID: 1, Label: "B"}},
+			},
+			want: "1-B, 2-A",
+		},
+		{
+			name: "essay",
+			q:    models.AttemptQuestion{Type: TypeEssay},
+			want: "Essay, graded with its rubric",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := AnswerKeyText(tt.q); got != tt.want {
+				t.Errorf("key = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRenderExamPDF(t *testing.T) {
+	questions := LayoutVariant(&models.Exam{ID: 5}, printItems(40), 1)
+	h := PrintHeader{ExamTitle: "Ujian (Akhir)", CourseName: "Biologi", DurationMinutes: 90, Variant: 1}
+
+	for name, pdf := range map[string][]byte{
+		"exam":       RenderExamPDF(h, questions),
+		"answer key": RenderAnswerKeyPDF(h, questions),
+	} {
+		if !bytes.HasPrefix(pdf, []byte("%PDF-")) || !bytes.HasSuffix(bytes.TrimSpace(pdf), []byte("%%EOF")) {
+			t.Errorf("%s is not a complete PDF", name)
+		}
+	}
+}
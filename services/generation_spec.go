@@ -0,0 +1,170 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"backendLMS/models"
+)
+
+// MaxGenerationCount bounds the questions one generation request may ask
+// for.
+const MaxGenerationCount = 50
+
+// GenerationLanguages are the languages questions can be generated in.
+var GenerationLanguages = []string{"id", "en"}
+
+// GenerationSpec is the structured part of a generation request. A zero
+// Count leaves the count to the free-text instruction.
+type GenerationSpec struct {
+	Count            int
+	DifficultyCounts map[string]int
+	Language         string
+}
+
+// NormalizeGenerationSpec validates the spec in place. The count defaults
+// to the sum of the per-difficulty counts and must match it when both are
+// given; the language defaults to Indonesian.
+func NormalizeGenerationSpec(s *GenerationSpec) error {
+	if s.Count < 0 || s.Count > MaxGenerationCount {
+		return fmt.Errorf("count must be between 1 and %d", MaxGenerationCount)
+	}
+
+	counts := make(map[string]int)
+	sum := 0
+	for d, n := range s.DifficultyCounts {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if !contains(Difficulties, d) {
+			return fmt.Errorf("difficulty_counts: difficulty must be one of %s", strings.Join(Difficulties, ", "))
+		}
+		if n < 0 {
+			return fmt.Errorf("difficulty_counts: %s must not be negative", d)
+		}
+		if n > 0 {
+			counts[d] += n
+			sum += n
+		}
+	}
+	switch {
+	case s.Count == 0:
+		s.Count = sum
+	case sum > 0 && sum != s.Count:
+		return fmt.Errorf("difficulty_counts add up to %d, count is %d", sum, s.Count)
+	}
+	if s.Count > MaxGenerationCount {
+		return fmt.Errorf("count must be between 1 and %d", MaxGenerationCount)
+	}
+	s.DifficultyCounts = counts
+
+	s.Language = strings.ToLower(strings.TrimSpace(s.Language))
+	if s.Language == "" {
+		s.Language = "id"
+	}
+	if !contains(GenerationLanguages, s.Language) {
+		return errors.New("language must be one of " + strings.Join(GenerationLanguages, ", "))
+	}
+	return nil
+}
+
+// DistributeGeneration splits a count and its per-difficulty counts over
+// the materials as evenly as possible, the first materials taking the
+// remainder. Difficulties are dealt out in turn so each material gets a
+// similar mix. Materials left with nothing are not listed.
+func DistributeGeneration(count int, difficultyCounts map[string]int, materialIDs []int64) []models.GenerationShare {
+	n := len(materialIDs)
+	if count == 0 || n == 0 {
+		return nil
+	}
+
+	shares := make([]models.GenerationShare, 0, min(count, n))
+	for i, id := range materialIDs {
+		c := count / n
+		if i < count%n {
+			c++
+		}
+		if c == 0 {
+			break
+		}
+		shares = append(shares, models.GenerationShare{MaterialID: id, Count: c})
+	}
+
+	// the per-difficulty counts add up to count, so a share with room is
+	// found until all are dealt; extra counts are dropped
+	if len(difficultyCounts) > 0 {
+		dealt := make([]int, len(shares))
+		total, next := 0, 0
+		for _, d := range Difficulties {
+			for k := 0; k < difficultyCounts[d] && total < count; k++ {
+				for dealt[next%len(shares)] >= shares[next%len(shares)].Count {
+					next++
+				}
+				s := &shares[next%len(shares)]
+				if s.DifficultyCounts == nil {
+					s.DifficultyCounts = make(map[string]int)
+				}
+				s.DifficultyCounts[d]++
+				dealt[next%len(shares)]++
+				total++
+				next++
+			}
+		}
+	}
+	return shares
+}
+
+// SummarizeGeneration compares the questions a job saved with the count,
+// difficulty split and per-material shares it asked for. Without a
+// structured count nothing is requested and there is no shortfall.
+// failures holds the error of each material whose generation call failed.
+func SummarizeGeneration(job *models.GenerationJob, report []models.GenerationItem, failures map[int64]string) models.GenerationSummary {
+	s := models.GenerationSummary{
+		Requested: job.Count,
+		Returned:  len(report),
+	}
+
+	saved := make(map[string]int)
+	returnedBy := make(map[int64]int)
+	savedBy := make(map[int64]int)
+	for _, it := range report {
+		returnedBy[it.MaterialID]++
+		if it.QuestionID != nil {
+			s.Saved++
+			saved[it.Difficulty]++
+			savedBy[it.MaterialID]++
+		}
+	}
+	if job.Count > s.Saved {
+		s.Shortfall = job.Count - s.Saved
+	}
+
+	for _, a := range job.Allocations {
+		t := models.MaterialTally{
+			MaterialID: a.MaterialID,
+			Requested:  a.Count,
+			Returned:   returnedBy[a.MaterialID],
+			Saved:      savedBy[a.MaterialID],
+			Error:      failures[a.MaterialID],
+		}
+		if t.Requested > t.Saved {
+			t.Shortfall = t.Requested - t.Saved
+		}
+		s.Materials = append(s.Materials, t)
+	}
+
+	for _, d := range Difficulties {
+		n, ok := job.DifficultyCounts[d]
+		if !ok {
+			continue
+		}
+		t := models.DifficultyTally{Requested: n, Saved: saved[d]}
+		if n > t.Saved {
+			t.Shortfall = n - t.Saved
+		}
+		if s.Difficulty == nil {
+			s.Difficulty = make(map[string]models.DifficultyTally)
+		}
+		s.Difficulty[d] = t
+	}
+	return s
+}
@@ -0,0 +1,210 @@
+package services
+
+import (
+	"maps"
+	"strings"
+	"testing"
+
+	"backendLMS/models"
+)
+
+func TestNormalizeGenerationSpec(t *testing.T) {
+	tests := []struct {
+		name     string
+		spec     GenerationSpec
+		wantErr  string
+		want     GenerationSpec
+		wantKeys int
+	}{
+		{
+			name: "count defaults to the difficulty split",
+			spec: GenerationSpec{DifficultyCounts: map[string]int{" Easy ": 2, "hard": 1, "medium": 0}},
+			want: GenerationSpec{Count: 3, DifficultyCounts: map[string]int{"easy": 2, "hard": 1}, Language: "id"},
+		},
+		{
+			name: "count without split",
+			spec: GenerationSpec{Count: 5, Language: "EN"},
+			want: GenerationSpec{Count: 5, DifficultyCounts: map[string]int{}, Language: "en"},
+		},
+		{
+			name: "nothing structured",
+			spec: GenerationSpec{},
+			want: GenerationSpec{DifficultyCounts: map[string]int{}, Language: "id"},
+		},
+		{
+			name:    "split must add up to the count",
+			spec:    GenerationSpec{Count: 4, DifficultyCounts: map[string]int{"easy": 2}},
+			wantErr: "add up to 2, count is 4",
+		},
+		{
+			name:    "split over the maximum",
+			spec:    GenerationSpec{DifficultyCounts: map[string]int{"easy": MaxGenerationCount, "hard": 1}},
+			wantErr: "count must be between",
+		},
+		{
+			name:    "negative count",
+			spec:    GenerationSpec{Count: -1},
+			wantErr: "count must be between",
+		},
+		{
+			name:    "unknown difficulty",
+			spec:    GenerationSpec{DifficultyCounts: map[string]int{"extreme": 1}},
+			wantErr: "difficulty must be one of",
+		},
+		{
+			name:    "negative difficulty count",
+			spec:    GenerationSpec{DifficultyCounts: map[string]int{"easy": -1}},
+			wantErr: "must not be negative",
+		},
+		{
+			name:    "unknown language",
+			spec:    GenerationSpec{Count: 1, Language: "fr"},
+			wantErr: "language must be one of",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := tt.spec
+			err := NormalizeGenerationSpec(&spec)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if spec.Count != tt.want.Count || spec.Language != tt.want.Language ||
+				!maps.Equal(spec.DifficultyCounts, tt.want.DifficultyCounts) {
+				t.Errorf("spec = %+v, want %+v", spec, tt.want)
+			}
+		})
+	}
+}
+
+func TestDistributeGeneration(t *testing.T) {
+	tests := []struct {
+		name             string
+		count            int
+		difficultyCounts map[string]int
+		materials        []int64
+		want             []models.GenerationShare
+	}{
+		{
+			name:      "nothing to split",
+			count:     0,
+			materials: []int64{1, 2},
+			want:      nil,
+		},
+		{
+			name:      "no materials",
+			count:     3,
+			materials: nil,
+			want:      nil,
+		},
+		{
+			name:      "remainder goes to the first materials",
+			count:     5,
+			materials: []int64{1, 2, 3},
+			want: []models.GenerationShare{
+				{MaterialID: 1, Count: 2},
+				{MaterialID: 2, Count: 2},
+				{MaterialID: 3, Count: 1},
+			},
+		},
+		{
+			name:      "materials left with nothing are not listed",
+			count:     2,
+			materials: []int64{1, 2, 3},
+			want: []models.GenerationShare{
+				{MaterialID: 1, Count: 1},
+				{MaterialID: 2, Count: 1},
+			},
+		},
+		{
+			name:             "difficulties are dealt in turn",
+			count:            6,
+			difficultyCounts: map[string]int{"easy": 3, "medium": 1, "hard": 2},
+			materials:        []int64{1, 2},
+			want: []models.GenerationShare{
+				{MaterialID: 1, Count: 3, DifficultyCounts: map[string]int{"easy": 2, "hard": 1}},
+				{MaterialID: 2, Count: 3, DifficultyCounts: map[string]int{"easy": 1, "medium": 1, "hard": 1}},
+			},
+		},
+		{
+			name:             "a full share is skipped",
+			count:            3,
+			difficultyCounts: map[string]int{"easy": 1, "hard": 2},
+			materials:        []int64{1, 2},
+			want: []models.GenerationShare{
+				{MaterialID: 1, Count: 2, DifficultyCounts: map[string]int{"easy": 1, "hard": 1}},
+				{MaterialID: 2, Count: 1, DifficultyCounts: map[string]int{"hard": 1}},
+			},
+		},
+		{
+			name:             "a split larger than the count is cut off",
+			count:            2,
+			difficultyCounts: map[string]int{"easy": 2, "hard": 2},
+			materials:        []int64{1, 2},
+			want: []models.GenerationShare{
+				{MaterialID: 1, Count: 1, DifficultyCounts: map[string]int{"easy": 1}},
+				{MaterialID: 2, Count: 1, DifficultyCounts: map[string]int{"easy": 1}},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DistributeGeneration(tt.count, tt.difficultyCounts, tt.materials)
+			if len(got) != len(tt.want) {
+				t.Fatalf("shares = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i].MaterialID != tt.want[i].MaterialID || got[i].Count != tt.want[i].Count ||
+					!maps.Equal(got[i].DifficultyCounts, tt.want[i].DifficultyCounts) {
+					t.Errorf("share %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestSummarizeGeneration(t *testing.T) {
+	id := func(v int64) *int64 { return &v }
+	job := &models.GenerationJob{
+		Count:            4,
+		DifficultyCounts: map[string]int{"easy": 2, "hard": 2},
+		Allocations: []models.GenerationShare{
+			{MaterialID: 1, Count: 2},
+			{MaterialID: 2, Count: 2},
+		},
+	}
+	report := []models.GenerationItem{
+		{MaterialID: 1, Difficulty: "easy", QuestionID: id(10)},
+		{MaterialID: 1, Difficulty: "hard", QuestionID: id(11)},
+		{MaterialID: 1, Difficulty: "hard"}, // rejected
+	}
+	s := SummarizeGeneration(job, report, map[int64]string{2: "timeout"})
+
+	if s.Requested != 4 || s.Returned != 3 || s.Saved != 2 || s.Shortfall != 2 {
+		t.Errorf("summary = %+v", s)
+	}
+	if d := s.Difficulty["easy"]; d.Requested != 2 || d.Saved != 1 || d.Shortfall != 1 {
+		t.Errorf("easy = %+v", d)
+	}
+	if d := s.Difficulty["hard"]; d.Requested != 2 || d.Saved != 1 || d.Shortfall != 1 {
+		t.Errorf("hard = %+v", d)
+	}
+	if _, ok := s.Difficulty["medium"]; ok {
+		t.Error("medium was not requested")
+	}
+	if len(s.Materials) != 2 {
+		t.Fatalf("materials = %+v", s.Materials)
+	}
+	if m := s.Materials[0]; m.Returned != 3 || m.Saved != 2 || m.Shortfall != 0 || m.Error != "" {
+		t.Errorf("material 1 = %+v", m)
+	}
+	if m := s.Materials[1]; m.Returned != 0 || m.Saved != 0 || m.Shortfall != 2 || m.Error != "timeout" {
+		t.Errorf("material 2 = %+v", m)
+	}
+}
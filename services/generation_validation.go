@@ -0,0 +1,243 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultGeneratedTaxonomy is the taxonomy the RAG prompt asks for when
+// the request names none.
+var DefaultGeneratedTaxonomy = []string{"C5", "C6"}
+
+// GenerationRules is what a generation request asked for. Empty fields
+// fall back to the RAG prompt's defaults.
+type GenerationRules struct {
+	TaxonomyLevels []string
+	OptionCount    int
+	Difficulty     string
+}
+
+var difficultySynonyms = map[string]string{
+	"mudah":  "easy",
+	"sedang": "medium",
+	"sulit":  "hard",
+	"sukar":  "hard",
+}
+
+// numberedPrefix matches the numbering the model sometimes puts before a
+// stem despite the prompt: "Pertanyaan 1:", "Soal no. 2.", "No. 3)", "4.".
+// A bare number of at most 3 digits needs punctuation right after it, so
+// a stem that starts with a year, an amount or a sum is left alone.
+var numberedPrefix = regexp.MustCompile(`(?i)^\s*(?:(?:(?:pertanyaan|soal|question)\s*(?:no\.?\s*)?\d+|no\.?\s*\d+)\s*[.:)\-]?|\d{1,3}[.:)])(?:\s+|$)`)
+
+// RepairGeneratedQuestion checks a generated question of the type against
+// the rules of the RAG prompt. What can be fixed without guessing the
+// intent is fixed and described in the returned repairs; anything else
+// rejects the question with an error. Difficulty and taxonomy level are
+// only normalized in spelling, never moved to another value: a question
+// outside what was requested is rejected.
+func RepairGeneratedQuestion(qType string, rules GenerationRules, q GeneratedQuestion) (GeneratedQuestion, []string, error) {
+	taxonomy := rules.TaxonomyLevels
+	if len(taxonomy) == 0 {
+		taxonomy = DefaultGeneratedTaxonomy
+	}
+
+	var repairs []string
+	repaired := func(format string, args ...any) {
+		repairs = append(repairs, fmt.Sprintf(format, args...))
+	}
+
+	content := strings.TrimSpace(q.Content)
+	if stripped := numberedPrefix.ReplaceAllString(content, ""); stripped != content {
+		content = strings.TrimSpace(stripped)
+		repaired("removed the numbering before the content")
+	}
+	if content == "" {
+		return q, nil, errors.New("content is empty")
+	}
+	q.Content = content
+
+	difficulty := strings.ToLower(strings.TrimSpace(q.Difficulty))
+	if d, ok := difficultySynonyms[difficulty]; ok {
+		difficulty = d
+	}
+	switch {
+	case difficulty == "" && rules.Difficulty == "":
+		difficulty = "medium"
+		repaired("set the missing difficulty to medium")
+	case rules.Difficulty != "" && difficulty != rules.Difficulty:
+		return q, nil, fmt.Errorf("difficulty %q does not match the requested %q", q.Difficulty, rules.Difficulty)
+	case !contains(Difficulties, difficulty):
+		return q, nil, fmt.Errorf("difficulty %q is not one of %s", q.Difficulty, strings.Join(Difficulties, ", "))
+	case difficulty != q.Difficulty:
+		repaired("normalized difficulty %q to %q", q.Difficulty, difficulty)
+	}
+	q.Difficulty = difficulty
+
+	level, err := normalizeTaxonomy(q.TaxonomyLevel, taxonomy)
+	if err != nil {
+		return q, nil, err
+	}
+	if level != q.TaxonomyLevel {
+		repaired("normalized taxonomy level %q to %q", q.TaxonomyLevel, level)
+	}
+	q.TaxonomyLevel = level
+
+	answers, answerRepairs, err := repairGeneratedAnswers(qType, q.Answers)
+	if err != nil {
+		return q, nil, err
+	}
+	choice := qType == TypeMultipleChoice || qType == TypeMultipleResponse
+	if choice && rules.OptionCount > 0 && len(answers) != rules.OptionCount {
+		return q, nil, fmt.Errorf("%d options were requested, got %d", rules.OptionCount, len(answers))
+	}
+	q.Answers = answers
+	repairs = append(repairs, answerRepairs...)
+
+	var sources []GeneratedSource
+	for _, s := range q.Sources {
+		if s.Text = strings.TrimSpace(s.Text); s.Text != "" {
+			sources = append(sources, s)
+		}
+	}
+	if len(sources) < len(q.Sources) {
+		repaired("dropped %d empty source(s)", len(q.Sources)-len(sources))
+	}
+	q.Sources = sources
+
+	return q, repairs, nil
+}
+
+// normalizeTaxonomy normalizes the spelling of a level, "c5" to "C5", and
+// rejects a level outside the allowed set.
+func normalizeTaxonomy(level string, allowed []string) (string, error) {
+	norm := strings.ToUpper(strings.TrimSpace(level))
+	if !contains(allowed, norm) {
+		return "", fmt.Errorf("taxonomy level %q is not one of %s", level, strings.Join(allowed, ", "))
+	}
+	return norm, nil
+}
+
+func repairGeneratedAnswers(qType string, answers []GeneratedAnswer) ([]GeneratedAnswer, []string, error) {
+	var repairs []string
+
+	if qType == TypeEssay {
+		if len(answers) > 0 {
+			repairs = append(repairs, "dropped the answers of an essay question")
+		}
+		return []GeneratedAnswer{}, repairs, nil
+	}
+
+	// duplicate option text is dropped; an option given as both correct
+	// and incorrect leaves the key of a choice question unknown
+	choice := IsSingleChoice(qType) || qType == TypeMultipleResponse
+	var result []GeneratedAnswer
+	seen := make(map[string]int)
+	for _, a := range answers {
+		a.Text = strings.TrimSpace(a.Text)
+		a.MatchText = strings.TrimSpace(a.MatchText)
+		if a.Text == "" {
+			return nil, nil, errors.New("an answer has no text")
+		}
+		key := normalizeShortAnswer(a.Text)
+		if qType == TypeMatching {
+			key += "\x00" + normalizeShortAnswer(a.MatchText)
+		}
+		if k, ok := seen[key]; ok {
+			if choice && result[k].IsCorrect != a.IsCorrect {
+				return nil, nil, fmt.Errorf("answer %q is given as both correct and incorrect", a.Text)
+			}
+			result[k].IsCorrect = result[k].IsCorrect || a.IsCorrect
+			repairs = append(repairs, fmt.Sprintf("dropped the duplicate answer %q", a.Text))
+			continue
+		}
+		seen[key] = len(result)
+		result = append(result, a)
+	}
+
+	correct := 0
+	for _, a := range result {
+		if a.IsCorrect {
+			correct++
+		}
+	}
+
+	switch qType {
+	case TypeMultipleChoice, TypeTrueFalse:
+		if len(result) < 2 {
+			return nil, nil, errors.New("fewer than 2 distinct answers")
+		}
+		if qType == TypeTrueFalse && len(result) != 2 {
+			return nil, nil, fmt.Errorf("true/false needs exactly 2 answers, got %d", len(result))
+		}
+		if correct != 1 {
+			return nil, nil, fmt.Errorf("exactly 1 answer must be correct, got %d", correct)
+		}
+
+	case TypeMultipleResponse:
+		if len(result) < 2 {
+			return nil, nil, errors.New("fewer than 2 distinct answers")
+		}
+		if correct < 1 {
+			return nil, nil, errors.New("no answer is correct")
+		}
+
+	case TypeShortAnswer:
+		if len(result) < 1 {
+			return nil, nil, errors.New("no accepted answer")
+		}
+
+	case TypeNumeric:
+		if len(result) != 1 {
+			return nil, nil, fmt.Errorf("numeric needs exactly 1 answer, got %d", len(result))
+		}
+		if _, err := ParseNumber(result[0].Text); err != nil {
+			return nil, nil, fmt.Errorf("answer %q is not a number", result[0].Text)
+		}
+		if t := result[0].Tolerance; t != nil && *t < 0 {
+			positive := -*t
+			result[0].Tolerance = &positive
+			repairs = append(repairs, "made the negative tolerance positive")
+		}
+
+	case TypeMatching:
+		if len(result) < 2 {
+			return nil, nil, errors.New("fewer than 2 distinct pairs")
+		}
+		matches := make(map[string]bool)
+		for _, a := range result {
+			m := normalizeShortAnswer(a.MatchText)
+			if m == "" {
+				return nil, nil, fmt.Errorf("pair %q has no match_text", a.Text)
+			}
+			if matches[m] {
+				return nil, nil, fmt.Errorf("match_text %q is used twice", a.MatchText)
+			}
+			matches[m] = true
+		}
+	}
+
+	relabeled := false
+	for i := range result {
+		if want := OptionLabel(i); result[i].Label != want {
+			result[i].Label = want
+			relabeled = true
+		}
+	}
+	if relabeled {
+		repairs = append(repairs, "relabeled the answers in sequence")
+	}
+
+	return result, repairs, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,331 @@
+package services
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func mcAnswers(correct int, texts ...string) []GeneratedAnswer {
+	answers := make([]GeneratedAnswer, len(texts))
+	for i, t := range texts {
+		answers[i] = GeneratedAnswer{Label: OptionLabel(i), Text: t, IsCorrect: i == correct}
+	}
+	return answers
+}
+
+func TestNumberedPrefix(t *testing.T) {
+	tests := []struct {
+		content string
+		want    string
+	}{
+		{"Pertanyaan 1: Apa ibu kota Indonesia?", "Apa ibu kota Indonesia?"},
+		{"Soal no. 2. Apa ibu kota Indonesia?", "Apa ibu kota Indonesia?"},
+		{"No. 3) Apa ibu kota Indonesia?", "Apa ibu kota Indonesia?"},
+		{"question 4 - What is the capital?", "What is the capital?"},
+		{"4. Apa ibu kota Indonesia?", "Apa ibu kota Indonesia?"},
+		{"12) Apa ibu kota Indonesia?", "Apa ibu kota Indonesia?"},
+		// a year, an amount or a sum at the start is content
+		{"1945 adalah tahun proklamasi kemerdekaan?", "1945 adalah tahun proklamasi kemerdekaan?"},
+		{"1945: tahun proklamasi kemerdekaan adalah?", "1945: tahun proklamasi kemerdekaan adalah?"},
+		{"10 - 3 = ?", "10 - 3 = ?"},
+		{"2.5 kg beras dibagi dua, berapa hasilnya?", "2.5 kg beras dibagi dua, berapa hasilnya?"},
+		{"Soal ini tentang fotosintesis?", "Soal ini tentang fotosintesis?"},
+	}
+	for _, tt := range tests {
+		q := GeneratedQuestion{
+			Content:       tt.content,
+			Difficulty:    "easy",
+			TaxonomyLevel: "C5",
+			Answers:       mcAnswers(0, "Ya", "Tidak"),
+		}
+		got, _, err := RepairGeneratedQuestion(TypeMultipleChoice, GenerationRules{}, q)
+		if err != nil {
+			t.Errorf("%q: %v", tt.content, err)
+			continue
+		}
+		if got.Content != tt.want {
+			t.Errorf("%q: content = %q, want %q", tt.content, got.Content, tt.want)
+		}
+	}
+}
+
+func TestNormalizeTaxonomy(t *testing.T) {
+	tests := []struct {
+		level   string
+		allowed []string
+		want    string
+		wantErr bool
+	}{
+		{"C5", []string{"C5", "C6"}, "C5", false},
+		{" c6 ", []string{"C5", "C6"}, "C6", false},
+		{"c5", []string{"C5", "C6"}, "C5", false},
+		{"C1", []string{"C5", "C6"}, "", true},
+		{"C4", []string{"C2", "C6"}, "", true},
+		{"C7", []string{"C5", "C6"}, "", true},
+		{"analyse", []string{"C5", "C6"}, "", true},
+		{"", []string{"C5", "C6"}, "", true},
+	}
+	for _, tt := range tests {
+		got, err := normalizeTaxonomy(tt.level, tt.allowed)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("normalizeTaxonomy(%q, %v) error = %v, want error %v", tt.level, tt.allowed, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("normalizeTaxonomy(%q, %v) = %q, want %q", tt.level, tt.allowed, got, tt.want)
+		}
+	}
+}
+
+func TestRepairGeneratedAnswers(t *testing.T) {
+	tol := -0.5
+	tests := []struct {
+		name        string
+		qType       string
+		answers     []GeneratedAnswer
+		wantErr     string
+		wantTexts   []string
+		wantCorrect []bool
+		wantRepairs int
+	}{
+		{
+			name:        "valid multiple choice",
+			qType:       TypeMultipleChoice,
+			answers:     mcAnswers(1, "Bandung", "Jakarta", "Surabaya"),
+			wantTexts:   []string{"Bandung", "Jakarta", "Surabaya"},
+			wantCorrect: []bool{false, true, false},
+		},
+		{
+			name:        "duplicate of a wrong option is dropped and relabeled",
+			qType:       TypeMultipleChoice,
+			answers:     mcAnswers(2, "Bandung", " bandung ", "Jakarta"),
+			wantTexts:   []string{"Bandung", "Jakarta"},
+			wantCorrect: []bool{false, true},
+			wantRepairs: 2,
+		},
+		{
+			name:  "duplicate of the correct option stays one correct answer",
+			qType: TypeMultipleChoice,
+			answers: []GeneratedAnswer{
+				{Label: "A", Text: "Jakarta", IsCorrect: true},
+				{Label: "B", Text: "Bandung"},
+				{Label: "C", Text: "JAKARTA", IsCorrect: true},
+			},
+			wantTexts:   []string{"Jakarta", "Bandung"},
+			wantCorrect: []bool{true, false},
+			wantRepairs: 1,
+		},
+		{
+			name:  "option both correct and incorrect is rejected",
+			qType: TypeMultipleChoice,
+			answers: []GeneratedAnswer{
+				{Label: "A", Text: "Bandung"},
+				{Label: "B", Text: "Jakarta", IsCorrect: true},
+				{Label: "C", Text: "Bandung", IsCorrect: true},
+			},
+			wantErr: "both correct and incorrect",
+		},
+		{
+			name:    "two correct answers are rejected",
+			qType:   TypeMultipleChoice,
+			answers: []GeneratedAnswer{{Text: "A", IsCorrect: true}, {Text: "B", IsCorrect: true}},
+			wantErr: "exactly 1 answer must be correct, got 2",
+		},
+		{
+			name:    "no correct answer is rejected",
+			qType:   TypeMultipleChoice,
+			answers: []GeneratedAnswer{{Text: "A"}, {Text: "B"}},
+			wantErr: "exactly 1 answer must be correct, got 0",
+		},
+		{
+			name:    "empty answer text is rejected",
+			qType:   TypeMultipleChoice,
+			answers: mcAnswers(0, "A", " "),
+			wantErr: "no text",
+		},
+		{
+			name:    "true/false needs two answers",
+			qType:   TypeTrueFalse,
+			answers: mcAnswers(0, "Benar", "Salah", "Mungkin"),
+			wantErr: "exactly 2 answers",
+		},
+		{
+			name:  "multiple response keeps several correct answers",
+			qType: TypeMultipleResponse,
+			answers: []GeneratedAnswer{
+				{Label: "A", Text: "2", IsCorrect: true},
+				{Label: "B", Text: "3", IsCorrect: true},
+				{Label: "C", Text: "4"},
+			},
+			wantTexts:   []string{"2", "3", "4"},
+			wantCorrect: []bool{true, true, false},
+		},
+		{
+			name:    "multiple response needs a correct answer",
+			qType:   TypeMultipleResponse,
+			answers: mcAnswers(-1, "2", "3"),
+			wantErr: "no answer is correct",
+		},
+		{
+			name:  "short answer duplicates merge",
+			qType: TypeShortAnswer,
+			answers: []GeneratedAnswer{
+				{Label: "A", Text: "fotosintesis", IsCorrect: true},
+				{Label: "B", Text: "Fotosintesis"},
+			},
+			wantTexts:   []string{"fotosintesis"},
+			wantCorrect: []bool{true},
+			wantRepairs: 1,
+		},
+		{
+			name:        "numeric tolerance is made positive",
+			qType:       TypeNumeric,
+			answers:     []GeneratedAnswer{{Label: "A", Text: "9.8", IsCorrect: true, Tolerance: &tol}},
+			wantTexts:   []string{"9.8"},
+			wantCorrect: []bool{true},
+			wantRepairs: 1,
+		},
+		{
+			name:    "numeric answer must be a number",
+			qType:   TypeNumeric,
+			answers: []GeneratedAnswer{{Text: "sembilan", IsCorrect: true}},
+			wantErr: "is not a number",
+		},
+		{
+			name:  "matching match text must be unique",
+			qType: TypeMatching,
+			answers: []GeneratedAnswer{
+				{Text: "Jawa", MatchText: "Jakarta"},
+				{Text: "Bali", MatchText: "Jakarta"},
+			},
+			wantErr: "used twice",
+		},
+		{
+			name:        "essay answers are dropped",
+			qType:       TypeEssay,
+			answers:     mcAnswers(0, "A", "B"),
+			wantTexts:   []string{},
+			wantCorrect: []bool{},
+			wantRepairs: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, repairs, err := repairGeneratedAnswers(tt.qType, tt.answers)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			texts := []string{}
+			correct := []bool{}
+			for i, a := range got {
+				texts = append(texts, a.Text)
+				correct = append(correct, a.IsCorrect)
+				if a.Label != OptionLabel(i) {
+					t.Errorf("answer %d label = %q, want %q", i, a.Label, OptionLabel(i))
+				}
+			}
+			if !slices.Equal(texts, tt.wantTexts) {
+				t.Errorf("texts = %q, want %q", texts, tt.wantTexts)
+			}
+			if !slices.Equal(correct, tt.wantCorrect) {
+				t.Errorf("correct = %v, want %v", correct, tt.wantCorrect)
+			}
+			if len(repairs) != tt.wantRepairs {
+				t.Errorf("repairs = %q, want %d", repairs, tt.wantRepairs)
+			}
+		})
+	}
+}
+
+func TestRepairGeneratedQuestion(t *testing.T) {
+	tests := []struct {
+		name           string
+		rules          GenerationRules
+		q              GeneratedQuestion
+		wantErr        string
+		wantDifficulty string
+		wantTaxonomy   string
+	}{
+		{
+			name:           "Indonesian difficulty is normalized",
+			q:              GeneratedQuestion{Content: "Apa?", Difficulty: "Sulit", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantDifficulty: "hard",
+			wantTaxonomy:   "C5",
+		},
+		{
+			name:           "missing difficulty defaults to medium",
+			q:              GeneratedQuestion{Content: "Apa?", TaxonomyLevel: "C6", Answers: mcAnswers(0, "A", "B")},
+			wantDifficulty: "medium",
+			wantTaxonomy:   "C6",
+		},
+		{
+			name:    "unknown difficulty is rejected",
+			q:       GeneratedQuestion{Content: "Apa?", Difficulty: "extreme", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantErr: "difficulty",
+		},
+		{
+			name:    "difficulty other than the requested one is rejected",
+			rules:   GenerationRules{Difficulty: "easy"},
+			q:       GeneratedQuestion{Content: "Apa?", Difficulty: "hard", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantErr: `difficulty "hard" does not match the requested "easy"`,
+		},
+		{
+			name:    "missing difficulty is rejected when one was requested",
+			rules:   GenerationRules{Difficulty: "easy"},
+			q:       GeneratedQuestion{Content: "Apa?", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantErr: `difficulty "" does not match the requested "easy"`,
+		},
+		{
+			name:           "synonym of the requested difficulty is accepted",
+			rules:          GenerationRules{Difficulty: "hard"},
+			q:              GeneratedQuestion{Content: "Apa?", Difficulty: "sukar", TaxonomyLevel: "c5", Answers: mcAnswers(0, "A", "B")},
+			wantDifficulty: "hard",
+			wantTaxonomy:   "C5",
+		},
+		{
+			name:    "taxonomy outside the requested levels is rejected",
+			rules:   GenerationRules{TaxonomyLevels: []string{"C1", "C2"}},
+			q:       GeneratedQuestion{Content: "Apa?", Difficulty: "easy", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantErr: `taxonomy level "C5" is not one of C1, C2`,
+		},
+		{
+			name:    "option count mismatch is rejected",
+			rules:   GenerationRules{OptionCount: 4},
+			q:       GeneratedQuestion{Content: "Apa?", Difficulty: "easy", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B", "C")},
+			wantErr: "4 options were requested, got 3",
+		},
+		{
+			name:    "numbering only is empty content",
+			q:       GeneratedQuestion{Content: "Soal 1: ", Difficulty: "easy", TaxonomyLevel: "C5", Answers: mcAnswers(0, "A", "B")},
+			wantErr: "content is empty",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := RepairGeneratedQuestion(TypeMultipleChoice, tt.rules, tt.q)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Difficulty != tt.wantDifficulty {
+				t.Errorf("difficulty = %q, want %q", got.Difficulty, tt.wantDifficulty)
+			}
+			if got.TaxonomyLevel != tt.wantTaxonomy {
+				t.Errorf("taxonomy = %q, want %q", got.TaxonomyLevel, tt.wantTaxonomy)
+			}
+		})
+	}
+}
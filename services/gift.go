@@ -0,0 +1,404 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backendLMS/models"
+)
+
+var giftEscaper = strings.NewReplacer(
+	`\`, `\\`,
+	`~`, `\~`,
+	`=`, `\=`,
+	`#`, `\#`,
+	`{`, `\{`,
+	`}`, `\}`,
+	`:`, `\:`,
+)
+
+// ExportGIFT writes questions in Moodle's GIFT format. Difficulty and
+// taxonomy level travel as "// [tag:...]" comments, which Moodle imports
+// as question tags.
+func ExportGIFT(questions []models.QuestionWithAnswers) []byte {
+	var buf bytes.Buffer
+
+	for _, qa := range questions {
+		q := qa.Question
+		if q.Difficulty != "" {
+			fmt.Fprintf(&buf, "// [tag:%s%s]\n", difficultyTagPrefix, q.Difficulty)
+		}
+		if q.TaxonomyLevel != "" {
+			fmt.Fprintf(&buf, "// [tag:%s%s]\n", taxonomyTagPrefix, q.TaxonomyLevel)
+		}
+
+		fmt.Fprintf(&buf, "::Q%d::%s {", q.ID, giftEscape(q.Content))
+		writeGIFTAnswers(&buf, q.Type, qa.Answers)
+		buf.WriteString("}\n\n")
+	}
+
+	return buf.Bytes()
+}
+
+func writeGIFTAnswers(buf *bytes.Buffer, qType string, answers []models.Answer) {
+	if qType == TypeEssay {
+		// an empty block is an essay; the rubric has no GIFT form and is
+		// supplied again on import
+		return
+	}
+
+	if qType == TypeTrueFalse {
+		if statement, ok := trueFalseStatement(answers); ok {
+			if statement {
+				buf.WriteString("TRUE")
+			} else {
+				buf.WriteString("FALSE")
+			}
+			return
+		}
+	}
+
+	if qType == TypeNumeric && len(answers) > 0 {
+		value := answers[0].Text
+		if answers[0].Tolerance != nil && *answers[0].Tolerance > 0 {
+			value += ":" + strconv.FormatFloat(*answers[0].Tolerance, 'f', -1, 64)
+		}
+		fmt.Fprintf(buf, "#%s", value)
+		return
+	}
+
+	correct := 0
+	for _, a := range answers {
+		if a.IsCorrect {
+			correct++
+		}
+	}
+
+	buf.WriteString("\n")
+	for _, a := range answers {
+		switch qType {
+		case TypeShortAnswer:
+			fmt.Fprintf(buf, "\t=%s\n", giftEscape(a.Text))
+		case TypeMatching:
+			fmt.Fprintf(buf, "\t=%s -> %s\n", giftEscape(a.Text), giftEscape(a.MatchText))
+		case TypeMultipleResponse:
+			weight := "-100"
+			if a.IsCorrect {
+				weight = strconv.FormatFloat(100/float64(correct), 'f', 5, 64)
+				weight = strings.TrimRight(strings.TrimRight(weight, "0"), ".")
+			}
+			fmt.Fprintf(buf, "\t~%%%s%%%s\n", weight, giftEscape(a.Text))
+		default:
+			mark := "~"
+			if a.IsCorrect {
+				mark = "="
+			}
+			fmt.Fprintf(buf, "\t%s%s\n", mark, giftEscape(a.Text))
+		}
+	}
+}
+
+func giftEscape(s string) string {
+	s = giftEscaper.Replace(s)
+	// a blank line ends a question in GIFT
+	return strings.ReplaceAll(s, "\n", `\n`)
+}
+
+// ParseGIFT reads the questions of a GIFT file. Questions are separated by
+// blank lines. Multiple choice, multiple response (weighted answers), true/
+// false, short answer, numeric, matching and essay ({}) blocks are
+// understood; other question kinds are reported per question. Essays come
+// without a rubric, which GIFT cannot carry.
+func ParseGIFT(data []byte) ([]ImportedQuestion, error) {
+	var result []ImportedQuestion
+	var block []string
+	var tags []string
+
+	flush := func() {
+		if len(block) == 0 {
+			tags = nil
+			return
+		}
+		q := parseGIFTQuestion(strings.Join(block, "\n"))
+		q.Index = len(result) + 1
+		for _, t := range tags {
+			applyMetadataTag(&q, t)
+		}
+		result = append(result, q)
+		block = nil
+		tags = nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			flush()
+		case strings.HasPrefix(trimmed, "//"):
+			comment := strings.TrimSpace(strings.TrimPrefix(trimmed, "//"))
+			if strings.HasPrefix(comment, "[tag:") && strings.HasSuffix(comment, "]") {
+				tags = append(tags, strings.TrimSuffix(strings.TrimPrefix(comment, "[tag:"), "]"))
+			}
+		case strings.HasPrefix(trimmed, "$CATEGORY:"):
+			// categories have no equivalent here
+		default:
+			block = append(block, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("invalid GIFT file: %w", err)
+	}
+	flush()
+
+	return result, nil
+}
+
+func parseGIFTQuestion(text string) ImportedQuestion {
+	var q ImportedQuestion
+
+	text = strings.TrimSpace(text)
+	if strings.HasPrefix(text, "::") {
+		end := indexUnescaped(text[2:], "::")
+		if end < 0 {
+			q.Err = fmt.Errorf("unterminated question title")
+			return q
+		}
+		q.Name = giftUnescape(text[2 : 2+end])
+		text = strings.TrimSpace(text[2+end+2:])
+	}
+
+	opening := indexUnescaped(text, "{")
+	if opening < 0 {
+		q.Err = fmt.Errorf("missing answer block")
+		return q
+	}
+	closing := indexUnescaped(text[opening:], "}")
+	if closing < 0 {
+		q.Err = fmt.Errorf("unterminated answer block")
+		return q
+	}
+	closing += opening
+
+	stem := strings.TrimSpace(text[:opening])
+	if tail := strings.TrimSpace(text[closing+1:]); tail != "" {
+		stem = strings.TrimSpace(stem + " _____ " + tail)
+	}
+	stem, isHTML := stripGIFTFormat(stem)
+	q.Content = giftUnescape(stem)
+	if isHTML {
+		q.Content = plainText(q.Content)
+	}
+	if q.Content == "" {
+		q.Err = fmt.Errorf("question text is empty")
+		return q
+	}
+
+	body := strings.TrimSpace(text[opening+1 : closing])
+	q.Err = parseGIFTAnswers(&q, body)
+	return q
+}
+
+func parseGIFTAnswers(q *ImportedQuestion, body string) error {
+	// drop general feedback of true/false and numeric blocks
+	head := body
+	if fb := indexUnescaped(head, "#"); fb > 0 {
+		head = strings.TrimSpace(head[:fb])
+	}
+	switch strings.ToUpper(head) {
+	case "T", "TRUE":
+		q.Type = TypeTrueFalse
+		q.Answers = trueFalseAnswers(true)
+		return nil
+	case "F", "FALSE":
+		q.Type = TypeTrueFalse
+		q.Answers = trueFalseAnswers(false)
+		return nil
+	}
+
+	if strings.HasPrefix(body, "#") {
+		return parseGIFTNumeric(q, strings.TrimSpace(body[1:]))
+	}
+
+	if body == "" {
+		q.Type = TypeEssay
+		return nil
+	}
+
+	if body[0] != '=' && body[0] != '~' {
+		return fmt.Errorf("unsupported answer block {%s}", body)
+	}
+
+	wrong, weighted, matching := 0, 0, false
+	for _, raw := range splitGIFTAnswers(body) {
+		isCorrect := raw[0] == '='
+		answer := strings.TrimSpace(raw[1:])
+
+		// drop per answer feedback
+		if fb := indexUnescaped(answer, "#"); fb >= 0 {
+			answer = strings.TrimSpace(answer[:fb])
+		}
+
+		// ~%50%text style weights
+		if strings.HasPrefix(answer, "%") {
+			if end := strings.Index(answer[1:], "%"); end >= 0 {
+				weight := answer[1 : 1+end]
+				answer = strings.TrimSpace(answer[end+2:])
+				isCorrect = !strings.HasPrefix(weight, "-") && weight != "0"
+				if isCorrect && weight != "100" {
+					weighted++
+				}
+			}
+		}
+
+		if arrow := strings.Index(answer, "->"); arrow >= 0 {
+			matching = true
+			q.Answers = append(q.Answers, ImportedAnswer{
+				Text:      giftUnescape(strings.TrimSpace(answer[:arrow])),
+				MatchText: giftUnescape(strings.TrimSpace(answer[arrow+2:])),
+				IsCorrect: true,
+			})
+			continue
+		}
+
+		if !isCorrect {
+			wrong++
+		}
+		q.Answers = append(q.Answers, ImportedAnswer{
+			Text:      giftUnescape(answer),
+			IsCorrect: isCorrect,
+		})
+	}
+
+	switch {
+	case matching:
+		q.Type = TypeMatching
+	case weighted > 0:
+		q.Type = TypeMultipleResponse
+	case wrong == 0:
+		// only right answers: a short answer question
+		q.Type = TypeShortAnswer
+	default:
+		q.Type = TypeMultipleChoice
+	}
+	return nil
+}
+
+// parseGIFTNumeric reads {#value}, {#value:tolerance} and {#min..max}.
+// Only the first answer of a multi-answer numeric block is kept.
+func parseGIFTNumeric(q *ImportedQuestion, body string) error {
+	q.Type = TypeNumeric
+	if strings.HasPrefix(body, "=") {
+		body = strings.TrimSpace(body[1:])
+		if next := indexUnescaped(body, "="); next >= 0 {
+			body = strings.TrimSpace(body[:next])
+		}
+		if strings.HasPrefix(body, "%") {
+			if end := strings.Index(body[1:], "%"); end >= 0 {
+				body = strings.TrimSpace(body[end+2:])
+			}
+		}
+	}
+	if fb := indexUnescaped(body, "#"); fb >= 0 {
+		body = strings.TrimSpace(body[:fb])
+	}
+
+	var value, tolerance float64
+	var err error
+	if lo, hi, ok := strings.Cut(body, ".."); ok {
+		var lower, upper float64
+		if lower, err = ParseNumber(lo); err == nil {
+			upper, err = ParseNumber(hi)
+		}
+		value, tolerance = (lower+upper)/2, (upper-lower)/2
+	} else if v, t, ok := strings.Cut(body, ":"); ok {
+		if value, err = ParseNumber(v); err == nil {
+			tolerance, err = ParseNumber(t)
+		}
+	} else {
+		value, err = ParseNumber(body)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid numeric answer {#%s}", body)
+	}
+
+	answer := ImportedAnswer{
+		Text:      strconv.FormatFloat(value, 'f', -1, 64),
+		IsCorrect: true,
+	}
+	if tolerance != 0 {
+		answer.Tolerance = &tolerance
+	}
+	q.Answers = []ImportedAnswer{answer}
+	return nil
+}
+
+// splitGIFTAnswers splits an answer block at unescaped = and ~ markers.
+func splitGIFTAnswers(body string) []string {
+	var parts []string
+	start := -1
+	for i := 0; i < len(body); i++ {
+		if body[i] == '\\' {
+			i++
+			continue
+		}
+		if body[i] == '=' || body[i] == '~' {
+			if start >= 0 {
+				parts = append(parts, body[start:i])
+			}
+			start = i
+		}
+	}
+	if start >= 0 {
+		parts = append(parts, body[start:])
+	}
+	return parts
+}
+
+// indexUnescaped finds sep in s, skipping backslash-escaped characters.
+func indexUnescaped(s, sep string) int {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' {
+			i++
+			continue
+		}
+		if strings.HasPrefix(s[i:], sep) {
+			return i
+		}
+	}
+	return -1
+}
+
+func giftUnescape(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+1 < len(s) {
+			i++
+			if s[i] == 'n' {
+				b.WriteByte('\n')
+			} else {
+				b.WriteByte(s[i])
+			}
+			continue
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// stripGIFTFormat removes a leading [html], [moodle], [plain] or
+// [markdown] format marker and reports whether the text is HTML.
+func stripGIFTFormat(s string) (string, bool) {
+	for _, f := range []string{"[html]", "[moodle]", "[plain]", "[markdown]"} {
+		if strings.HasPrefix(s, f) {
+			return strings.TrimSpace(strings.TrimPrefix(s, f)), f == "[html]"
+		}
+	}
+	return s, false
+}
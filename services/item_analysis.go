@@ -0,0 +1,200 @@
+package services
+
+import (
+	"math"
+	"sort"
+	"strings"
+
+	"backendLMS/models"
+)
+
+// ItemResponse is one finished attempt's result on one item. Score is the
+// share of the item's points awarded (0..1) and Total the attempt's share
+// of the exam's points, so attempts of different exams can be compared.
+// Answer is the stored response, empty when the item was left unanswered.
+// Labels are the labels of the options it picked in the question version
+// the attempt was served, so responses to older versions still count for
+// the option now under that label.
+type ItemResponse struct {
+	Score  float64
+	Total  float64
+	Answer models.AttemptAnswer
+	Labels []string
+}
+
+// groupShare is the share of attempts in the upper and lower groups.
+const groupShare = 0.27
+
+// MinResponsesForFlag is the number of responses needed before the
+// analysed difficulty is compared with the label.
+const MinResponsesForFlag = 10
+
+// AnalyzeItem computes the difficulty index, the upper/lower 27%
+// discrimination index, the point-biserial correlation with the total
+// score, and per option selection rates. Only types students pick options
+// from get option rates; essays also have no omitted count, since a blank
+// essay is graded like any other.
+func AnalyzeItem(q models.Question, options []models.Answer, responses []ItemResponse) models.ItemStats {
+	stats := models.ItemStats{
+		QuestionID:         q.ID,
+		Content:            q.Content,
+		LabelledDifficulty: q.Difficulty,
+		Responses:          len(responses),
+	}
+	if !hasOptionStats(q.Type) {
+		options = nil
+	}
+
+	n := len(responses)
+	if n == 0 {
+		for _, o := range options {
+			stats.Options = append(stats.Options, models.OptionStats{
+				AnswerID:  o.ID,
+				Label:     o.Label,
+				Text:      o.Text,
+				IsCorrect: o.IsCorrect,
+			})
+		}
+		return stats
+	}
+
+	sorted := make([]ItemResponse, n)
+	copy(sorted, responses)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Total > sorted[j].Total
+	})
+
+	groupSize := int(math.Round(float64(n) * groupShare))
+	if groupSize < 1 {
+		groupSize = 1
+	}
+	upper := sorted[:groupSize]
+	lower := sorted[n-groupSize:]
+
+	stats.PValue = meanScore(sorted)
+	stats.Discrimination = meanScore(upper) - meanScore(lower)
+	stats.PointBiserial = pearson(sorted)
+
+	if !IsManuallyGraded(q.Type) {
+		for _, r := range sorted {
+			if !isAnswered(q.Type, r.Answer) {
+				stats.Omitted++
+			}
+		}
+	}
+
+	for _, o := range options {
+		count := countSelected(sorted, o.Label)
+		stats.Options = append(stats.Options, models.OptionStats{
+			AnswerID:  o.ID,
+			Label:     o.Label,
+			Text:      o.Text,
+			IsCorrect: o.IsCorrect,
+			Count:     count,
+			Rate:      float64(count) / float64(n),
+			UpperRate: float64(countSelected(upper, o.Label)) / float64(len(upper)),
+			LowerRate: float64(countSelected(lower, o.Label)) / float64(len(lower)),
+		})
+	}
+
+	if n >= MinResponsesForFlag {
+		stats.AnalysedDifficulty = DifficultyFromPValue(stats.PValue)
+		stats.DifficultyMismatch = !strings.EqualFold(
+			strings.TrimSpace(q.Difficulty), stats.AnalysedDifficulty,
+		)
+	}
+
+	return stats
+}
+
+// DifficultyFromPValue maps a difficulty index to a difficulty label.
+func DifficultyFromPValue(p float64) string {
+	switch {
+	case p >= 0.7:
+		return "easy"
+	case p >= 0.3:
+		return "medium"
+	default:
+		return "hard"
+	}
+}
+
+func meanScore(rs []ItemResponse) float64 {
+	if len(rs) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, r := range rs {
+		sum += r.Score
+	}
+	return sum / float64(len(rs))
+}
+
+// hasOptionStats reports whether option selection rates mean anything for
+// the type: short answer and numeric rows are the key, matching rows are
+// pairs and essays have none.
+func hasOptionStats(qType string) bool {
+	return IsSingleChoice(qType) || qType == TypeMultipleResponse
+}
+
+// isAnswered reports whether a stored response gives an answer.
+func isAnswered(qType string, a models.AttemptAnswer) bool {
+	switch {
+	case IsSingleChoice(qType):
+		return a.AnswerID != nil
+	case qType == TypeMultipleResponse:
+		return len(a.AnswerIDs) > 0
+	case qType == TypeMatching:
+		return len(a.Pairs) > 0
+	default: // short answer, numeric, essay
+		return a.Text != nil && strings.TrimSpace(*a.Text) != ""
+	}
+}
+
+// SelectedAnswerIDs returns the option ids a response picked.
+func SelectedAnswerIDs(a models.AttemptAnswer) []int64 {
+	if a.AnswerID != nil {
+		return []int64{*a.AnswerID}
+	}
+	return a.AnswerIDs
+}
+
+func countSelected(rs []ItemResponse, label string) int {
+	count := 0
+	for _, r := range rs {
+		for _, l := range r.Labels {
+			if l == label {
+				count++
+				break
+			}
+		}
+	}
+	return count
+}
+
+// pearson correlates item score with total score. For right/wrong items
+// this is the point-biserial coefficient. It is nil when either side has
+// no variance.
+func pearson(rs []ItemResponse) *float64 {
+	n := float64(len(rs))
+	var sx, sy float64
+	for _, r := range rs {
+		sx += r.Score
+		sy += r.Total
+	}
+	mx, my := sx/n, sy/n
+
+	var cov, vx, vy float64
+	for _, r := range rs {
+		dx, dy := r.Score-mx, r.Total-my
+		cov += dx * dy
+		vx += dx * dx
+		vy += dy * dy
+	}
+	if vx == 0 || vy == 0 {
+		return nil
+	}
+
+	v := cov / math.Sqrt(vx*vy)
+	return &v
+}
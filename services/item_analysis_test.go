@@ -0,0 +1,185 @@
+package services
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"backendLMS/models"
+)
+
+func TestDifficultyFromPValue(t *testing.T) {
+	tests := map[float64]string{0: "hard", 0.29: "hard", 0.3: "medium", 0.69: "medium", 0.7: "easy", 1: "easy"}
+	for p, want := range tests {
+		if got := DifficultyFromPValue(p); got != want {
+			t.Errorf("DifficultyFromPValue(%v) = %q, want %q", p, got, want)
+		}
+	}
+}
+
+func TestAnalyzeItem(t *testing.T) {
+	id := func(v int64) *int64 { return &v }
+	text := func(s string) *string { return &s }
+	picked := func(score, total float64, labels ...string) ItemResponse {
+		r := ItemResponse{Score: score, Total: total, Labels: labels}
+		if len(labels) > 0 {
+			r.Answer.AnswerID = id(1)
+		}
+		return r
+	}
+	typed := func(score, total float64, s string) ItemResponse {
+		return ItemResponse{Score: score, Total: total, Answer: models.AttemptAnswer{Text: text(s)}}
+	}
+	options := []models.Answer{
+		{ID: 1, Label: "A", Text: "Jakarta", IsCorrect: true},
+		{ID: 2, Label: "B", Text: "Bandung"},
+	}
+	// ten right answers with spread totals, enough to compare difficulty
+	var allRight []ItemResponse
+	for i := range MinResponsesForFlag {
+		allRight = append(allRight, picked(1, float64(i+1)/10, "A"))
+	}
+
+	tests := []struct {
+		name           string
+		qType          string
+		difficulty     string
+		responses      []ItemResponse
+		pValue         float64
+		discrimination float64
+		pointBiserial  float64 // 0 when it should be nil
+		omitted        int
+		counts         []int // per option, nil when options are left out
+		analysed       string
+		mismatch       bool
+	}{
+		{
+			name:   "no responses lists the options",
+			qType:  TypeMultipleChoice,
+			counts: []int{0, 0},
+		},
+		{
+			name:  "multiple choice",
+			qType: TypeMultipleChoice,
+			responses: []ItemResponse{
+				picked(1, 0.9, "A"),
+				picked(0, 0.4, "B"),
+				picked(1, 0.8, "A"),
+				picked(0, 0.2),
+			},
+			pValue:         0.5,
+			discrimination: 1,
+			pointBiserial:  0.55 / math.Sqrt(0.3275),
+			omitted:        1,
+			counts:         []int{2, 1},
+		},
+		{
+			name:  "multiple response counts every picked option",
+			qType: TypeMultipleResponse,
+			responses: []ItemResponse{
+				{Score: 1, Total: 1, Labels: []string{"A", "B"}, Answer: models.AttemptAnswer{AnswerIDs: []int64{1, 2}}},
+				{Score: 0.5, Total: 0.5, Labels: []string{"A"}, Answer: models.AttemptAnswer{AnswerIDs: []int64{1}}},
+				{Score: 0, Total: 0},
+			},
+			pValue:         0.5,
+			discrimination: 1,
+			pointBiserial:  1,
+			omitted:        1,
+			counts:         []int{2, 1},
+		},
+		{
+			name:  "typed answers are answered and have no option rates",
+			qType: TypeShortAnswer,
+			responses: []ItemResponse{
+				typed(1, 1, "Jakarta"),
+				typed(0, 0.5, "Bandung"),
+				typed(0, 0, "  "),
+			},
+			pValue:         1.0 / 3,
+			discrimination: 1,
+			pointBiserial:  math.Sqrt(0.75),
+			omitted:        1,
+		},
+		{
+			name:  "essays have no omitted count",
+			qType: TypeEssay,
+			responses: []ItemResponse{
+				typed(0.5, 0.5, ""),
+				{Score: 1, Total: 1},
+			},
+			pValue:         0.75,
+			discrimination: 0.5,
+			pointBiserial:  1,
+		},
+		{
+			name:       "difficulty is compared after enough responses",
+			qType:      TypeMultipleChoice,
+			difficulty: "hard",
+			responses:  allRight,
+			pValue:     1,
+			counts:     []int{MinResponsesForFlag, 0},
+			analysed:   "easy",
+			mismatch:   true,
+		},
+		{
+			name:       "the label is matched loosely",
+			qType:      TypeMultipleChoice,
+			difficulty: " Easy ",
+			responses:  allRight,
+			pValue:     1,
+			counts:     []int{MinResponsesForFlag, 0},
+			analysed:   "easy",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q := models.Question{ID: 7, Type: tt.qType, Difficulty: tt.difficulty}
+			s := AnalyzeItem(q, options, tt.responses)
+
+			near := func(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
+			if s.Responses != len(tt.responses) || !near(s.PValue, tt.pValue) ||
+				!near(s.Discrimination, tt.discrimination) || s.Omitted != tt.omitted {
+				t.Errorf("stats = %+v", s)
+			}
+			switch {
+			case tt.pointBiserial == 0 && s.PointBiserial != nil:
+				t.Errorf("point biserial = %v, want nil", *s.PointBiserial)
+			case tt.pointBiserial != 0 && (s.PointBiserial == nil || !near(*s.PointBiserial, tt.pointBiserial)):
+				t.Errorf("point biserial = %v, want %v", s.PointBiserial, tt.pointBiserial)
+			}
+			var counts []int
+			for _, o := range s.Options {
+				counts = append(counts, o.Count)
+			}
+			if !slices.Equal(counts, tt.counts) {
+				t.Errorf("option counts = %v, want %v", counts, tt.counts)
+			}
+			if s.AnalysedDifficulty != tt.analysed || s.DifficultyMismatch != tt.mismatch {
+				t.Errorf("analysed = %q mismatch = %v, want %q %v",
+					s.AnalysedDifficulty, s.DifficultyMismatch, tt.analysed, tt.mismatch)
+			}
+		})
+	}
+}
+
+func TestAnalyzeItemGroupRates(t *testing.T) {
+	// 27% of 10 rounds to groups of 3
+	var responses []ItemResponse
+	for i := range 10 {
+		label := "B"
+		if i >= 6 {
+			label = "A"
+		}
+		responses = append(responses, ItemResponse{Total: float64(i) / 10, Labels: []string{label}})
+	}
+	options := []models.Answer{{ID: 1, Label: "A", IsCorrect: true}, {ID: 2, Label: "B"}}
+
+	s := AnalyzeItem(models.Question{Type: TypeMultipleChoice}, options, responses)
+	a, b := s.Options[0], s.Options[1]
+	if a.Count != 4 || a.Rate != 0.4 || a.UpperRate != 1 || a.LowerRate != 0 {
+		t.Errorf("option A = %+v", a)
+	}
+	if b.Count != 6 || b.Rate != 0.6 || b.UpperRate != 0 || b.LowerRate != 1 {
+		t.Errorf("option B = %+v", b)
+	}
+}
@@ -0,0 +1,33 @@
+package services
+
+import (
+	"net/url"
+	"os"
+	"path"
+	"strings"
+)
+
+// materialPublicPath is where the materials bucket of Supabase Storage is
+// read without a key.
+const materialPublicPath = "/storage/v1/object/public/materials/"
+
+// MaterialFileURL is the public URL of an uploaded material file.
+func MaterialFileURL(filename string) string {
+	return strings.TrimRight(os.Getenv("SUPABASE_URL"), "/") + materialPublicPath + filename
+}
+
+// IsMaterialFileURL reports whether raw is a file in the materials bucket
+// of the configured SUPABASE_URL. file_url is set by teachers and fetched
+// by the workers, so nothing else may be stored or downloaded.
+func IsMaterialFileURL(raw string) bool {
+	base, err := url.Parse(strings.TrimRight(os.Getenv("SUPABASE_URL"), "/"))
+	if err != nil || base.Host == "" {
+		return false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.User != nil || u.Scheme != base.Scheme || u.Host != base.Host {
+		return false
+	}
+	name, ok := strings.CutPrefix(u.Path, base.Path+materialPublicPath)
+	return ok && name != "" && !strings.Contains(name, "/") && path.Clean(u.Path) == u.Path
+}
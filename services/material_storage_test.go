@@ -0,0 +1,42 @@
+package services
+
+import "testing"
+
+func TestIsMaterialFileURL(t *testing.T) {
+	t.Setenv("SUPABASE_URL", "https://abc.supabase.co/")
+
+	tests := []struct {
+		name string
+		url  string
+		want bool
+	}{
+		{name: "uploaded file", url: MaterialFileURL("7_1700000000_bab1.pdf"), want: true},
+		{name: "escaped file name", url: "https://abc.supabase.co/storage/v1/object/public/materials/7_1_bab%201.pdf", want: true},
+		{name: "empty", url: "", want: false},
+		{name: "bucket without a file", url: "https://abc.supabase.co/storage/v1/object/public/materials/", want: false},
+		{name: "other bucket", url: "https://abc.supabase.co/storage/v1/object/public/avatars/a.pdf", want: false},
+		{name: "private object path", url: "https://abc.supabase.co/storage/v1/object/materials/a.pdf", want: false},
+		{name: "other host", url: "https://evil.example/storage/v1/object/public/materials/a.pdf", want: false},
+		{name: "host with the same prefix", url: "https://abc.supabase.co.evil.example/storage/v1/object/public/materials/a.pdf", want: false},
+		{name: "credentials in the url", url: "https://x@abc.supabase.co/storage/v1/object/public/materials/a.pdf", want: false},
+		{name: "plain http", url: "http://abc.supabase.co/storage/v1/object/public/materials/a.pdf", want: false},
+		{name: "climbs out of the bucket", url: "https://abc.supabase.co/storage/v1/object/public/materials/../../../../auth/v1/admin", want: false},
+		{name: "escaped climb", url: "https://abc.supabase.co/storage/v1/object/public/materials/%2e%2e", want: false},
+		{name: "nested path", url: "https://abc.supabase.co/storage/v1/object/public/materials/a/b.pdf", want: false},
+		{name: "local file", url: "/etc/passwd", want: false},
+		{name: "file scheme", url: "file:///etc/passwd", want: false},
+		{name: "internal service", url: "http://169.254.169.254/latest/meta-data/", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsMaterialFileURL(tt.url); got != tt.want {
+				t.Errorf("IsMaterialFileURL(%q) = %v, want %v", tt.url, got, tt.want)
+			}
+		})
+	}
+
+	t.Setenv("SUPABASE_URL", "")
+	if IsMaterialFileURL("https://abc.supabase.co/storage/v1/object/public/materials/a.pdf") {
+		t.Error("no file is trusted without SUPABASE_URL")
+	}
+}
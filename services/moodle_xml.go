@@ -0,0 +1,324 @@
+package services
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"backendLMS/models"
+)
+
+type moodleText struct {
+	Text string `xml:"text"`
+}
+
+type moodleFormattedText struct {
+	Format string `xml:"format,attr,omitempty"`
+	Text   string `xml:"text"`
+}
+
+type moodleAnswer struct {
+	Fraction  string     `xml:"fraction,attr"`
+	Format    string     `xml:"format,attr,omitempty"`
+	Text      string     `xml:"text"`
+	Tolerance string     `xml:"tolerance,omitempty"`
+	Feedback  moodleText `xml:"feedback"`
+}
+
+type moodleSubquestion struct {
+	Format string     `xml:"format,attr,omitempty"`
+	Text   string     `xml:"text"`
+	Answer moodleText `xml:"answer"`
+}
+
+type moodleTag struct {
+	Text string `xml:"text"`
+}
+
+type moodleQuestion struct {
+	Type            string              `xml:"type,attr"`
+	Name            moodleText          `xml:"name"`
+	QuestionText    moodleFormattedText `xml:"questiontext"`
+	DefaultGrade    string              `xml:"defaultgrade,omitempty"`
+	Single          string              `xml:"single,omitempty"`
+	ShuffleAnswers  string              `xml:"shuffleanswers,omitempty"`
+	AnswerNumbering string              `xml:"answernumbering,omitempty"`
+	UseCase         string              `xml:"usecase,omitempty"`
+	Answers         []moodleAnswer      `xml:"answer"`
+	Subquestions    []moodleSubquestion `xml:"subquestion"`
+	Tags            []moodleTag         `xml:"tags>tag"`
+}
+
+type moodleQuiz struct {
+	XMLName   xml.Name         `xml:"quiz"`
+	Questions []moodleQuestion `xml:"question"`
+}
+
+// ExportMoodleXML writes questions as a Moodle XML quiz file. Each question
+// type maps onto the matching Moodle type; true/false questions whose
+// options are not plain true/false words are written as multiple choice.
+// Essays are exported without their rubric.
+func ExportMoodleXML(questions []models.QuestionWithAnswers) ([]byte, error) {
+	quiz := moodleQuiz{}
+
+	for _, qa := range questions {
+		mq := moodleQuestion{
+			Name:         moodleText{Text: fmt.Sprintf("Q%d", qa.Question.ID)},
+			QuestionText: moodleFormattedText{Format: "plain_text", Text: qa.Question.Content},
+			DefaultGrade: "1",
+		}
+
+		switch qa.Question.Type {
+		case TypeTrueFalse:
+			if statement, ok := trueFalseStatement(qa.Answers); ok {
+				mq.Type = "truefalse"
+				mq.Answers = []moodleAnswer{
+					{Fraction: moodleFraction(statement), Text: "true"},
+					{Fraction: moodleFraction(!statement), Text: "false"},
+				}
+				break
+			}
+			mq.Type = "multichoice"
+			mq.Single = "true"
+			mq.ShuffleAnswers = "true"
+			mq.AnswerNumbering = "ABCD"
+			mq.Answers = moodleChoiceAnswers(qa.Answers, false)
+
+		case TypeMultipleResponse:
+			mq.Type = "multichoice"
+			mq.Single = "false"
+			mq.ShuffleAnswers = "true"
+			mq.AnswerNumbering = "ABCD"
+			mq.Answers = moodleChoiceAnswers(qa.Answers, true)
+
+		case TypeShortAnswer:
+			mq.Type = "shortanswer"
+			mq.UseCase = "0"
+			for _, a := range qa.Answers {
+				mq.Answers = append(mq.Answers, moodleAnswer{Fraction: "100", Format: "plain_text", Text: a.Text})
+			}
+
+		case TypeNumeric:
+			mq.Type = "numerical"
+			for _, a := range qa.Answers {
+				tolerance := "0"
+				if a.Tolerance != nil {
+					tolerance = strconv.FormatFloat(*a.Tolerance, 'f', -1, 64)
+				}
+				mq.Answers = append(mq.Answers, moodleAnswer{Fraction: "100", Text: a.Text, Tolerance: tolerance})
+			}
+
+		case TypeMatching:
+			mq.Type = "matching"
+			mq.ShuffleAnswers = "true"
+			for _, a := range qa.Answers {
+				mq.Subquestions = append(mq.Subquestions, moodleSubquestion{
+					Format: "plain_text",
+					Text:   a.Text,
+					Answer: moodleText{Text: a.MatchText},
+				})
+			}
+
+		case TypeEssay:
+			// Moodle question XML has no rubric; it stays behind
+			mq.Type = "essay"
+
+		default:
+			mq.Type = "multichoice"
+			mq.Single = "true"
+			mq.ShuffleAnswers = "true"
+			mq.AnswerNumbering = "ABCD"
+			mq.Answers = moodleChoiceAnswers(qa.Answers, false)
+		}
+
+		if qa.Question.Difficulty != "" {
+			mq.Tags = append(mq.Tags, moodleTag{Text: difficultyTagPrefix + qa.Question.Difficulty})
+		}
+		if qa.Question.TaxonomyLevel != "" {
+			mq.Tags = append(mq.Tags, moodleTag{Text: taxonomyTagPrefix + qa.Question.TaxonomyLevel})
+		}
+		quiz.Questions = append(quiz.Questions, mq)
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", "  ")
+	if err := enc.Encode(quiz); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+
+	return buf.Bytes(), nil
+}
+
+// moodleChoiceAnswers writes choice options. With several correct options
+// the credit is split between them and wrong options cancel it, which is
+// as close as Moodle gets to all-or-nothing grading.
+func moodleChoiceAnswers(answers []models.Answer, multiple bool) []moodleAnswer {
+	correct := 0
+	for _, a := range answers {
+		if a.IsCorrect {
+			correct++
+		}
+	}
+
+	var result []moodleAnswer
+	for _, a := range answers {
+		fraction := "0"
+		switch {
+		case a.IsCorrect && multiple:
+			fraction = strconv.FormatFloat(100/float64(correct), 'f', 5, 64)
+			fraction = strings.TrimRight(strings.TrimRight(fraction, "0"), ".")
+		case a.IsCorrect:
+			fraction = "100"
+		case multiple:
+			fraction = "-100"
+		}
+		result = append(result, moodleAnswer{
+			Fraction: fraction,
+			Format:   "plain_text",
+			Text:     a.Text,
+		})
+	}
+	return result
+}
+
+func moodleFraction(correct bool) string {
+	if correct {
+		return "100"
+	}
+	return "0"
+}
+
+// ParseMoodleXML reads the questions of a Moodle XML quiz file. Category
+// entries are skipped; unsupported question types are reported per
+// question.
+func ParseMoodleXML(data []byte) ([]ImportedQuestion, error) {
+	var quiz moodleQuiz
+	if err := xml.Unmarshal(data, &quiz); err != nil {
+		return nil, fmt.Errorf("invalid Moodle XML: %w", err)
+	}
+
+	var result []ImportedQuestion
+	index := 0
+	for _, mq := range quiz.Questions {
+		if mq.Type == "category" {
+			continue
+		}
+		index++
+
+		q := ImportedQuestion{
+			Index: index,
+			Name:  mq.Name.Text,
+		}
+		for _, t := range mq.Tags {
+			applyMetadataTag(&q, t.Text)
+		}
+
+		q.Content = moodleBody(mq.QuestionText.Format, mq.QuestionText.Text)
+		if q.Content == "" {
+			q.Err = fmt.Errorf("question text is empty")
+			result = append(result, q)
+			continue
+		}
+
+		q.Err = parseMoodleAnswers(&q, mq)
+		result = append(result, q)
+	}
+
+	return result, nil
+}
+
+func parseMoodleAnswers(q *ImportedQuestion, mq moodleQuestion) error {
+	switch mq.Type {
+	case "multichoice":
+		q.Type = TypeMultipleChoice
+		if mq.Single == "false" || mq.Single == "0" {
+			q.Type = TypeMultipleResponse
+		}
+		for _, a := range mq.Answers {
+			fraction, err := strconv.ParseFloat(a.Fraction, 64)
+			if err != nil {
+				return fmt.Errorf("invalid answer fraction %q", a.Fraction)
+			}
+			q.Answers = append(q.Answers, ImportedAnswer{
+				Text:      moodleBody(a.Format, a.Text),
+				IsCorrect: fraction > 0,
+			})
+		}
+
+	case "truefalse":
+		q.Type = TypeTrueFalse
+		statement := false
+		for _, a := range mq.Answers {
+			if strings.EqualFold(strings.TrimSpace(a.Text), "true") && a.Fraction == "100" {
+				statement = true
+			}
+		}
+		q.Answers = trueFalseAnswers(statement)
+
+	case "shortanswer":
+		q.Type = TypeShortAnswer
+		for _, a := range mq.Answers {
+			fraction, err := strconv.ParseFloat(a.Fraction, 64)
+			if err != nil {
+				return fmt.Errorf("invalid answer fraction %q", a.Fraction)
+			}
+			// partial credit answers have no equivalent and are dropped
+			if fraction >= 100 {
+				q.Answers = append(q.Answers, ImportedAnswer{Text: moodleBody(a.Format, a.Text), IsCorrect: true})
+			}
+		}
+
+	case "numerical":
+		q.Type = TypeNumeric
+		for _, a := range mq.Answers {
+			if a.Fraction != "100" {
+				continue
+			}
+			answer := ImportedAnswer{Text: strings.TrimSpace(a.Text), IsCorrect: true}
+			if a.Tolerance != "" {
+				tolerance, err := strconv.ParseFloat(a.Tolerance, 64)
+				if err != nil {
+					return fmt.Errorf("invalid tolerance %q", a.Tolerance)
+				}
+				answer.Tolerance = &tolerance
+			}
+			q.Answers = append(q.Answers, answer)
+			break
+		}
+
+	case "matching":
+		q.Type = TypeMatching
+		for _, sq := range mq.Subquestions {
+			left := moodleBody(sq.Format, sq.Text)
+			// subquestions without text are extra distractors on the right
+			if left == "" {
+				continue
+			}
+			q.Answers = append(q.Answers, ImportedAnswer{
+				Text:      left,
+				MatchText: strings.TrimSpace(sq.Answer.Text),
+				IsCorrect: true,
+			})
+		}
+
+	case "essay":
+		// the rubric is supplied on import, see ParseGIFT
+		q.Type = TypeEssay
+
+	default:
+		return fmt.Errorf("unsupported question type %q", mq.Type)
+	}
+	return nil
+}
+
+func moodleBody(format, text string) string {
+	if format == "html" || format == "" {
+		return plainText(text)
+	}
+	return strings.TrimSpace(text)
+}
@@ -0,0 +1,217 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// A minimal PDF writer for printable documents. It only knows the two
+// standard Helvetica fonts, so no font files need to be embedded, and it
+// lays text out top to bottom with word wrapping.
+
+const (
+	pdfPageWidth  = 595.0 // A4 in points
+	pdfPageHeight = 842.0
+	pdfMargin     = 50.0
+)
+
+const (
+	fontRegular = "F1"
+	fontBold    = "F2"
+)
+
+// helveticaWidths holds the glyph widths of Helvetica for ASCII 32..126 in
+// thousandths of the font size.
+var helveticaWidths = [...]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+type pdfDocument struct {
+	pages []*bytes.Buffer
+	page  *bytes.Buffer
+	y     float64
+}
+
+func newPDFDocument() *pdfDocument {
+	d := &pdfDocument{}
+	d.newPage()
+	return d
+}
+
+func (d *pdfDocument) newPage() {
+	d.page = &bytes.Buffer{}
+	d.pages = append(d.pages, d.page)
+	d.y = pdfPageHeight - pdfMargin
+}
+
+// ensure starts a new page unless height points are left on this one.
+func (d *pdfDocument) ensure(height float64) {
+	if d.y-height < pdfMargin {
+		d.newPage()
+	}
+}
+
+func (d *pdfDocument) textAt(x, y float64, font string, size float64, s string) {
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.2f %.2f Td (%s) Tj ET\n", font, size, x, y, pdfEscape(s))
+}
+
+func (d *pdfDocument) line(x1, y1, x2, y2 float64) {
+	fmt.Fprintf(d.page, "%.2f %.2f m %.2f %.2f l S\n", x1, y1, x2, y2)
+}
+
+// paragraph writes wrapped text starting at the current position. The
+// first line starts at x, later lines at indent.
+func (d *pdfDocument) paragraph(x, indent float64, font string, size float64, s string) {
+	lead := size * 1.35
+	for i, ln := range wrapText(s, font, size, pdfPageWidth-pdfMargin-x, pdfPageWidth-pdfMargin-indent) {
+		d.ensure(lead)
+		d.y -= lead
+		left := x
+		if i > 0 {
+			left = indent
+		}
+		d.textAt(left, d.y, font, size, ln)
+	}
+}
+
+// paragraphHeight returns how much vertical space paragraph would use.
+func paragraphHeight(x, indent float64, font string, size float64, s string) float64 {
+	lines := wrapText(s, font, size, pdfPageWidth-pdfMargin-x, pdfPageWidth-pdfMargin-indent)
+	return float64(len(lines)) * size * 1.35
+}
+
+func (d *pdfDocument) space(h float64) {
+	d.y -= h
+}
+
+// Bytes serialises the document, adding a page number footer to each page.
+func (d *pdfDocument) Bytes() []byte {
+	for i, p := range d.pages {
+		footer := fmt.Sprintf("%d / %d", i+1, len(d.pages))
+		x := (pdfPageWidth - textWidth(footer, fontRegular, 9)) / 2
+		fmt.Fprintf(p, "BT /%s 9 Tf %.2f %.2f Td (%s) Tj ET\n", fontRegular, x, pdfMargin/2, footer)
+	}
+
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// objects 1-4 are fixed, then a page and a content stream per page
+	pageIDs := make([]string, len(d.pages))
+	for i := range d.pages {
+		pageIDs[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(pageIDs, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	for i, p := range d.pages {
+		obj(fmt.Sprintf(
+			"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] /Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pdfPageWidth, pdfPageHeight, fontRegular, fontBold, 6+2*i,
+		))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", p.Len(), p.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// textWidth approximates the width of s in points. Bold glyphs are a little
+// wider than regular ones, which the 1.05 factor covers well enough for
+// wrapping.
+func textWidth(s, font string, size float64) float64 {
+	var w int
+	for _, r := range s {
+		if r >= 32 && r <= 126 {
+			w += helveticaWidths[r-32]
+		} else {
+			w += 556
+		}
+	}
+	width := float64(w) * size / 1000
+	if font == fontBold {
+		width *= 1.05
+	}
+	return width
+}
+
+// wrapText breaks s into lines no wider than first (for the first line) and
+// rest (for the others). Explicit newlines are kept.
+func wrapText(s, font string, size, first, rest float64) []string {
+	var lines []string
+	limit := first
+	for _, para := range strings.Split(s, "\n") {
+		words := strings.Fields(para)
+		if len(words) == 0 {
+			lines = append(lines, "")
+			limit = rest
+			continue
+		}
+		cur := ""
+		for _, word := range words {
+			next := word
+			if cur != "" {
+				next = cur + " " + word
+			}
+			if cur != "" && textWidth(next, font, size) > limit {
+				lines = append(lines, cur)
+				limit = rest
+				cur = word
+				continue
+			}
+			cur = next
+		}
+		lines = append(lines, cur)
+		limit = rest
+	}
+	return lines
+}
+
+// winAnsiExtra maps the typographic punctuation that word processors like
+// to insert onto its WinAnsi code.
+var winAnsiExtra = map[rune]byte{
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '…': 0x85,
+}
+
+// pdfEscape converts s to WinAnsi and escapes it for a PDF string literal.
+// Characters outside Latin-1 are replaced by '?'.
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteByte(byte(r))
+		case r == '\t':
+			b.WriteByte(' ')
+		case r < 32:
+			// drop control characters
+		case r < 128:
+			b.WriteByte(byte(r))
+		case r >= 160 && r < 256:
+			fmt.Fprintf(&b, "\\%03o", r)
+		case winAnsiExtra[r] != 0:
+			fmt.Fprintf(&b, "\\%03o", winAnsiExtra[r])
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,63 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// PDFPages extracts the plain text of each page of a PDF, skipping pages
+// without text. Scanned pages have no text layer and yield nothing.
+func PDFPages(data []byte) ([]string, error) {
+	r, err := pdf.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("invalid PDF: %w", err)
+	}
+
+	var pages []string
+	for i := 1; i <= r.NumPage(); i++ {
+		p := r.Page(i)
+		if p.V.IsNull() {
+			continue
+		}
+		text, err := pageText(p)
+		if err != nil {
+			return nil, fmt.Errorf("page %d: %w", i, err)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			pages = append(pages, text)
+		}
+	}
+	return pages, nil
+}
+
+// pageText joins the glyphs of a page in content order. Many PDFs place
+// words without space characters, so a gap wider than a fraction of the
+// font size becomes a space and a jump to another baseline a line break.
+func pageText(p pdf.Page) (text string, err error) {
+	// the reader panics on malformed content streams
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("unreadable content: %v", r)
+		}
+	}()
+
+	var b strings.Builder
+	var prev pdf.Text
+	for k, t := range p.Content().Text {
+		if k > 0 {
+			switch {
+			case math.Abs(t.Y-prev.Y) > prev.FontSize/2:
+				b.WriteString("\n")
+			case t.X-(prev.X+prev.W) > prev.FontSize*0.15:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString(t.S)
+		prev = t
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,78 @@
+package services
+
+import (
+	"sync"
+	"time"
+
+	"backendLMS/models"
+)
+
+// progressBuffer is how many events a slow subscriber may fall behind
+// before further events to it are dropped.
+const progressBuffer = 32
+
+// ProgressHub fans progress events out to the open event streams of each
+// user. Events are not stored: a user without an open stream misses them
+// and falls back to the job and material endpoints.
+type ProgressHub struct {
+	mu     sync.Mutex
+	subs   map[int64]map[chan models.ProgressEvent]struct{}
+	closed chan struct{}
+	once   sync.Once
+}
+
+// Progress is the hub shared by the handlers and the background workers.
+var Progress = &ProgressHub{
+	subs:   make(map[int64]map[chan models.ProgressEvent]struct{}),
+	closed: make(chan struct{}),
+}
+
+// Close tells the open streams to end, so a server shutting down does not
+// wait on them.
+func (h *ProgressHub) Close() {
+	h.once.Do(func() { close(h.closed) })
+}
+
+// Done is closed once the hub is closed.
+func (h *ProgressHub) Done() <-chan struct{} {
+	return h.closed
+}
+
+// Subscribe opens a stream of the user's events. The returned function
+// closes it and must be called once the stream is done.
+func (h *ProgressHub) Subscribe(userID int64) (<-chan models.ProgressEvent, func()) {
+	ch := make(chan models.ProgressEvent, progressBuffer)
+
+	h.mu.Lock()
+	if h.subs[userID] == nil {
+		h.subs[userID] = make(map[chan models.ProgressEvent]struct{})
+	}
+	h.subs[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	return ch, func() {
+		h.mu.Lock()
+		delete(h.subs[userID], ch)
+		if len(h.subs[userID]) == 0 {
+			delete(h.subs, userID)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// Publish sends an event to every open stream of the user without
+// blocking the caller.
+func (h *ProgressHub) Publish(userID int64, ev models.ProgressEvent) {
+	if ev.Time == 0 {
+		ev.Time = time.Now().Unix()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for ch := range h.subs[userID] {
+		select {
+		case ch <- ev:
+		default:
+		}
+	}
+}
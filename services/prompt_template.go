@@ -0,0 +1,87 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// PromptPlaceholders are the values FastAPI fills into a prompt template.
+var PromptPlaceholders = []string{
+	"context",
+	"instruction",
+	"material_id",
+	"question_type",
+	"type_rules",
+	"taxonomy_levels",
+	"option_count",
+	"difficulty",
+	"count",
+	"language",
+}
+
+// TaxonomyLevels are the levels of the revised Bloom taxonomy used for
+// questions, from remembering (C1) to creating (C6).
+var TaxonomyLevels = []string{"C1", "C2", "C3", "C4", "C5", "C6"}
+
+const (
+	MinOptionCount = 2
+	MaxOptionCount = 10
+)
+
+var placeholderPattern = regexp.MustCompile(`\{([a-z_]+)\}`)
+
+// ValidatePromptTemplate checks that a template body grounds the model in
+// the retrieved context and only uses placeholders FastAPI knows, so a
+// typo does not reach the model as literal text.
+func ValidatePromptTemplate(body string) error {
+	if strings.TrimSpace(body) == "" {
+		return errors.New("template body is empty")
+	}
+	found := make(map[string]bool)
+	for _, m := range placeholderPattern.FindAllStringSubmatch(body, -1) {
+		if !contains(PromptPlaceholders, m[1]) {
+			return fmt.Errorf("unknown placeholder {%s}", m[1])
+		}
+		found[m[1]] = true
+	}
+	for _, required := range []string{"context", "instruction"} {
+		if !found[required] {
+			return fmt.Errorf("template must contain {%s}", required)
+		}
+	}
+	return nil
+}
+
+// NormalizeTaxonomyLevels uppercases, deduplicates and sorts the levels
+// from low to high and rejects unknown ones.
+func NormalizeTaxonomyLevels(levels []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, l := range levels {
+		l = strings.ToUpper(strings.TrimSpace(l))
+		if !contains(TaxonomyLevels, l) {
+			return nil, fmt.Errorf("unknown taxonomy level %q", l)
+		}
+		if !seen[l] {
+			seen[l] = true
+			result = append(result, l)
+		}
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+// ValidateGenerationSettings checks the settings a preset or request may
+// fix; empty values leave the prompt's default.
+func ValidateGenerationSettings(optionCount *int, difficulty string) error {
+	if optionCount != nil && (*optionCount < MinOptionCount || *optionCount > MaxOptionCount) {
+		return fmt.Errorf("option_count must be between %d and %d", MinOptionCount, MaxOptionCount)
+	}
+	if difficulty != "" && !contains(Difficulties, difficulty) {
+		return fmt.Errorf("difficulty must be one of %s", strings.Join(Difficulties, ", "))
+	}
+	return nil
+}
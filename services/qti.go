@@ -0,0 +1,456 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+
+	"backendLMS/models"
+)
+
+const (
+	qtiNamespace      = "http://www.imsglobal.org/xsd/imsqti_v2p1"
+	imscpNamespace    = "http://www.imsglobal.org/xsd/imscp_v1p1"
+	qtiMatchCorrect   = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/match_correct"
+	qtiMapResponse    = "http://www.imsglobal.org/question/qti_v2p1/rptemplates/map_response"
+	qtiResponseID     = "RESPONSE"
+	qtiScoreID        = "SCORE"
+	qtiWeightID       = "WEIGHT"
+	qtiTestHref       = "assessmentTest.xml"
+	qtiTestResourceID = "RES_TEST"
+)
+
+type qtiValue struct {
+	Value string `xml:"value"`
+}
+
+type qtiMapEntry struct {
+	MapKey        string `xml:"mapKey,attr"`
+	MappedValue   string `xml:"mappedValue,attr"`
+	CaseSensitive *bool  `xml:"caseSensitive,attr,omitempty"`
+}
+
+type qtiMapping struct {
+	DefaultValue string        `xml:"defaultValue,attr"`
+	Entries      []qtiMapEntry `xml:"mapEntry"`
+}
+
+type qtiResponseDeclaration struct {
+	Identifier      string      `xml:"identifier,attr"`
+	Cardinality     string      `xml:"cardinality,attr"`
+	BaseType        string      `xml:"baseType,attr"`
+	CorrectResponse []string    `xml:"correctResponse>value"`
+	Mapping         *qtiMapping `xml:"mapping,omitempty"`
+}
+
+type qtiOutcomeDeclaration struct {
+	Identifier   string    `xml:"identifier,attr"`
+	Cardinality  string    `xml:"cardinality,attr"`
+	BaseType     string    `xml:"baseType,attr"`
+	DefaultValue *qtiValue `xml:"defaultValue,omitempty"`
+}
+
+type qtiSimpleChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	Text       string `xml:",chardata"`
+}
+
+type qtiChoiceInteraction struct {
+	ResponseIdentifier string            `xml:"responseIdentifier,attr"`
+	Shuffle            bool              `xml:"shuffle,attr"`
+	MaxChoices         int               `xml:"maxChoices,attr"`
+	Prompt             string            `xml:"prompt"`
+	Choices            []qtiSimpleChoice `xml:"simpleChoice"`
+}
+
+type qtiSimpleAssociableChoice struct {
+	Identifier string `xml:"identifier,attr"`
+	MatchMax   int    `xml:"matchMax,attr"`
+	Text       string `xml:",chardata"`
+}
+
+type qtiMatchSet struct {
+	Choices []qtiSimpleAssociableChoice `xml:"simpleAssociableChoice"`
+}
+
+type qtiMatchInteraction struct {
+	ResponseIdentifier string        `xml:"responseIdentifier,attr"`
+	Shuffle            bool          `xml:"shuffle,attr"`
+	MaxAssociations    int           `xml:"maxAssociations,attr"`
+	Prompt             string        `xml:"prompt"`
+	Sets               []qtiMatchSet `xml:"simpleMatchSet"`
+}
+
+type qtiExtendedTextInteraction struct {
+	ResponseIdentifier string `xml:"responseIdentifier,attr"`
+	ExpectedLines      int    `xml:"expectedLines,attr"`
+	Prompt             string `xml:"prompt"`
+}
+
+type qtiTextEntryInteraction struct {
+	ResponseIdentifier string `xml:"responseIdentifier,attr"`
+	ExpectedLength     int    `xml:"expectedLength,attr"`
+}
+
+// qtiItemBody holds exactly one interaction. Text entry is an inline
+// interaction, so its question text goes in a paragraph before it.
+type qtiItemBody struct {
+	Text      string                      `xml:"p,omitempty"`
+	Choice    *qtiChoiceInteraction       `xml:"choiceInteraction,omitempty"`
+	Match     *qtiMatchInteraction        `xml:"matchInteraction,omitempty"`
+	TextEntry *qtiTextEntryInteraction    `xml:"div>textEntryInteraction,omitempty"`
+	Extended  *qtiExtendedTextInteraction `xml:"extendedTextInteraction,omitempty"`
+}
+
+type qtiResponseProcessing struct {
+	Template string `xml:"template,attr,omitempty"`
+	Rules    string `xml:",innerxml"`
+}
+
+type qtiAssessmentItem struct {
+	XMLName             xml.Name               `xml:"assessmentItem"`
+	Xmlns               string                 `xml:"xmlns,attr"`
+	Identifier          string                 `xml:"identifier,attr"`
+	Title               string                 `xml:"title,attr"`
+	Adaptive            bool                   `xml:"adaptive,attr"`
+	TimeDependent       bool                   `xml:"timeDependent,attr"`
+	ResponseDeclaration qtiResponseDeclaration `xml:"responseDeclaration"`
+	OutcomeDeclaration  qtiOutcomeDeclaration  `xml:"outcomeDeclaration"`
+	Body                qtiItemBody            `xml:"itemBody"`
+	ResponseProcessing  *qtiResponseProcessing `xml:"responseProcessing,omitempty"`
+}
+
+type qtiWeight struct {
+	Identifier string `xml:"identifier,attr"`
+	Value      string `xml:"value,attr"`
+}
+
+type qtiItemRef struct {
+	Identifier string    `xml:"identifier,attr"`
+	Href       string    `xml:"href,attr"`
+	Weight     qtiWeight `xml:"weight"`
+}
+
+type qtiOrdering struct {
+	Shuffle bool `xml:"shuffle,attr"`
+}
+
+type qtiSection struct {
+	Identifier string       `xml:"identifier,attr"`
+	Title      string       `xml:"title,attr"`
+	Visible    bool         `xml:"visible,attr"`
+	Ordering   qtiOrdering  `xml:"ordering"`
+	ItemRefs   []qtiItemRef `xml:"assessmentItemRef"`
+}
+
+type qtiTestPart struct {
+	Identifier     string     `xml:"identifier,attr"`
+	NavigationMode string     `xml:"navigationMode,attr"`
+	SubmissionMode string     `xml:"submissionMode,attr"`
+	Section        qtiSection `xml:"assessmentSection"`
+}
+
+type qtiTimeLimits struct {
+	MaxTime int `xml:"maxTime,attr"`
+}
+
+type qtiTestVariables struct {
+	VariableIdentifier string `xml:"variableIdentifier,attr"`
+	WeightIdentifier   string `xml:"weightIdentifier,attr"`
+}
+
+type qtiSetOutcomeValue struct {
+	Identifier string           `xml:"identifier,attr"`
+	Sum        qtiTestVariables `xml:"sum>testVariables"`
+}
+
+type qtiAssessmentTest struct {
+	XMLName            xml.Name              `xml:"assessmentTest"`
+	Xmlns              string                `xml:"xmlns,attr"`
+	Identifier         string                `xml:"identifier,attr"`
+	Title              string                `xml:"title,attr"`
+	OutcomeDeclaration qtiOutcomeDeclaration `xml:"outcomeDeclaration"`
+	TimeLimits         *qtiTimeLimits        `xml:"timeLimits,omitempty"`
+	TestPart           qtiTestPart           `xml:"testPart"`
+	OutcomeProcessing  qtiSetOutcomeValue    `xml:"outcomeProcessing>setOutcomeValue"`
+}
+
+type imsFile struct {
+	Href string `xml:"href,attr"`
+}
+
+type imsDependency struct {
+	IdentifierRef string `xml:"identifierref,attr"`
+}
+
+type imsResource struct {
+	Identifier   string          `xml:"identifier,attr"`
+	Type         string          `xml:"type,attr"`
+	Href         string          `xml:"href,attr"`
+	File         imsFile         `xml:"file"`
+	Dependencies []imsDependency `xml:"dependency"`
+}
+
+type imsManifest struct {
+	XMLName       xml.Name      `xml:"manifest"`
+	Xmlns         string        `xml:"xmlns,attr"`
+	Identifier    string        `xml:"identifier,attr"`
+	Schema        string        `xml:"metadata>schema"`
+	SchemaVersion string        `xml:"metadata>schemaversion"`
+	Organizations struct{}      `xml:"organizations"`
+	Resources     []imsResource `xml:"resources>resource"`
+}
+
+// ExportQTI packages an exam as an IMS QTI 2.1 content package: one
+// assessmentItem per question, an assessmentTest referencing them in exam
+// order with the item points as weights, and an imsmanifest.xml.
+func ExportQTI(exam *models.Exam, items []models.ExamItem) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+
+	test := qtiAssessmentTest{
+		Xmlns:      qtiNamespace,
+		Identifier: fmt.Sprintf("EXAM_%d", exam.ID),
+		Title:      exam.Title,
+		OutcomeDeclaration: qtiOutcomeDeclaration{
+			Identifier:  qtiScoreID,
+			Cardinality: "single",
+			BaseType:    "float",
+		},
+		TestPart: qtiTestPart{
+			Identifier:     "PART_1",
+			NavigationMode: "nonlinear",
+			SubmissionMode: "simultaneous",
+			Section: qtiSection{
+				Identifier: "SECTION_1",
+				Title:      exam.Title,
+				Visible:    true,
+				Ordering:   qtiOrdering{Shuffle: exam.ShuffleQuestions},
+			},
+		},
+		OutcomeProcessing: qtiSetOutcomeValue{
+			Identifier: qtiScoreID,
+			Sum: qtiTestVariables{
+				VariableIdentifier: qtiScoreID,
+				WeightIdentifier:   qtiWeightID,
+			},
+		},
+	}
+	if exam.DurationMinutes > 0 {
+		test.TimeLimits = &qtiTimeLimits{MaxTime: exam.DurationMinutes * 60}
+	}
+
+	testResource := imsResource{
+		Identifier: qtiTestResourceID,
+		Type:       "imsqti_test_xmlv2p1",
+		Href:       qtiTestHref,
+		File:       imsFile{Href: qtiTestHref},
+	}
+	var itemResources []imsResource
+
+	for _, it := range items {
+		item, err := qtiItem(it, exam.ShuffleOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		href := "items/" + item.Identifier + ".xml"
+		if err := writeZipXML(zw, href, item); err != nil {
+			return nil, err
+		}
+
+		test.TestPart.Section.ItemRefs = append(test.TestPart.Section.ItemRefs, qtiItemRef{
+			Identifier: item.Identifier,
+			Href:       href,
+			Weight: qtiWeight{
+				Identifier: qtiWeightID,
+				Value:      strconv.FormatFloat(it.Points, 'f', -1, 64),
+			},
+		})
+
+		resourceID := "RES_" + item.Identifier
+		testResource.Dependencies = append(testResource.Dependencies, imsDependency{IdentifierRef: resourceID})
+		itemResources = append(itemResources, imsResource{
+			Identifier: resourceID,
+			Type:       "imsqti_item_xmlv2p1",
+			Href:       href,
+			File:       imsFile{Href: href},
+		})
+	}
+
+	if err := writeZipXML(zw, qtiTestHref, test); err != nil {
+		return nil, err
+	}
+
+	manifest := imsManifest{
+		Xmlns:         imscpNamespace,
+		Identifier:    fmt.Sprintf("MANIFEST_EXAM_%d", exam.ID),
+		Schema:        "QTIv2.1 Package",
+		SchemaVersion: "1.0.0",
+		Resources:     append([]imsResource{testResource}, itemResources...),
+	}
+	if err := writeZipXML(zw, "imsmanifest.xml", manifest); err != nil {
+		return nil, err
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// qtiItem builds the assessmentItem of one question. Choice questions use
+// choiceInteraction, short answer and numeric textEntryInteraction, and
+// matching matchInteraction, essays extendedTextInteraction; scoring
+// follows our own grading rules and essays are left to a human scorer.
+func qtiItem(it models.ExamItem, shuffle bool) (*qtiAssessmentItem, error) {
+	q := it.Question
+	item := &qtiAssessmentItem{
+		Xmlns:      qtiNamespace,
+		Identifier: fmt.Sprintf("Q%d", q.ID),
+		Title:      fmt.Sprintf("Q%d", q.ID),
+		ResponseDeclaration: qtiResponseDeclaration{
+			Identifier:  qtiResponseID,
+			Cardinality: "single",
+			BaseType:    "identifier",
+		},
+		OutcomeDeclaration: qtiOutcomeDeclaration{
+			Identifier:   qtiScoreID,
+			Cardinality:  "single",
+			BaseType:     "float",
+			DefaultValue: &qtiValue{Value: "0"},
+		},
+		ResponseProcessing: &qtiResponseProcessing{Template: qtiMatchCorrect},
+	}
+	decl := &item.ResponseDeclaration
+
+	switch q.Type {
+	case TypeEssay:
+		// scored by a person; no response processing
+		decl.BaseType = "string"
+		item.Body.Extended = &qtiExtendedTextInteraction{
+			ResponseIdentifier: qtiResponseID,
+			ExpectedLines:      10,
+			Prompt:             q.Content,
+		}
+		item.ResponseProcessing = nil
+		return item, nil
+
+	case TypeShortAnswer:
+		decl.BaseType = "string"
+		decl.Mapping = &qtiMapping{DefaultValue: "0"}
+		caseSensitive := false
+		for _, a := range it.Answers {
+			decl.Mapping.Entries = append(decl.Mapping.Entries, qtiMapEntry{
+				MapKey:        a.Text,
+				MappedValue:   "1",
+				CaseSensitive: &caseSensitive,
+			})
+		}
+		if len(it.Answers) > 0 {
+			decl.CorrectResponse = []string{it.Answers[0].Text}
+		}
+		item.Body.Text = q.Content
+		item.Body.TextEntry = &qtiTextEntryInteraction{ResponseIdentifier: qtiResponseID, ExpectedLength: 20}
+		item.ResponseProcessing = &qtiResponseProcessing{Template: qtiMapResponse}
+
+	case TypeNumeric:
+		if len(it.Answers) == 0 {
+			break
+		}
+		value, err := ParseNumber(it.Answers[0].Text)
+		if err != nil {
+			return nil, fmt.Errorf("question %d has an invalid numeric answer", q.ID)
+		}
+		tolerance := 0.0
+		if it.Answers[0].Tolerance != nil {
+			tolerance = *it.Answers[0].Tolerance
+		}
+		decl.BaseType = "float"
+		decl.CorrectResponse = []string{strconv.FormatFloat(value, 'f', -1, 64)}
+		item.Body.Text = q.Content
+		item.Body.TextEntry = &qtiTextEntryInteraction{ResponseIdentifier: qtiResponseID, ExpectedLength: 10}
+		item.ResponseProcessing = &qtiResponseProcessing{Rules: qtiToleranceRules(tolerance)}
+
+	case TypeMatching:
+		decl.Cardinality = "multiple"
+		decl.BaseType = "directedPair"
+		decl.Mapping = &qtiMapping{DefaultValue: "0"}
+		share := strconv.FormatFloat(1/float64(len(it.Answers)), 'f', -1, 64)
+
+		match := &qtiMatchInteraction{
+			ResponseIdentifier: qtiResponseID,
+			Shuffle:            true,
+			MaxAssociations:    len(it.Answers),
+			Prompt:             q.Content,
+			Sets:               make([]qtiMatchSet, 2),
+		}
+		for _, a := range it.Answers {
+			left, right := fmt.Sprintf("L%d", a.ID), fmt.Sprintf("R%d", a.ID)
+			match.Sets[0].Choices = append(match.Sets[0].Choices, qtiSimpleAssociableChoice{Identifier: left, MatchMax: 1, Text: a.Text})
+			match.Sets[1].Choices = append(match.Sets[1].Choices, qtiSimpleAssociableChoice{Identifier: right, MatchMax: 1, Text: a.MatchText})
+			pair := left + " " + right
+			decl.CorrectResponse = append(decl.CorrectResponse, pair)
+			decl.Mapping.Entries = append(decl.Mapping.Entries, qtiMapEntry{MapKey: pair, MappedValue: share})
+		}
+		item.Body.Match = match
+		item.ResponseProcessing = &qtiResponseProcessing{Template: qtiMapResponse}
+
+	default:
+		choice := &qtiChoiceInteraction{
+			ResponseIdentifier: qtiResponseID,
+			Shuffle:            shuffle,
+			MaxChoices:         1,
+			Prompt:             q.Content,
+		}
+		if q.Type == TypeMultipleResponse {
+			decl.Cardinality = "multiple"
+			choice.MaxChoices = 0
+		}
+		for _, a := range it.Answers {
+			choiceID := fmt.Sprintf("A%d", a.ID)
+			choice.Choices = append(choice.Choices, qtiSimpleChoice{
+				Identifier: choiceID,
+				Text:       a.Text,
+			})
+			if a.IsCorrect {
+				decl.CorrectResponse = append(decl.CorrectResponse, choiceID)
+			}
+		}
+		item.Body.Choice = choice
+	}
+
+	if len(decl.CorrectResponse) == 0 {
+		return nil, fmt.Errorf("question %d has no correct answer", q.ID)
+	}
+	return item, nil
+}
+
+// qtiToleranceRules scores a numeric response as correct when it is within
+// tolerance of the correct value.
+func qtiToleranceRules(tolerance float64) string {
+	t := strconv.FormatFloat(tolerance, 'f', -1, 64)
+	return `<responseCondition>` +
+		`<responseIf>` +
+		`<equal toleranceMode="absolute" tolerance="` + t + ` ` + t + `">` +
+		`<variable identifier="` + qtiResponseID + `"/><correct identifier="` + qtiResponseID + `"/>` +
+		`</equal>` +
+		`<setOutcomeValue identifier="` + qtiScoreID + `"><baseValue baseType="float">1</baseValue></setOutcomeValue>` +
+		`</responseIf>` +
+		`</responseCondition>`
+}
+
+func writeZipXML(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(f)
+	enc.Indent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,258 @@
+package services
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+
+	"backendLMS/models"
+)
+
+func TestQTIItem(t *testing.T) {
+	tolerance := 0.5
+	item := func(id int64, qType string, answers ...models.Answer) models.ExamItem {
+		return models.ExamItem{Points: 2, Question: models.Question{ID: id, Type: qType, Content: "Soal?"}, Answers: answers}
+	}
+	tests := []struct {
+		name        string
+		item        models.ExamItem
+		interaction string
+		cardinality string
+		baseType    string
+		correct     []string
+		template    string
+		wantErr     string
+	}{
+		{
+			name: "multiple choice",
+			item: item(1, TypeMultipleChoice,
+				models.Answer{ID: 10, Text: "a"},
+				models.Answer{ID: 11, Text: "b", IsCorrect: true},
+			),
+			interaction: "choice",
+			cardinality: "single",
+			baseType:    "identifier",
+			correct:     []string{"A11"},
+			template:    qtiMatchCorrect,
+		},
+		{
+			name: "multiple response",
+			item: item(2, TypeMultipleResponse,
+				models.Answer{ID: 20, Text: "a", IsCorrect: true},
+				models.Answer{ID: 21, Text: "b"},
+				models.Answer{ID: 22, Text: "c", IsCorrect: true},
+			),
+			interaction: "choice",
+			cardinality: "multiple",
+			baseType:    "identifier",
+			correct:     []string{"A20", "A22"},
+			template:    qtiMatchCorrect,
+		},
+		{
+			name: "short answer",
+			item: item(3, TypeShortAnswer,
+				models.Answer{ID: 30, Text: "Jupiter", IsCorrect: true},
+				models.Answer{ID: 31, Text: "Yupiter", IsCorrect: true},
+			),
+			interaction: "textEntry",
+			cardinality: "single",
+			baseType:    "string",
+			correct:     []string{"Jupiter"},
+			template:    qtiMapResponse,
+		},
+		{
+			name:        "numeric",
+			item:        item(4, TypeNumeric, models.Answer{ID: 40, Text: "3,50", IsCorrect: true, Tolerance: &tolerance}),
+			interaction: "textEntry",
+			cardinality: "single",
+			baseType:    "float",
+			correct:     []string{"3.5"},
+		},
+		{
+			name: "matching",
+			item: item(5, TypeMatching,
+				models.Answer{ID: 50, Text: "Jepang", MatchText: "Tokyo", IsCorrect: true},
+				models.Answer{ID: 51, Text: "Prancis", MatchText: "Paris", IsCorrect: true},
+			),
+			interaction: "match",
+			cardinality: "multiple",
+			baseType:    "directedPair",
+			correct:     []string{"L50 R50", "L51 R51"},
+			template:    qtiMapResponse,
+		},
+		{
+			name:        "essay",
+			item:        item(6, TypeEssay),
+			interaction: "extendedText",
+			cardinality: "single",
+			baseType:    "string",
+		},
+		{
+			name:    "choice without a correct option",
+			item:    item(7, TypeMultipleChoice, models.Answer{ID: 70, Text: "a"}),
+			wantErr: "question 7 has no correct answer",
+		},
+		{
+			name:    "numeric without an answer",
+			item:    item(8, TypeNumeric),
+			wantErr: "question 8 has no correct answer",
+		},
+		{
+			name:    "numeric answer that is not a number",
+			item:    item(9, TypeNumeric, models.Answer{ID: 90, Text: "tiga", IsCorrect: true}),
+			wantErr: "question 9 has an invalid numeric answer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := qtiItem(tt.item, true)
+			if tt.wantErr != "" {
+				if err == nil || err.Error() != tt.wantErr {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var interaction string
+			switch b := got.Body; {
+			case b.Choice != nil:
+				interaction = "choice"
+			case b.TextEntry != nil:
+				interaction = "textEntry"
+			case b.Match != nil:
+				interaction = "match"
+			case b.Extended != nil:
+				interaction = "extendedText"
+			}
+			decl := got.ResponseDeclaration
+			if interaction != tt.interaction || decl.Cardinality != tt.cardinality || decl.BaseType != tt.baseType {
+				t.Errorf("interaction = %s %s %s, want %s %s %s",
+					interaction, decl.Cardinality, decl.BaseType, tt.interaction, tt.cardinality, tt.baseType)
+			}
+			if !slices.Equal(decl.CorrectResponse, tt.correct) {
+				t.Errorf("correct response = %v, want %v", decl.CorrectResponse, tt.correct)
+			}
+
+			switch {
+			case tt.item.Question.Type == TypeEssay:
+				if got.ResponseProcessing != nil {
+					t.Error("essays are scored by a person")
+				}
+			case tt.template == "":
+				if got.ResponseProcessing == nil || !strings.Contains(got.ResponseProcessing.Rules, `tolerance="0.5 0.5"`) {
+					t.Errorf("response processing = %+v", got.ResponseProcessing)
+				}
+			case got.ResponseProcessing == nil || got.ResponseProcessing.Template != tt.template:
+				t.Errorf("response processing = %+v, want template %s", got.ResponseProcessing, tt.template)
+			}
+		})
+	}
+}
+
+func TestExportQTI(t *testing.T) {
+	exam := &models.Exam{ID: 3, Title: "Ujian Tengah Semester", DurationMinutes: 90, ShuffleQuestions: true}
+	items := []models.ExamItem{
+		{Points: 2, Question: models.Question{ID: 12, Type: TypeTrueFalse, Content: "Benar?"}, Answers: []models.Answer{
+			{ID: 1, Text: "True", IsCorrect: true}, {ID: 2, Text: "False"},
+		}},
+		{Points: 1.5, Question: models.Question{ID: 11, Type: TypeEssay, Content: "Jelaskan."}},
+	}
+
+	data, err := ExportQTI(exam, items)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	files := make(map[string][]byte)
+	var names []string
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		files[f.Name] = b
+		names = append(names, f.Name)
+	}
+	wantNames := []string{"items/Q12.xml", "items/Q11.xml", qtiTestHref, "imsmanifest.xml"}
+	if !slices.Equal(names, wantNames) {
+		t.Fatalf("files = %v, want %v", names, wantNames)
+	}
+
+	var test struct {
+		TimeLimits struct {
+			MaxTime int `xml:"maxTime,attr"`
+		} `xml:"timeLimits"`
+		Ordering struct {
+			Shuffle bool `xml:"shuffle,attr"`
+		} `xml:"testPart>assessmentSection>ordering"`
+		ItemRefs []struct {
+			Href   string `xml:"href,attr"`
+			Weight struct {
+				Value string `xml:"value,attr"`
+			} `xml:"weight"`
+		} `xml:"testPart>assessmentSection>assessmentItemRef"`
+	}
+	if err := xml.Unmarshal(files[qtiTestHref], &test); err != nil {
+		t.Fatal(err)
+	}
+	if test.TimeLimits.MaxTime != 5400 || !test.Ordering.Shuffle {
+		t.Errorf("test = %+v", test)
+	}
+	if len(test.ItemRefs) != 2 ||
+		test.ItemRefs[0].Href != "items/Q12.xml" || test.ItemRefs[0].Weight.Value != "2" ||
+		test.ItemRefs[1].Href != "items/Q11.xml" || test.ItemRefs[1].Weight.Value != "1.5" {
+		t.Errorf("item refs = %+v", test.ItemRefs)
+	}
+
+	var manifest struct {
+		Resources []struct {
+			Identifier   string `xml:"identifier,attr"`
+			Dependencies []struct {
+				Ref string `xml:"identifierref,attr"`
+			} `xml:"dependency"`
+		} `xml:"resources>resource"`
+	}
+	if err := xml.Unmarshal(files["imsmanifest.xml"], &manifest); err != nil {
+		t.Fatal(err)
+	}
+	var resources, deps []string
+	for _, r := range manifest.Resources {
+		resources = append(resources, r.Identifier)
+	}
+	for _, d := range manifest.Resources[0].Dependencies {
+		deps = append(deps, d.Ref)
+	}
+	if !slices.Equal(resources, []string{qtiTestResourceID, "RES_Q12", "RES_Q11"}) ||
+		!slices.Equal(deps, []string{"RES_Q12", "RES_Q11"}) {
+		t.Errorf("resources = %v, dependencies = %v", resources, deps)
+	}
+
+	for name, b := range files {
+		if err := xml.Unmarshal(b, new(struct{})); err != nil {
+			t.Errorf("%s is not well-formed: %v", name, err)
+		}
+	}
+}
+
+func TestExportQTIRejectsUnanswerableItems(t *testing.T) {
+	items := []models.ExamItem{{Question: models.Question{ID: 4, Type: TypeMultipleChoice}}}
+	if _, err := ExportQTI(&models.Exam{ID: 1}, items); err == nil {
+		t.Error("an item without a correct answer should fail the export")
+	}
+}
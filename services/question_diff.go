@@ -0,0 +1,111 @@
+package services
+
+import (
+	"strconv"
+	"strings"
+
+	"backendLMS/models"
+)
+
+// DiffQuestionVersions lists the changes between two versions of a
+// question. Answers are matched by label and rubric criteria by position,
+// since every version has its own answer and criterion ids.
+func DiffQuestionVersions(from, to models.QuestionVersion) models.QuestionVersionDiff {
+	d := models.QuestionVersionDiff{
+		QuestionID: to.QuestionID,
+		From:       from.Version,
+		To:         to.Version,
+		Changes:    []models.FieldChange{},
+	}
+
+	change := func(field, key, a, b string) {
+		if a != b {
+			d.Changes = append(d.Changes, models.FieldChange{Field: field, Key: key, From: a, To: b})
+		}
+	}
+
+	change("type", "", from.Type, to.Type)
+	change("content", "", from.Content, to.Content)
+	change("difficulty", "", from.Difficulty, to.Difficulty)
+	change("taxonomy_level", "", from.TaxonomyLevel, to.TaxonomyLevel)
+
+	oldAnswers := make(map[string]models.Answer)
+	for _, a := range from.Answers {
+		oldAnswers[a.Label] = a
+	}
+	newAnswers := make(map[string]bool)
+	for _, a := range to.Answers {
+		newAnswers[a.Label] = true
+		old, ok := oldAnswers[a.Label]
+		if !ok {
+			change("answer", a.Label, "", describeAnswer(a))
+			continue
+		}
+		change("answer.text", a.Label, old.Text, a.Text)
+		change("answer.is_correct", a.Label, strconv.FormatBool(old.IsCorrect), strconv.FormatBool(a.IsCorrect))
+		change("answer.tolerance", a.Label, formatTolerance(old.Tolerance), formatTolerance(a.Tolerance))
+		change("answer.match_text", a.Label, old.MatchText, a.MatchText)
+	}
+	for _, a := range from.Answers {
+		if !newAnswers[a.Label] {
+			change("answer", a.Label, describeAnswer(a), "")
+		}
+	}
+
+	n := len(from.Rubric)
+	if len(to.Rubric) > n {
+		n = len(to.Rubric)
+	}
+	for i := 0; i < n; i++ {
+		key := strconv.Itoa(i + 1)
+		switch {
+		case i >= len(from.Rubric):
+			change("criterion", key, "", describeCriterion(to.Rubric[i]))
+		case i >= len(to.Rubric):
+			change("criterion", key, describeCriterion(from.Rubric[i]), "")
+		default:
+			a, b := from.Rubric[i], to.Rubric[i]
+			change("criterion.title", key, a.Title, b.Title)
+			change("criterion.description", key, a.Description, b.Description)
+			change("criterion.levels", key, describeLevels(a.Levels), describeLevels(b.Levels))
+		}
+	}
+
+	return d
+}
+
+func describeAnswer(a models.Answer) string {
+	s := a.Text
+	if a.MatchText != "" {
+		s += " -> " + a.MatchText
+	}
+	if a.Tolerance != nil {
+		s += " +/- " + formatTolerance(a.Tolerance)
+	}
+	if a.IsCorrect {
+		s += " (correct)"
+	}
+	return s
+}
+
+func describeCriterion(c models.RubricCriterion) string {
+	return c.Title + ": " + describeLevels(c.Levels)
+}
+
+func describeLevels(levels []models.RubricLevel) string {
+	parts := make([]string, len(levels))
+	for i, l := range levels {
+		parts[i] = strconv.FormatFloat(l.Score, 'f', -1, 64) + " " + l.Label
+		if l.Description != "" {
+			parts[i] += " (" + l.Description + ")"
+		}
+	}
+	return strings.Join(parts, "; ")
+}
+
+func formatTolerance(t *float64) string {
+	if t == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*t, 'f', -1, 64)
+}
@@ -0,0 +1,98 @@
+package services
+
+import (
+	"html"
+	"regexp"
+	"strings"
+
+	"backendLMS/models"
+)
+
+// ImportedAnswer is an answer row read from an exchange file; see
+// models.Answer for how each question type uses it.
+type ImportedAnswer struct {
+	Text      string
+	IsCorrect bool
+	Tolerance *float64
+	MatchText string
+}
+
+// ImportedQuestion is one question read from an exchange file. Err is set
+// when the question could not be parsed; the other questions of the file
+// are still usable.
+type ImportedQuestion struct {
+	Index         int
+	Name          string
+	Type          string
+	Content       string
+	Difficulty    string
+	TaxonomyLevel string
+	Answers       []ImportedAnswer
+	Err           error
+}
+
+// Tags used to carry our metadata through formats that have no field for it.
+const (
+	difficultyTagPrefix = "difficulty:"
+	taxonomyTagPrefix   = "taxonomy:"
+)
+
+func applyMetadataTag(q *ImportedQuestion, tag string) {
+	tag = strings.TrimSpace(tag)
+	switch {
+	case strings.HasPrefix(tag, difficultyTagPrefix):
+		q.Difficulty = strings.TrimPrefix(tag, difficultyTagPrefix)
+	case strings.HasPrefix(tag, taxonomyTagPrefix):
+		q.TaxonomyLevel = strings.TrimPrefix(tag, taxonomyTagPrefix)
+	}
+}
+
+var htmlTag = regexp.MustCompile(`<[^>]*>`)
+
+// plainText turns an HTML fragment into plain text.
+func plainText(s string) string {
+	s = strings.NewReplacer("<br>", "\n", "<br/>", "\n", "<br />", "\n", "</p>", "\n").Replace(s)
+	s = htmlTag.ReplaceAllString(s, "")
+	return strings.TrimSpace(html.UnescapeString(s))
+}
+
+var (
+	trueWords  = []string{"true", "benar", "betul", "ya", "t", "b"}
+	falseWords = []string{"false", "salah", "tidak", "f", "s"}
+)
+
+func isOneOf(s string, words []string) bool {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for _, w := range words {
+		if s == w {
+			return true
+		}
+	}
+	return false
+}
+
+// trueFalseStatement reports whether the statement of a true/false question
+// is true, provided its two options read as true and false.
+func trueFalseStatement(answers []models.Answer) (statement bool, ok bool) {
+	if len(answers) != 2 {
+		return false, false
+	}
+	for _, a := range answers {
+		if isOneOf(a.Text, trueWords) && a.IsCorrect {
+			statement = true
+		}
+	}
+	a, b := answers[0].Text, answers[1].Text
+	ok = (isOneOf(a, trueWords) && isOneOf(b, falseWords)) ||
+		(isOneOf(a, falseWords) && isOneOf(b, trueWords))
+	return statement, ok
+}
+
+// trueFalseAnswers returns the two options of an imported true/false
+// question.
+func trueFalseAnswers(statement bool) []ImportedAnswer {
+	return []ImportedAnswer{
+		{Text: "True", IsCorrect: statement},
+		{Text: "False", IsCorrect: !statement},
+	}
+}
@@ -0,0 +1,348 @@
+package services
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"backendLMS/models"
+)
+
+// exchangeQuestions holds one question of every type, each written the way
+// an import gives it back.
+func exchangeQuestions() []models.QuestionWithAnswers {
+	tolerance := 0.5
+	question := func(id int64, qType, content string, answers ...models.Answer) models.QuestionWithAnswers {
+		return models.QuestionWithAnswers{
+			Question: models.Question{ID: id, Type: qType, Content: content, Difficulty: "medium", TaxonomyLevel: "C2"},
+			Answers:  answers,
+		}
+	}
+	return []models.QuestionWithAnswers{
+		question(1, TypeMultipleChoice, "Ibu kota Indonesia adalah {kota}: #1?",
+			models.Answer{Text: "Jakarta = DKI", IsCorrect: true},
+			models.Answer{Text: "Bandung"},
+		),
+		question(2, TypeTrueFalse, "Air mendidih pada 100 derajat Celsius.",
+			models.Answer{Text: "True", IsCorrect: true},
+			models.Answer{Text: "False"},
+		),
+		question(3, TypeMultipleResponse, "Pilih bilangan prima.",
+			models.Answer{Text: "2", IsCorrect: true},
+			models.Answer{Text: "3", IsCorrect: true},
+			models.Answer{Text: "4"},
+		),
+		question(4, TypeShortAnswer, "Sebutkan planet terbesar.",
+			models.Answer{Text: "Jupiter", IsCorrect: true},
+			models.Answer{Text: "Yupiter", IsCorrect: true},
+		),
+		question(5, TypeNumeric, "Berapa 7 dibagi 2?",
+			models.Answer{Text: "3.5", IsCorrect: true, Tolerance: &tolerance},
+		),
+		question(6, TypeMatching, "Pasangkan negara dengan ibu kotanya.",
+			models.Answer{Text: "Jepang", MatchText: "Tokyo", IsCorrect: true},
+			models.Answer{Text: "Prancis", MatchText: "Paris", IsCorrect: true},
+		),
+		question(7, TypeEssay, "Jelaskan proses fotosintesis."),
+	}
+}
+
+func TestExchangeRoundTrip(t *testing.T) {
+	formats := []struct {
+		name   string
+		export func([]models.QuestionWithAnswers) ([]byte, error)
+		parse  func([]byte) ([]ImportedQuestion, error)
+	}{
+		{
+			name: "GIFT",
+			export: func(qs []models.QuestionWithAnswers) ([]byte, error) {
+				return ExportGIFT(qs), nil
+			},
+			parse: ParseGIFT,
+		},
+		{
+			name:   "Moodle XML",
+			export: ExportMoodleXML,
+			parse:  ParseMoodleXML,
+		},
+	}
+	for _, f := range formats {
+		t.Run(f.name, func(t *testing.T) {
+			want := exchangeQuestions()
+			data, err := f.export(want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := f.parse(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(want) {
+				t.Fatalf("imported %d questions, want %d", len(got), len(want))
+			}
+
+			for i, q := range got {
+				w := want[i]
+				if q.Err != nil {
+					t.Errorf("%s: %v", w.Question.Type, q.Err)
+					continue
+				}
+				if q.Type != w.Question.Type || q.Content != w.Question.Content ||
+					q.Difficulty != w.Question.Difficulty || q.TaxonomyLevel != w.Question.TaxonomyLevel {
+					t.Errorf("%s: question = %+v", w.Question.Type, q)
+				}
+				var answers []ImportedAnswer
+				for _, a := range w.Answers {
+					answers = append(answers, ImportedAnswer{
+						Text:      a.Text,
+						IsCorrect: a.IsCorrect,
+						Tolerance: a.Tolerance,
+						MatchText: a.MatchText,
+					})
+				}
+				if !reflect.DeepEqual(q.Answers, answers) {
+					t.Errorf("%s: answers = %+v, want %+v", w.Question.Type, q.Answers, answers)
+				}
+			}
+		})
+	}
+}
+
+func TestParseGIFT(t *testing.T) {
+	tolerance := func(v float64) *float64 { return &v }
+	tests := []struct {
+		name    string
+		input   string
+		qType   string
+		content string
+		answers []ImportedAnswer
+		wantErr string
+	}{
+		{
+			name:    "short true",
+			input:   "Bumi itu bulat. {T}",
+			qType:   TypeTrueFalse,
+			content: "Bumi itu bulat.",
+			answers: trueFalseAnswers(true),
+		},
+		{
+			name:    "false with feedback",
+			input:   "Matahari mengelilingi bumi. {FALSE#Sebaliknya.}",
+			qType:   TypeTrueFalse,
+			content: "Matahari mengelilingi bumi.",
+			answers: trueFalseAnswers(false),
+		},
+		{
+			name:    "numeric range",
+			input:   "Sebutkan bilangan antara 1 dan 3. {#1..3}",
+			qType:   TypeNumeric,
+			content: "Sebutkan bilangan antara 1 dan 3.",
+			answers: []ImportedAnswer{{Text: "2", IsCorrect: true, Tolerance: tolerance(1)}},
+		},
+		{
+			name:    "numeric with answer marker",
+			input:   "Berapa 2 + 3? {#=5#benar =%50%6}",
+			qType:   TypeNumeric,
+			content: "Berapa 2 + 3?",
+			answers: []ImportedAnswer{{Text: "5", IsCorrect: true}},
+		},
+		{
+			name:    "per answer feedback is dropped",
+			input:   "::Judul::Warna langit? {=biru#tepat ~merah#salah}",
+			qType:   TypeMultipleChoice,
+			content: "Warna langit?",
+			answers: []ImportedAnswer{{Text: "biru", IsCorrect: true}, {Text: "merah"}},
+		},
+		{
+			name:    "zero weight is wrong",
+			input:   "Pilih dua. {~%50%a ~%50%b ~%0%c}",
+			qType:   TypeMultipleResponse,
+			content: "Pilih dua.",
+			answers: []ImportedAnswer{{Text: "a", IsCorrect: true}, {Text: "b", IsCorrect: true}, {Text: "c"}},
+		},
+		{
+			name:    "missing word keeps the text after the block",
+			input:   "Ibu kota Jepang {=Tokyo ~Kyoto} adalah kota besar.",
+			qType:   TypeMultipleChoice,
+			content: "Ibu kota Jepang _____ adalah kota besar.",
+			answers: []ImportedAnswer{{Text: "Tokyo", IsCorrect: true}, {Text: "Kyoto"}},
+		},
+		{
+			name:    "html text",
+			input:   "[html]<p>Jelaskan &amp; beri contoh.</p>{}",
+			qType:   TypeEssay,
+			content: "Jelaskan & beri contoh.",
+		},
+		{
+			name:    "unterminated title",
+			input:   "::Judul Soal {T}",
+			wantErr: "unterminated question title",
+		},
+		{
+			name:    "missing answer block",
+			input:   "Soal tanpa jawaban.",
+			wantErr: "missing answer block",
+		},
+		{
+			name:    "unterminated answer block",
+			input:   "Soal {=a ~b",
+			wantErr: "unterminated answer block",
+		},
+		{
+			name:    "empty text",
+			input:   "{T}",
+			wantErr: "question text is empty",
+		},
+		{
+			name:    "unsupported block",
+			input:   "Soal {1:MC:=a~b}",
+			wantErr: "unsupported answer block",
+		},
+		{
+			name:    "invalid number",
+			input:   "Soal {#abc}",
+			wantErr: "invalid numeric answer",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseGIFT([]byte(tt.input))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != 1 {
+				t.Fatalf("parsed %d questions, want 1", len(got))
+			}
+			q := got[0]
+			if tt.wantErr != "" {
+				if q.Err == nil || !strings.Contains(q.Err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", q.Err, tt.wantErr)
+				}
+				return
+			}
+			if q.Err != nil {
+				t.Fatal(q.Err)
+			}
+			if q.Type != tt.qType || q.Content != tt.content || !reflect.DeepEqual(q.Answers, tt.answers) {
+				t.Errorf("question = %+v, want %s %q %+v", q, tt.qType, tt.content, tt.answers)
+			}
+		})
+	}
+}
+
+func TestParseGIFTFile(t *testing.T) {
+	input := strings.Join([]string{
+		"$CATEGORY: $course$/Biologi",
+		"",
+		"// biasa saja",
+		"// [tag:difficulty:easy]",
+		"// [tag:taxonomy:C1]",
+		"Sel terkecil? {",
+		"  =sel",
+		"  ~organ",
+		"}",
+		"",
+		"",
+		"Soal rusak.",
+		"",
+		"Tanpa tag. {T}",
+	}, "\r\n")
+
+	got, err := ParseGIFT([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("parsed %d questions, want 3", len(got))
+	}
+	for i, q := range got {
+		if q.Index != i+1 {
+			t.Errorf("question %d has index %d", i+1, q.Index)
+		}
+	}
+	if q := got[0]; q.Err != nil || q.Difficulty != "easy" || q.TaxonomyLevel != "C1" || len(q.Answers) != 2 {
+		t.Errorf("first question = %+v", q)
+	}
+	if got[1].Err == nil {
+		t.Error("second question should fail")
+	}
+	if q := got[2]; q.Err != nil || q.Difficulty != "" || q.TaxonomyLevel != "" {
+		t.Errorf("tags leaked into the third question: %+v", q)
+	}
+}
+
+func TestParseMoodleXML(t *testing.T) {
+	input := `<?xml version="1.0" encoding="UTF-8"?>
+<quiz>
+  <question type="category"><category><text>$course$/Kimia</text></category></question>
+  <question type="shortanswer">
+    <name><text>Lambang air</text></name>
+    <questiontext format="html"><text><![CDATA[<p>Rumus kimia air?</p>]]></text></questiontext>
+    <answer fraction="100"><text>H2O</text></answer>
+    <answer fraction="50"><text>HO</text></answer>
+  </question>
+  <question type="matching">
+    <questiontext format="plain_text"><text>Pasangkan.</text></questiontext>
+    <subquestion><text>Na</text><answer><text>Natrium</text></answer></subquestion>
+    <subquestion><text></text><answer><text>Kalium</text></answer></subquestion>
+  </question>
+  <question type="multichoice">
+    <questiontext format="plain_text"><text>Rusak.</text></questiontext>
+    <answer fraction="penuh"><text>a</text></answer>
+  </question>
+  <question type="calculated">
+    <questiontext format="plain_text"><text>Hitung {x}.</text></questiontext>
+  </question>
+  <question type="essay">
+    <questiontext format="plain_text"><text>  </text></questiontext>
+  </question>
+</quiz>`
+
+	got, err := ParseMoodleXML([]byte(input))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		qType   string
+		content string
+		answers []ImportedAnswer
+		wantErr string
+	}{
+		{
+			qType:   TypeShortAnswer,
+			content: "Rumus kimia air?",
+			answers: []ImportedAnswer{{Text: "H2O", IsCorrect: true}},
+		},
+		{
+			qType:   TypeMatching,
+			content: "Pasangkan.",
+			answers: []ImportedAnswer{{Text: "Na", MatchText: "Natrium", IsCorrect: true}},
+		},
+		{wantErr: `invalid answer fraction "penuh"`},
+		{wantErr: `unsupported question type "calculated"`},
+		{wantErr: "question text is empty"},
+	}
+	if len(got) != len(tests) {
+		t.Fatalf("parsed %d questions, want %d", len(got), len(tests))
+	}
+	for i, tt := range tests {
+		q := got[i]
+		if q.Index != i+1 {
+			t.Errorf("question %d has index %d", i+1, q.Index)
+		}
+		if tt.wantErr != "" {
+			if q.Err == nil || q.Err.Error() != tt.wantErr {
+				t.Errorf("question %d: error = %v, want %q", i+1, q.Err, tt.wantErr)
+			}
+			continue
+		}
+		if q.Err != nil || q.Type != tt.qType || q.Content != tt.content || !reflect.DeepEqual(q.Answers, tt.answers) {
+			t.Errorf("question %d = %+v", i+1, q)
+		}
+	}
+
+	if _, err := ParseMoodleXML([]byte("<quiz><question>")); err == nil {
+		t.Error("broken XML should fail")
+	}
+}
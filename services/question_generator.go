@@ -0,0 +1,451 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"backendLMS/models"
+)
+
+// GenerationRequest is what a QuestionGenerator is asked to write.
+// The prompt template, taxonomy levels, option count, difficulty, count
+// and per-difficulty counts are optional; empty values leave the
+// generator's default. MaterialIDs, when set, is the material set to
+// write from instead of MaterialID alone.
+type GenerationRequest struct {
+	MaterialID       int64
+	MaterialIDs      []int64
+	QuestionType     string
+	Instruction      string
+	PromptTemplate   string
+	TaxonomyLevels   []string
+	OptionCount      int
+	Difficulty       string
+	Count            int
+	DifficultyCounts map[string]int
+	Language         string
+}
+
+func (req GenerationRequest) materials() []int64 {
+	if len(req.MaterialIDs) > 0 {
+		return req.MaterialIDs
+	}
+	return []int64{req.MaterialID}
+}
+
+// GeneratedQuestion is a question as a generator returns it, before it is
+// validated and saved.
+type GeneratedQuestion struct {
+	Content       string               `json:"content"`
+	Difficulty    string               `json:"difficulty"`
+	TaxonomyLevel string               `json:"taxonomy_level"`
+	Answers       []GeneratedAnswer    `json:"answers"`
+	Rubric        []GeneratedCriterion `json:"rubric"`
+	Sources       []GeneratedSource    `json:"sources"`
+}
+
+// GeneratedSource is a chunk of the material the question was written
+// from.
+type GeneratedSource struct {
+	MaterialID int64  `json:"material_id"`
+	ChunkID    string `json:"chunk_id"`
+	Page       *int   `json:"page"`
+	Text       string `json:"text"`
+}
+
+type GeneratedAnswer struct {
+	Label     string   `json:"label"`
+	Text      string   `json:"text"`
+	IsCorrect bool     `json:"is_correct"`
+	Tolerance *float64 `json:"tolerance"`
+	MatchText string   `json:"match_text"`
+}
+
+type GeneratedCriterion struct {
+	Title       string           `json:"title"`
+	Description string           `json:"description"`
+	Levels      []GeneratedLevel `json:"levels"`
+}
+
+type GeneratedLevel struct {
+	Score       float64 `json:"score"`
+	Label       string  `json:"label"`
+	Description string  `json:"description"`
+}
+
+// QuestionGenerator writes questions about a material and reports the
+// tokens it used.
+type QuestionGenerator interface {
+	Generate(ctx context.Context, req GenerationRequest) ([]GeneratedQuestion, models.TokenUsage, error)
+}
+
+// HTTPQuestionGenerator asks the FastAPI RAG service, which retrieves the
+// material's chunks from Pinecone and prompts the LLM.
+type HTTPQuestionGenerator struct {
+	BaseURL string
+	Client  *http.Client
+}
+
+func (g *HTTPQuestionGenerator) Generate(ctx context.Context, req GenerationRequest) ([]GeneratedQuestion, models.TokenUsage, error) {
+	payload := map[string]interface{}{
+		"material_id":   req.MaterialID,
+		"instruction":   req.Instruction,
+		"question_type": req.QuestionType,
+	}
+	if req.PromptTemplate != "" {
+		payload["prompt_template"] = req.PromptTemplate
+	}
+	if len(req.TaxonomyLevels) > 0 {
+		payload["taxonomy_levels"] = req.TaxonomyLevels
+	}
+	if req.OptionCount > 0 {
+		payload["option_count"] = req.OptionCount
+	}
+	if req.Difficulty != "" {
+		payload["difficulty"] = req.Difficulty
+	}
+	if req.Count > 0 {
+		payload["count"] = req.Count
+	}
+	if len(req.DifficultyCounts) > 0 {
+		payload["difficulty_counts"] = req.DifficultyCounts
+	}
+	if req.Language != "" {
+		payload["language"] = req.Language
+	}
+	if len(req.MaterialIDs) > 0 {
+		payload["material_ids"] = req.MaterialIDs
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, g.BaseURL+"/generate_exam", bytes.NewReader(body))
+	if err != nil {
+		return nil, models.TokenUsage{}, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := g.Client.Do(httpReq)
+	if err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to generate question from RAG: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return nil, models.TokenUsage{}, fmt.Errorf("failed to generate question from RAG: %s %s", resp.Status, bytes.TrimSpace(b))
+	}
+
+	var out struct {
+		RagResult []GeneratedQuestion `json:"rag_result"`
+		Usage     models.TokenUsage   `json:"usage"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, models.TokenUsage{}, fmt.Errorf("invalid response from RAG: %w", err)
+	}
+	return out.RagResult, out.Usage, nil
+}
+
+// ChunkSource returns the text chunks of a material.
+type ChunkSource func(ctx context.Context, materialID int64) ([]string, error)
+
+const maxLocalQuestions = 20
+
+// LocalQuestionGenerator writes questions from templates filled with the
+// sentences of the material's chunks. It needs no network and gives the
+// same questions for the same input, for development and integration
+// tests. Like the RAG prompt it writes the requested count, else as many
+// questions as the first number in the instruction, or one, and follows
+// the requested taxonomy levels, option count and difficulties. The prompt
+// template and language are ignored; the templates are Indonesian. It
+// uses no tokens.
+type LocalQuestionGenerator struct {
+	Chunks ChunkSource
+}
+
+var ErrNoMaterialText = errors.New("materi tidak memiliki teks untuk dibuat soal")
+
+var instructionCount = regexp.MustCompile(`\d+`)
+
+func (g *LocalQuestionGenerator) Generate(ctx context.Context, req GenerationRequest) ([]GeneratedQuestion, models.TokenUsage, error) {
+	type chunk struct {
+		material int64
+		index    int
+		text     string
+	}
+	var chunks []chunk
+	for _, id := range req.materials() {
+		texts, err := g.Chunks(ctx, id)
+		if err != nil {
+			return nil, models.TokenUsage{}, err
+		}
+		for k, t := range texts {
+			chunks = append(chunks, chunk{material: id, index: k, text: t})
+		}
+	}
+
+	var sentences []string
+	var from []int // chunk of each sentence
+	for k, c := range chunks {
+		for _, s := range splitSentences(c.text) {
+			sentences = append(sentences, s)
+			from = append(from, k)
+		}
+	}
+	if len(sentences) == 0 {
+		return nil, models.TokenUsage{}, ErrNoMaterialText
+	}
+
+	count := 1
+	if req.Count > 0 {
+		count = req.Count
+	} else if n, err := strconv.Atoi(instructionCount.FindString(req.Instruction)); err == nil && n > 0 {
+		count = min(n, maxLocalQuestions)
+	}
+
+	// the requested split, in the order of Difficulties
+	var plan []string
+	for _, d := range Difficulties {
+		for n := 0; n < req.DifficultyCounts[d]; n++ {
+			plan = append(plan, d)
+		}
+	}
+
+	qType := req.QuestionType
+	if qType == "" {
+		qType = TypeMultipleChoice
+	}
+
+	options := req.OptionCount
+	if options == 0 {
+		options = 4
+	}
+	taxonomy := req.TaxonomyLevels
+	if len(taxonomy) == 0 {
+		taxonomy = DefaultGeneratedTaxonomy
+	}
+
+	result := make([]GeneratedQuestion, 0, count)
+	for i := 0; i < count; i++ {
+		q := localQuestion(qType, sentences, i, options)
+		switch {
+		case i < len(plan):
+			q.Difficulty = plan[i]
+		case req.Difficulty != "":
+			q.Difficulty = req.Difficulty
+		default:
+			q.Difficulty = Difficulties[i%len(Difficulties)]
+		}
+		q.TaxonomyLevel = taxonomy[i%len(taxonomy)]
+		c := chunks[from[i%len(sentences)]]
+		q.Sources = []GeneratedSource{{
+			MaterialID: c.material,
+			ChunkID:    fmt.Sprintf("local-%d-%d", c.material, c.index),
+			Text:       c.text,
+		}}
+		result = append(result, q)
+	}
+	return result, models.TokenUsage{Model: "local"}, nil
+}
+
+// localQuestion fills the template of the type with sentence i (wrapping
+// around), using the keywords of the other sentences as distractors.
+// Choice types get the given number of options.
+func localQuestion(qType string, sentences []string, i, options int) GeneratedQuestion {
+	s := sentences[i%len(sentences)]
+	skip := i % len(sentences)
+	key := keyword(s)
+
+	switch qType {
+	case TypeTrueFalse:
+		return GeneratedQuestion{
+			Content: "Pernyataan berikut sesuai dengan materi: " + s,
+			Answers: []GeneratedAnswer{
+				{Label: "A", Text: "Benar", IsCorrect: true},
+				{Label: "B", Text: "Salah"},
+			},
+		}
+
+	case TypeMultipleResponse:
+		answers := []GeneratedAnswer{{Text: key, IsCorrect: true}}
+		second := keyword(strings.Replace(s, key, "", 1))
+		if second != "" && options > 2 {
+			answers = append(answers, GeneratedAnswer{Text: second, IsCorrect: true})
+		}
+		for _, d := range distractors(sentences, skip, options-len(answers), key, second) {
+			answers = append(answers, GeneratedAnswer{Text: d})
+		}
+		return GeneratedQuestion{
+			Content: "Pilih semua kata yang terdapat dalam pernyataan berikut: " + s,
+			Answers: labelAnswers(rotate(answers, i)),
+		}
+
+	case TypeShortAnswer:
+		return GeneratedQuestion{
+			Content: "Lengkapi pernyataan berikut: " + cloze(s, key),
+			Answers: []GeneratedAnswer{{Label: "A", Text: key, IsCorrect: true}},
+		}
+
+	case TypeNumeric:
+		zero := 0.0
+		if num := firstNumber(s); num != "" {
+			return GeneratedQuestion{
+				Content: "Lengkapi angka pada pernyataan berikut: " + cloze(s, num),
+				Answers: []GeneratedAnswer{{Label: "A", Text: num, IsCorrect: true, Tolerance: &zero}},
+			}
+		}
+		return GeneratedQuestion{
+			Content: "Berapa jumlah kata pada pernyataan berikut: " + s,
+			Answers: []GeneratedAnswer{{
+				Label:     "A",
+				Text:      strconv.Itoa(len(strings.Fields(s))),
+				IsCorrect: true,
+				Tolerance: &zero,
+			}},
+		}
+
+	case TypeMatching:
+		var answers []GeneratedAnswer
+		seen := make(map[string]bool)
+		for k := 0; k < len(sentences) && len(answers) < 3; k++ {
+			p := sentences[(i+k)%len(sentences)]
+			w := keyword(p)
+			if w == "" || seen[strings.ToLower(w)] {
+				continue
+			}
+			seen[strings.ToLower(w)] = true
+			answers = append(answers, GeneratedAnswer{Text: cloze(p, w), MatchText: w, IsCorrect: true})
+		}
+		// a material of a single sentence pairs two of its words
+		if second := keyword(strings.Replace(s, key, "", 1)); len(answers) < 2 && second != "" && !seen[strings.ToLower(second)] {
+			answers = append(answers, GeneratedAnswer{Text: cloze(s, second), MatchText: second, IsCorrect: true})
+		}
+		return GeneratedQuestion{
+			Content: "Jodohkan setiap pernyataan dengan kata yang melengkapinya, dimulai dari: " + cloze(s, key),
+			Answers: labelAnswers(answers),
+		}
+
+	case TypeEssay:
+		return GeneratedQuestion{
+			Content: "Jelaskan dan evaluasi pernyataan berikut berdasarkan materi: " + s,
+			Answers: []GeneratedAnswer{},
+			Rubric: []GeneratedCriterion{
+				{Title: "Ketepatan konsep", Description: "Penjelasan sesuai dengan materi.", Levels: localLevels()},
+				{Title: "Kualitas argumen", Description: "Evaluasi didukung alasan yang jelas.", Levels: localLevels()},
+			},
+		}
+
+	default:
+		answers := []GeneratedAnswer{{Text: key, IsCorrect: true}}
+		for _, d := range distractors(sentences, skip, options-1, key) {
+			answers = append(answers, GeneratedAnswer{Text: d})
+		}
+		return GeneratedQuestion{
+			Content: "Kata yang tepat untuk melengkapi pernyataan berikut adalah: " + cloze(s, key),
+			Answers: labelAnswers(rotate(answers, i)),
+		}
+	}
+}
+
+func localLevels() []GeneratedLevel {
+	return []GeneratedLevel{
+		{Score: 0, Label: "Kurang", Description: "Tidak sesuai materi."},
+		{Score: 2, Label: "Cukup", Description: "Sebagian sesuai materi."},
+		{Score: 4, Label: "Baik", Description: "Lengkap dan sesuai materi."},
+	}
+}
+
+var localFillers = []string{
+	"struktur", "proses", "fungsi", "sistem", "metode",
+	"konsep", "prinsip", "unsur", "tahap", "faktor",
+}
+
+// distractors returns n keywords of the other sentences that differ from
+// the excluded words, padded with fixed fillers.
+func distractors(sentences []string, skip, n int, exclude ...string) []string {
+	seen := make(map[string]bool)
+	for _, w := range exclude {
+		seen[strings.ToLower(w)] = true
+	}
+	var result []string
+	add := func(w string) {
+		if w != "" && !seen[strings.ToLower(w)] {
+			seen[strings.ToLower(w)] = true
+			result = append(result, w)
+		}
+	}
+	for k := 1; k < len(sentences) && len(result) < n; k++ {
+		add(keyword(sentences[(skip+k)%len(sentences)]))
+	}
+	for _, w := range localFillers {
+		if len(result) >= n {
+			break
+		}
+		add(w)
+	}
+	return result
+}
+
+// keyword is the longest word of the sentence, the first one on a tie.
+func keyword(s string) string {
+	best := ""
+	for _, w := range strings.FieldsFunc(s, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}) {
+		if len([]rune(w)) > len([]rune(best)) {
+			best = w
+		}
+	}
+	return best
+}
+
+var numberPattern = regexp.MustCompile(`\d+(?:[.,]\d+)?`)
+
+func firstNumber(s string) string {
+	return numberPattern.FindString(s)
+}
+
+func cloze(s, word string) string {
+	return strings.Replace(s, word, "____", 1)
+}
+
+// rotate moves the correct answer away from always being first.
+func rotate(answers []GeneratedAnswer, n int) []GeneratedAnswer {
+	k := n % len(answers)
+	result := make([]GeneratedAnswer, 0, len(answers))
+	result = append(result, answers[k:]...)
+	return append(result, answers[:k]...)
+}
+
+func labelAnswers(answers []GeneratedAnswer) []GeneratedAnswer {
+	for i := range answers {
+		answers[i].Label = OptionLabel(i)
+	}
+	return answers
+}
+
+var sentenceEnd = regexp.MustCompile(`[.!?]+(?:\s+|$)|\n+`)
+
+// splitSentences splits text at sentence ends and line breaks, leaving
+// decimal points alone, and keeps the sentences of at least three words.
+func splitSentences(text string) []string {
+	var result []string
+	for _, s := range sentenceEnd.Split(text, -1) {
+		s = strings.Join(strings.Fields(s), " ")
+		if len(strings.Fields(s)) >= 3 {
+			result = append(result, s+".")
+		}
+	}
+	return result
+}
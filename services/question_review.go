@@ -0,0 +1,83 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	StatusDraft            = "draft"
+	StatusSubmitted        = "submitted"
+	StatusInReview         = "in_review"
+	StatusApproved         = "approved"
+	StatusRejected         = "rejected"
+	StatusChangesRequested = "changes_requested"
+)
+
+var (
+	ErrReviewForbidden = errors.New("you are not allowed to make this review step")
+	ErrSelfReview      = errors.New("the author of a question cannot review it")
+	ErrReasonRequired  = errors.New("a reason is required for this review step")
+	ErrInvalidStatus   = errors.New("invalid status transition")
+)
+
+// ReviewActor is how the user moving a question relates to it.
+type ReviewActor struct {
+	IsAdmin    bool
+	IsAuthor   bool
+	IsReviewer bool
+}
+
+type reviewStep struct {
+	from, to string
+	// byAuthor steps are made by the author; the others by the assigned
+	// reviewer, who is never the author. Admins may act as either.
+	byAuthor    bool
+	needsReason bool
+}
+
+var reviewSteps = []reviewStep{
+	{StatusDraft, StatusSubmitted, true, false},
+	{StatusChangesRequested, StatusSubmitted, true, false},
+	{StatusSubmitted, StatusDraft, true, false},
+	{StatusRejected, StatusDraft, true, false},
+	{StatusSubmitted, StatusInReview, false, false},
+	{StatusInReview, StatusApproved, false, false},
+	{StatusInReview, StatusRejected, false, true},
+	{StatusInReview, StatusChangesRequested, false, true},
+}
+
+// IsEditableStatus reports whether the author may still edit a question
+// in the status.
+func IsEditableStatus(status string) bool {
+	return status == StatusDraft || status == StatusChangesRequested
+}
+
+// CheckReviewTransition validates moving a question from one status to
+// another. Reviewer steps are never allowed to the author, admins
+// included, so nobody approves their own question.
+func CheckReviewTransition(from, to string, actor ReviewActor, reason string) error {
+	for _, s := range reviewSteps {
+		if s.from != from || s.to != to {
+			continue
+		}
+		if s.byAuthor {
+			if !actor.IsAuthor && !actor.IsAdmin {
+				return ErrReviewForbidden
+			}
+		} else {
+			if actor.IsAuthor {
+				return ErrSelfReview
+			}
+			if !actor.IsReviewer && !actor.IsAdmin {
+				return ErrReviewForbidden
+			}
+		}
+		if s.needsReason && strings.TrimSpace(reason) == "" {
+			return ErrReasonRequired
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: %s to %s", ErrInvalidStatus, from, to)
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCheckReviewTransition(t *testing.T) {
+	author := ReviewActor{IsAuthor: true}
+	reviewer := ReviewActor{IsReviewer: true}
+	admin := ReviewActor{IsAdmin: true}
+	adminAuthor := ReviewActor{IsAdmin: true, IsAuthor: true}
+	other := ReviewActor{}
+
+	tests := []struct {
+		name     string
+		from, to string
+		actor    ReviewActor
+		reason   string
+		wantErr  error
+	}{
+		{name: "author submits a draft", from: StatusDraft, to: StatusSubmitted, actor: author},
+		{name: "author resubmits after changes", from: StatusChangesRequested, to: StatusSubmitted, actor: author},
+		{name: "author withdraws a submission", from: StatusSubmitted, to: StatusDraft, actor: author},
+		{name: "author reopens a rejected question", from: StatusRejected, to: StatusDraft, actor: author},
+		{name: "admin submits for the author", from: StatusDraft, to: StatusSubmitted, actor: admin},
+		{name: "reviewer cannot submit", from: StatusDraft, to: StatusSubmitted, actor: reviewer, wantErr: ErrReviewForbidden},
+		{name: "reviewer starts the review", from: StatusSubmitted, to: StatusInReview, actor: reviewer},
+		{name: "reviewer approves", from: StatusInReview, to: StatusApproved, actor: reviewer},
+		{name: "admin approves", from: StatusInReview, to: StatusApproved, actor: admin},
+		{name: "author cannot approve", from: StatusInReview, to: StatusApproved, actor: author, wantErr: ErrSelfReview},
+		{name: "admin cannot approve their own", from: StatusInReview, to: StatusApproved, actor: adminAuthor, wantErr: ErrSelfReview},
+		{name: "unrelated teacher cannot review", from: StatusSubmitted, to: StatusInReview, actor: other, wantErr: ErrReviewForbidden},
+		{name: "rejecting needs a reason", from: StatusInReview, to: StatusRejected, actor: reviewer, reason: "  ", wantErr: ErrReasonRequired},
+		{name: "rejecting with a reason", from: StatusInReview, to: StatusRejected, actor: reviewer, reason: "kunci salah"},
+		{name: "requesting changes needs a reason", from: StatusInReview, to: StatusChangesRequested, actor: reviewer, wantErr: ErrReasonRequired},
+		{name: "approving skips the review", from: StatusSubmitted, to: StatusApproved, actor: reviewer, wantErr: ErrInvalidStatus},
+		{name: "approved questions stay approved", from: StatusApproved, to: StatusDraft, actor: admin, wantErr: ErrInvalidStatus},
+		{name: "unknown status", from: "archived", to: StatusDraft, actor: author, wantErr: ErrInvalidStatus},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := CheckReviewTransition(tt.from, tt.to, tt.actor, tt.reason)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestIsEditableStatus(t *testing.T) {
+	tests := map[string]bool{
+		StatusDraft:            true,
+		StatusChangesRequested: true,
+		StatusSubmitted:        false,
+		StatusInReview:         false,
+		StatusApproved:         false,
+		StatusRejected:         false,
+	}
+	for status, want := range tests {
+		if got := IsEditableStatus(status); got != want {
+			t.Errorf("IsEditableStatus(%q) = %v, want %v", status, got, want)
+		}
+	}
+}
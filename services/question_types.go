@@ -0,0 +1,165 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"backendLMS/models"
+)
+
+const (
+	TypeMultipleChoice   = "multiple_choice"
+	TypeTrueFalse        = "true_false"
+	TypeMultipleResponse = "multiple_response"
+	TypeShortAnswer      = "short_answer"
+	TypeNumeric          = "numeric"
+	TypeMatching         = "matching"
+	TypeEssay            = "essay"
+)
+
+var QuestionTypes = []string{
+	TypeMultipleChoice,
+	TypeTrueFalse,
+	TypeMultipleResponse,
+	TypeShortAnswer,
+	TypeNumeric,
+	TypeMatching,
+	TypeEssay,
+}
+
+// NormalizeQuestionType validates a question type; an empty type means
+// multiple choice.
+func NormalizeQuestionType(t string) (string, error) {
+	t = strings.ToLower(strings.TrimSpace(t))
+	if t == "" {
+		return TypeMultipleChoice, nil
+	}
+	for _, known := range QuestionTypes {
+		if t == known {
+			return t, nil
+		}
+	}
+	return "", fmt.Errorf("unknown question type %q", t)
+}
+
+// IsSingleChoice reports whether a response to the type is one answer id.
+func IsSingleChoice(t string) bool {
+	return t == TypeMultipleChoice || t == TypeTrueFalse || t == ""
+}
+
+// HasOptions reports whether students pick from the answer rows of the
+// type. Short answer and numeric rows are the key and must stay hidden;
+// essays have no answer rows at all.
+func HasOptions(t string) bool {
+	return t != TypeShortAnswer && t != TypeNumeric && t != TypeEssay
+}
+
+// IsManuallyGraded reports whether responses to the type are scored by a
+// teacher against a rubric instead of by GradeResponse.
+func IsManuallyGraded(t string) bool {
+	return t == TypeEssay
+}
+
+// GradeResponse returns the fraction of the points a response earns, from
+// 0 to 1. Multiple response is all or nothing; matching earns a share per
+// correct pair. Essays are not graded here, see RubricFraction.
+func GradeResponse(qType string, answers []models.Answer, resp models.AttemptAnswer) float64 {
+	switch qType {
+	case TypeMultipleResponse:
+		selected := make(map[int64]bool)
+		for _, id := range resp.AnswerIDs {
+			selected[id] = true
+		}
+		if len(selected) == 0 {
+			return 0
+		}
+		for _, a := range answers {
+			if a.IsCorrect != selected[a.ID] {
+				return 0
+			}
+		}
+		return 1
+
+	case TypeShortAnswer:
+		if resp.Text == nil {
+			return 0
+		}
+		given := normalizeShortAnswer(*resp.Text)
+		if given == "" {
+			return 0
+		}
+		for _, a := range answers {
+			if normalizeShortAnswer(a.Text) == given {
+				return 1
+			}
+		}
+		return 0
+
+	case TypeNumeric:
+		if resp.Text == nil || len(answers) == 0 {
+			return 0
+		}
+		given, err := ParseNumber(*resp.Text)
+		if err != nil {
+			return 0
+		}
+		want, err := ParseNumber(answers[0].Text)
+		if err != nil {
+			return 0
+		}
+		tolerance := 0.0
+		if answers[0].Tolerance != nil {
+			tolerance = *answers[0].Tolerance
+		}
+		// a little slack so 0.1+0.2 style rounding does not fail exact answers
+		if math.Abs(given-want) <= tolerance+1e-9 {
+			return 1
+		}
+		return 0
+
+	case TypeMatching:
+		if len(answers) == 0 {
+			return 0
+		}
+		right := 0
+		for _, a := range answers {
+			if resp.Pairs[a.ID] == a.ID {
+				right++
+			}
+		}
+		return float64(right) / float64(len(answers))
+
+	case TypeEssay:
+		return 0
+
+	default:
+		if resp.AnswerID == nil {
+			return 0
+		}
+		for _, a := range answers {
+			if a.ID == *resp.AnswerID {
+				if a.IsCorrect {
+					return 1
+				}
+				return 0
+			}
+		}
+		return 0
+	}
+}
+
+// ParseNumber reads a number written with either a decimal point or a
+// decimal comma ("3.5" or "3,5").
+func ParseNumber(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, ".") {
+		s = strings.Replace(s, ",", ".", 1)
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+func normalizeShortAnswer(s string) string {
+	return strings.Join(strings.Fields(strings.ToLower(s)), " ")
+}
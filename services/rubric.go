@@ -0,0 +1,73 @@
+package services
+
+import (
+	"fmt"
+
+	"backendLMS/models"
+)
+
+// RubricMax is the best score a response can reach on a rubric: the top
+// level of every criterion.
+func RubricMax(rubric []models.RubricCriterion) float64 {
+	var total float64
+	for _, c := range rubric {
+		top := 0.0
+		for _, l := range c.Levels {
+			if l.Score > top {
+				top = l.Score
+			}
+		}
+		total += top
+	}
+	return total
+}
+
+// ScoreRubric resolves the level picked for every criterion and returns
+// the scored criteria with the fraction of the rubric maximum they reach.
+// Every criterion must be scored exactly once.
+func ScoreRubric(rubric []models.RubricCriterion, picked []models.CriterionScore) ([]models.CriterionScore, float64, error) {
+	if len(rubric) == 0 {
+		return nil, 0, fmt.Errorf("question has no rubric")
+	}
+
+	byCriterion := make(map[int64]models.CriterionScore)
+	for _, p := range picked {
+		if _, dup := byCriterion[p.CriterionID]; dup {
+			return nil, 0, fmt.Errorf("criterion %d is scored twice", p.CriterionID)
+		}
+		byCriterion[p.CriterionID] = p
+	}
+
+	var total float64
+	result := make([]models.CriterionScore, 0, len(rubric))
+	for _, c := range rubric {
+		p, ok := byCriterion[c.ID]
+		if !ok {
+			return nil, 0, fmt.Errorf("criterion %q is not scored", c.Title)
+		}
+		delete(byCriterion, c.ID)
+
+		found := false
+		for _, l := range c.Levels {
+			if l.ID == p.LevelID {
+				p.Score = l.Score
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, 0, fmt.Errorf("level %d does not belong to criterion %q", p.LevelID, c.Title)
+		}
+		total += p.Score
+		result = append(result, p)
+	}
+	for id := range byCriterion {
+		return nil, 0, fmt.Errorf("criterion %d is not part of the rubric", id)
+	}
+
+	best := RubricMax(rubric)
+	if best <= 0 {
+		return result, 0, nil
+	}
+	return result, total / best, nil
+}
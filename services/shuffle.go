@@ -0,0 +1,71 @@
+package services
+
+// The shuffles below use their own generator instead of math/rand so that a
+// stored seed reproduces exactly the same layout after a Go upgrade.
+
+type splitMix64 struct {
+	state uint64
+}
+
+func (s *splitMix64) next() uint64 {
+	s.state += 0x9e3779b97f4a7c15
+	z := s.state
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+// permutation returns a Fisher-Yates permutation of 0..n-1 for the seed.
+func permutation(seed uint64, n int) []int {
+	p := make([]int, n)
+	for i := range p {
+		p[i] = i
+	}
+	rng := &splitMix64{state: seed}
+	for i := n - 1; i > 0; i-- {
+		j := int(rng.next() % uint64(i+1))
+		p[i], p[j] = p[j], p[i]
+	}
+	return p
+}
+
+// QuestionOrder returns the order in which n exam items are shown for the
+// seed: element i is the index of the item displayed at position i+1.
+func QuestionOrder(seed int64, n int) []int {
+	return permutation(uint64(seed), n)
+}
+
+// OptionOrder returns the display order of n options of one question. The
+// question ID is mixed in so each question gets its own order, independent
+// of where the question lands in the exam.
+func OptionOrder(seed int64, questionID int64, n int) []int {
+	return permutation(uint64(seed)^(uint64(questionID)*0xff51afd7ed558ccd), n)
+}
+
+// OptionLabel returns the display label for the option at index i (A, B, ...).
+func OptionLabel(i int) string {
+	if i < 26 {
+		return string(rune('A' + i))
+	}
+	return OptionLabel(i/26-1) + OptionLabel(i%26)
+}
+
+// SameOrder reports whether two orders are identical.
+func SameOrder(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// MatchOrder returns the display order of the right column of a matching
+// question. It is always shuffled, since in stored order every left item
+// would sit next to its own match.
+func MatchOrder(seed int64, questionID int64, n int) []int {
+	return permutation(uint64(seed)^(uint64(questionID)*0xc4ceb9fe1a85ec53)^0x9e3779b97f4a7c15, n)
+}
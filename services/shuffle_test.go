@@ -0,0 +1,87 @@
+package services
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestQuestionOrder(t *testing.T) {
+	// stored seeds must keep reproducing the layout students were shown
+	tests := []struct {
+		seed int64
+		n    int
+		want []int
+	}{
+		{seed: 1, n: 5, want: []int{2, 1, 4, 3, 0}},
+		{seed: 2, n: 5, want: []int{1, 3, 4, 2, 0}},
+		{seed: 42, n: 8, want: []int{3, 1, 6, 2, 4, 0, 7, 5}},
+		{seed: -7, n: 3, want: []int{1, 2, 0}},
+		{seed: 9, n: 1, want: []int{0}},
+		{seed: 9, n: 0, want: []int{}},
+	}
+	for _, tt := range tests {
+		if got := QuestionOrder(tt.seed, tt.n); !slices.Equal(got, tt.want) {
+			t.Errorf("QuestionOrder(%d, %d) = %v, want %v", tt.seed, tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestOptionOrder(t *testing.T) {
+	tests := []struct {
+		name       string
+		seed       int64
+		questionID int64
+		want       []int
+	}{
+		{name: "question 10", seed: 1, questionID: 10, want: []int{3, 0, 2, 1}},
+		{name: "another question in the same attempt", seed: 1, questionID: 11, want: []int{0, 1, 2, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := OptionOrder(tt.seed, tt.questionID, len(tt.want))
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("order = %v, want %v", got, tt.want)
+			}
+			if again := OptionOrder(tt.seed, tt.questionID, len(tt.want)); !slices.Equal(again, got) {
+				t.Errorf("order changed between calls: %v then %v", got, again)
+			}
+		})
+	}
+}
+
+func TestPermutationIsComplete(t *testing.T) {
+	for seed := int64(0); seed < 50; seed++ {
+		for n := 0; n < 12; n++ {
+			got := slices.Sorted(slices.Values(QuestionOrder(seed, n)))
+			if !slices.Equal(got, identity(n)) {
+				t.Fatalf("QuestionOrder(%d, %d) is not a permutation: %v", seed, n, got)
+			}
+		}
+	}
+}
+
+func TestOptionLabel(t *testing.T) {
+	tests := map[int]string{0: "A", 1: "B", 25: "Z", 26: "AA", 27: "AB", 51: "AZ", 52: "BA", 701: "ZZ", 702: "AAA"}
+	for i, want := range tests {
+		if got := OptionLabel(i); got != want {
+			t.Errorf("OptionLabel(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestSameOrder(t *testing.T) {
+	tests := []struct {
+		a, b []int
+		want bool
+	}{
+		{a: []int{0, 1, 2}, b: []int{0, 1, 2}, want: true},
+		{a: nil, b: []int{}, want: true},
+		{a: []int{0, 1, 2}, b: []int{0, 2, 1}, want: false},
+		{a: []int{0, 1}, b: []int{0, 1, 2}, want: false},
+	}
+	for _, tt := range tests {
+		if got := SameOrder(tt.a, tt.b); got != tt.want {
+			t.Errorf("SameOrder(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package services
+
+import (
+	"hash/fnv"
+	"sort"
+	"strings"
+	"unicode"
+
+	"backendLMS/models"
+)
+
+// DuplicateThreshold is the trigram Jaccard similarity from which two
+// question stems count as near-duplicates.
+const DuplicateThreshold = 0.8
+
+const (
+	minHashSize = 64
+	lshBands    = 16 // of minHashSize / lshBands rows each
+)
+
+// StemItem is a question stem to compare.
+type StemItem struct {
+	ID      int64
+	Content string
+}
+
+// NormalizeStem lowercases a stem and reduces everything that is not a
+// letter or digit to single spaces, so punctuation, markup leftovers and
+// spacing do not hide a duplicate.
+func NormalizeStem(s string) string {
+	var b strings.Builder
+	space := true
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			space = false
+			continue
+		}
+		if !space {
+			b.WriteByte(' ')
+			space = true
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Shingles returns the hashed character trigrams of the normalized stem.
+// Stems shorter than three characters are a single shingle.
+func Shingles(s string) map[uint64]struct{} {
+	runes := []rune(NormalizeStem(s))
+	set := make(map[uint64]struct{})
+	if len(runes) == 0 {
+		return set
+	}
+	if len(runes) < 3 {
+		set[hashString(string(runes))] = struct{}{}
+		return set
+	}
+	for i := 0; i+3 <= len(runes); i++ {
+		set[hashString(string(runes[i:i+3]))] = struct{}{}
+	}
+	return set
+}
+
+// Jaccard is |a ∩ b| / |a ∪ b|; two empty sets are not similar.
+func Jaccard(a, b map[uint64]struct{}) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 0
+	}
+	if len(a) > len(b) {
+		a, b = b, a
+	}
+	shared := 0
+	for h := range a {
+		if _, ok := b[h]; ok {
+			shared++
+		}
+	}
+	return float64(shared) / float64(len(a)+len(b)-shared)
+}
+
+// SimilarStems returns the items of pool whose stem is at least threshold
+// similar to content, most similar first.
+func SimilarStems(content string, pool []StemItem, threshold float64) []models.DuplicateMatch {
+	target := Shingles(content)
+	var result []models.DuplicateMatch
+	for _, it := range pool {
+		if sim := Jaccard(target, Shingles(it.Content)); sim >= threshold {
+			result = append(result, models.DuplicateMatch{QuestionID: it.ID, Similarity: sim})
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Similarity != result[j].Similarity {
+			return result[i].Similarity > result[j].Similarity
+		}
+		return result[i].QuestionID < result[j].QuestionID
+	})
+	return result
+}
+
+// DuplicateClusters groups the items into clusters of near-duplicates.
+// Candidate pairs come from MinHash locality-sensitive hashing, so the
+// whole bank is not compared pair by pair, and every candidate is checked
+// with the exact Jaccard similarity. Pairs join transitively. Clusters
+// hold their ids in ascending order and only clusters of two or more are
+// returned.
+func DuplicateClusters(items []StemItem, threshold float64) [][]int64 {
+	shingles := make([]map[uint64]struct{}, len(items))
+	buckets := make(map[[2]uint64][]int)
+	for i, it := range items {
+		shingles[i] = Shingles(it.Content)
+		if len(shingles[i]) == 0 {
+			continue
+		}
+		sig := minHash(shingles[i])
+		rows := minHashSize / lshBands
+		for band := 0; band < lshBands; band++ {
+			h := fnv.New64a()
+			for _, v := range sig[band*rows : (band+1)*rows] {
+				var buf [8]byte
+				for k := range buf {
+					buf[k] = byte(v >> (8 * k))
+				}
+				h.Write(buf[:])
+			}
+			key := [2]uint64{uint64(band), h.Sum64()}
+			buckets[key] = append(buckets[key], i)
+		}
+	}
+
+	parent := make([]int, len(items))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+
+	checked := make(map[[2]int]bool)
+	for _, members := range buckets {
+		for x := 0; x < len(members); x++ {
+			for y := x + 1; y < len(members); y++ {
+				a, b := members[x], members[y]
+				if checked[[2]int{a, b}] {
+					continue
+				}
+				checked[[2]int{a, b}] = true
+				if find(a) == find(b) {
+					continue
+				}
+				if Jaccard(shingles[a], shingles[b]) >= threshold {
+					parent[find(a)] = find(b)
+				}
+			}
+		}
+	}
+
+	groups := make(map[int][]int64)
+	for i, it := range items {
+		root := find(i)
+		groups[root] = append(groups[root], it.ID)
+	}
+
+	var result [][]int64
+	for _, ids := range groups {
+		if len(ids) < 2 {
+			continue
+		}
+		sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+		result = append(result, ids)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i][0] < result[j][0] })
+	return result
+}
+
+// minHash is the MinHash signature of a shingle set; every position uses
+// its own seeded mix of the shingle hashes.
+func minHash(set map[uint64]struct{}) []uint64 {
+	sig := make([]uint64, minHashSize)
+	for i := range sig {
+		sig[i] = ^uint64(0)
+	}
+	for h := range set {
+		for i := range sig {
+			if v := mix64(h ^ (uint64(i+1) * 0x9e3779b97f4a7c15)); v < sig[i] {
+				sig[i] = v
+			}
+		}
+	}
+	return sig
+}
+
+// mix64 is the splitmix64 finalizer.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+func hashString(s string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(s))
+	return h.Sum64()
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"math"
+	"slices"
+	"testing"
+)
+
+const (
+	stemMitochondria = "Apa fungsi utama mitokondria dalam sel eukariotik?"
+	stemRephrased    = "Apa fungsi utama mitokondria dalam sel eukariota?"     // 0.9375
+	stemRibosome     = "Apa fungsi utama ribosom dalam sel eukariotik?"        // 0.61
+	stemReformatted  = "APA  fungsi utama mitokondria, dalam sel eukariotik!!" // 1
+	stemCapital      = "Sebutkan ibu kota Indonesia."
+)
+
+func TestNormalizeStem(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "lowercase", in: "Ibu Kota", want: "ibu kota"},
+		{name: "punctuation and spacing", in: "  Apa   fungsi-nya?!  ", want: "apa fungsi nya"},
+		{name: "markup leftovers", in: "<p>2 + 2 = ?</p>", want: "p 2 2 p"},
+		{name: "letters outside ascii", in: "Café Ünïcode", want: "café ünïcode"},
+		{name: "nothing left", in: "?!...", want: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NormalizeStem(tt.in); got != tt.want {
+				t.Errorf("NormalizeStem(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShingles(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want int
+	}{
+		{name: "empty", in: "", want: 0},
+		{name: "only punctuation", in: "?!", want: 0},
+		{name: "shorter than a trigram", in: "ab", want: 1},
+		{name: "one trigram", in: "abc", want: 1},
+		{name: "repeated trigrams count once", in: "aaaaaa", want: 1},
+		{name: "sliding window", in: "abcde", want: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := len(Shingles(tt.in)); got != tt.want {
+				t.Errorf("len(Shingles(%q)) = %d, want %d", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestJaccard(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want float64
+	}{
+		{name: "same stem", a: stemMitochondria, b: stemMitochondria, want: 1},
+		{name: "case, punctuation and spacing", a: stemMitochondria, b: stemReformatted, want: 1},
+		{name: "nothing shared", a: stemMitochondria, b: stemCapital, want: 0},
+		{name: "half shared", a: "abcd", b: "bcde", want: 1.0 / 3},
+		{name: "two empty stems", a: "", b: "", want: 0},
+		{name: "one empty stem", a: "", b: stemCapital, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Jaccard(Shingles(tt.a), Shingles(tt.b))
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Jaccard = %v, want %v", got, tt.want)
+			}
+			if back := Jaccard(Shingles(tt.b), Shingles(tt.a)); back != got {
+				t.Errorf("Jaccard is not symmetric: %v and %v", got, back)
+			}
+		})
+	}
+}
+
+func TestSimilarStems(t *testing.T) {
+	pool := []StemItem{
+		{ID: 4, Content: stemRephrased},
+		{ID: 3, Content: stemRibosome},
+		{ID: 2, Content: stemReformatted},
+		{ID: 1, Content: stemMitochondria},
+		{ID: 5, Content: stemCapital},
+	}
+	tests := []struct {
+		name      string
+		threshold float64
+		want      []int64
+	}{
+		{name: "exact matches first, then by id", threshold: 1, want: []int64{1, 2}},
+		{name: "duplicate threshold", threshold: DuplicateThreshold, want: []int64{1, 2, 4}},
+		{name: "lower threshold", threshold: 0.5, want: []int64{1, 2, 4, 3}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ids []int64
+			for _, m := range SimilarStems(stemMitochondria, pool, tt.threshold) {
+				ids = append(ids, m.QuestionID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("matches = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+
+	if got := SimilarStems("", pool, DuplicateThreshold); len(got) != 0 {
+		t.Errorf("an empty stem matched %v", got)
+	}
+}
+
+func TestDuplicateClusters(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []StemItem
+		want  [][]int64
+	}{
+		{
+			name: "no duplicates",
+			items: []StemItem{
+				{ID: 1, Content: stemMitochondria},
+				{ID: 2, Content: stemCapital},
+			},
+		},
+		{
+			name: "ids ascending, singletons dropped",
+			items: []StemItem{
+				{ID: 9, Content: stemReformatted},
+				{ID: 5, Content: stemCapital},
+				{ID: 3, Content: stemMitochondria},
+				{ID: 7, Content: stemRibosome},
+			},
+			want: [][]int64{{3, 9}},
+		},
+		{
+			// 1 and 3 are 0.79 apart, each 0.89 from 2
+			name: "pairs join transitively",
+			items: []StemItem{
+				{ID: 1, Content: "Sebutkan dua hasil utama proses fotosintesis"},
+				{ID: 2, Content: "Sebutkan dua hasil utama proses fotosintesis daun"},
+				{ID: 3, Content: "Sebutkan dua hasil utama proses fotosintesis daun hijau"},
+			},
+			want: [][]int64{{1, 2, 3}},
+		},
+		{
+			name: "clusters ordered by their first id",
+			items: []StemItem{
+				{ID: 8, Content: stemCapital},
+				{ID: 6, Content: stemMitochondria},
+				{ID: 2, Content: stemCapital + "!"},
+				{ID: 4, Content: stemRephrased},
+			},
+			want: [][]int64{{2, 8}, {4, 6}},
+		},
+		{
+			name: "empty stems are never duplicates",
+			items: []StemItem{
+				{ID: 1, Content: ""},
+				{ID: 2, Content: "?"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := DuplicateClusters(tt.items, DuplicateThreshold)
+			if !slices.EqualFunc(got, tt.want, slices.Equal[[]int64]) {
+				t.Errorf("clusters = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMinHash(t *testing.T) {
+	a := Shingles(stemMitochondria)
+	sig := minHash(a)
+	if len(sig) != minHashSize {
+		t.Fatalf("signature has %d values, want %d", len(sig), minHashSize)
+	}
+	if !slices.Equal(minHash(Shingles(stemReformatted)), sig) {
+		t.Error("equal shingle sets gave different signatures")
+	}
+	if slices.Equal(minHash(Shingles(stemCapital)), sig) {
+		t.Error("unrelated stems gave the same signature")
+	}
+
+	// the share of equal positions estimates the Jaccard similarity
+	b := Shingles(stemRephrased)
+	equal := 0
+	for i, v := range minHash(b) {
+		if v == sig[i] {
+			equal++
+		}
+	}
+	estimate := float64(equal) / minHashSize
+	if want := Jaccard(a, b); math.Abs(estimate-want) > 0.25 {
+		t.Errorf("signature agreement %v is far from similarity %v", estimate, want)
+	}
+}
@@ -0,0 +1,369 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"time"
+
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+)
+
+const (
+	// maxGenerationAttempts bounds how often a job whose server died is
+	// started again.
+	maxGenerationAttempts    = 3
+	defaultGenerationTimeout = 5 * time.Minute
+	// generationLeaseSlack is the time a running job gets on top of its
+	// generator calls to validate and save before it counts as abandoned.
+	generationLeaseSlack = time.Minute
+)
+
+var generationWake = make(chan struct{}, 1)
+
+// NotifyGenerationJob wakes an idle worker after a job has been queued.
+func NotifyGenerationJob() {
+	notify(generationWake)
+}
+
+// StartGenerationWorkers starts n workers that run queued jobs until ctx
+// is done, and a sweep that requeues the jobs of servers that died. A job
+// is only taken as abandoned once it has run past every generator call it
+// makes, so the jobs of other live servers are left alone. A worker
+// stopped by ctx puts its job back itself.
+func StartGenerationWorkers(ctx context.Context, n int) {
+	timeout := defaultGenerationTimeout
+	if v, err := strconv.Atoi(os.Getenv("GENERATION_TIMEOUT_SECONDS")); err == nil && v > 0 {
+		timeout = time.Duration(v) * time.Second
+	}
+	gen := newQuestionGenerator(timeout)
+
+	sweep(ctx, func() {
+		lease := timeout + generationLeaseSlack
+		if err := repositories.RequeueAbandonedGenerationJobs(ctx, maxGenerationAttempts, lease); err != nil && ctx.Err() == nil {
+			log.Println("requeue generation jobs:", err)
+		}
+	})
+	for i := 0; i < n; i++ {
+		spawn(func() { generationWorker(ctx, gen) })
+	}
+}
+
+func generationWorker(ctx context.Context, gen services.QuestionGenerator) {
+	runQueue(ctx, generationWake, func() bool {
+		job, err := repositories.ClaimGenerationJob(ctx)
+		if err != nil {
+			log.Println("claim generation job:", err)
+			return false
+		}
+		if job == nil {
+			return false
+		}
+		// there may be more; let another idle worker look as well
+		NotifyGenerationJob()
+		runGenerationJob(ctx, gen, job)
+		return true
+	})
+}
+
+func runGenerationJob(ctx context.Context, gen services.QuestionGenerator, job *models.GenerationJob) {
+	services.Progress.Publish(job.CreatedBy, models.ProgressEvent{
+		Type:       "generation_started",
+		MaterialID: job.MaterialID,
+		JobID:      job.ID,
+	})
+
+	out, err := generateJob(ctx, gen, job)
+	var batch *models.GenerationBatch
+	if err == nil {
+		batch, err = repositories.CompleteGenerationJob(ctx, job, out)
+	}
+	// the server is stopping: the job runs again on the next start
+	if err != nil && ctx.Err() != nil {
+		log.Printf("generation job %d interrupted, requeued", job.ID)
+		if rerr := repositories.ReleaseGenerationJob(context.WithoutCancel(ctx), job.ID); rerr != nil {
+			log.Printf("generation job %d: %v", job.ID, rerr)
+		}
+		return
+	}
+	if err != nil {
+		log.Printf("generation job %d failed: %v", job.ID, err)
+		if ferr := repositories.FailGenerationJob(ctx, job.ID, err.Error()); ferr != nil {
+			log.Printf("generation job %d: %v", job.ID, ferr)
+		}
+		services.Progress.Publish(job.CreatedBy, models.ProgressEvent{
+			Type:       "generation_failed",
+			MaterialID: job.MaterialID,
+			JobID:      job.ID,
+			Message:    err.Error(),
+		})
+		return
+	}
+
+	rejected := 0
+	for _, it := range batch.Report {
+		if it.Status == "rejected" {
+			rejected++
+		}
+	}
+	message := fmt.Sprintf("%d questions created", batch.Stats.Total)
+	if s := job.Summary; s != nil && s.Shortfall > 0 {
+		message = fmt.Sprintf("%d of %d requested questions created", s.Saved, s.Requested)
+	}
+	services.Progress.Publish(job.CreatedBy, models.ProgressEvent{
+		Type:       "generation_done",
+		MaterialID: job.MaterialID,
+		JobID:      job.ID,
+		BatchID:    batch.ID,
+		Count:      batch.Stats.Total,
+		Skipped:    len(batch.Skipped),
+		Rejected:   rejected,
+		Message:    message,
+	})
+}
+
+// generateJob asks the generator for the job's questions and validates
+// them. A distributed job makes one call per material share and links
+// the questions of a share to its material; a share that fails is listed
+// in the failures, and only a job whose every share fails is an error.
+func generateJob(ctx context.Context, gen services.QuestionGenerator, job *models.GenerationJob) (repositories.GenerationOutcome, error) {
+	optionCount := 0
+	if job.OptionCount != nil {
+		optionCount = *job.OptionCount
+	}
+	rules := services.GenerationRules{
+		TaxonomyLevels: job.TaxonomyLevels,
+		OptionCount:    optionCount,
+		Difficulty:     job.Difficulty,
+	}
+	req := services.GenerationRequest{
+		MaterialID:       job.MaterialID,
+		QuestionType:     job.QuestionType,
+		Instruction:      job.Instruction,
+		PromptTemplate:   job.PromptTemplate,
+		TaxonomyLevels:   job.TaxonomyLevels,
+		OptionCount:      optionCount,
+		Difficulty:       job.Difficulty,
+		Count:            job.Count,
+		DifficultyCounts: job.DifficultyCounts,
+		Language:         job.Language,
+	}
+
+	// without a count there is nothing to split: one call over the set
+	if len(job.Allocations) == 0 {
+		if len(job.MaterialIDs) > 1 {
+			req.MaterialIDs = job.MaterialIDs
+		}
+		generated, usage, err := gen.Generate(ctx, req)
+		if err != nil {
+			return repositories.GenerationOutcome{}, err
+		}
+		items := validateGenerated(job.QuestionType, rules, job.MaterialIDs, generated)
+		limitGenerated(items, job.Count, job.DifficultyCounts)
+		return repositories.GenerationOutcome{
+			Items: items,
+			Usage: map[int64]models.TokenUsage{0: usage},
+		}, nil
+	}
+
+	out := repositories.GenerationOutcome{
+		Failures: make(map[int64]string),
+		Usage:    make(map[int64]models.TokenUsage),
+	}
+	var lastErr error
+	for _, share := range job.Allocations {
+		req.MaterialID = share.MaterialID
+		req.Count = share.Count
+		req.DifficultyCounts = share.DifficultyCounts
+		generated, usage, err := gen.Generate(ctx, req)
+		if err != nil {
+			log.Printf("generation job %d, material %d: %v", job.ID, share.MaterialID, err)
+			out.Failures[share.MaterialID] = err.Error()
+			lastErr = err
+			continue
+		}
+		out.Usage[share.MaterialID] = usage
+		got := validateGenerated(job.QuestionType, rules, []int64{share.MaterialID}, generated)
+		for i := range got {
+			got[i].MaterialID = share.MaterialID
+		}
+		limitGenerated(got, share.Count, share.DifficultyCounts)
+		out.Items = append(out.Items, got...)
+	}
+	// a server stopping mid-job requeues it rather than saving part
+	if err := ctx.Err(); err != nil {
+		return repositories.GenerationOutcome{}, err
+	}
+	if len(out.Failures) == len(job.Allocations) {
+		return repositories.GenerationOutcome{}, lastErr
+	}
+	return out, nil
+}
+
+// limitGenerated rejects the valid items beyond the count, and beyond a
+// difficulty's count when the request split it, so a generator that
+// writes too many does not overfill the batch.
+func limitGenerated(items []repositories.GeneratedInput, count int, difficultyCounts map[string]int) {
+	if count == 0 {
+		return
+	}
+	total := 0
+	perDifficulty := make(map[string]int)
+	for i := range items {
+		q := items[i].Question
+		if q == nil {
+			continue
+		}
+		reason := ""
+		want, ok := difficultyCounts[q.Difficulty]
+		if len(difficultyCounts) > 0 && !ok {
+			reason = fmt.Sprintf("difficulty %s was not requested", q.Difficulty)
+		} else if ok && perDifficulty[q.Difficulty] >= want {
+			reason = fmt.Sprintf("exceeds the requested %d %s question(s)", want, q.Difficulty)
+		} else if total >= count {
+			reason = fmt.Sprintf("exceeds the requested count of %d", count)
+		}
+		if reason != "" {
+			items[i].Question = nil
+			items[i].RejectReason = reason
+			continue
+		}
+		total++
+		perDifficulty[q.Difficulty]++
+	}
+}
+
+// newQuestionGenerator picks the generator set by QUESTION_GENERATOR:
+// "http" (the default) calls FastAPI at FASTAPI_URL, "local" writes
+// template questions from the text of the material's PDF without FastAPI.
+func newQuestionGenerator(timeout time.Duration) services.QuestionGenerator {
+	switch kind := os.Getenv("QUESTION_GENERATOR"); kind {
+	case "local":
+		client := &http.Client{Timeout: timeout}
+		return &services.LocalQuestionGenerator{
+			Chunks: func(ctx context.Context, materialID int64) ([]string, error) {
+				return materialText(ctx, client, materialID)
+			},
+		}
+	case "", "http":
+	default:
+		log.Printf("unknown QUESTION_GENERATOR %q, using http", kind)
+	}
+	return &services.HTTPQuestionGenerator{
+		BaseURL: os.Getenv("FASTAPI_URL"),
+		Client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// materialText is the chunk source of the local generator: the text of
+// each page of the material's PDF, then its title and description. The
+// file is read from its URL, or from disk for a file:// URL or a plain
+// path, so integration tests need no file storage.
+func materialText(ctx context.Context, client *http.Client, materialID int64) ([]string, error) {
+	m, err := repositories.GetMaterialByID(ctx, materialID)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := readMaterialFile(ctx, client, m.FileURL)
+	if err != nil {
+		return nil, fmt.Errorf("material %d: %w", materialID, err)
+	}
+	pages, err := services.PDFPages(data)
+	if err != nil {
+		return nil, fmt.Errorf("material %d: %w", materialID, err)
+	}
+	return append(pages, m.Title, m.Description), nil
+}
+
+// readMaterialFile downloads a material's PDF. Like ingestion, it only
+// reads files of the materials bucket, never local paths.
+func readMaterialFile(ctx context.Context, client *http.Client, fileURL string) ([]byte, error) {
+	if !services.IsMaterialFileURL(fileURL) {
+		return nil, fmt.Errorf("file_url is not in material storage: %q", fileURL)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("download failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("download failed: %s", resp.Status)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// validateGenerated repairs or rejects every generated question and
+// converts the accepted ones for saving. The job's type wins over whatever
+// the generator echoes back. A question is linked to the material of its
+// first source that is one of the job's materials.
+func validateGenerated(qType string, rules services.GenerationRules, materials []int64, generated []services.GeneratedQuestion) []repositories.GeneratedInput {
+	items := make([]repositories.GeneratedInput, 0, len(generated))
+	for _, g := range generated {
+		g, repairs, err := services.RepairGeneratedQuestion(qType, rules, g)
+		if err != nil {
+			items = append(items, repositories.GeneratedInput{
+				Content:      g.Content,
+				RejectReason: err.Error(),
+			})
+			continue
+		}
+
+		q := repositories.QuestionInput{
+			Type:          qType,
+			Content:       g.Content,
+			Difficulty:    g.Difficulty,
+			TaxonomyLevel: g.TaxonomyLevel,
+		}
+		for _, a := range g.Answers {
+			q.Answers = append(q.Answers, repositories.AnswerInput{
+				Label:     a.Label,
+				Text:      a.Text,
+				IsCorrect: a.IsCorrect,
+				Tolerance: a.Tolerance,
+				MatchText: a.MatchText,
+			})
+		}
+		for _, c := range g.Rubric {
+			in := repositories.RubricCriterionInput{Title: c.Title, Description: c.Description}
+			for _, l := range c.Levels {
+				in.Levels = append(in.Levels, repositories.RubricLevelInput{
+					Score:       l.Score,
+					Label:       l.Label,
+					Description: l.Description,
+				})
+			}
+			q.Rubric = append(q.Rubric, in)
+		}
+		var materialID int64
+		for _, s := range g.Sources {
+			q.Sources = append(q.Sources, repositories.SourceInput{
+				ChunkID: s.ChunkID,
+				Page:    s.Page,
+				Text:    s.Text,
+			})
+			if materialID == 0 && slices.Contains(materials, s.MaterialID) {
+				materialID = s.MaterialID
+			}
+		}
+		items = append(items, repositories.GeneratedInput{
+			Question:   &q,
+			MaterialID: materialID,
+			Content:    q.Content,
+			Repairs:    repairs,
+		})
+	}
+	return items
+}
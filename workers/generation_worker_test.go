@@ -0,0 +1,78 @@
+package workers
+
+import (
+	"slices"
+	"testing"
+
+	"backendLMS/repositories"
+)
+
+func generatedItems(difficulties ...string) []repositories.GeneratedInput {
+	items := make([]repositories.GeneratedInput, len(difficulties))
+	for i, d := range difficulties {
+		if d == "" {
+			items[i] = repositories.GeneratedInput{RejectReason: "invalid"}
+			continue
+		}
+		items[i] = repositories.GeneratedInput{Question: &repositories.QuestionInput{Difficulty: d}}
+	}
+	return items
+}
+
+func TestLimitGenerated(t *testing.T) {
+	tests := []struct {
+		name             string
+		items            []repositories.GeneratedInput
+		count            int
+		difficultyCounts map[string]int
+		want             []string // reject reason per item, "" when kept
+	}{
+		{
+			name:  "no count keeps everything",
+			items: generatedItems("easy", "hard", "hard"),
+			want:  []string{"", "", ""},
+		},
+		{
+			name:  "items beyond the count are rejected",
+			items: generatedItems("easy", "hard", "medium"),
+			count: 2,
+			want:  []string{"", "", "exceeds the requested count of 2"},
+		},
+		{
+			name:  "already rejected items do not count",
+			items: generatedItems("", "easy", "hard"),
+			count: 2,
+			want:  []string{"invalid", "", ""},
+		},
+		{
+			name:             "items beyond a difficulty's count are rejected",
+			items:            generatedItems("easy", "easy", "hard"),
+			count:            2,
+			difficultyCounts: map[string]int{"easy": 1, "hard": 1},
+			want:             []string{"", "exceeds the requested 1 easy question(s)", ""},
+		},
+		{
+			name:             "a difficulty that was not requested is rejected",
+			items:            generatedItems("medium", "easy"),
+			count:            1,
+			difficultyCounts: map[string]int{"easy": 1},
+			want:             []string{"difficulty medium was not requested", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limitGenerated(tt.items, tt.count, tt.difficultyCounts)
+
+			var got []string
+			for _, it := range tt.items {
+				if (it.Question == nil) == (it.RejectReason == "") {
+					t.Fatalf("item %+v is neither kept nor rejected", it)
+				}
+				got = append(got, it.RejectReason)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("reasons = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,270 @@
+package workers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"backendLMS/models"
+	"backendLMS/repositories"
+	"backendLMS/services"
+)
+
+const (
+	// maxIngestAttempts is how often a material is tried before it is
+	// left failed until ingestion is triggered again.
+	maxIngestAttempts = 5
+	ingestBackoffBase = 30 * time.Second
+	ingestBackoffMax  = 30 * time.Minute
+	ingestTimeout     = 2 * time.Minute
+	// ingestLease is how long a material or purge may be processing before
+	// it counts as abandoned by a server that died: a download and an
+	// upload, each bounded by ingestTimeout, and some slack.
+	ingestLease = 2*ingestTimeout + time.Minute
+)
+
+var ingestionWake = make(chan struct{}, 1)
+
+// NotifyMaterialIngestion wakes the ingestion worker after a material has
+// been queued.
+func NotifyMaterialIngestion() {
+	notify(ingestionWake)
+}
+
+// StartIngestionWorker starts the worker that handles pending materials
+// and vector purges until ctx is done, and a sweep that requeues the ones
+// of servers that died. A single worker keeps a purge from racing the
+// ingestion of the same material; purges go first so a deleted material
+// stops being retrieved as soon as possible.
+func StartIngestionWorker(ctx context.Context) {
+	sweep(ctx, func() {
+		if err := repositories.RequeueAbandonedIngestions(ctx, ingestLease); err != nil && ctx.Err() == nil {
+			log.Println("requeue material ingestion:", err)
+		}
+	})
+
+	client := &http.Client{Timeout: ingestTimeout}
+	spawn(func() {
+		runQueue(ctx, ingestionWake, func() bool {
+			p, err := repositories.ClaimVectorPurge(ctx)
+			if err != nil {
+				log.Println("claim vector purge:", err)
+			}
+			if p != nil {
+				purgeMaterial(ctx, client, p)
+				return true
+			}
+
+			m, err := repositories.ClaimMaterialIngestion(ctx)
+			if err != nil {
+				log.Println("claim material ingestion:", err)
+				return false
+			}
+			if m == nil {
+				return false
+			}
+			ingestMaterial(ctx, client, m)
+			return true
+		})
+	})
+}
+
+// ingestBackoff is the wait before the next attempt after the given
+// number of failed ones: 30s, 1m, 2m, ... capped at 30m.
+func ingestBackoff(attempts int) time.Duration {
+	d := ingestBackoffBase
+	for i := 1; i < attempts && d < ingestBackoffMax; i++ {
+		d *= 2
+	}
+	if d > ingestBackoffMax {
+		d = ingestBackoffMax
+	}
+	return d
+}
+
+func ingestMaterial(ctx context.Context, client *http.Client, m *models.Material) {
+	services.Progress.Publish(m.TeacherID, models.ProgressEvent{
+		Type:       "ingest_started",
+		MaterialID: m.ID,
+	})
+
+	chunks, err := ingestPDF(ctx, client, m)
+	if err == nil {
+		err = repositories.CompleteMaterialIngestion(ctx, m.ID, chunks)
+		if err == nil {
+			services.Progress.Publish(m.TeacherID, models.ProgressEvent{
+				Type:       "ingest_done",
+				MaterialID: m.ID,
+				Count:      chunks,
+				Message:    fmt.Sprintf("%d chunks indexed", chunks),
+			})
+			return
+		}
+	}
+
+	// the server is stopping: the material is ingested on the next start
+	if ctx.Err() != nil {
+		if rerr := repositories.ReleaseMaterialIngestion(context.WithoutCancel(ctx), m.ID); rerr != nil {
+			log.Printf("ingest material %d: %v", m.ID, rerr)
+		}
+		return
+	}
+
+	log.Printf("ingest material %d (attempt %d): %v", m.ID, m.Ingestion.Attempts, err)
+
+	var nextAt *int64
+	ev := models.ProgressEvent{
+		Type:       "ingest_failed",
+		MaterialID: m.ID,
+		Message:    err.Error(),
+	}
+	if m.Ingestion.Attempts < maxIngestAttempts {
+		t := time.Now().Add(ingestBackoff(m.Ingestion.Attempts)).Unix()
+		nextAt = &t
+		ev.Type = "ingest_retrying"
+	}
+
+	if ferr := repositories.FailMaterialIngestion(ctx, m.ID, err.Error(), nextAt); ferr != nil {
+		log.Printf("ingest material %d: %v", m.ID, ferr)
+	}
+	services.Progress.Publish(m.TeacherID, ev)
+}
+
+// ingestPDF downloads the material's PDF, posts it to FastAPI
+// /ingest_material, or /reingest_material to replace the vectors of a
+// re-index, and returns the number of chunks it indexed. Only files of
+// the materials bucket are downloaded.
+func ingestPDF(ctx context.Context, client *http.Client, m *models.Material) (int, error) {
+	if !services.IsMaterialFileURL(m.FileURL) {
+		return 0, fmt.Errorf("file_url is not in material storage: %q", m.FileURL)
+	}
+
+	dl, err := http.NewRequestWithContext(ctx, http.MethodGet, m.FileURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	file, err := client.Do(dl)
+	if err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+	defer file.Body.Close()
+	if file.StatusCode >= 300 {
+		return 0, fmt.Errorf("download failed: %s", file.Status)
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+
+	// file
+	part, err := writer.CreateFormFile("file", path.Base(dl.URL.Path))
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.Copy(part, file.Body); err != nil {
+		return 0, fmt.Errorf("download failed: %w", err)
+	}
+
+	// metadata
+	writer.WriteField("material_id", fmt.Sprintf("%d", m.ID))
+	writer.WriteField("course_id", fmt.Sprintf("%d", m.CourseID))
+	writer.WriteField("chapter_id", fmt.Sprintf("%d", m.ChapterID))
+
+	writer.Close()
+
+	endpoint := "/ingest_material"
+	if m.Ingestion.Action == "reindex" {
+		endpoint = "/reingest_material"
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, os.Getenv("FASTAPI_URL")+endpoint, body)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return 0, fmt.Errorf("fastapi ingest failed: %s", string(b))
+	}
+
+	var result struct {
+		Chunks int `json:"chunks"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid response from fastapi ingest: %w", err)
+	}
+
+	return result.Chunks, nil
+}
+
+func purgeMaterial(ctx context.Context, client *http.Client, p *models.VectorPurge) {
+	deleted, err := deleteVectors(ctx, client, p.MaterialID)
+	if err == nil {
+		err = repositories.CompleteVectorPurge(ctx, p.ID, deleted)
+		if err == nil {
+			return
+		}
+	}
+
+	if ctx.Err() != nil {
+		if rerr := repositories.ReleaseVectorPurge(context.WithoutCancel(ctx), p.ID); rerr != nil {
+			log.Printf("purge vectors of material %d: %v", p.MaterialID, rerr)
+		}
+		return
+	}
+
+	log.Printf("purge vectors of material %d (attempt %d): %v", p.MaterialID, p.Attempts, err)
+
+	var nextAt *int64
+	if p.Attempts < maxIngestAttempts {
+		t := time.Now().Add(ingestBackoff(p.Attempts)).Unix()
+		nextAt = &t
+	}
+	if ferr := repositories.FailVectorPurge(ctx, p.ID, err.Error(), nextAt); ferr != nil {
+		log.Printf("purge vectors of material %d: %v", p.MaterialID, ferr)
+	}
+}
+
+// deleteVectors asks FastAPI to delete the vectors of a material and
+// returns how many it removed.
+func deleteVectors(ctx context.Context, client *http.Client, materialID int64) (int, error) {
+	url := fmt.Sprintf("%s/materials/%d/vectors", os.Getenv("FASTAPI_URL"), materialID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, url, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		b, _ := io.ReadAll(io.LimitReader(resp.Body, 2048))
+		return 0, fmt.Errorf("fastapi delete vectors failed: %s", string(b))
+	}
+
+	var result struct {
+		Deleted int `json:"deleted"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("invalid response from fastapi delete vectors: %w", err)
+	}
+
+	return result.Deleted, nil
+}
@@ -0,0 +1,74 @@
+package workers
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// pollInterval is how often an idle worker looks for work it was not woken
+// for, e.g. jobs queued before a restart or retries coming due.
+const pollInterval = 5 * time.Second
+
+// sweepInterval is how often work claimed by a server that died is looked
+// for.
+const sweepInterval = time.Minute
+
+var running sync.WaitGroup
+
+// Wait blocks until every worker has stopped after its ctx is done.
+func Wait() {
+	running.Wait()
+}
+
+// spawn runs fn as a worker Wait waits for.
+func spawn(fn func()) {
+	running.Add(1)
+	go func() {
+		defer running.Done()
+		fn()
+	}()
+}
+
+// sweep calls fn now and every sweepInterval until ctx is done.
+func sweep(ctx context.Context, fn func()) {
+	spawn(func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+		for {
+			fn()
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	})
+}
+
+// runQueue calls work until it reports that nothing was left to do, then
+// sleeps until woken, the poll interval passes or ctx is done.
+func runQueue(ctx context.Context, wake <-chan struct{}, work func() bool) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil && work() {
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// notify wakes one idle worker of a queue without blocking.
+func notify(wake chan struct{}) {
+	select {
+	case wake <- struct{}{}:
+	default:
+	}
+}